@@ -32,22 +32,27 @@ type OAuth struct {
 }
 
 type AccountMetadata struct {
-	Password              []byte             `json:"pw,omitempty"`
-	Key                   *SSHKey            `json:"key,omitempty"`
-	Blurb                 []byte             `json:"blurb,omitempty"`
-	Icon                  ImageMetadata      `json:"icon,omitempty"`
-	Name                  string             `json:"name,omitempty"`
-	ID                    string             `json:"id,omitempty"`
-	URL                   string             `json:"url,omitempty"`
-	InboxIRI              string             `json:"inbox,omitempty"`
-	OutboxIRI             string             `json:"outbox,omitempty"`
-	LikedIRI              string             `json:"liked,omitempty"`
-	FollowersIRI          string             `json:"followers,omitempty"`
-	FollowingIRI          string             `json:"following,omitempty"`
-	OAuth                 OAuth              `json:-`
-	AuthorizationEndPoint string             `json:-`
-	TokenEndPoint         string             `json:-`
-	OutboxUpdated         time.Time          `json:-`
+	Password              []byte              `json:"pw,omitempty"`
+	Key                   *SSHKey             `json:"key,omitempty"`
+	Blurb                 []byte              `json:"blurb,omitempty"`
+	Icon                  ImageMetadata       `json:"icon,omitempty"`
+	Name                  string              `json:"name,omitempty"`
+	Email                 string              `json:"-"`
+	ID                    string              `json:"id,omitempty"`
+	URL                   string              `json:"url,omitempty"`
+	InboxIRI              string              `json:"inbox,omitempty"`
+	OutboxIRI             string              `json:"outbox,omitempty"`
+	LikedIRI              string              `json:"liked,omitempty"`
+	FollowersIRI          string              `json:"followers,omitempty"`
+	FollowingIRI          string              `json:"following,omitempty"`
+	SharedInboxIRI        string              `json:"sharedInbox,omitempty"`
+	OAuth                 OAuth               `json:-`
+	AuthorizationEndPoint string              `json:-`
+	TokenEndPoint         string              `json:-`
+	OutboxUpdated         time.Time           `json:-`
+	TOTP                  *TOTP               `json:"-"`
+	FeaturedTags          []string            `json:"featuredTags,omitempty"`
+	Preferences           *AccountPreferences `json:"-"`
 	Outbox                pub.ItemCollection
 }
 
@@ -68,6 +73,8 @@ type Account struct {
 	Blocked   AccountCollection    `json:"-"`
 	Ignored   AccountCollection    `json:"-"`
 	Level     uint8                `json:"-"`
+	Trust     TrustLevel           `json:"-"`
+	Karma     int                  `json:"-"`
 	Parent    *Account             `json:"-"`
 	Children  AccountPtrCollection `json:"-"`
 }
@@ -159,6 +166,19 @@ func (a *Account) IsLogged() bool {
 	return a != nil && (!a.CreatedAt.IsZero() || (a.Hash != AnonymousHash && a.Handle != Anonymous))
 }
 
+// IsModerator returns true if the account is a local one listed in the instance's moderators
+func (a *Account) IsModerator() bool {
+	if !a.IsLogged() || Instance.Conf == nil {
+		return false
+	}
+	for _, handle := range Instance.Conf.Moderators {
+		if strings.EqualFold(handle, a.Handle) {
+			return a.IsLocal()
+		}
+	}
+	return false
+}
+
 // HasIcon
 func (a *Account) HasIcon() bool {
 	return a.HasMetadata() && len(a.Metadata.Icon.URI) > 0
@@ -199,7 +219,8 @@ func (h *handler)accountFromPost(r *http.Request) (Account, error) {
 		return AnonymousAccount, errors.Errorf("invalid http method type")
 	}
 
-	a := &AnonymousAccount
+	a := new(Account)
+	*a = AnonymousAccount
 	hash := r.PostFormValue("hash")
 	if len(hash) > 0 {
 		// NOTE(marius): coming from an invite
@@ -209,10 +230,11 @@ func (h *handler)accountFromPost(r *http.Request) (Account, error) {
 	if accountsEqual(*a, AnonymousAccount) {
 		*a = Account{Metadata: &AccountMetadata{}}
 	}
+	errs := make([]error, 0)
 	pw := r.PostFormValue("pw")
 	pwConfirm := r.PostFormValue("pw-confirm")
 	if pw != pwConfirm {
-		return AnonymousAccount, errors.Errorf("the passwords don't match")
+		errs = append(errs, invalidField("pw-confirm", "the passwords don't match"))
 	}
 
 	/*
@@ -227,6 +249,12 @@ func (h *handler)accountFromPost(r *http.Request) (Account, error) {
 	}
 	a.Metadata = &AccountMetadata{
 		Password: []byte(pw),
+		Name:     strings.TrimSpace(r.PostFormValue("name")),
+		Email:    strings.TrimSpace(r.PostFormValue("email")),
+	}
+	errs = append(errs, validateAccount(*a, PasswordPolicyFromConfig(h.conf.Configuration))...)
+	if verr := NewValidationError(errs...); verr != nil {
+		return *a, verr
 	}
 	return *a, nil
 }
@@ -304,3 +332,15 @@ func reparentAccounts(allAccounts *AccountPtrCollection) {
 	}
 	*allAccounts = retAccounts
 }
+
+// renderBlurb returns the HTML of the markdown bio of an account, sanitized like the rest of the local content,
+// with its mentions and tags linked. It returns also the Mention and hashtag objects for the actor's tags.
+func renderBlurb(blurb []byte) (pub.Content, pub.ItemCollection) {
+	tags, mentions := loadTags(string(blurb))
+	it := Item{
+		MimeType: MimeTypeHTML,
+		Data:     LocalHTMLPolicy.Sanitize(string(Markdown(string(blurb)))),
+		Metadata: &ItemMetadata{Tags: tags, Mentions: mentions},
+	}
+	return pub.Content(replaceTags(MimeTypeHTML, it)), loadAPTags(mentions, tags)
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-ap/errors"
+)
+
+// imageExtensions are the media types of the images we recognize from the extension of their URL
+var imageExtensions = map[string]string{
+	".apng": "image/apng",
+	".avif": "image/avif",
+	".gif":  "image/gif",
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".svg":  MimeTypeSVG,
+	".webp": "image/webp",
+}
+
+// imageURLMimeType returns the media type of the image the URL points to, or an empty string if it's not an image
+func imageURLMimeType(u string) string {
+	pu, err := url.Parse(u)
+	if err != nil || len(pu.Host) == 0 {
+		return ""
+	}
+	return imageExtensions[strings.ToLower(path.Ext(pu.Path))]
+}
+
+// isImageItem returns true if the item is an image, or a link to one
+func isImageItem(it Item) bool {
+	if it.MimeType == MimeTypeURL {
+		return len(imageURLMimeType(it.Data)) > 0
+	}
+	return isImage(it.MimeType)
+}
+
+// checkAltText refuses the images submitted without a description of their content, when the instance requires one
+func (r *repository) checkAltText(it Item) error {
+	if !r.requireAltText || !isImageItem(it) {
+		return nil
+	}
+	if len(strings.TrimSpace(it.Alt())) == 0 {
+		return errors.BadRequestf("images need a description of their content")
+	}
+	return nil
+}
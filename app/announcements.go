@@ -0,0 +1,175 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi"
+)
+
+// Announcement is a message of the instance's operators, shown above the items in the feeds
+// between its Start and End times. The zero times leave it open at that end.
+type Announcement struct {
+	Hash        Hash
+	Content     string
+	MimeType    string
+	Start       time.Time
+	End         time.Time
+	Dismissible bool
+}
+
+// Active returns true if the announcement is shown at the time t
+func (a Announcement) Active(t time.Time) bool {
+	if !a.Start.IsZero() && t.Before(a.Start) {
+		return false
+	}
+	return a.End.IsZero() || t.Before(a.End)
+}
+
+// announcementIndex is an announcement in the ANNOUNCEMENTS_PATH file
+type announcementIndex struct {
+	Hash        string    `json:"hash"`
+	Content     string    `json:"content"`
+	MimeType    string    `json:"mediaType,omitempty"`
+	Start       time.Time `json:"start,omitempty"`
+	End         time.Time `json:"end,omitempty"`
+	Dismissible bool      `json:"dismissible"`
+}
+
+// announcementStore keeps the announcements of the instance.
+// The ones every account dismissed are saved in its preferences, they are not federated.
+type announcementStore struct {
+	m    sync.RWMutex
+	list []Announcement
+}
+
+func newAnnouncementStore(list ...Announcement) *announcementStore {
+	s := new(announcementStore)
+	for _, a := range list {
+		if a.Hash.IsValid() && len(a.Content) > 0 {
+			s.list = append(s.list, a)
+		}
+	}
+	return s
+}
+
+// loadAnnouncementsFile loads the announcements from the ANNOUNCEMENTS_PATH JSON file, a list of announcements
+func loadAnnouncementsFile(path string) (*announcementStore, error) {
+	dat, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to load the announcements")
+	}
+	index := make([]announcementIndex, 0)
+	if err = json.Unmarshal(dat, &index); err != nil {
+		return nil, errors.Annotatef(err, "invalid announcements file %s", path)
+	}
+	list := make([]Announcement, 0, len(index))
+	for _, a := range index {
+		list = append(list, Announcement{
+			Hash:        HashFromString(a.Hash),
+			Content:     a.Content,
+			MimeType:    a.MimeType,
+			Start:       a.Start,
+			End:         a.End,
+			Dismissible: a.Dismissible,
+		})
+	}
+	return newAnnouncementStore(list...), nil
+}
+
+// Active returns the announcements shown at the time t, without the dismissed ones, the ones starting last first
+func (s *announcementStore) Active(dismissed Hashes, t time.Time) []Announcement {
+	result := make([]Announcement, 0)
+	if s == nil {
+		return result
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	for _, a := range s.list {
+		if !a.Active(t) || (a.Dismissible && dismissed.Contains(a.Hash)) {
+			continue
+		}
+		result = append(result, a)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Start.After(result[j].Start)
+	})
+	return result
+}
+
+// Dismissible returns true if there's a dismissible announcement with the hash
+func (s *announcementStore) Dismissible(id Hash) bool {
+	if s == nil {
+		return false
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	for _, a := range s.list {
+		if a.Hash == id {
+			return a.Dismissible
+		}
+	}
+	return false
+}
+
+// Current returns the announcements in dismissed which the instance still has
+func (s *announcementStore) Current(dismissed Hashes) Hashes {
+	result := make(Hashes, 0, len(dismissed))
+	if s == nil {
+		return result
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	for _, a := range s.list {
+		if dismissed.Contains(a.Hash) {
+			result = append(result, a.Hash)
+		}
+	}
+	return result
+}
+
+// LoadAnnouncements returns the current announcements of the instance, without the ones the viewer dismissed
+func (r *repository) LoadAnnouncements(ctx context.Context, viewer *Account) []Announcement {
+	var dismissed Hashes
+	if viewer.IsLogged() {
+		dismissed = accountPreferences(viewer).DismissedAnnouncements
+	}
+	return r.announcements.Active(dismissed, time.Now().UTC())
+}
+
+// DismissAnnouncement hides the announcement from the viewer
+func (r *repository) DismissAnnouncement(ctx context.Context, viewer *Account, id Hash) error {
+	if !r.announcements.Dismissible(id) {
+		return errors.NotFoundf("announcement %s not found", id)
+	}
+	return r.SavePreferences(ctx, viewer, func(p *AccountPreferences) {
+		// NOTE(marius): we don't keep the dismissals of the announcements that were removed from the instance
+		dismissed := r.announcements.Current(p.DismissedAnnouncements)
+		if !dismissed.Contains(id) {
+			dismissed = append(dismissed, id)
+		}
+		p.DismissedAnnouncements = dismissed
+	})
+}
+
+// HandleDismissAnnouncement serves the POST /announcements/{hash}/dismiss requests of the logged accounts,
+// and returns to the feed it was dismissed from
+func (h *handler) HandleDismissAnnouncement(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	if err := h.storage.DismissAnnouncement(context.TODO(), acc, HashFromString(chi.URLParam(r, "hash"))); err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	url := "/"
+	if backUrl := r.Header.Get("Referer"); len(backUrl) > 0 && strings.Contains(backUrl, Instance.BaseURL) {
+		url = backUrl
+	}
+	h.v.Redirect(w, r, url, http.StatusFound)
+}
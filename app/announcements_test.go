@@ -0,0 +1,65 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_repository_LoadAnnouncements(t *testing.T) {
+	const (
+		expiredHash = "7c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01"
+		activeHash  = "7c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c02"
+		pinnedHash  = "7c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c03"
+	)
+	now := time.Now().UTC()
+	f := newAccountFedbox()
+	defer f.Close()
+	r := testRepository(f.Server)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(f.URL), Type: pub.ServiceType}
+	r.announcements = newAnnouncementStore(
+		Announcement{Hash: HashFromString(expiredHash), Content: "expired", Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour), Dismissible: true},
+		Announcement{Hash: HashFromString(activeHash), Content: "active", Start: now.Add(-time.Hour), Dismissible: true},
+		Announcement{Hash: HashFromString(pinnedHash), Content: "pinned", Start: now.Add(-2 * time.Hour), End: now.Add(time.Hour)},
+	)
+	viewer := testVote(f.Server, 1).SubmittedBy
+	other := Account{Hash: HashFromString(testLikeHash), Handle: "janedoe", Metadata: &AccountMetadata{ID: "https://fedbox.example/actors/" + testLikeHash}}
+	hashes := func(aa []Announcement) Hashes {
+		h := make(Hashes, 0)
+		for _, a := range aa {
+			h = append(h, a.Hash)
+		}
+		return h
+	}
+	ctx := context.Background()
+
+	got := hashes(r.LoadAnnouncements(ctx, viewer))
+	if got.Contains(HashFromString(expiredHash)) {
+		t.Errorf("The expired announcement should not be returned: %v", got)
+	}
+	if len(got) != 2 || got[0] != HashFromString(activeHash) || got[1] != HashFromString(pinnedHash) {
+		t.Errorf("Expected the active announcements, newest first, received %v", got)
+	}
+
+	if err := r.DismissAnnouncement(ctx, viewer, HashFromString(activeHash)); err != nil {
+		t.Fatalf("Unable to dismiss the announcement: %s", err)
+	}
+	if err := r.DismissAnnouncement(ctx, viewer, HashFromString(pinnedHash)); err == nil {
+		t.Errorf("The announcements which are not dismissible should not be dismissed")
+	}
+	if got = hashes(r.LoadAnnouncements(ctx, viewer)); got.Contains(HashFromString(activeHash)) || !got.Contains(HashFromString(pinnedHash)) {
+		t.Errorf("The dismissed announcement should be hidden for the viewer, received %v", got)
+	}
+	// NOTE(marius): the dismissals are saved with the account, the next requests load them from the actor
+	if got = hashes(r.LoadAnnouncements(ctx, f.storedAccount(t, r))); got.Contains(HashFromString(activeHash)) {
+		t.Errorf("The dismissed announcement should be hidden for the account loaded again, received %v", got)
+	}
+	if got = hashes(r.LoadAnnouncements(ctx, &other)); !got.Contains(HashFromString(activeHash)) {
+		t.Errorf("The dismissed announcement should still be shown to the other accounts, received %v", got)
+	}
+	if got = hashes(r.LoadAnnouncements(ctx, &AnonymousAccount)); len(got) != 2 {
+		t.Errorf("Expected 2 announcements for the anonymous viewers, received %v", got)
+	}
+}
@@ -86,10 +86,14 @@ func New(c *config.Configuration, host string, port int, ver string, m *chi.Mux)
 func (a *Application) setUp(c *config.Configuration, host string, port int) error {
 	a.Conf = c
 	a.Logger = log.Dev(c.LogLevel)
+	baseHost := c.HostName
+	if len(c.CanonicalHost) > 0 {
+		baseHost = c.CanonicalHost
+	}
 	if c.Secure {
-		a.BaseURL = fmt.Sprintf("https://%s", c.HostName)
+		a.BaseURL = fmt.Sprintf("https://%s", baseHost)
 	} else {
-		a.BaseURL = fmt.Sprintf("http://%s", c.HostName)
+		a.BaseURL = fmt.Sprintf("http://%s", baseHost)
 	}
 	if c.AdminContact == "" {
 		c.AdminContact = author
@@ -130,6 +134,7 @@ func (a *Application) Front() error {
 	ni := nodeinfo.NewService(cfg, NodeInfoResolverNew(front.storage.fedbox))
 	// Web-Finger
 	r.Route("/.well-known", func(r chi.Router) {
+		r.Use(front.CanonicalHostMw, front.CORS)
 		r.Get("/webfinger", front.HandleWebFinger)
 		r.Get("/host-meta", front.HandleHostMeta)
 		r.Get("/nodeinfo", ni.NodeInfoDiscover)
@@ -137,7 +142,8 @@ func (a *Application) Front() error {
 			errors.HandleError(errors.NotFoundf("%s", r.RequestURI)).ServeHTTP(w, r)
 		})
 	})
-	r.Get("/nodeinfo", ni.NodeInfo)
+	r.With(front.CORS).Get("/nodeinfo", ni.NodeInfo)
+	r.With(front.CORS).Options("/nodeinfo", ni.NodeInfo)
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
 		front.v.HandleErrors(w, r, errors.NotFoundf("%s", r.RequestURI))
 	})
@@ -0,0 +1,170 @@
+package app
+
+import (
+	"fmt"
+	ht "html"
+	"html/template"
+	"mime"
+	"strings"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+// attachmentFromLink returns the media in a Link, which can be the attachment itself, or its url
+func attachmentFromLink(m *AttachmentMetadata, l *pub.Link) {
+	m.URI = l.Href.String()
+	if len(l.MediaType) > 0 {
+		m.MimeType = string(l.MediaType)
+	}
+	if len(m.Alt) == 0 {
+		m.Alt = l.Name.First().Value.String()
+	}
+	if l.Width > 0 && l.Height > 0 {
+		m.Width, m.Height = l.Width, l.Height
+	}
+}
+
+// attachmentFromItem returns the media in one of the elements of an attachment collection, they can be Links,
+// or Documents, Images, Videos and Audios with their url pointing to the media, and their name as its description
+func attachmentFromItem(it pub.Item) (AttachmentMetadata, bool) {
+	m := AttachmentMetadata{}
+	if it == nil {
+		return m, false
+	}
+	if it.IsLink() {
+		if l, ok := it.(*pub.Link); ok {
+			attachmentFromLink(&m, l)
+		} else {
+			m.URI = it.GetLink().String()
+		}
+	} else {
+		pub.OnObject(it, func(o *pub.Object) error {
+			m.MimeType = string(o.MediaType)
+			if alt := o.Name.First().Value; len(alt) > 0 {
+				m.Alt = alt.String()
+			} else {
+				m.Alt = o.Summary.First().Value.String()
+			}
+			if o.URL == nil {
+				return nil
+			}
+			if o.URL.IsCollection() {
+				u, _ := urlsFromItem(o.URL)
+				m.URI = u.URI
+				return nil
+			}
+			if l, ok := o.URL.(*pub.Link); ok {
+				attachmentFromLink(&m, l)
+				return nil
+			}
+			m.URI = o.URL.GetLink().String()
+			return nil
+		})
+	}
+	// NOTE(marius): the attachments come from any federated object, we only show the ones served over http(s),
+	// so data: and javascript: URIs never make it to the templates
+	if !isMediaURL(m.URI) {
+		return m, false
+	}
+	m.MimeType = attachmentMimeType(m.MimeType)
+	m.URI = ProxiedURL(m.URI)
+	return m, true
+}
+
+// attachmentMimeType returns the media type without its parameters, or an empty string if it's invalid
+func attachmentMimeType(typ string) string {
+	mt, _, err := mime.ParseMediaType(typ)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+// attachmentsFromItem returns the media attached to an object
+func attachmentsFromItem(it pub.Item) []AttachmentMetadata {
+	var attachments []AttachmentMetadata
+	items := pub.ItemCollection{it}
+	if it.IsCollection() {
+		pub.OnCollectionIntf(it, func(col pub.CollectionInterface) error {
+			items = col.Collection()
+			return nil
+		})
+	}
+	for _, att := range items {
+		if m, ok := attachmentFromItem(att); ok {
+			attachments = append(attachments, m)
+		}
+	}
+	return attachments
+}
+
+// attachmentType returns the object type for publishing the media with the mime type
+func attachmentType(mime string) pub.ActivityVocabularyType {
+	switch {
+	case strings.HasPrefix(mime, "image/"):
+		return pub.ImageType
+	case strings.HasPrefix(mime, "video/"):
+		return pub.VideoType
+	case strings.HasPrefix(mime, "audio/"):
+		return pub.AudioType
+	}
+	return pub.DocumentType
+}
+
+// loadAPAttachments returns the attachment collection of an item's object. Every media is an object with its
+// description as name, and a Link with its type and its dimensions as url.
+func loadAPAttachments(attachments []AttachmentMetadata, lang pub.LangRef) pub.ItemCollection {
+	col := make(pub.ItemCollection, 0)
+	for _, m := range attachments {
+		if len(m.URI) == 0 {
+			continue
+		}
+		u := unproxiedURL(m.URI)
+		o := &pub.Object{
+			Type:      attachmentType(m.MimeType),
+			MediaType: pub.MimeType(m.MimeType),
+			URL: &pub.Link{
+				Type:      pub.LinkType,
+				Href:      pub.IRI(u),
+				MediaType: pub.MimeType(m.MimeType),
+				Width:     m.Width,
+				Height:    m.Height,
+			},
+		}
+		if len(m.Alt) > 0 {
+			o.Name = make(pub.NaturalLanguageValues, 0)
+			o.Name.Set(lang, pub.Content(m.Alt))
+		}
+		col = append(col, o)
+	}
+	return col
+}
+
+const (
+	attachmentImageFmt = `<img src="%s" alt="%s"/>`
+	attachmentVideoFmt = `<video controls width="90%%"><source src="%s" type="%s"/></video>`
+	attachmentAudioFmt = `<audio controls><source src="%s" type="%s"/></audio>`
+	attachmentLinkFmt  = `<a href="%s">%s</a>`
+)
+
+// attachment renders the media of an attachment, which is always an URL, unlike the items' own data, so the
+// attachments don't go through the inline base64 and SVG paths of the Image, Video and Audio helpers
+func attachment(m AttachmentMetadata) template.HTML {
+	if !isMediaURL(m.URI) {
+		return ""
+	}
+	uri, typ := ht.EscapeString(m.URI), ht.EscapeString(attachmentMimeType(m.MimeType))
+	switch attachmentType(typ) {
+	case pub.ImageType:
+		return template.HTML(fmt.Sprintf(attachmentImageFmt, uri, ht.EscapeString(m.Alt)))
+	case pub.VideoType:
+		return template.HTML(fmt.Sprintf(attachmentVideoFmt, uri, typ))
+	case pub.AudioType:
+		return template.HTML(fmt.Sprintf(attachmentAudioFmt, uri, typ))
+	}
+	label := m.Alt
+	if len(label) == 0 {
+		label = m.URI
+	}
+	return template.HTML(fmt.Sprintf(attachmentLinkFmt, uri, ht.EscapeString(label)))
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"encoding/json"
+	"html/template"
+	"reflect"
+	"strings"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_loadAPItem_AttachmentsRoundTrip(t *testing.T) {
+	attachments := []AttachmentMetadata{
+		{URI: "https://cdn.example/cat.png", MimeType: "image/png", Alt: "A cat sleeping on a keyboard", Width: 640, Height: 480},
+		{URI: "https://cdn.example/dog.jpg", MimeType: "image/jpeg", Alt: "A dog chasing its tail", Width: 1024, Height: 768},
+	}
+	item := Item{
+		Hash:     HashFromString(testObjectHash),
+		MimeType: MimeTypeHTML,
+		Data:     "<p>pets</p>",
+		Metadata: &ItemMetadata{ID: "https://fedbox.example/objects/" + testObjectHash, Attachments: attachments},
+	}
+	o := new(pub.Object)
+	if err := loadAPItem(o, item); err != nil {
+		t.Fatalf("unable to convert item: %s", err)
+	}
+	raw, err := json.Marshal(o)
+	if err != nil {
+		t.Fatalf("unable to marshal object: %s", err)
+	}
+	it, err := pub.UnmarshalJSON(raw)
+	if err != nil {
+		t.Fatalf("unable to unmarshal object: %s", err)
+	}
+	loaded := Item{}
+	if err := loaded.FromActivityPub(it); err != nil {
+		t.Fatalf("unable to load item: %s", err)
+	}
+	if !reflect.DeepEqual(loaded.Metadata.Attachments, attachments) {
+		t.Errorf("Invalid attachments after the round trip %#v, expected %#v", loaded.Metadata.Attachments, attachments)
+	}
+}
+
+func Test_attachmentsFromItem(t *testing.T) {
+	raw := `{"id":"https://remote.example/notes/1","type":"Note","content":"pets","attachment":[
+		{"type":"Document","mediaType":"image/png","url":"https://remote.example/cat.png","name":"A cat"},
+		{"type":"Link","mediaType":"video/mp4","href":"https://remote.example/dog.mp4","width":320,"height":240}]}`
+	it, err := pub.UnmarshalJSON([]byte(raw))
+	if err != nil {
+		t.Fatalf("unable to unmarshal object: %s", err)
+	}
+	loaded := Item{}
+	if err := loaded.FromActivityPub(it); err != nil {
+		t.Fatalf("unable to load item: %s", err)
+	}
+	want := []AttachmentMetadata{
+		{URI: "https://remote.example/cat.png", MimeType: "image/png", Alt: "A cat"},
+		{URI: "https://remote.example/dog.mp4", MimeType: "video/mp4", Width: 320, Height: 240},
+	}
+	if !reflect.DeepEqual(loaded.Metadata.Attachments, want) {
+		t.Errorf("Invalid attachments %#v, expected %#v", loaded.Metadata.Attachments, want)
+	}
+}
+
+func Test_attachmentsFromItem_Unsafe(t *testing.T) {
+	raw := `{"id":"https://remote.example/notes/1","type":"Note","content":"pets","attachment":[
+		{"type":"Document","mediaType":"image/svg+xml","url":"<svg onload=alert(1)>"},
+		{"type":"Link","mediaType":"image/png","href":"javascript:alert(1)"},
+		{"type":"Document","mediaType":"video/mp4' onerror='alert(1)","url":"data:text/html;base64,PHNjcmlwdD4="},
+		{"type":"Document","mediaType":"video/mp4","url":"https://remote.example/dog.mp4?a=1&b='2'"}]}`
+	it, err := pub.UnmarshalJSON([]byte(raw))
+	if err != nil {
+		t.Fatalf("unable to unmarshal object: %s", err)
+	}
+	loaded := Item{}
+	if err := loaded.FromActivityPub(it); err != nil {
+		t.Fatalf("unable to load item: %s", err)
+	}
+	if len(loaded.Metadata.Attachments) != 1 {
+		t.Fatalf("Only the http(s) attachments should be loaded, received %#v", loaded.Metadata.Attachments)
+	}
+	want := `<video controls width="90%"><source src="https://remote.example/dog.mp4?a=1&amp;b=&#39;2&#39;" type="video/mp4"/></video>`
+	if got := string(attachment(loaded.Metadata.Attachments[0])); got != want {
+		t.Errorf("Invalid attachment HTML %s, expected %s", got, want)
+	}
+	if got := attachment(AttachmentMetadata{URI: "https://remote.example/x", MimeType: `video/mp4"><script>`}); strings.Contains(string(got), "<script>") {
+		t.Errorf("The mime type of the attachment should be escaped, received %s", got)
+	}
+}
+
+func Test_audioVideo_UnsafeMimeType(t *testing.T) {
+	unsafe := `video/mp4'/><script>alert(1)</script><source type='video/mp4`
+	for name, fn := range map[string]func(string, string) template.HTML{"audio": audio, "video": video} {
+		html := string(fn(unsafe, "https://remote.example/media/1"))
+		if strings.Contains(html, "<script>") {
+			t.Errorf("The %s media type should not be rendered unescaped: %s", name, html)
+		}
+		html = string(fn("Video/MP4; codecs=avc1", "https://remote.example/media/1"))
+		if !strings.Contains(html, "type='video/mp4'") {
+			t.Errorf("The %s media type should be normalised: %s", name, html)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+// cacheStore is the local storage for the objects decoded by the cached repository
+type cacheStore interface {
+	load(key string) (interface{}, bool)
+	save(key string, v interface{})
+	remove(keys ...string)
+	removePrefix(prefix string)
+	removeFn(fn func(key string, v interface{}) bool) int
+	each(fn func(key string, v interface{}))
+	expire() int
+}
+
+// DefaultCacheSize is the number of entries a memCache keeps, if it's not configured
+const DefaultCacheSize = 10000
+
+type cacheEntry struct {
+	v  interface{}
+	at time.Time
+}
+
+// memCache is a cacheStore that keeps at most max entries in memory, for ttl.
+// The expired entries are removed when they're loaded, or by expire.
+type memCache struct {
+	m   sync.RWMutex
+	ttl time.Duration
+	max int
+	c   map[string]cacheEntry
+}
+
+func newMemCache(ttl time.Duration, max int) *memCache {
+	if max <= 0 {
+		max = DefaultCacheSize
+	}
+	return &memCache{ttl: ttl, max: max, c: make(map[string]cacheEntry)}
+}
+
+func (m *memCache) load(key string) (interface{}, bool) {
+	m.m.RLock()
+	e, ok := m.c[key]
+	m.m.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	if time.Since(e.at) > m.ttl {
+		m.m.Lock()
+		// NOTE(marius): the entry could have been saved again since we released the read lock
+		if e, ok := m.c[key]; ok && time.Since(e.at) > m.ttl {
+			delete(m.c, key)
+		}
+		m.m.Unlock()
+		return nil, false
+	}
+	return e.v, true
+}
+
+func (m *memCache) save(key string, v interface{}) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if _, ok := m.c[key]; !ok && len(m.c) >= m.max {
+		// NOTE(marius): the map iteration order is random, so we evict a random entry to make room
+		for k := range m.c {
+			delete(m.c, k)
+			break
+		}
+	}
+	m.c[key] = cacheEntry{v: v, at: time.Now()}
+}
+
+func (m *memCache) remove(keys ...string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	for _, k := range keys {
+		delete(m.c, k)
+	}
+}
+
+func (m *memCache) removePrefix(prefix string) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	for k := range m.c {
+		if strings.HasPrefix(k, prefix) {
+			delete(m.c, k)
+		}
+	}
+}
+
+// removeFn removes the entries for which fn returns true, it returns the number of removed entries
+func (m *memCache) removeFn(fn func(key string, v interface{}) bool) int {
+	m.m.Lock()
+	defer m.m.Unlock()
+	removed := 0
+	for k, e := range m.c {
+		if fn(k, e.v) {
+			delete(m.c, k)
+			removed++
+		}
+	}
+	return removed
+}
+
+// expire removes the expired entries, it returns the number of removed entries
+func (m *memCache) expire() int {
+	m.m.Lock()
+	defer m.m.Unlock()
+	removed := 0
+	now := time.Now()
+	for k, e := range m.c {
+		if now.Sub(e.at) > m.ttl {
+			delete(m.c, k)
+			removed++
+		}
+	}
+	return removed
+}
+
+// each calls fn for all the entries that didn't expire
+func (m *memCache) each(fn func(key string, v interface{})) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+	for k, e := range m.c {
+		if time.Since(e.at) <= m.ttl {
+			fn(k, e.v)
+		}
+	}
+}
+
+const (
+	itemsCachePrefix    = "items:"
+	accountsCachePrefix = "accounts:"
+	votesCachePrefix    = "votes:"
+)
+
+// cachedRepository serves the items, accounts and votes from the cache, loading them from the
+// underlying Repository on a miss. The writes go to the underlying Repository and invalidate the cache.
+type cachedRepository struct {
+	Repository
+	c            cacheStore
+	interactions *localInteractions
+}
+
+var _ Repository = new(cachedRepository)
+
+func newCachedRepository(r Repository, c cacheStore) *cachedRepository {
+	return &cachedRepository{Repository: r, c: c, interactions: newLocalInteractions()}
+}
+
+func itemCacheKey(iri pub.IRI) string {
+	return itemsCachePrefix + iri.String()
+}
+
+func accountCacheKey(iri pub.IRI) string {
+	return accountsCachePrefix + iri.String()
+}
+
+// itemIRIs returns the IRIs an item can be loaded by
+func (c *cachedRepository) itemIRIs(it Item) []pub.IRI {
+	iris := make([]pub.IRI, 0, 3)
+	if id, ok := BuildIDFromItem(it); ok {
+		iris = append(iris, id)
+	}
+	if it.pub != nil {
+		iris = append(iris, it.pub.GetLink())
+	}
+	if it.Hash.IsValid() {
+		iris = append(iris, c.ItemIRI(it.Hash.String()))
+	}
+	return iris
+}
+
+func (c *cachedRepository) invalidateItem(it Item) {
+	keys := make([]string, 0)
+	for _, iri := range c.itemIRIs(it) {
+		keys = append(keys, itemCacheKey(iri))
+	}
+	if it.Parent != nil {
+		for _, iri := range c.itemIRIs(*it.Parent) {
+			keys = append(keys, itemCacheKey(iri))
+		}
+	}
+	if it.SubmittedBy != nil && it.SubmittedBy.pub != nil {
+		keys = append(keys, accountCacheKey(it.SubmittedBy.pub.GetLink()))
+	}
+	c.c.remove(keys...)
+}
+
+func (c *cachedRepository) LoadItem(ctx context.Context, iri pub.IRI) (Item, error) {
+	if v, ok := c.c.load(itemCacheKey(iri)); ok {
+		return v.(Item), nil
+	}
+	it, err := c.Repository.LoadItem(ctx, iri)
+	if err == nil {
+		c.c.save(itemCacheKey(iri), it)
+	}
+	return it, err
+}
+
+func (c *cachedRepository) SaveItem(ctx context.Context, it Item) (Item, error) {
+	saved, err := c.Repository.SaveItem(ctx, it)
+	c.invalidateItem(it)
+	if err == nil {
+		c.invalidateItem(saved)
+		if it.Parent != nil {
+			c.touchItem(*it.Parent)
+		}
+	}
+	return saved, err
+}
+
+func (c *cachedRepository) SaveItems(ctx context.Context, items []Item) ([]Item, []error) {
+	saved, errs := c.Repository.SaveItems(ctx, items)
+	for _, it := range items {
+		c.invalidateItem(it)
+	}
+	for _, it := range saved {
+		c.invalidateItem(it)
+	}
+	return saved, errs
+}
+
+func (c *cachedRepository) LoadAccount(ctx context.Context, iri pub.IRI) (*Account, error) {
+	if v, ok := c.c.load(accountCacheKey(iri)); ok {
+		acc := v.(Account)
+		return &acc, nil
+	}
+	acc, err := c.Repository.LoadAccount(ctx, iri)
+	if err == nil && acc != nil {
+		c.c.save(accountCacheKey(iri), *acc)
+	}
+	return acc, err
+}
+
+func (c *cachedRepository) SaveAccount(ctx context.Context, a Account) (Account, error) {
+	saved, err := c.Repository.SaveAccount(ctx, a)
+	keys := make([]string, 0, 2)
+	if a.HasMetadata() && len(a.Metadata.ID) > 0 {
+		keys = append(keys, accountCacheKey(pub.IRI(a.Metadata.ID)))
+	}
+	if a.pub != nil {
+		keys = append(keys, accountCacheKey(a.pub.GetLink()))
+	}
+	c.c.remove(keys...)
+	return saved, err
+}
+
+func (c *cachedRepository) LoadVotes(ctx context.Context, actor pub.Item, vf VotesFilter) (VotesPage, error) {
+	if actor == nil {
+		return c.Repository.LoadVotes(ctx, actor, vf)
+	}
+	key := fmt.Sprintf("%s%s:%v", votesCachePrefix, actor.GetLink(), vf)
+	if v, ok := c.c.load(key); ok {
+		return v.(VotesPage), nil
+	}
+	page, err := c.Repository.LoadVotes(ctx, actor, vf)
+	if err == nil {
+		c.c.save(key, page)
+	}
+	return page, err
+}
+
+func (c *cachedRepository) CurrentAccountVotes(ctx context.Context, viewer Account, items ...Item) (map[Hash]Vote, error) {
+	hashes := make([]string, len(items))
+	for i, it := range items {
+		hashes[i] = it.Hash.String()
+	}
+	key := fmt.Sprintf("%s%s:%s", votesCachePrefix, viewer.Hash, strings.Join(hashes, ","))
+	if v, ok := c.c.load(key); ok {
+		return v.(map[Hash]Vote), nil
+	}
+	votes, err := c.Repository.CurrentAccountVotes(ctx, viewer, items...)
+	if err == nil {
+		c.c.save(key, votes)
+	}
+	return votes, err
+}
+
+// SaveVote invalidates all the cached votes, as well as the item, because its score changed
+func (c *cachedRepository) SaveVote(ctx context.Context, v Vote) (Vote, error) {
+	saved, err := c.Repository.SaveVote(ctx, v)
+	c.c.removePrefix(votesCachePrefix)
+	if v.Item != nil {
+		c.invalidateItem(*v.Item)
+		if err == nil {
+			c.touchItem(*v.Item)
+		}
+	}
+	return saved, err
+}
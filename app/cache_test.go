@@ -0,0 +1,187 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+// countingRepository counts the calls that reach the underlying storage
+type countingRepository struct {
+	Repository
+	loads int
+	saves int
+}
+
+func (c *countingRepository) ItemIRI(hash string) pub.IRI {
+	return pub.IRI("https://fedbox.example/objects/" + hash)
+}
+
+func (c *countingRepository) LoadItem(_ context.Context, iri pub.IRI) (Item, error) {
+	c.loads++
+	return Item{Hash: HashFromString(testObjectHash), Title: "loaded", Metadata: &ItemMetadata{ID: iri.String()}}, nil
+}
+
+func (c *countingRepository) SaveItem(_ context.Context, it Item) (Item, error) {
+	c.saves++
+	return it, nil
+}
+
+// RepairAllScores sets the score of all the items to the one of a single vote
+func (c *countingRepository) RepairAllScores(_ context.Context, items ItemCollection) ([]ItemRepair, error) {
+	report := make([]ItemRepair, len(items))
+	for k := range items {
+		report[k] = ItemRepair{Hash: items[k].Hash, Cached: items[k].Score, Score: ScoreMultiplier, Likes: 1}
+		items[k].Score = ScoreMultiplier
+	}
+	return report, nil
+}
+
+func (c *countingRepository) LoadAccount(_ context.Context, iri pub.IRI) (*Account, error) {
+	c.loads++
+	return &Account{Hash: HashFromString(testActorHash), Handle: "johndoe", Metadata: &AccountMetadata{ID: iri.String()}}, nil
+}
+
+func (c *countingRepository) SaveAccount(_ context.Context, a Account) (Account, error) {
+	c.saves++
+	return a, nil
+}
+
+func Test_cachedRepository_LoadItem(t *testing.T) {
+	iri := pub.IRI("https://fedbox.example/objects/" + testObjectHash)
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		save  bool
+		loads int
+	}{
+		{name: "hit", ttl: time.Minute, loads: 1},
+		{name: "miss on expired entries", ttl: -time.Second, loads: 2},
+		{name: "invalidated on save", ttl: time.Minute, save: true, loads: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := new(countingRepository)
+			c := newCachedRepository(st, newMemCache(tt.ttl, 0))
+			if _, err := c.LoadItem(context.Background(), iri); err != nil {
+				t.Fatalf("LoadItem() error = %s", err)
+			}
+			if tt.save {
+				it := Item{Hash: HashFromString(testObjectHash), Metadata: &ItemMetadata{ID: iri.String()}}
+				if _, err := c.SaveItem(context.Background(), it); err != nil {
+					t.Fatalf("SaveItem() error = %s", err)
+				}
+				if st.saves != 1 {
+					t.Errorf("SaveItem() should go straight to the storage, saves = %d", st.saves)
+				}
+			}
+			it, err := c.LoadItem(context.Background(), iri)
+			if err != nil {
+				t.Fatalf("LoadItem() error = %s", err)
+			}
+			if it.Title != "loaded" {
+				t.Errorf("LoadItem() title = %q, want %q", it.Title, "loaded")
+			}
+			if st.loads != tt.loads {
+				t.Errorf("LoadItem() storage loads = %d, want %d", st.loads, tt.loads)
+			}
+		})
+	}
+}
+
+func Test_cachedRepository_LoadAccount(t *testing.T) {
+	iri := pub.IRI("https://fedbox.example/actors/" + testActorHash)
+	st := new(countingRepository)
+	c := newCachedRepository(st, newMemCache(time.Minute, 0))
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.LoadAccount(context.Background(), iri); err != nil {
+			t.Fatalf("LoadAccount() error = %s", err)
+		}
+	}
+	if st.loads != 1 {
+		t.Errorf("LoadAccount() should be served from the cache, storage loads = %d", st.loads)
+	}
+
+	acc := Account{Hash: HashFromString(testActorHash), Metadata: &AccountMetadata{ID: iri.String()}}
+	if _, err := c.SaveAccount(context.Background(), acc); err != nil {
+		t.Fatalf("SaveAccount() error = %s", err)
+	}
+	if _, err := c.LoadAccount(context.Background(), iri); err != nil {
+		t.Fatalf("LoadAccount() error = %s", err)
+	}
+	if st.loads != 2 {
+		t.Errorf("LoadAccount() should miss the cache after SaveAccount, storage loads = %d", st.loads)
+	}
+}
+
+func Test_cachedRepository_RepairCachedScores(t *testing.T) {
+	iri := pub.IRI("https://fedbox.example/objects/" + testObjectHash)
+	st := new(countingRepository)
+	c := newCachedRepository(st, newMemCache(time.Minute, 0))
+	c.c.save(itemCacheKey(iri), Item{Hash: HashFromString(testObjectHash), Score: 999, Metadata: &ItemMetadata{ID: iri.String()}})
+
+	report, err := c.RepairCachedScores(context.Background())
+	if err != nil {
+		t.Fatalf("RepairCachedScores() error = %s", err)
+	}
+	if len(report) != 1 || !report[0].Discrepancy() || report[0].Cached != 999 {
+		t.Errorf("Expected the corrupted cached score to be reported, got %#v", report)
+	}
+	// NOTE(marius): the repaired item replaces the cached one, without loading it again
+	it, err := c.LoadItem(context.Background(), iri)
+	if err != nil {
+		t.Fatalf("LoadItem() error = %s", err)
+	}
+	if it.Score != ScoreMultiplier {
+		t.Errorf("Invalid cached score %d, expected the repaired %d", it.Score, ScoreMultiplier)
+	}
+	if st.loads != 0 {
+		t.Errorf("The repaired item should be served from the cache, storage loads = %d", st.loads)
+	}
+}
+
+func Test_memCache_Size(t *testing.T) {
+	m := newMemCache(time.Minute, 3)
+	for _, k := range []string{"a", "b", "c"} {
+		m.save(k, k)
+	}
+	// NOTE(marius): saving an existing key again doesn't evict anything
+	m.save("a", "a")
+	if len(m.c) != 3 {
+		t.Errorf("Invalid cache size %d after saving an existing key, expected %d", len(m.c), 3)
+	}
+	m.save("d", "d")
+	if len(m.c) != 3 {
+		t.Errorf("Invalid cache size %d after saving over the limit, expected %d", len(m.c), 3)
+	}
+	if _, ok := m.load("d"); !ok {
+		t.Errorf("The last saved entry should be in the cache")
+	}
+}
+
+func Test_memCache_Expire(t *testing.T) {
+	m := newMemCache(time.Minute, 0)
+	m.save("fresh", 1)
+	m.save("old", 2)
+	m.save("older", 3)
+	for _, k := range []string{"old", "older"} {
+		e := m.c[k]
+		e.at = e.at.Add(-time.Hour)
+		m.c[k] = e
+	}
+	if _, ok := m.load("old"); ok {
+		t.Errorf("The expired entry should not be loaded")
+	}
+	if _, ok := m.c["old"]; ok {
+		t.Errorf("The expired entry should be removed when loaded")
+	}
+	if removed := m.expire(); removed != 1 {
+		t.Errorf("Invalid expired entries count %d, expected %d", removed, 1)
+	}
+	if _, ok := m.load("fresh"); !ok || len(m.c) != 1 {
+		t.Errorf("Only the fresh entry should be left in the cache, got %d entries", len(m.c))
+	}
+}
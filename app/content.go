@@ -1,12 +1,18 @@
 package app
 
 import (
+	"fmt"
+	ht "html"
 	"html/template"
+	"net/url"
+	"regexp"
 	"sort"
+	"strings"
 	"time"
 	"unicode"
 
 	pub "github.com/go-ap/activitypub"
+	"github.com/mariusor/go-littr/internal/config"
 	mark "gitlab.com/golang-commonmark/markdown"
 )
 
@@ -15,6 +21,14 @@ type FlagBits uint8
 const (
 	FlagsDeleted = FlagBits(1 << iota)
 	FlagsPrivate
+	FlagsBrigaded
+	FlagsLocalOnly
+	FlagsLocked
+	FlagsSensitive
+	// FlagsCollapsed marks the sensitive items shown collapsed in the listings, it's never saved
+	FlagsCollapsed
+	// FlagsLowScore marks the items with a score lower than the viewer's minimum, shown collapsed, it's never saved
+	FlagsLowScore
 
 	FlagsNone = FlagBits(0)
 )
@@ -33,20 +47,146 @@ func (f *FlagBits) FromInt64() error {
 
 type ItemCollection []Item
 
-var MdPolicy = mark.New(
-	mark.HTML(true),
-	mark.Tables(true),
-	mark.Linkify(false),
-	mark.Breaks(false),
-	mark.Typographer(false),
-	mark.XHTMLOutput(false),
+const (
+	MarkdownFeatureHTML        = "html"
+	MarkdownFeatureTables      = "tables"
+	MarkdownFeatureLinkify     = "linkify"
+	MarkdownFeatureBreaks      = "breaks"
+	MarkdownFeatureTypographer = "typographer"
 )
 
+// MarkdownOptions are the markdown extensions enabled for rendering the items
+type MarkdownOptions struct {
+	HTML        bool
+	Tables      bool
+	Linkify     bool
+	Breaks      bool
+	Typographer bool
+}
+
+// MarkdownOptionsFromConfig returns the markdown options of the instance, the unknown features are ignored
+func MarkdownOptionsFromConfig(c config.Configuration) MarkdownOptions {
+	o := MarkdownOptions{}
+	for _, f := range c.MarkdownFeatures {
+		switch f {
+		case MarkdownFeatureHTML:
+			o.HTML = true
+		case MarkdownFeatureTables:
+			o.Tables = true
+		case MarkdownFeatureLinkify:
+			o.Linkify = true
+		case MarkdownFeatureBreaks:
+			o.Breaks = true
+		case MarkdownFeatureTypographer:
+			o.Typographer = true
+		}
+	}
+	return o
+}
+
+// Renderer returns a markdown renderer with the o options
+func (o MarkdownOptions) Renderer() *mark.Markdown {
+	return mark.New(
+		mark.HTML(o.HTML),
+		mark.Tables(o.Tables),
+		mark.Linkify(o.Linkify),
+		mark.Breaks(o.Breaks),
+		mark.Typographer(o.Typographer),
+		mark.XHTMLOutput(false),
+	)
+}
+
+// MdPolicy is the markdown renderer used for the items, Init replaces it with the one for the configured MarkdownOptions
+var MdPolicy = MarkdownOptions{HTML: true, Tables: true}.Renderer()
+
 // Markdown outputs the markdown render of a string
 func Markdown(data string) template.HTML {
 	return template.HTML(MdPolicy.RenderToString([]byte(data)))
 }
 
+func isTrackingParam(name string, params []string) bool {
+	name = strings.ToLower(name)
+	for _, p := range params {
+		p = strings.ToLower(p)
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(name, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+		if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// StripTrackingParams removes the tracking query parameters from the u URL
+func StripTrackingParams(u string, params []string) string {
+	if len(params) == 0 || !strings.Contains(u, "?") {
+		return u
+	}
+	pu, err := url.Parse(u)
+	if err != nil || len(pu.RawQuery) == 0 {
+		return u
+	}
+	// NOTE(marius): we don't use url.Values, because it doesn't keep the order of the parameters
+	kept := make([]string, 0)
+	changed := false
+	for _, param := range strings.Split(pu.RawQuery, "&") {
+		name := param
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			name = param[:i]
+		}
+		if n, err := url.QueryUnescape(name); err == nil {
+			name = n
+		}
+		if isTrackingParam(name, params) {
+			changed = true
+			continue
+		}
+		kept = append(kept, param)
+	}
+	if !changed {
+		return u
+	}
+	pu.RawQuery = strings.Join(kept, "&")
+	return pu.String()
+}
+
+// NormalizeURL returns the u URL in a form that can be compared to other ones pointing to the same resource:
+// lower case scheme and host, without "www.", default ports, fragment, trailing slash and tracking parameters
+func NormalizeURL(u string, params []string) string {
+	pu, err := url.Parse(strings.TrimSpace(StripTrackingParams(u, params)))
+	if err != nil || len(pu.Host) == 0 {
+		return u
+	}
+	pu.Scheme = strings.ToLower(pu.Scheme)
+	if pu.Scheme == "http" {
+		pu.Scheme = "https"
+	}
+	host := strings.TrimPrefix(strings.ToLower(pu.Hostname()), "www.")
+	if port := pu.Port(); len(port) > 0 && port != "80" && port != "443" {
+		host = host + ":" + port
+	}
+	pu.Host = host
+	pu.Fragment = ""
+	pu.Path = strings.TrimRight(pu.Path, "/")
+	pu.RawPath = ""
+	return pu.String()
+}
+
+var hrefRegexp = regexp.MustCompile(`(?i)(href=")([^"]+)(")`)
+
+// StripTrackingParamsHTML removes the tracking parameters from the links in the h HTML fragment
+func StripTrackingParamsHTML(h template.HTML, params []string) template.HTML {
+	if len(params) == 0 {
+		return h
+	}
+	return template.HTML(hrefRegexp.ReplaceAllStringFunc(string(h), func(s string) string {
+		m := hrefRegexp.FindStringSubmatch(s)
+		link := StripTrackingParams(ht.UnescapeString(m[2]), params)
+		return m[1] + ht.EscapeString(link) + m[3]
+	}))
+}
+
 // HasMetadata
 func (i *Item) HasMetadata() bool {
 	return i != nil && i.Metadata != nil
@@ -95,6 +235,11 @@ type Renderable interface {
 	Date() time.Time
 }
 
+// HasEmoji is implemented by the renderables that can contain custom emoji
+type HasEmoji interface {
+	Emoji() TagCollection
+}
+
 type HasContent interface {
 	Content() map[string][]byte
 	Tags() TagCollection
@@ -108,6 +253,8 @@ type Item struct {
 	MimeType    string            `json:"-"`
 	Data        string            `json:"-"`
 	Score       int               `json:"-"`
+	Upvotes     int               `json:"-"`
+	Downvotes   int               `json:"-"`
 	SubmittedAt time.Time         `json:"-"`
 	SubmittedBy *Account          `json:"by,omitempty"`
 	UpdatedAt   time.Time         `json:"-"`
@@ -117,8 +264,40 @@ type Item struct {
 	pub         pub.Item          `json:"-"`
 	Parent      *Item             `json:"-"`
 	OP          *Item             `json:"-"`
+	Quote       *Item             `json:"-"`
 	Level       uint8             `json:"-"`
 	children    ItemPtrCollection `json:"-"`
+	Crossposts  ItemPtrCollection `json:"-"`
+	ReplyCount  int               `json:"-"`
+}
+
+// QuoteMediaType is the media type of the Link tag that references a quoted item
+const QuoteMediaType = `application/ld+json; profile="https://www.w3.org/ns/activitystreams"`
+
+// quoteLink returns the tag we add to an object quoting the iri one
+func quoteLink(iri pub.IRI) *pub.Link {
+	return &pub.Link{
+		Type:      pub.LinkType,
+		MediaType: QuoteMediaType,
+		Href:      iri,
+		Name:      pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content(fmt.Sprintf("RE: %s", iri))}},
+	}
+}
+
+// quoteFallback is appended to the content of a quoting object, for the servers that don't know about quotes
+func quoteFallback(iri pub.IRI) string {
+	escaped := ht.EscapeString(iri.String())
+	return fmt.Sprintf(`<p class="quote-inline">RE: <a href="%s">%s</a></p>`, escaped, escaped)
+}
+
+// quotedIRI returns the IRI of the quoted object, if there's a quote Link in the tags
+func quotedIRI(tags pub.ItemCollection) pub.IRI {
+	for _, t := range tags {
+		if l, ok := t.(*pub.Link); ok && l.MediaType == QuoteMediaType && len(l.Href) > 0 {
+			return l.Href
+		}
+	}
+	return ""
 }
 
 func (i Item) ID() Hash {
@@ -237,7 +416,13 @@ func (h ItemPtrCollection) Sorted() ItemPtrCollection {
 	sort.SliceStable(h, func(i, j int) bool {
 		ii := h[i]
 		ij := h[j]
-		return ii.Score > ij.Score || (ii.Score == ij.Score && ii.SubmittedAt.After(ij.SubmittedAt))
+		if ii.Score != ij.Score {
+			return ii.Score > ij.Score
+		}
+		if !ii.SubmittedAt.Equal(ij.SubmittedAt) {
+			return ii.SubmittedAt.After(ij.SubmittedAt)
+		}
+		return hashLess(ii.Hash, ij.Hash)
 	})
 	return h
 }
@@ -2,7 +2,12 @@ package app
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/config"
 )
 
 func Test_replaceTags(t *testing.T) {
@@ -239,6 +244,36 @@ func Test_loadTags(t *testing.T) {
 			},
 			wantMentions: TagCollection{},
 		},
+		{
+			name: "a-short-tag-and-a-mention",
+			data: "@alice #go",
+			wantTags: TagCollection{
+				Tag{
+					Type: TagTag,
+					Name: "go",
+					URL:  "/t/go",
+				},
+			},
+			wantMentions: TagCollection{
+				Tag{
+					Type: TagMention,
+					Name: "alice",
+					URL:  "/~alice",
+				},
+			},
+		},
+		{
+			name:         "an-email-address",
+			data:         "write to x@y.com",
+			wantTags:     TagCollection{},
+			wantMentions: TagCollection{},
+		},
+		{
+			name:         "inside-code",
+			data:         "run `git log #tag` or\n```\n@alice #go\n```\n<code>#html</code>",
+			wantTags:     TagCollection{},
+			wantMentions: TagCollection{},
+		},
 		{
 			name: "release-notes-202006",
 			data: `
@@ -296,3 +331,154 @@ This is a very important step forward in removing the need for a custom "activit
 		})
 	}
 }
+
+func Test_autoLinkTags(t *testing.T) {
+	it := Item{
+		Data:     "hello @alice, this is about #go, mail x@y.com",
+		MimeType: MimeTypeMarkdown,
+		Metadata: &ItemMetadata{
+			Mentions: TagCollection{{Type: TagMention, Name: "alice", URL: "/~alice"}},
+		},
+	}
+	autoLinkTags(&it)
+	if len(it.Metadata.Mentions) != 1 {
+		t.Errorf("Expected one mention, received %d: %v", len(it.Metadata.Mentions), it.Metadata.Mentions)
+	}
+	if len(it.Metadata.Tags) != 1 || it.Metadata.Tags[0].Name != "go" {
+		t.Errorf("Expected the #go tag, received %v", it.Metadata.Tags)
+	}
+}
+
+func TestStripTrackingParams(t *testing.T) {
+	params := strings.Split(config.DefaultTrackingParams, ",")
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{
+			name: "no query",
+			url:  "https://example.com/article",
+			want: "https://example.com/article",
+		},
+		{
+			name: "only tracking",
+			url:  "https://example.com/article?utm_source=feed&utm_medium=rss&fbclid=abc",
+			want: "https://example.com/article",
+		},
+		{
+			name: "mixed",
+			url:  "https://example.com/article?id=2&utm_campaign=x&page=3&gclid=y#top",
+			want: "https://example.com/article?id=2&page=3#top",
+		},
+		{
+			name: "untouched",
+			url:  "https://example.com/article?b=2&a=1",
+			want: "https://example.com/article?b=2&a=1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripTrackingParams(tt.url, params); got != tt.want {
+				t.Errorf("StripTrackingParams() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripTrackingParamsHTML(t *testing.T) {
+	params := strings.Split(config.DefaultTrackingParams, ",")
+	it := Item{
+		MimeType: MimeTypeMarkdown,
+		Data:     "Read [this](https://example.com/article?id=2&utm_source=newsletter&fbclid=abc) now",
+	}
+	source := it.Data
+
+	got := string(StripTrackingParamsHTML(Markdown(it.Data), params))
+	if strings.Contains(got, "utm_source") || strings.Contains(got, "fbclid") {
+		t.Errorf("The rendered link still has tracking parameters: %s", got)
+	}
+	if !strings.Contains(got, `href="https://example.com/article?id=2"`) {
+		t.Errorf("The rendered link %s should keep the other parameters", got)
+	}
+	if it.Data != source {
+		t.Errorf("The stored source was changed to %s, expected %s", it.Data, source)
+	}
+}
+
+func TestMarkdownOptions_Tables(t *testing.T) {
+	const table = "| a | b |\n|---|---|\n| 1 | 2 |\n"
+	tests := []struct {
+		name     string
+		features []string
+		want     bool
+	}{
+		{name: "tables enabled", features: []string{MarkdownFeatureTables}, want: true},
+		{name: "tables disabled", features: []string{MarkdownFeatureHTML, MarkdownFeatureLinkify}, want: false},
+		{name: "unknown feature", features: []string{"footnotes"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := MarkdownOptionsFromConfig(config.Configuration{MarkdownFeatures: tt.features})
+			got := o.Renderer().RenderToString([]byte(table))
+			if strings.Contains(got, "<table>") != tt.want {
+				t.Errorf("Render() = %q, table rendered should be %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_normalizeTags(t *testing.T) {
+	tags := TagCollection{
+		{Type: TagTag, Name: "Go", URL: "/t/Go"},
+		{Type: TagTag, Name: "#go", URL: "/t/go"},
+		{Type: TagTag, Name: "GO", URL: "/t/GO"},
+		{Type: TagTag, Name: "#ActivityPub", URL: "https://remote.example/tags/ActivityPub"},
+	}
+	want := TagCollection{
+		{Type: TagTag, Name: "go", URL: "/t/go"},
+		{Type: TagTag, Name: "activitypub", URL: "https://remote.example/tags/ActivityPub"},
+	}
+	if got := normalizeTags(tags); !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeTags() = %v, want %v", got, want)
+	}
+}
+
+func Test_repository_limitTags(t *testing.T) {
+	item := func() Item {
+		return Item{Metadata: &ItemMetadata{Tags: TagCollection{
+			{Type: TagTag, Name: "one"}, {Type: TagTag, Name: "#One"}, {Type: TagTag, Name: "two"}, {Type: TagTag, Name: "three"},
+		}}}
+	}
+	r := repository{maxTags: 3, tagsLimitPolicy: TagsLimitReject}
+	it := item()
+	if err := r.limitTags(&it); err != nil {
+		t.Errorf("The duplicate tags should not count against the limit, received: %s", err)
+	}
+
+	r.maxTags = 2
+	it = item()
+	if err := r.limitTags(&it); !errors.IsBadRequest(err) {
+		t.Errorf("Expected a bad request error for an item with more than %d tags, received: %v", r.maxTags, err)
+	}
+
+	r.tagsLimitPolicy = TagsLimitTruncate
+	it = item()
+	if err := r.limitTags(&it); err != nil {
+		t.Fatalf("The extra tags should have been dropped, received: %s", err)
+	}
+	if len(it.Metadata.Tags) != 2 || it.Metadata.Tags[0].Name != "one" || it.Metadata.Tags[1].Name != "two" {
+		t.Errorf("Expected the first 2 tags to be kept, received %v", it.Metadata.Tags)
+	}
+}
+
+func Test_quoteFallback(t *testing.T) {
+	html := quoteFallback(pub.IRI(`https://remote.example/objects/1"><script>alert(1)</script>`))
+	if strings.Contains(html, "<script>") || strings.Contains(html, `1">`) {
+		t.Errorf("The quoted IRI should be escaped in the fallback link: %s", html)
+	}
+	want := `<p class="quote-inline">RE: <a href="https://remote.example/objects/1">https://remote.example/objects/1</a></p>`
+	if html := quoteFallback("https://remote.example/objects/1"); html != want {
+		t.Errorf("Invalid fallback link %s, expected %s", html, want)
+	}
+}
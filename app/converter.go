@@ -95,6 +95,12 @@ func FromActor(a *Account, p *pub.Actor) error {
 			return iconMetadataFromObject(&a.Metadata.Icon, o)
 		})
 	}
+	if p.Source.MediaType == MimeTypeMarkdown && p.Source.Content.Count() > 0 {
+		// NOTE(marius): our own actors keep the markdown of the bio as the source of the rendered summary
+		a.Metadata.Blurb = []byte(p.Source.Content.First().Value)
+	} else if p.Summary.Count() > 0 {
+		a.Metadata.Blurb = []byte(LocalHTMLPolicy.Sanitize(p.Summary.First().Value.String()))
+	}
 	if p.GetType() == pub.TombstoneType {
 		a.Handle = Anonymous
 		a.Flags = a.Flags & FlagsDeleted
@@ -121,10 +127,10 @@ func FromActor(a *Account, p *pub.Actor) error {
 		a.Metadata.OutboxIRI = p.Outbox.GetLink().String()
 	}
 	if p.Followers != nil {
-		a.Metadata.FollowersIRI = p.Followers.GetLink().String()
+		a.Metadata.FollowersIRI = fedboxFollowIRI(*a, p.Followers.GetLink(), handlers.Followers)
 	}
 	if p.Following != nil {
-		a.Metadata.FollowingIRI = p.Following.GetLink().String()
+		a.Metadata.FollowingIRI = fedboxFollowIRI(*a, p.Following.GetLink(), handlers.Following)
 	}
 	if p.Liked != nil {
 		a.Metadata.LikedIRI = p.Liked.GetLink().String()
@@ -137,21 +143,30 @@ func FromActor(a *Account, p *pub.Actor) error {
 			if ic.Content != nil {
 				a.Metadata.Icon.URI = ic.Content.First().String()
 			} else if ic.URL != nil {
-				a.Metadata.Icon.URI = ic.URL.GetLink().String()
+				a.Metadata.Icon.URI = ProxiedURL(ic.URL.GetLink().String())
 			} else {
-				a.Metadata.Icon.URI = ic.GetLink().String()
+				a.Metadata.Icon.URI = ProxiedURL(ic.GetLink().String())
 			}
 			return nil
 		})
 	} else {
 		a.Metadata.Icon = accountDefaultAvatar(a)
 	}
+	if tags := featuredTagsFromStreams(p.Streams); len(tags) > 0 {
+		a.Metadata.FeaturedTags = tags
+	}
+	if prefs := preferencesFromStreams(p.Streams); prefs != nil {
+		a.Metadata.Preferences = prefs
+	}
 	if block, _ := pem.Decode([]byte(p.PublicKey.PublicKeyPem)); block != nil {
 		pub := make([]byte, base64.StdEncoding.EncodedLen(len(block.Bytes)))
 		base64.StdEncoding.Encode(pub, block.Bytes)
 		a.Metadata.Key = &SSHKey{Public: pub}
 	}
 	if p.Endpoints != nil {
+		if p.Endpoints.SharedInbox != nil {
+			a.Metadata.SharedInboxIRI = p.Endpoints.SharedInbox.GetLink().String()
+		}
 		if p.Endpoints.OauthAuthorizationEndpoint != nil {
 			u, _ := p.Endpoints.OauthAuthorizationEndpoint.GetLink().URL()
 			a.Metadata.AuthorizationEndPoint = u.String()
@@ -225,6 +240,17 @@ func FromObjectWithBinaryData(i *Item, a *pub.Object) error {
 	if err != nil {
 		return err
 	}
+	if u, _ := urlsFromItem(a.URL); a.Type == pub.ImageType && len(u.URI) > 0 && len(a.Content) > 0 {
+		// NOTE(marius): the images which link to their data have the description of the image as content
+		i.Metadata.Alt = a.Content.First().Value.String()
+		i.Data = u.URI
+		i.MimeType = MimeTypeURL
+	}
+	if i.MimeType == MimeTypeURL && len(a.MediaType) > 0 {
+		// NOTE(marius): media objects which link to their content, get rendered inline from the URL
+		i.MimeType = string(a.MediaType)
+		i.Data = ProxiedURL(i.Data)
+	}
 	return nil
 }
 
@@ -234,7 +260,7 @@ func iconMetadataFromObject(m *ImageMetadata, o *pub.Object) error {
 	}
 	m.MimeType = string(o.MediaType)
 	if o.URL != nil {
-		m.URI = o.URL.GetLink().String()
+		m.URI = ProxiedURL(o.URL.GetLink().String())
 	}
 	if o.Content != nil && len(o.Content) > 0 {
 		var cnt []byte = o.Content.First().Value
@@ -277,6 +303,9 @@ func FromTag(t *Tag, a *pub.Object) error {
 	if a.Type == pub.MentionType {
 		t.Type = TagMention
 	}
+	if a.Type == EmojiType {
+		t.Type = TagEmoji
+	}
 	t.SubmittedAt = a.Published
 	t.UpdatedAt = a.Updated
 	if t.Metadata == nil {
@@ -330,6 +359,58 @@ func BlueMondayPolicy() *bluemonday.Policy {
 	return p
 }
 
+func linkMetadata(it pub.Item) LinkMetadata {
+	l := LinkMetadata{}
+	if it == nil {
+		return l
+	}
+	if it.IsLink() {
+		l.URI = it.GetLink().String()
+		return l
+	}
+	pub.OnLink(it, func(lnk *pub.Link) error {
+		l.URI = lnk.Href.String()
+		l.MimeType = string(lnk.MediaType)
+		return nil
+	})
+	return l
+}
+
+// urlsFromItem returns the permalink from the url property of an object and its alternate representations.
+// The url can be a single IRI or Link, or an array of them, in which case we prefer the HTML one for the permalink.
+func urlsFromItem(u pub.Item) (LinkMetadata, []LinkMetadata) {
+	if u == nil {
+		return LinkMetadata{}, nil
+	}
+	col, ok := u.(pub.ItemCollection)
+	if !ok {
+		return linkMetadata(u), nil
+	}
+	links := make([]LinkMetadata, 0, len(col))
+	for _, it := range col {
+		if l := linkMetadata(it); len(l.URI) > 0 {
+			links = append(links, l)
+		}
+	}
+	if len(links) == 0 {
+		return LinkMetadata{}, nil
+	}
+	perma := 0
+	for k, l := range links {
+		if strings.HasPrefix(l.MimeType, MimeTypeHTML) {
+			perma = k
+			break
+		}
+	}
+	var alternates []LinkMetadata
+	for k, l := range links {
+		if k != perma {
+			alternates = append(alternates, l)
+		}
+	}
+	return links[perma], alternates
+}
+
 func FromArticle(i *Item, a *pub.Object) error {
 	title := a.Name.First().Value
 
@@ -338,8 +419,9 @@ func FromArticle(i *Item, a *pub.Object) error {
 		i.Title = title.String()
 	}
 	i.MimeType = MimeTypeHTML
-	if len(a.Content) == 0 && a.URL != nil && len(a.URL.GetLink()) > 0 {
-		i.Data = string(a.URL.GetLink())
+	u, alternates := urlsFromItem(a.URL)
+	if len(a.Content) == 0 && len(u.URI) > 0 {
+		i.Data = u.URI
 		i.MimeType = MimeTypeURL
 	} else {
 		if len(a.MediaType) > 0 {
@@ -352,6 +434,14 @@ func FromArticle(i *Item, a *pub.Object) error {
 	if i.Metadata == nil {
 		i.Metadata = &ItemMetadata{}
 	}
+	if lang := langFromValues(a.Content); len(lang) > 0 {
+		i.Metadata.Lang = lang
+	} else {
+		i.Metadata.Lang = langFromValues(a.Name)
+	}
+	if i.IsLink() {
+		i.Metadata.Domain = displayDomain(i.Data)
+	}
 
 	if a.AttributedTo != nil {
 		auth := Account{Metadata: &AccountMetadata{}}
@@ -362,15 +452,19 @@ func FromArticle(i *Item, a *pub.Object) error {
 	if len(a.ID) > 0 {
 		iri := a.GetLink()
 		i.Metadata.ID = iri.String()
-		if a.URL != nil {
-			i.Metadata.URL = a.URL.GetLink().String()
+		if len(u.URI) > 0 {
+			i.Metadata.URL = u.URI
 		}
+		i.Metadata.Alternates = alternates
 	}
 	if a.Icon != nil {
 		pub.OnObject(a.Icon, func(o *pub.Object) error {
 			return iconMetadataFromObject(&i.Metadata.Icon, o)
 		})
 	}
+	if a.Attachment != nil {
+		i.Metadata.Attachments = attachmentsFromItem(a.Attachment)
+	}
 	if a.Context != nil {
 		op := Item{}
 		op.FromActivityPub(a.Context)
@@ -410,6 +504,16 @@ func FromArticle(i *Item, a *pub.Object) error {
 		i.Data = a.Source.Content.First().Value.String()
 		i.MimeType = string(a.Source.MediaType)
 	}
+	if q := quotedIRI(a.Tag); len(q) > 0 {
+		i.Quote = &Item{Hash: HashFromIRI(q), Metadata: &ItemMetadata{ID: q.String()}}
+		i.Data = strings.TrimSuffix(i.Data, quoteFallback(q))
+	}
+	if isLocked(a.Tag) {
+		i.Lock()
+	}
+	if isSensitive(a.Tag) {
+		i.MarkSensitive()
+	}
 	if a.Tag != nil && len(a.Tag) > 0 {
 		i.Metadata.Tags = make(TagCollection, 0)
 		i.Metadata.Mentions = make(TagCollection, 0)
@@ -423,6 +527,9 @@ func FromArticle(i *Item, a *pub.Object) error {
 			if t.Type == TagMention {
 				i.Metadata.Mentions = append(i.Metadata.Mentions, t)
 			}
+			if t.Type == TagEmoji {
+				i.Metadata.Emoji = append(i.Metadata.Emoji, t)
+			}
 		}
 	}
 	loadRecipients(i, a)
@@ -473,6 +580,9 @@ func loadRecipients(i *Item, it pub.Item) error {
 		if isPublic {
 			i.MakePublic()
 		}
+		if isLocalOnlyAudience(o.To, o.CC) {
+			i.MakeLocalOnly()
+		}
 		return nil
 	})
 }
@@ -574,6 +684,14 @@ func (i *Item) FromActivityPub(it pub.Item) error {
 			if err := i.FromActivityPub(act.Object); err != nil {
 				return err
 			}
+			// NOTE(marius): when the object doesn't have its own dates, the Create was its publishing
+			// and the Update its last edit
+			if act.Type == pub.CreateType && i.SubmittedAt.IsZero() {
+				i.SubmittedAt = act.Published
+			}
+			if act.Type == pub.UpdateType && act.Published.After(i.UpdatedAt) {
+				i.UpdatedAt = act.Published
+			}
 			i.SubmittedBy.FromActivityPub(act.Actor)
 			if i.Metadata == nil {
 				i.Metadata = &ItemMetadata{}
@@ -598,7 +716,9 @@ func (i *Item) FromActivityPub(it pub.Item) error {
 		if len(id) > 0 {
 			i.Metadata.ID = id.String()
 		}
-		pub.OnObject(it, func(o *pub.Object) error {
+		// NOTE(marius): we read the Tombstone directly, as it can't always be converted to an Object,
+		// and we need its parent so the replies to the deleted item keep their place in the thread
+		pub.OnTombstone(it, func(o *pub.Tombstone) error {
 			if o.Context != nil {
 				op := new(Item)
 				if err := op.FromActivityPub(o.Context); err == nil {
@@ -628,10 +748,7 @@ func (i *Item) FromActivityPub(it pub.Item) error {
 				}
 			}
 			i.SubmittedAt = o.Published
-			return nil
-		})
-		pub.OnTombstone(it, func(t *pub.Tombstone) error {
-			i.UpdatedAt = t.Deleted
+			i.UpdatedAt = o.Deleted
 			if i.SubmittedAt.IsZero() {
 				i.SubmittedAt = i.UpdatedAt
 			}
@@ -662,7 +779,15 @@ func (v *Vote) FromActivityPub(it pub.Item) error {
 	case pub.DislikeType:
 		fromAct := func(act pub.Activity, v *Vote) {
 			on := Item{}
-			on.FromActivityPub(act.Object)
+			ob := act.Object
+			if act.Type == pub.UndoType && ob != nil && ob.IsObject() && ValidAppreciationTypes.Contains(ob.GetType()) {
+				// NOTE(marius): when the undone activity is embedded, the vote is on its object
+				pub.OnActivity(ob, func(undone *pub.Activity) error {
+					ob = undone.Object
+					return nil
+				})
+			}
+			on.FromActivityPub(ob)
 			v.Item = &on
 
 			er := Account{Metadata: &AccountMetadata{}}
@@ -683,7 +808,9 @@ func (v *Vote) FromActivityPub(it pub.Item) error {
 			}
 			if act.Type == pub.UndoType {
 				v.Weight = 0
-				v.Metadata.OriginalIRI = act.Object.GetLink().String()
+				if act.Object != nil {
+					v.Metadata.OriginalIRI = act.Object.GetLink().String()
+				}
 			}
 		}
 		pub.OnActivity(it, func(act *pub.Activity) error {
@@ -696,6 +823,9 @@ func (v *Vote) FromActivityPub(it pub.Item) error {
 }
 
 func HostIsLocal(s string) bool {
+	if c := Instance.Conf.CanonicalHost; len(c) > 0 && strings.Contains(host(s), c) {
+		return true
+	}
 	return strings.Contains(host(s), Instance.Conf.HostName) || strings.Contains(host(s), host(Instance.Conf.APIURL))
 }
 
@@ -0,0 +1,47 @@
+package app
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// corsMaxAge is the number of seconds the browsers can cache the answer to a preflight request
+const corsMaxAge = 3600
+
+// corsOriginAllowed returns true if the origin matches one of the allowed ones, "*" allows any origin
+func corsOriginAllowed(allowed []string, origin string) bool {
+	for _, o := range allowed {
+		if o == "*" || strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS adds the Access-Control headers for the origins in the CORS_ALLOWED_ORIGINS list to the JSON endpoints,
+// so they can be used by web clients hosted elsewhere. The preflight OPTIONS requests are answered directly.
+func (h handler) CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0
+		w.Header().Add("Vary", "Origin")
+		if len(origin) > 0 && corsOriginAllowed(h.conf.CORSOrigins, origin) {
+			allowOrigin := origin
+			if len(h.conf.CORSOrigins) == 1 && h.conf.CORSOrigins[0] == "*" {
+				allowOrigin = "*"
+			}
+			w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(h.conf.CORSMethods, ", "))
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(h.conf.CORSHeaders, ", "))
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+			}
+		}
+		if preflight {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
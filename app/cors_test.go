@@ -0,0 +1,57 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+func Test_handler_CORS(t *testing.T) {
+	h := handler{conf: appConfig{Configuration: config.Configuration{
+		CORSOrigins: []string{"https://client.example"},
+		CORSMethods: []string{"GET", "HEAD", "OPTIONS"},
+		CORSHeaders: []string{"Accept", "Authorization"},
+	}}}
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		wantStatus  int
+		wantOrigin  string
+		wantMethods string
+	}{
+		{name: "allowed origin", method: http.MethodGet, origin: "https://client.example", wantStatus: http.StatusOK, wantOrigin: "https://client.example"},
+		{name: "allowed origin preflight", method: http.MethodOptions, origin: "https://client.example", wantStatus: http.StatusNoContent, wantOrigin: "https://client.example", wantMethods: "GET, HEAD, OPTIONS"},
+		{name: "disallowed origin", method: http.MethodGet, origin: "https://evil.example", wantStatus: http.StatusOK},
+		{name: "disallowed origin preflight", method: http.MethodOptions, origin: "https://evil.example", wantStatus: http.StatusNoContent},
+		{name: "same origin", method: http.MethodGet, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			req := httptest.NewRequest(tt.method, "/.well-known/webfinger", nil)
+			if len(tt.origin) > 0 {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			w := httptest.NewRecorder()
+			h.CORS(next).ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("CORS() status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("CORS() Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+				t.Errorf("CORS() Access-Control-Allow-Methods = %q, want %q", got, tt.wantMethods)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"net/http"
+	"sort"
+)
+
+// collapseCrossposts merges the link items in the list that point to the same normalized URL into
+// the highest scoring one, the other submissions are kept in its Crossposts, ordered by score.
+func collapseCrossposts(list RenderableList, params []string) RenderableList {
+	byURL := make(map[string]ItemPtrCollection)
+	for _, ren := range list {
+		it, ok := ren.(*Item)
+		if !ok || !it.IsLink() || it.Deleted() || len(it.Data) == 0 {
+			continue
+		}
+		u := NormalizeURL(it.Data, params)
+		byURL[u] = append(byURL[u], it)
+	}
+	for _, items := range byURL {
+		if len(items) < 2 {
+			continue
+		}
+		sort.SliceStable(items, func(i, j int) bool {
+			if items[i].Score != items[j].Score {
+				return items[i].Score > items[j].Score
+			}
+			if !items[i].SubmittedAt.Equal(items[j].SubmittedAt) {
+				return items[i].SubmittedAt.Before(items[j].SubmittedAt)
+			}
+			return hashLess(items[i].Hash, items[j].Hash)
+		})
+		top := items[0]
+		for _, it := range items[1:] {
+			top.Crossposts = append(top.Crossposts, it)
+			delete(list, it.ID())
+		}
+	}
+	return list
+}
+
+// CollapseCrosspostsMw collapses the crossposted items in the loaded page, when enabled
+func (h *handler) CollapseCrosspostsMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c := ContextCursor(r.Context()); c != nil && h.conf.CollapseCrossposts {
+			c.items = collapseCrossposts(c.items, h.conf.TrackingParams)
+			c.total = uint(len(c.items))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
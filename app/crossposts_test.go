@@ -0,0 +1,41 @@
+package app
+
+import (
+	"testing"
+)
+
+func Test_collapseCrossposts(t *testing.T) {
+	params := []string{"utm_*"}
+	link := func(hash, url string, score int) *Item {
+		return &Item{Hash: HashFromString(hash), MimeType: MimeTypeURL, Data: url, Score: score}
+	}
+	low := link("0b7e8a6c-1f2d-4a3b-8c9d-0e1f2a3b4c01", "http://www.example.com/article/?utm_source=feed", 2)
+	top := link("0b7e8a6c-1f2d-4a3b-8c9d-0e1f2a3b4c02", "https://example.com/article#comments", 10)
+	mid := link("0b7e8a6c-1f2d-4a3b-8c9d-0e1f2a3b4c03", "https://EXAMPLE.com/article", 5)
+	other := link("0b7e8a6c-1f2d-4a3b-8c9d-0e1f2a3b4c04", "https://example.com/other", 1)
+
+	list := make(RenderableList)
+	for _, it := range []*Item{low, top, mid, other} {
+		list[it.Hash] = it
+	}
+	list = collapseCrossposts(list, params)
+
+	if len(list) != 2 {
+		t.Fatalf("collapseCrossposts() returned %d entries, want 2", len(list))
+	}
+	if _, ok := list[top.Hash]; !ok {
+		t.Fatalf("collapseCrossposts() should keep the highest scoring submission")
+	}
+	if _, ok := list[other.Hash]; !ok {
+		t.Errorf("collapseCrossposts() should keep the submissions of other URLs")
+	}
+	if len(top.Crossposts) != 2 {
+		t.Fatalf("Crossposts = %d, want 2", len(top.Crossposts))
+	}
+	if top.Crossposts[0] != mid || top.Crossposts[1] != low {
+		t.Errorf("Crossposts should be ordered by score, got %s, %s", top.Crossposts[0].Hash, top.Crossposts[1].Hash)
+	}
+	if len(other.Crossposts) != 0 {
+		t.Errorf("Crossposts for a single submission = %d, want 0", len(other.Crossposts))
+	}
+}
@@ -1,6 +1,8 @@
 package app
 
 import (
+	"bytes"
+	"net/url"
 	"sort"
 	"time"
 
@@ -12,14 +14,102 @@ type Cursor struct {
 	before Hash
 	items  RenderableList
 	total  uint
+	pages  Pagination
 }
 
 var emptyCursor = Cursor{}
 
+// Pagination returns the pagination links of the collection the cursor was loaded from
+func (c Cursor) Pagination() Pagination {
+	return c.pages
+}
+
 type colCursor struct {
 	filters *Filters
 	loaded  int
 	items   pub.ItemCollection
+	pages   Pagination
+}
+
+// Pagination holds the query strings for the first, previous, next and last pages of a collection,
+// as received in the collection page's links, together with the item counts.
+type Pagination struct {
+	First string `json:"first,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last,omitempty"`
+	Count int    `json:"count"`
+	Total uint   `json:"total"`
+}
+
+// NextCursor returns the "after" value from the next page link
+func (p Pagination) NextCursor() string {
+	q, _ := url.ParseQuery(p.Next)
+	return q.Get("after")
+}
+
+// PrevCursor returns the "before" value from the previous page link
+func (p Pagination) PrevCursor() string {
+	q, _ := url.ParseQuery(p.Prev)
+	return q.Get("before")
+}
+
+// followedBy updates the pagination with the values of the page that was loaded after the current one
+func (p *Pagination) followedBy(next Pagination) {
+	if len(p.First) == 0 {
+		p.First = next.First
+	}
+	p.Next = next.Next
+	if len(next.Last) > 0 {
+		p.Last = next.Last
+	}
+	p.Count += next.Count
+	if next.Total > p.Total {
+		p.Total = next.Total
+	}
+}
+
+func linkQuery(it pub.Item) string {
+	if it == nil {
+		return ""
+	}
+	u, err := it.GetLink().URL()
+	if err != nil {
+		return ""
+	}
+	return u.RawQuery
+}
+
+// paginationFromCollection loads the pagination links from a fedbox collection, or collection page
+func paginationFromCollection(col pub.CollectionInterface) Pagination {
+	p := Pagination{}
+	if col == nil {
+		return p
+	}
+	switch c := col.(type) {
+	case *pub.OrderedCollectionPage:
+		p.First = linkQuery(c.First)
+		p.Prev = linkQuery(c.Prev)
+		p.Next = linkQuery(c.Next)
+		p.Last = linkQuery(c.Last)
+		p.Total = c.TotalItems
+	case *pub.OrderedCollection:
+		p.First = linkQuery(c.First)
+		p.Last = linkQuery(c.Last)
+		p.Total = c.TotalItems
+	case *pub.CollectionPage:
+		p.First = linkQuery(c.First)
+		p.Prev = linkQuery(c.Prev)
+		p.Next = linkQuery(c.Next)
+		p.Last = linkQuery(c.Last)
+		p.Total = c.TotalItems
+	case *pub.Collection:
+		p.First = linkQuery(c.First)
+		p.Last = linkQuery(c.Last)
+		p.Total = c.TotalItems
+	}
+	p.Count = len(col.Collection())
+	return p
 }
 
 type RenderableList map[Hash]Renderable
@@ -56,6 +146,12 @@ func (r *RenderableList) Append(others ...Renderable) {
 	}
 }
 
+// hashLess is the tiebreaker for the elements that sort the same otherwise, so the order of a listing
+// doesn't depend on the iteration order of the RenderableList map, and stays the same between the pages.
+func hashLess(a, b Hash) bool {
+	return bytes.Compare(a[:], b[:]) < 0
+}
+
 func ByDate (r RenderableList) []Renderable {
 	rl := make([]Renderable, 0)
 	for _, rr := range r {
@@ -69,21 +165,73 @@ func ByDate (r RenderableList) []Renderable {
 			case CommentType:
 				ii, oki := ri.(*Item)
 				ij, okj := rj.(*Item)
-				subOrder := ii.SubmittedAt.After(ij.SubmittedAt)
-				subSame := ii.SubmittedAt.Sub(ij.SubmittedAt) == 0
-				updOrder := ii.UpdatedAt.After(ij.UpdatedAt)
-				return oki && okj && ( subOrder || (subSame && updOrder))
+				if !oki || !okj {
+					return false
+				}
+				if !ii.SubmittedAt.Equal(ij.SubmittedAt) {
+					return ii.SubmittedAt.After(ij.SubmittedAt)
+				}
+				if !ii.UpdatedAt.Equal(ij.UpdatedAt) {
+					return ii.UpdatedAt.After(ij.UpdatedAt)
+				}
+				return hashLess(ii.Hash, ij.Hash)
 			}
 		}
-		return ri.Date().After(rj.Date())
+		if !ri.Date().Equal(rj.Date()) {
+			return ri.Date().After(rj.Date())
+		}
+		return hashLess(ri.ID(), rj.ID())
 	})
 	return rl
 }
+// lastActive returns the time of the last edit of the item, or of its publishing if it wasn't edited
+func lastActive(i *Item) time.Time {
+	if i.UpdatedAt.After(i.SubmittedAt) {
+		return i.UpdatedAt
+	}
+	return i.SubmittedAt
+}
+
+// ByUpdated orders the items by their last edit, the recently active ones first,
+// unlike ByDate which keeps them in the order they were published
+func ByUpdated(r RenderableList) []Renderable {
+	rl := make([]Renderable, 0)
+	for _, rr := range r {
+		rl = append(rl, rr)
+	}
+	sort.SliceStable(rl, func(i, j int) bool {
+		ri := rl[i]
+		rj := rl[j]
+		if ri.Type() == rj.Type() {
+			switch ri.Type() {
+			case CommentType:
+				ii, oki := ri.(*Item)
+				ij, okj := rj.(*Item)
+				if !oki || !okj {
+					return false
+				}
+				if ai, aj := lastActive(ii), lastActive(ij); !ai.Equal(aj) {
+					return ai.After(aj)
+				}
+				return hashLess(ii.Hash, ij.Hash)
+			}
+		}
+		if !ri.Date().Equal(rj.Date()) {
+			return ri.Date().After(rj.Date())
+		}
+		return hashLess(ri.ID(), rj.ID())
+	})
+	return rl
+}
+
 func ByScore (r RenderableList) []Renderable {
 	rl := make([]Renderable, 0)
 	for _, rr := range r {
 		rl = append(rl, rr)
 	}
+	// NOTE(marius): all the items are ranked at the same moment, otherwise the ones with equal scores and ages
+	// could end up in a different order depending on when they were compared
+	now := time.Now()
 	sort.SliceStable(rl, func(i, j int) bool {
 		ri := rl[i]
 		rj := rl[j]
@@ -92,12 +240,21 @@ func ByScore (r RenderableList) []Renderable {
 			case CommentType:
 				ii, oki := ri.(*Item)
 				ij, okj := rj.(*Item)
-				hi := Hacker(int64(ii.Score), time.Now().Sub(ii.SubmittedAt))
-				hj := Hacker(int64(ij.Score), time.Now().Sub(ij.SubmittedAt))
-				return oki && okj && hi > hj
+				if !oki || !okj {
+					return false
+				}
+				hi := Hacker(int64(ii.Score), now.Sub(ii.SubmittedAt))
+				hj := Hacker(int64(ij.Score), now.Sub(ij.SubmittedAt))
+				if hi != hj {
+					return hi > hj
+				}
+				return hashLess(ii.Hash, ij.Hash)
 			}
 		}
-		return ri.Date().After(rj.Date())
+		if !ri.Date().Equal(rj.Date()) {
+			return ri.Date().After(rj.Date())
+		}
+		return hashLess(ri.ID(), rj.ID())
 	})
 	return rl
 }
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_paginationFromCollection(t *testing.T) {
+	page := &pub.OrderedCollectionPage{
+		ID:         "https://fedbox.example/objects?after=f1&maxItems=2",
+		Type:       pub.OrderedCollectionPageType,
+		First:      pub.IRI("https://fedbox.example/objects?maxItems=2"),
+		Prev:       pub.IRI("https://fedbox.example/objects?before=f2&maxItems=2"),
+		Next:       pub.IRI("https://fedbox.example/objects?after=f3&maxItems=2"),
+		Last:       pub.IRI("https://fedbox.example/objects?before=f0&maxItems=2"),
+		TotalItems: 42,
+		OrderedItems: pub.ItemCollection{
+			pub.IRI("https://fedbox.example/objects/f2"),
+			pub.IRI("https://fedbox.example/objects/f3"),
+		},
+	}
+	want := Pagination{
+		First: "maxItems=2",
+		Prev:  "before=f2&maxItems=2",
+		Next:  "after=f3&maxItems=2",
+		Last:  "before=f0&maxItems=2",
+		Count: 2,
+		Total: 42,
+	}
+	got := paginationFromCollection(page)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("paginationFromCollection() = %#v, want %#v", got, want)
+	}
+	if got.NextCursor() != "f3" {
+		t.Errorf("Invalid next cursor %q, expected %q", got.NextCursor(), "f3")
+	}
+	if got.PrevCursor() != "f2" {
+		t.Errorf("Invalid previous cursor %q, expected %q", got.PrevCursor(), "f2")
+	}
+
+	following := Pagination{
+		Prev:  "before=f4&maxItems=2",
+		Next:  "after=f5&maxItems=2",
+		Count: 2,
+		Total: 42,
+	}
+	got.followedBy(following)
+	if got.First != want.First || got.Prev != want.Prev {
+		t.Errorf("The first and previous pages should not change when following pages: %#v", got)
+	}
+	if got.Next != following.Next {
+		t.Errorf("Invalid next page %q, expected %q", got.Next, following.Next)
+	}
+	if got.Count != 4 {
+		t.Errorf("Invalid count %d, expected %d", got.Count, 4)
+	}
+}
+
+func Test_SortTiebreaker(t *testing.T) {
+	now := time.Now().Add(-time.Hour)
+	list := make(RenderableList)
+	hashes := []string{testObjectHash, testLikeHash, testActorHash, "7d1c2b3a-4e5f-4a6b-8c7d-9e0f1a2b3c4d"}
+	for _, h := range hashes {
+		it := &Item{Hash: HashFromString(h), Score: 10, SubmittedAt: now, UpdatedAt: now}
+		list[it.Hash] = it
+	}
+	for name, sortFn := range map[string]func(RenderableList) []Renderable{"ByScore": ByScore, "ByDate": ByDate} {
+		t.Run(name, func(t *testing.T) {
+			first := sortFn(list)
+			for i := 1; i < len(first); i++ {
+				if !hashLess(first[i-1].ID(), first[i].ID()) {
+					t.Errorf("The items with the same score and date should be ordered by hash")
+				}
+			}
+			for n := 0; n < 20; n++ {
+				got := sortFn(list)
+				for i := range got {
+					if got[i].ID() != first[i].ID() {
+						t.Fatalf("Invalid order at %d after %d sorts: %s, expected %s", i, n, got[i].ID(), first[i].ID())
+					}
+				}
+			}
+		})
+	}
+}
+
+func Test_SortEditedItem(t *testing.T) {
+	now := time.Now().UTC()
+	older := &Item{Hash: HashFromString(testObjectHash), SubmittedAt: now.Add(-2 * time.Hour), UpdatedAt: now.Add(-2 * time.Hour)}
+	newer := &Item{Hash: HashFromString(testLikeHash), SubmittedAt: now.Add(-time.Hour), UpdatedAt: now.Add(-time.Hour)}
+	list := RenderableList{older.Hash: older, newer.Hash: newer}
+
+	// NOTE(marius): the older item gets edited after the newer one was published
+	older.UpdatedAt = now
+	if got := ByDate(list); got[0].ID() != newer.Hash {
+		t.Errorf("The edited item should keep its place in the \"new\" listing, received %s first", got[0].ID())
+	}
+	if got := ByUpdated(list); got[0].ID() != older.Hash {
+		t.Errorf("The edited item should be first in the \"active\" listing, received %s first", got[0].ID())
+	}
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi"
+)
+
+// maxDismissedItems is the number of items an account can dismiss, the oldest dismissals are dropped after it
+const maxDismissedItems = 1000
+
+// The dismissals hide items from the listings of the account that dismissed them.
+// Unlike the blocks, they don't hide anything else from the author, and unlike the thread mutes they are about the
+// item itself, not its replies. The dismissals are saved in the account preferences, they are not federated.
+
+// isDismissed returns true if the account dismissed the item
+func isDismissed(acc *Account, it Hash) bool {
+	return accountPreferences(acc).DismissedItems.Contains(it)
+}
+
+// DismissItem hides the item from the listings of the viewer
+func (r *repository) DismissItem(ctx context.Context, viewer *Account, it Hash) error {
+	if !it.IsValid() {
+		return errors.NotValidf("invalid item %s", it)
+	}
+	return r.SavePreferences(ctx, viewer, func(p *AccountPreferences) {
+		p.DismissedItems = appendBounded(p.DismissedItems, it, maxDismissedItems)
+	})
+}
+
+// UndismissItem shows the item in the listings of the viewer again
+func (r *repository) UndismissItem(ctx context.Context, viewer *Account, it Hash) error {
+	return r.SavePreferences(ctx, viewer, func(p *AccountPreferences) {
+		p.DismissedItems = removeHash(p.DismissedItems, it)
+	})
+}
+
+// filterDismissed removes the items dismissed by the logged account from the loaded listing
+func (r *repository) filterDismissed(acc *Account, list RenderableList) {
+	dismissed := accountPreferences(acc).DismissedItems
+	if !acc.IsLogged() || len(dismissed) == 0 {
+		return
+	}
+	for k, r := range list {
+		if i, ok := r.(*Item); ok && dismissed.Contains(i.Hash) {
+			delete(list, k)
+		}
+	}
+}
+
+// HandleDismissItem dismisses, or un-dismisses, the current item for the logged account,
+// and returns to the listing it was dismissed from
+func (h *handler) HandleDismissItem(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	ctx := context.TODO()
+	p, err := h.storage.LoadItem(ctx, h.storage.ItemIRI(chi.URLParam(r, "hash")))
+	if err != nil {
+		h.errFn()("Error: %s", err)
+		h.v.HandleErrors(w, r, errors.NewNotFound(err, "not found"))
+		return
+	}
+	url := ItemPermaLink(&p)
+	if path.Base(r.URL.Path) == "undismiss" {
+		err = h.storage.UndismissItem(ctx, acc, p.Hash)
+	} else {
+		err = h.storage.DismissItem(ctx, acc, p.Hash)
+		if backUrl := r.Header.Get("Referer"); !strings.Contains(backUrl, url) && strings.Contains(backUrl, Instance.BaseURL) {
+			url = backUrl
+		}
+	}
+	if err != nil {
+		h.v.addFlashMessage(Error, w, r, "Unable to update the dismissed items")
+	} else if path.Base(r.URL.Path) != "undismiss" {
+		h.v.addFlashMessage(Success, w, r, fmt.Sprintf("The item was dismissed, you can bring it back from %s/undismiss", ItemPermaLink(&p)))
+	}
+	h.v.Redirect(w, r, url, http.StatusFound)
+}
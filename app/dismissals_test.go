@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_repository_DismissItem(t *testing.T) {
+	f := newAccountFedbox()
+	defer f.Close()
+	r := testRepository(f.Server)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(f.URL), Type: pub.ServiceType}
+
+	viewer := testVote(f.Server, 1).SubmittedBy
+	other := Account{Hash: HashFromString("7d1c2b3a-4e5f-4a6b-8c7d-9e0f1a2b3c4d"), Handle: "janedoe"}
+	dismissed := HashFromString(testObjectHash)
+	kept := HashFromString(testLikeHash)
+	listing := func() RenderableList {
+		return RenderableList{
+			dismissed: &Item{Hash: dismissed, SubmittedBy: &other},
+			kept:      &Item{Hash: kept, SubmittedBy: &other},
+		}
+	}
+
+	if err := r.DismissItem(context.Background(), viewer, dismissed); err != nil {
+		t.Fatalf("Unable to dismiss the item: %s", err)
+	}
+	anonymous := AnonymousAccount
+	if err := r.DismissItem(context.Background(), &anonymous, dismissed); err == nil {
+		t.Errorf("Anonymous visitors should not be able to dismiss items")
+	}
+
+	// NOTE(marius): the dismissals are saved with the account, the next requests load them from the actor
+	stored := f.storedAccount(t, r)
+	list := listing()
+	r.filterDismissed(stored, list)
+	if _, ok := list[dismissed]; ok {
+		t.Errorf("The dismissed item should be absent for the account that dismissed it")
+	}
+	if _, ok := list[kept]; !ok {
+		t.Errorf("The other items should be present for the account that dismissed the item")
+	}
+	for _, acc := range []*Account{&other, &AnonymousAccount} {
+		list = listing()
+		r.filterDismissed(acc, list)
+		if len(list) != 2 {
+			t.Errorf("The dismissed item should be present for %s", acc.Handle)
+		}
+	}
+
+	if err := r.UndismissItem(context.Background(), stored, dismissed); err != nil {
+		t.Fatalf("Unable to undismiss the item: %s", err)
+	}
+	list = listing()
+	r.filterDismissed(f.storedAccount(t, r), list)
+	if len(list) != 2 {
+		t.Errorf("The undismissed item should be present again")
+	}
+}
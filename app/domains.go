@@ -0,0 +1,25 @@
+package app
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// displayDomain returns the domain of the link we show next to its submission: the host name without the port
+// and the www. prefix, with the internationalized domain names in their unicode form
+func displayDomain(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if len(host) == 0 {
+		return ""
+	}
+	if uni, err := idna.Display.ToUnicode(host); err == nil {
+		host = uni
+	}
+	return strings.TrimPrefix(host, "www.")
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_displayDomain(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "https://www.example.com/article", want: "example.com"},
+		{url: "https://Example.COM:8443/article", want: "example.com"},
+		{url: "https://xn--mnchen-3ya.de/", want: "münchen.de"},
+		{url: "https://www.xn--bcher-kva.example/list", want: "bücher.example"},
+		{url: "not a link", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := displayDomain(tt.url); got != tt.want {
+				t.Errorf("displayDomain() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Item_FromActivityPubLinkDomain(t *testing.T) {
+	ob := &pub.Object{
+		ID:   "https://littr.example/objects/6435b2b5-26df-434c-87ca-58ddab49fcc8",
+		Type: pub.PageType,
+		Name: pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content("Bücher")}},
+		URL:  pub.IRI("https://xn--bcher-kva.example/list"),
+	}
+	it := Item{}
+	if err := it.FromActivityPub(ob); err != nil {
+		t.Fatalf("Unable to load the item: %s", err)
+	}
+	if !it.IsLink() {
+		t.Fatalf("The item should be loaded as a link, received %s", it.MimeType)
+	}
+	if it.Metadata.Domain != "bücher.example" {
+		t.Errorf("Invalid domain %q, expected the unicode form %q", it.Metadata.Domain, "bücher.example")
+	}
+	if got := string(GetDomainTitle(it)); got != "bücher.example" {
+		t.Errorf("Invalid rendered domain %q, expected %q", got, "bücher.example")
+	}
+}
@@ -0,0 +1,138 @@
+package app
+
+import (
+	"fmt"
+	ht "html"
+	"regexp"
+	"strings"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+// EmojiType is the type of the custom emoji tags, as used by Mastodon and the other fediverse servers
+const EmojiType pub.ActivityVocabularyType = "Emoji"
+
+const TagEmoji = "emoji"
+
+// unicodeEmoji maps the common shortcodes to their unicode emoji
+var unicodeEmoji = map[string]string{
+	"smile":          "\U0001F604",
+	"smiley":         "\U0001F603",
+	"grin":           "\U0001F601",
+	"laughing":       "\U0001F606",
+	"joy":            "\U0001F602",
+	"wink":           "\U0001F609",
+	"blush":          "\U0001F60A",
+	"heart_eyes":     "\U0001F60D",
+	"thinking":       "\U0001F914",
+	"neutral_face":   "\U0001F610",
+	"unamused":       "\U0001F612",
+	"confused":       "\U0001F615",
+	"cry":            "\U0001F622",
+	"sob":            "\U0001F62D",
+	"angry":          "\U0001F620",
+	"scream":         "\U0001F631",
+	"sunglasses":     "\U0001F60E",
+	"eyes":           "\U0001F440",
+	"heart":          "❤️",
+	"broken_heart":   "\U0001F494",
+	"+1":             "\U0001F44D",
+	"thumbsup":       "\U0001F44D",
+	"-1":             "\U0001F44E",
+	"thumbsdown":     "\U0001F44E",
+	"ok_hand":        "\U0001F44C",
+	"clap":           "\U0001F44F",
+	"wave":           "\U0001F44B",
+	"pray":           "\U0001F64F",
+	"muscle":         "\U0001F4AA",
+	"tada":           "\U0001F389",
+	"fire":           "\U0001F525",
+	"rocket":         "\U0001F680",
+	"star":           "⭐",
+	"sparkles":       "✨",
+	"100":            "\U0001F4AF",
+	"warning":        "⚠️",
+	"check":          "✔️",
+	"x":              "❌",
+	"question":       "❓",
+	"bulb":           "\U0001F4A1",
+	"coffee":         "☕",
+	"beer":           "\U0001F37A",
+	"shrug":          "\U0001F937",
+	"facepalm":       "\U0001F926",
+	"see_no_evil":    "\U0001F648",
+	"rofl":           "\U0001F923",
+	"slightly_smile": "\U0001F642",
+}
+
+// itemByType decodes the Emoji tags as plain objects, as the ActivityStreams vocabulary doesn't know about them
+func itemByType(typ pub.ActivityVocabularyType) (pub.Item, error) {
+	if typ == EmojiType {
+		return &pub.Object{Type: typ}, nil
+	}
+	return pub.GetItemByType(typ)
+}
+
+var shortcodeRegexp = regexp.MustCompile(`:([a-zA-Z0-9_+-]{1,64}):`)
+
+// loadEmoji returns the custom emoji of the instance used in data
+func loadEmoji(data string) TagCollection {
+	if instanceEmoji == nil || !strings.Contains(data, ":") {
+		return nil
+	}
+	emoji := make(TagCollection, 0)
+	for _, sub := range shortcodeRegexp.FindAllStringSubmatch(data, -1) {
+		if e, ok := instanceEmoji.tag(sub[1]); ok && !emoji.Contains(e) {
+			emoji = append(emoji, e)
+		}
+	}
+	if len(emoji) == 0 {
+		return nil
+	}
+	return emoji
+}
+
+// emojiObject returns the ActivityPub Emoji tag for the custom emoji
+func emojiObject(t Tag) *pub.Object {
+	e := &pub.Object{
+		Type: EmojiType,
+		Name: pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content(t.Name)}},
+	}
+	icon := &pub.Object{Type: pub.ImageType, URL: pub.IRI(t.URL)}
+	if t.Metadata != nil {
+		if len(t.Metadata.ID) > 0 {
+			e.ID = pub.IRI(t.Metadata.ID)
+		}
+		icon.MediaType = pub.MimeType(t.Metadata.Icon.MimeType)
+	}
+	e.Icon = icon
+	return e
+}
+
+func emojiSrc(t Tag) string {
+	if t.Metadata != nil && len(t.Metadata.Icon.URI) > 0 {
+		return t.Metadata.Icon.URI
+	}
+	return t.URL
+}
+
+// replaceEmoji expands the :shortcode: emoji in data to the custom emoji images or to the unicode emoji
+func replaceEmoji(data []byte, custom TagCollection) []byte {
+	if !strings.Contains(string(data), ":") {
+		return data
+	}
+	return shortcodeRegexp.ReplaceAllFunc(data, func(m []byte) []byte {
+		code := string(m)
+		for _, t := range custom {
+			if t.Name == code || t.Name == strings.Trim(code, ":") {
+				if src := emojiSrc(t); len(src) > 0 {
+					return []byte(fmt.Sprintf(`<img class="emoji" src="%s" alt="%s" title="%s"/>`, ht.EscapeString(src), code, code))
+				}
+			}
+		}
+		if e, ok := unicodeEmoji[strings.Trim(code, ":")]; ok {
+			return []byte(e)
+		}
+		return m
+	})
+}
@@ -0,0 +1,168 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+func Test_Emoji_RoundTrip(t *testing.T) {
+	Instance.Conf = &config.Configuration{HostName: "littr.example", APIURL: "https://fedbox.example"}
+	dir, err := ioutil.TempDir("", "emoji")
+	if err != nil {
+		t.Fatalf("unable to create the emoji directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "littr.png"), []byte("\x89PNG"), 0600); err != nil {
+		t.Fatalf("unable to write the emoji: %s", err)
+	}
+	defer func(e *emojiStore) {
+		instanceEmoji = e
+	}(instanceEmoji)
+	if instanceEmoji, err = newEmojiStore(dir, "https://littr.example", 0); err != nil {
+		t.Fatalf("unable to load the custom emoji: %s", err)
+	}
+	// NOTE(marius): this is what ActivityPubService does
+	pub.ItemTyperFunc = itemByType
+
+	item := Item{
+		Hash:     HashFromString(testLikeHash),
+		MimeType: MimeTypeMarkdown,
+		Data:     "hello :smile: from :littr:",
+		Metadata: &ItemMetadata{ID: "https://fedbox.example/objects/" + testLikeHash},
+	}
+	item.Metadata.Emoji = loadEmoji(item.Data)
+	if len(item.Metadata.Emoji) != 1 {
+		t.Fatalf("Expected the custom emoji to be found, received %v", item.Metadata.Emoji)
+	}
+
+	o := new(pub.Object)
+	if err := loadAPItem(o, item); err != nil {
+		t.Fatalf("unable to convert item: %s", err)
+	}
+	raw, err := json.Marshal(o)
+	if err != nil {
+		t.Fatalf("unable to marshal object: %s", err)
+	}
+	if !strings.Contains(string(raw), `"type":"Emoji"`) || !strings.Contains(string(raw), "https://littr.example/emoji/littr.png") {
+		t.Errorf("The custom emoji should federate as an Emoji tag: %s", raw)
+	}
+	it, err := pub.UnmarshalJSON(raw)
+	if err != nil {
+		t.Fatalf("unable to unmarshal object: %s", err)
+	}
+	loaded := Item{}
+	if err := loaded.FromActivityPub(it); err != nil {
+		t.Fatalf("unable to load item: %s", err)
+	}
+	if len(loaded.Metadata.Tags) > 0 {
+		t.Errorf("The emoji should not be loaded as a tag: %v", loaded.Metadata.Tags)
+	}
+
+	// NOTE(marius): a remote instance doesn't have our custom emoji, they come only from the tags
+	instanceEmoji = nil
+	got := replaceTags(MimeTypeMarkdown, loaded)
+	if !strings.Contains(got, unicodeEmoji["smile"]) {
+		t.Errorf("replaceTags() = %q, the unicode emoji was not expanded", got)
+	}
+	if !strings.Contains(got, `<img class="emoji" src="https://littr.example/emoji/littr.png" alt=":littr:"`) {
+		t.Errorf("replaceTags() = %q, the custom emoji was not expanded", got)
+	}
+}
+
+func Test_handler_HandleAddEmoji(t *testing.T) {
+	Instance.Conf = &config.Configuration{HostName: "littr.example", Moderators: []string{"mod"}}
+	dir, err := ioutil.TempDir("", "emoji")
+	if err != nil {
+		t.Fatalf("unable to create the emoji directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(e *emojiStore) {
+		instanceEmoji = e
+	}(instanceEmoji)
+	if instanceEmoji, err = newEmojiStore(dir, "https://littr.example", 64); err != nil {
+		t.Fatalf("unable to load the custom emoji: %s", err)
+	}
+
+	h := handler{infoFn: defaultCtxLogFn, errFn: defaultCtxLogFn}
+	mod := &Account{Hash: HashFromString(testActorHash), Handle: "mod"}
+	user := &Account{Hash: HashFromString(testActorHash), Handle: "johndoe"}
+	png := []byte("\x89PNG\r\n\x1a\n")
+
+	upload := func(acc *Account, code string, image []byte) *httptest.ResponseRecorder {
+		body := new(bytes.Buffer)
+		mw := multipart.NewWriter(body)
+		mw.WriteField("shortcode", code)
+		mw.WriteField("category", "blobs")
+		fw, _ := mw.CreateFormFile("image", code+".png")
+		fw.Write(image)
+		mw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/emojis", body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req = req.WithContext(context.WithValue(req.Context(), LoggedAccountCtxtKey, acc))
+		w := httptest.NewRecorder()
+		h.HandleAddEmoji(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name   string
+		acc    *Account
+		code   string
+		image  []byte
+		status int
+	}{
+		{name: "moderator", acc: mod, code: "blob", image: png, status: http.StatusCreated},
+		{name: "duplicate shortcode", acc: mod, code: ":blob:", image: png, status: http.StatusBadRequest},
+		{name: "not a moderator", acc: user, code: "other", image: png, status: http.StatusForbidden},
+		{name: "invalid shortcode", acc: mod, code: "not valid", image: png, status: http.StatusBadRequest},
+		{name: "too large", acc: mod, code: "large", image: append(png, bytes.Repeat([]byte{0}, 64)...), status: http.StatusBadRequest},
+		{name: "not an image", acc: mod, code: "text", image: []byte("hello"), status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := upload(tt.acc, tt.code, tt.image); w.Code != tt.status {
+				t.Errorf("Invalid status %d, expected %d: %s", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+
+	emoji := loadEmoji("hello :blob: and :large:")
+	if len(emoji) != 1 || emoji[0].URL != "https://littr.example/emoji/blob.png" {
+		t.Fatalf("Expected the uploaded emoji to be resolved, received %v", emoji)
+	}
+	if got := string(replaceEmoji([]byte("hello :blob:"), emoji)); !strings.Contains(got, `src="https://littr.example/emoji/blob.png"`) {
+		t.Errorf("replaceEmoji() = %q, the uploaded emoji was not expanded", got)
+	}
+
+	w := httptest.NewRecorder()
+	h.HandleListEmoji(w, httptest.NewRequest(http.MethodGet, "/emojis", nil))
+	list := make([]CustomEmoji, 0)
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("invalid emoji collection: %s", err)
+	}
+	if len(list) != 1 || list[0].Shortcode != "blob" || list[0].Category != "blobs" {
+		t.Errorf("Expected the uploaded emoji in the collection, received %v", list)
+	}
+
+	// NOTE(marius): the uploaded emoji need to survive a restart
+	stored, err := newEmojiStore(dir, "https://littr.example", 64)
+	if err != nil {
+		t.Fatalf("unable to reload the custom emoji: %s", err)
+	}
+	if e, ok := stored.tag("blob"); !ok || e.Name != ":blob:" {
+		t.Errorf("Expected the uploaded emoji to be stored, received %v", e)
+	}
+}
@@ -0,0 +1,328 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// DefaultEmojiMaxSize is the maximum size of a custom emoji image, in bytes
+const DefaultEmojiMaxSize = 256 * 1024
+
+const emojiIndexFile = "emoji.json"
+
+// emojiImageTypes are the image types accepted for custom emoji, with their file extensions
+var emojiImageTypes = map[string]string{
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// CustomEmoji is a custom emoji of the instance
+type CustomEmoji struct {
+	Shortcode string `json:"shortcode"`
+	URL       string `json:"url"`
+	MimeType  string `json:"mediaType"`
+	Category  string `json:"category,omitempty"`
+	file      string
+}
+
+type customEmojiIndex struct {
+	Shortcode string `json:"shortcode"`
+	File      string `json:"file"`
+	MimeType  string `json:"mediaType"`
+	Category  string `json:"category,omitempty"`
+}
+
+// emojiStore keeps the custom emoji images in a directory, together with an index of their shortcodes and categories.
+// The images in the directory that are missing from the index are loaded using their file names as shortcodes.
+type emojiStore struct {
+	path    string
+	baseURL string
+	maxSize int64
+	m       sync.RWMutex
+	emoji   map[string]CustomEmoji
+}
+
+// instanceEmoji are the custom emoji of the instance, loaded by Init from the CUSTOM_EMOJI_PATH directory
+var instanceEmoji *emojiStore
+
+func newEmojiStore(path, baseURL string, maxSize int64) (*emojiStore, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultEmojiMaxSize
+	}
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, errors.Annotatef(err, "unable to create the custom emoji storage")
+	}
+	s := &emojiStore{
+		path:    path,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		maxSize: maxSize,
+		emoji:   make(map[string]CustomEmoji),
+	}
+	if dat, err := ioutil.ReadFile(filepath.Join(path, emojiIndexFile)); err == nil {
+		index := make([]customEmojiIndex, 0)
+		if err := json.Unmarshal(dat, &index); err != nil {
+			return nil, errors.Annotatef(err, "invalid custom emoji index")
+		}
+		for _, e := range index {
+			s.emoji[e.Shortcode] = s.customEmoji(e.Shortcode, e.File, e.MimeType, e.Category)
+		}
+	}
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to load the custom emoji")
+	}
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		typ := mime.TypeByExtension(ext)
+		code := strings.TrimSuffix(f.Name(), ext)
+		if f.IsDir() || !strings.HasPrefix(typ, "image/") || !validShortcode(code) {
+			continue
+		}
+		if _, ok := s.emoji[code]; !ok {
+			s.emoji[code] = s.customEmoji(code, f.Name(), typ, "")
+		}
+	}
+	return s, nil
+}
+
+func validShortcode(code string) bool {
+	return shortcodeRegexp.MatchString(":" + code + ":")
+}
+
+func (s *emojiStore) customEmoji(code, file, typ, category string) CustomEmoji {
+	return CustomEmoji{
+		Shortcode: code,
+		URL:       fmt.Sprintf("%s/emoji/%s", s.baseURL, file),
+		MimeType:  typ,
+		Category:  category,
+		file:      file,
+	}
+}
+
+// tag returns the custom emoji with the code shortcode as a Tag
+func (s *emojiStore) tag(code string) (Tag, bool) {
+	if s == nil {
+		return Tag{}, false
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	e, ok := s.emoji[code]
+	if !ok {
+		return Tag{}, false
+	}
+	return Tag{
+		Type:     TagEmoji,
+		Name:     ":" + e.Shortcode + ":",
+		URL:      e.URL,
+		Metadata: &ItemMetadata{ID: e.URL, Icon: ImageMetadata{URI: e.URL, MimeType: e.MimeType}},
+	}, true
+}
+
+// list returns the custom emoji ordered by category and shortcode
+func (s *emojiStore) list() []CustomEmoji {
+	result := make([]CustomEmoji, 0)
+	if s == nil {
+		return result
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	for _, e := range s.emoji {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Category == result[j].Category {
+			return result[i].Shortcode < result[j].Shortcode
+		}
+		return result[i].Category < result[j].Category
+	})
+	return result
+}
+
+// add stores a new custom emoji, the shortcodes are unique
+func (s *emojiStore) add(code, category string, data []byte) (CustomEmoji, error) {
+	if s == nil {
+		return CustomEmoji{}, errors.NotImplementedf("custom emoji are disabled")
+	}
+	if !validShortcode(code) {
+		return CustomEmoji{}, errors.BadRequestf("invalid shortcode %q", code)
+	}
+	if int64(len(data)) > s.maxSize {
+		return CustomEmoji{}, errors.BadRequestf("the emoji image is larger than %d bytes", s.maxSize)
+	}
+	typ := http.DetectContentType(data)
+	ext, ok := emojiImageTypes[typ]
+	if !ok {
+		return CustomEmoji{}, errors.BadRequestf("invalid emoji image type %s", typ)
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	if _, exists := s.emoji[code]; exists {
+		return CustomEmoji{}, errors.BadRequestf("the %q shortcode is already used", code)
+	}
+	e := s.customEmoji(code, code+ext, typ, category)
+	if err := ioutil.WriteFile(filepath.Join(s.path, e.file), data, 0600); err != nil {
+		return CustomEmoji{}, errors.Annotatef(err, "unable to save the emoji image")
+	}
+	s.emoji[code] = e
+	if err := s.saveIndex(); err != nil {
+		delete(s.emoji, code)
+		os.Remove(filepath.Join(s.path, e.file))
+		return CustomEmoji{}, err
+	}
+	return e, nil
+}
+
+// remove deletes the custom emoji with the code shortcode
+func (s *emojiStore) remove(code string) error {
+	if s == nil {
+		return errors.NotImplementedf("custom emoji are disabled")
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	e, ok := s.emoji[code]
+	if !ok {
+		return errors.NotFoundf("emoji %q", code)
+	}
+	delete(s.emoji, code)
+	if err := s.saveIndex(); err != nil {
+		s.emoji[code] = e
+		return err
+	}
+	if err := os.Remove(filepath.Join(s.path, e.file)); err != nil && !os.IsNotExist(err) {
+		return errors.Annotatef(err, "unable to remove the emoji image")
+	}
+	return nil
+}
+
+// saveIndex writes the index of the emoji, it needs to be called with the lock held
+func (s *emojiStore) saveIndex() error {
+	index := make([]customEmojiIndex, 0, len(s.emoji))
+	for _, e := range s.emoji {
+		index = append(index, customEmojiIndex{Shortcode: e.Shortcode, File: e.file, MimeType: e.MimeType, Category: e.Category})
+	}
+	sort.Slice(index, func(i, j int) bool { return index[i].Shortcode < index[j].Shortcode })
+	dat, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(s.path, emojiIndexFile), dat, 0600); err != nil {
+		return errors.Annotatef(err, "unable to save the custom emoji index")
+	}
+	return nil
+}
+
+// file returns the path of the image of the emoji served at the /emoji/{file} path
+func (s *emojiStore) file(name string) (string, bool) {
+	if s == nil || filepath.Base(name) != name {
+		return "", false
+	}
+	s.m.RLock()
+	defer s.m.RUnlock()
+	e, ok := s.emoji[strings.TrimSuffix(name, filepath.Ext(name))]
+	if !ok || e.file != name {
+		return "", false
+	}
+	return filepath.Join(s.path, e.file), true
+}
+
+// HandleEmoji serves the custom emoji images of the instance
+func (h *handler) HandleEmoji(w http.ResponseWriter, r *http.Request) {
+	file := chi.URLParam(r, "file")
+	path, ok := instanceEmoji.file(file)
+	if !ok {
+		h.v.HandleErrors(w, r, errors.NotFoundf("emoji %q", file))
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=604800")
+	http.ServeFile(w, r, path)
+}
+
+// HandleListEmoji serves the /emojis collection of the custom emoji of the instance
+func (h *handler) HandleListEmoji(w http.ResponseWriter, r *http.Request) {
+	dat, _ := json.Marshal(instanceEmoji.list())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dat)
+}
+
+// writeJSONError writes the err as a JSON document, for the API clients that can't follow our error pages
+func writeJSONError(w http.ResponseWriter, err error) {
+	status := httpErrorResponse(err)
+	dat, _ := json.Marshal(map[string]string{"error": err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(dat)
+}
+
+// HandleAddEmoji serves the moderators' POST /emojis requests, which upload a custom emoji
+// as a multipart form with the shortcode, category and image fields
+func (h *handler) HandleAddEmoji(w http.ResponseWriter, r *http.Request) {
+	if !loggedAccount(r).IsModerator() {
+		writeJSONError(w, errors.Forbiddenf("only moderators can add custom emoji"))
+		return
+	}
+	max := int64(DefaultEmojiMaxSize)
+	if instanceEmoji != nil {
+		max = instanceEmoji.maxSize
+	}
+	// NOTE(marius): we leave some room for the other form fields, the image size is checked by the store
+	r.Body = http.MaxBytesReader(w, r.Body, max+4096)
+	if err := r.ParseMultipartForm(max); err != nil {
+		writeJSONError(w, errors.BadRequestf("invalid emoji upload: %s", err))
+		return
+	}
+	f, _, err := r.FormFile("image")
+	if err != nil {
+		writeJSONError(w, errors.BadRequestf("missing emoji image"))
+		return
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		writeJSONError(w, errors.BadRequestf("unable to read the emoji image"))
+		return
+	}
+	code := strings.Trim(r.FormValue("shortcode"), ":")
+	e, err := instanceEmoji.add(code, strings.TrimSpace(r.FormValue("category")), data)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	h.infoFn(log.Ctx{"shortcode": e.Shortcode, "by": loggedAccount(r).Handle})("added custom emoji")
+	dat, _ := json.Marshal(e)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(dat)
+}
+
+// HandleRemoveEmoji serves the moderators' DELETE /emojis/{shortcode} requests
+func (h *handler) HandleRemoveEmoji(w http.ResponseWriter, r *http.Request) {
+	if !loggedAccount(r).IsModerator() {
+		writeJSONError(w, errors.Forbiddenf("only moderators can remove custom emoji"))
+		return
+	}
+	code := chi.URLParam(r, "shortcode")
+	if err := instanceEmoji.remove(code); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	h.infoFn(log.Ctx{"shortcode": code, "by": loggedAccount(r).Handle})("removed custom emoji")
+	w.WriteHeader(http.StatusNoContent)
+}
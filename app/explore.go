@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+const exploreCachePrefix = "explore:"
+
+// exploreItem is an item of the explore feed, with the number of followed accounts that liked it
+type exploreItem struct {
+	item  Item
+	likes int
+}
+
+// likedBy returns, for every object liked by the accounts, the hashes of the accounts that liked it
+func (r *repository) likedBy(ctx context.Context, accounts ...Account) map[Hash]Hashes {
+	liked := make(map[Hash]Hashes)
+	f := &Filters{MaxItems: MaxPageSize}
+	for _, acc := range accounts {
+		if !acc.HasMetadata() || len(acc.Metadata.LikedIRI) == 0 {
+			continue
+		}
+		col, err := r.fedbox.Collection(ctx, pub.IRI(acc.Metadata.LikedIRI), Values(f))
+		if err != nil {
+			r.errFn(log.Ctx{"account": acc.Handle})(err.Error())
+			continue
+		}
+		if col == nil {
+			continue
+		}
+		for _, it := range col.Collection() {
+			iri := it.GetLink()
+			if pub.ActivityTypes.Contains(it.GetType()) {
+				pub.OnActivity(it, func(a *pub.Activity) error {
+					if a.Object != nil {
+						iri = a.Object.GetLink()
+					}
+					return nil
+				})
+			}
+			h := HashFromIRI(iri)
+			if !h.IsValid() || liked[h].Contains(acc.Hash) {
+				continue
+			}
+			liked[h] = append(liked[h], acc.Hash)
+		}
+	}
+	return liked
+}
+
+// LoadExplore returns the items liked by the accounts the viewer follows, the ones liked by more of them first.
+// The items the viewer authored, voted on, or dismissed are left out. The feed is cached for every viewer.
+func (r *repository) LoadExplore(ctx context.Context, viewer Account) (ItemCollection, error) {
+	if !viewer.IsLogged() {
+		return nil, errors.Unauthorizedf("invalid account %s", viewer.Handle)
+	}
+	key := exploreCachePrefix + viewer.Hash.String()
+	if r.explore != nil {
+		if items, ok := r.explore.load(key); ok {
+			// NOTE(marius): the listings modify the items, so every request gets its own copy
+			return append(ItemCollection{}, items.(ItemCollection)...), nil
+		}
+	}
+	if len(viewer.Following) == 0 {
+		if err := r.loadAccountsFollowing(ctx, &viewer); err != nil {
+			return nil, errors.Annotatef(err, "unable to load the followed accounts")
+		}
+	}
+	liked := r.likedBy(ctx, viewer.Following...)
+	result := make(ItemCollection, 0)
+	if len(liked) == 0 {
+		return result, nil
+	}
+	hashes := make(CompStrs, 0, len(liked))
+	for h := range liked {
+		hashes = append(hashes, LikeString(h.String()))
+	}
+	items, err := r.objects(ctx, &Filters{IRI: hashes, MaxItems: len(hashes)})
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to load the liked items")
+	}
+	votes, err := r.CurrentAccountVotes(ctx, viewer, items...)
+	if err != nil {
+		r.errFn(log.Ctx{"account": viewer.Handle})(err.Error())
+	}
+
+	explore := make([]exploreItem, 0, len(items))
+	for _, it := range items {
+		if it.Deleted() || (it.SubmittedBy != nil && it.SubmittedBy.Hash == viewer.Hash) {
+			continue
+		}
+		if _, voted := votes[it.Hash]; voted || isDismissed(&viewer, it.Hash) {
+			continue
+		}
+		explore = append(explore, exploreItem{item: it, likes: len(liked[it.Hash])})
+	}
+	sort.SliceStable(explore, func(i, j int) bool {
+		if explore[i].likes != explore[j].likes {
+			return explore[i].likes > explore[j].likes
+		}
+		if !explore[i].item.SubmittedAt.Equal(explore[j].item.SubmittedAt) {
+			return explore[i].item.SubmittedAt.After(explore[j].item.SubmittedAt)
+		}
+		return hashLess(explore[i].item.Hash, explore[j].item.Hash)
+	})
+	for _, e := range explore {
+		result = append(result, e.item)
+	}
+	if r.explore != nil {
+		r.explore.save(key, result)
+	}
+	return result, nil
+}
+
+// ByRank returns a sort function that keeps the order of the ranked hashes
+func ByRank(ranked Hashes) func(RenderableList) []Renderable {
+	return func(r RenderableList) []Renderable {
+		rl := make([]Renderable, 0, len(r))
+		for _, h := range ranked {
+			if it, ok := r[h]; ok {
+				rl = append(rl, it)
+			}
+		}
+		return rl
+	}
+}
+
+// LoadExploreMw loads the explore feed of the logged account in the cursor for the listing
+func LoadExploreMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		repo := ContextRepository(r.Context())
+		items, err := repo.LoadExplore(r.Context(), *loggedAccount(r))
+		if err != nil {
+			ctxtErr(next, w, r, errors.Annotatef(err, "unable to load the explore feed"))
+			return
+		}
+		c := &Cursor{
+			items: make(RenderableList),
+			total: uint(len(items)),
+		}
+		ranked := make(Hashes, 0, len(items))
+		for k := range items {
+			c.items.Append(&items[k])
+			ranked = append(ranked, items[k].Hash)
+		}
+		if m := ContextListingModel(r.Context()); m != nil {
+			m.Title = "Explore"
+			m.ShowText = true
+			m.sortFn = ByRank(ranked)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), CursorCtxtKey, c)))
+	})
+}
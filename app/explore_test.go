@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_repository_LoadExploreRanksByFollowsLikes(t *testing.T) {
+	const (
+		viewerHash = "4d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c00"
+		aliceHash  = "4d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01"
+		bobHash    = "4d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c02"
+		twiceHash  = "4d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c03"
+		onceHash   = "4d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c04"
+	)
+	var srv *httptest.Server
+	person := func(hash, handle string) string {
+		return fmt.Sprintf(`{"id":"%s/actors/%s","type":"Person","preferredUsername":"%s","liked":"%s/actors/%s/liked"}`, srv.URL, hash, handle, srv.URL, hash)
+	}
+	object := func(hash, published string) string {
+		return fmt.Sprintf(`{"id":"%s/objects/%s","type":"Article","name":"%s","published":"%s"}`, srv.URL, hash, hash, published)
+	}
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/actors/" + viewerHash + "/following":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[%s,%s]}`, person(aliceHash, "alice"), person(bobHash, "bob")))
+		case "/actors/" + aliceHash + "/liked":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":["%s/objects/%s","%s/objects/%s"]}`, srv.URL, onceHash, srv.URL, twiceHash))
+		case "/actors/" + bobHash + "/liked":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":["%s/objects/%s"]}`, srv.URL, twiceHash))
+		case "/objects":
+			// NOTE(marius): the item liked once is the newer one, so it's first when ordered by date
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[%s,%s]}`,
+				object(onceHash, "2021-06-02T00:00:00Z"), object(twiceHash, "2021-06-01T00:00:00Z")))
+		default:
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+		}
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.explore = newMemCache(time.Minute, 0)
+	viewer := Account{
+		Hash:   HashFromString(viewerHash),
+		Handle: "viewer",
+		Metadata: &AccountMetadata{
+			ID:           srv.URL + "/actors/" + viewerHash,
+			FollowingIRI: srv.URL + "/actors/" + viewerHash + "/following",
+		},
+	}
+
+	items, err := r.LoadExplore(context.Background(), viewer)
+	if err != nil {
+		t.Fatalf("Unable to load the explore feed: %s", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items in the explore feed, received %d", len(items))
+	}
+	if items[0].Hash != HashFromString(twiceHash) || items[1].Hash != HashFromString(onceHash) {
+		t.Errorf("Expected the item liked by two follows before the one liked by one, received %s, %s", items[0].Hash, items[1].Hash)
+	}
+	if _, ok := r.explore.load(exploreCachePrefix + viewer.Hash.String()); !ok {
+		t.Errorf("The explore feed should be cached for the viewer")
+	}
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+)
+
+// DefaultMaxFeaturedTags is the number of tags an account can feature on its profile, if not configured
+const DefaultMaxFeaturedTags = 5
+
+// featuredTagsName is the name of the collection, in the actor's streams, with the tags it features on its profile
+const featuredTagsName = "featuredTags"
+
+var featuredTagRegexp = regexp.MustCompile(`^\w[\w-]+$`)
+
+// normaliseFeaturedTags returns the tag names without their leading #, and without the duplicates
+func normaliseFeaturedTags(tags []string, max int) ([]string, error) {
+	result := make([]string, 0)
+	for _, t := range tags {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "#")
+		if len(t) == 0 {
+			continue
+		}
+		if !featuredTagRegexp.MatchString(t) {
+			return nil, errors.NotValidf("invalid tag %q", t)
+		}
+		dup := false
+		for _, ex := range result {
+			if strings.EqualFold(ex, t) {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			result = append(result, t)
+		}
+	}
+	if max > 0 && len(result) > max {
+		return nil, errors.NotValidf("an account can not feature more than %d tags", max)
+	}
+	return result, nil
+}
+
+// featuredTagURL returns the URL of the listing of the account's items with the tag
+func featuredTagURL(acc Account, tag string) string {
+	return fmt.Sprintf("%s/t/%s", accountURL(acc), tag)
+}
+
+// loadAPFeaturedTags returns the collection of the account's featured tags, which we add to the actor's streams
+func loadAPFeaturedTags(acc Account) *pub.OrderedCollection {
+	col := pub.OrderedCollectionNew(pub.ID(fmt.Sprintf("%s/%s", acc.Metadata.ID, featuredTagsName)))
+	col.Name = pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content(featuredTagsName)}}
+	for _, tag := range acc.Metadata.FeaturedTags {
+		col.OrderedItems = append(col.OrderedItems, &pub.Object{
+			URL:  pub.IRI(featuredTagURL(acc, tag)),
+			Name: pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content("#" + tag)}},
+		})
+	}
+	col.TotalItems = uint(len(col.OrderedItems))
+	return col
+}
+
+// isNamedStream returns true if the stream is the one with the name, which we add to the actor's streams
+func isNamedStream(it pub.Item, name string) bool {
+	if it == nil {
+		return false
+	}
+	if strings.HasSuffix(it.GetLink().String(), "/"+name) {
+		return true
+	}
+	isNamed := false
+	pub.OnObject(it, func(o *pub.Object) error {
+		isNamed = o.Name.First().Value.String() == name
+		return nil
+	})
+	return isNamed
+}
+
+// isFeaturedTags returns true if the stream is the collection of featured tags
+func isFeaturedTags(it pub.Item) bool {
+	return isNamedStream(it, featuredTagsName)
+}
+
+// setAPFeaturedTags replaces the featured tags collection in the actor's streams with the account's
+func setAPFeaturedTags(p *pub.Actor, acc Account) {
+	streams := make(pub.ItemCollection, 0)
+	for _, s := range p.Streams {
+		if !isFeaturedTags(s) {
+			streams = append(streams, s)
+		}
+	}
+	if len(acc.Metadata.FeaturedTags) > 0 {
+		streams = append(streams, loadAPFeaturedTags(acc))
+	}
+	p.Streams = streams
+}
+
+// featuredTagsFromStreams returns the names of the featured tags in the actor's streams
+func featuredTagsFromStreams(streams pub.ItemCollection) []string {
+	var tags []string
+	for _, s := range streams {
+		if !isFeaturedTags(s) {
+			continue
+		}
+		pub.OnCollectionIntf(s, func(col pub.CollectionInterface) error {
+			for _, t := range col.Collection() {
+				pub.OnObject(t, func(o *pub.Object) error {
+					if name := strings.TrimPrefix(o.Name.First().Value.String(), "#"); len(name) > 0 {
+						tags = append(tags, name)
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+	}
+	return tags
+}
+
+// SetFeaturedTags saves the tags the account features on its profile, replacing the previous ones
+func (r *repository) SetFeaturedTags(ctx context.Context, acc Account, tags []string) (Account, error) {
+	if !acc.IsLogged() {
+		return acc, errors.Unauthorizedf("invalid account %s", acc.Handle)
+	}
+	tags, err := normaliseFeaturedTags(tags, r.maxFeaturedTags)
+	if err != nil {
+		return acc, err
+	}
+	acc.Metadata.FeaturedTags = tags
+	return r.SaveAccount(ctx, acc)
+}
+
+// HandleFeaturedTags saves the tags, separated by spaces or commas, the logged account features on its profile
+func (h *handler) HandleFeaturedTags(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	tags := strings.FieldsFunc(r.PostFormValue("tags"), func(c rune) bool {
+		return c == ',' || c == ' '
+	})
+	if _, err := h.storage.SetFeaturedTags(context.TODO(), *acc, tags); err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	h.v.Redirect(w, r, AccountPermaLink(acc), http.StatusFound)
+}
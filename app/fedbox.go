@@ -1,18 +1,22 @@
 package app
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/x509"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path"
+	"time"
 
 	pub "github.com/go-ap/activitypub"
 	"github.com/go-ap/client"
 	"github.com/go-ap/errors"
 	"github.com/go-ap/handlers"
+	j "github.com/go-ap/jsonld"
 	"github.com/mariusor/go-littr/internal/log"
 )
 
@@ -25,6 +29,10 @@ const (
 type fedbox struct {
 	baseURL       pub.IRI
 	skipTLSVerify bool
+	rootCAs       string
+	logTraffic    bool
+	attempts      int
+	backoff       time.Duration
 	pub           *pub.Actor
 	client        *client.C
 	infoFn        CtxLogFn
@@ -97,7 +105,7 @@ func withAccountS2S(a *Account) (client.RequestSignFn, error) {
 			return nil, err
 		}
 	}
-	return getSigner(k.ID, prv).Sign, nil
+	return s2sSignFn(k.ID, prv), nil
 }
 
 func SetSignFn(signer *Account) OptionFn {
@@ -121,6 +129,15 @@ func (f *fedbox) SignBy(signer *Account) {
 func SetUA(s string) OptionFn {
 	return func(f *fedbox) error {
 		client.UserAgent = s
+		defaultTransport.userAgent = s
+		return nil
+	}
+}
+
+// SetPeerUA sets the User-Agent values to be used for requests to specific hosts
+func SetPeerUA(uas map[string]string) OptionFn {
+	return func(f *fedbox) error {
+		defaultTransport.userAgents = uas
 		return nil
 	}
 }
@@ -132,6 +149,22 @@ func SkipTLSCheck(skip bool) OptionFn {
 	}
 }
 
+// SetRootCAs sets the path to a PEM bundle with extra certificates to be trusted, eg. a self-signed one for fedbox
+func SetRootCAs(file string) OptionFn {
+	return func(f *fedbox) error {
+		f.rootCAs = file
+		return nil
+	}
+}
+
+// LogTraffic enables logging the requests and responses exchanged with fedbox and the other servers
+func LogTraffic(enabled bool) OptionFn {
+	return func(f *fedbox) error {
+		f.logTraffic = enabled
+		return nil
+	}
+}
+
 var optionLogFn = func(fn CtxLogFn) func(ctx ...client.Ctx) client.LogFn {
 	return func(ctx ...client.Ctx) client.LogFn {
 		c := make([]log.Ctx, 0)
@@ -153,12 +186,28 @@ func NewClient(o ...OptionFn) (*fedbox, error) {
 		}
 	}
 
+	tlsConf, err := tlsConfig(f.rootCAs, f.skipTLSVerify)
+	if err != nil {
+		return nil, err
+	}
+	if f.skipTLSVerify {
+		f.errFn(log.Ctx{"url": f.baseURL})("WARNING: TLS certificate verification is disabled, this is insecure and should not be used in production")
+	}
+	defaultTransport.setTLSConfig(tlsConf)
+	if f.logTraffic {
+		defaultTransport.debugFn = f.infoFn
+	}
 	f.client = client.New(
+		client.WithHTTPClient(defaultClient),
 		client.SetErrorLogger(optionLogFn(f.errFn)),
 		client.SetInfoLogger(optionLogFn(f.infoFn)),
 		client.SkipTLSValidation(f.skipTLSVerify),
 	)
-	service, err := f.client.LoadIRI(f.baseURL)
+	var service pub.Item
+	err = f.withRetry(context.Background(), func() error {
+		service, err = f.client.LoadIRI(f.baseURL)
+		return err
+	})
 	if err != nil {
 		return &f, err
 	}
@@ -182,8 +231,110 @@ func (f fedbox) normaliseIRI(i pub.IRI) pub.IRI {
 	return pub.IRI(iu.String())
 }
 
+// fedboxError keeps the HTTP status of a failed fedbox response, as not all of them have an equivalent error type
+type fedboxError struct {
+	status int
+	error
+}
+
+func (e *fedboxError) Unwrap() error {
+	return e.error
+}
+
+// maxErrorSnippet is the maximum length of a raw response body we keep in an error message
+const maxErrorSnippet = 256
+
+func errorBodySnippet(body []byte) string {
+	body = bytes.TrimSpace(body)
+	if len(body) > maxErrorSnippet {
+		return string(body[:maxErrorSnippet]) + "..."
+	}
+	return string(body)
+}
+
+// errorFromResponse converts a failed fedbox response to an error that preserves the response's status.
+// NOTE(marius): fedbox versions differ on the shape of the error envelope, and proxies in front of it
+// can respond with plain text, so when we can't find an error in the body we still return one,
+// built from the HTTP status and the beginning of the body.
+func errorFromResponse(status int, body []byte) error {
+	if status < http.StatusBadRequest {
+		status = http.StatusInternalServerError
+	}
+	errs := _errors{}
+	if err := j.Unmarshal(body, &errs); err == nil && len(errs.Errors) > 0 {
+		e := errs.Errors[0]
+		if e.Code == 0 {
+			e.Code = status
+		}
+		if len(e.Message) > 0 {
+			return &fedboxError{status: e.Code, error: errors.WrapWithStatus(e.Code, nil, e.Message)}
+		}
+		status = e.Code
+	}
+	msg := errorBodySnippet(body)
+	if len(msg) == 0 {
+		msg = http.StatusText(status)
+	}
+	return &fedboxError{status: status, error: errors.WrapWithStatus(status, nil, "%s", msg)}
+}
+
+// load fetches the item at IRI i, returning an error with the response's status on failure
+func (f fedbox) load(ctx context.Context, i pub.IRI) (pub.Item, error) {
+	it, _, err := f.loadRaw(ctx, i)
+	return it, err
+}
+
+// loadRaw is like load, but it returns the raw response body too.
+// The requests that fail with a transient error are retried.
+func (f fedbox) loadRaw(ctx context.Context, i pub.IRI) (pub.Item, []byte, error) {
+	var body []byte
+	err := f.withRetry(ctx, func() error {
+		body = nil
+		resp, err := f.client.CtxGet(ctx, i.String())
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if body, err = ioutil.ReadAll(resp.Body); err != nil {
+			return errors.Annotatef(err, "Unable to read response body")
+		}
+		if resp.StatusCode >= http.StatusBadRequest || resp.StatusCode < http.StatusOK {
+			return errorFromResponse(resp.StatusCode, body)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, body, err
+	}
+	it, err := pub.UnmarshalJSON(body)
+	return it, body, err
+}
+
+// toCollection posts the activity to the collection, retrying it if it fails with a transient error
+func (f fedbox) toCollection(ctx context.Context, col pub.IRI, a pub.Item) (pub.IRI, pub.Item, error) {
+	var (
+		iri pub.IRI
+		it  pub.Item
+	)
+	err := f.withRetry(ctx, func() error {
+		var err error
+		iri, it, err = f.client.CtxToCollection(ctx, col, a)
+		return err
+	})
+	return iri, it, err
+}
+
 func (f fedbox) collection(ctx context.Context, i pub.IRI) (pub.CollectionInterface, error) {
-	it, err := f.client.CtxLoadIRI(ctx, f.normaliseIRI(i))
+	return f.loadCollection(ctx, f.normaliseIRI(i))
+}
+
+// remoteCollection loads the collection from its own host, instead of from fedbox
+func (f fedbox) remoteCollection(ctx context.Context, i pub.IRI) (pub.CollectionInterface, error) {
+	return f.loadCollection(ctx, i)
+}
+
+func (f fedbox) loadCollection(ctx context.Context, i pub.IRI) (pub.CollectionInterface, error) {
+	it, err := f.load(ctx, i)
 	if err != nil {
 		return nil, errors.Annotatef(err, "Unable to load IRI: %s", i)
 	}
@@ -213,7 +364,7 @@ func (f fedbox) collection(ctx context.Context, i pub.IRI) (pub.CollectionInterf
 }
 
 func (f fedbox) object(ctx context.Context, i pub.IRI) (pub.Item, error) {
-	return f.client.CtxLoadIRI(ctx, f.normaliseIRI(i))
+	return f.load(ctx, f.normaliseIRI(i))
 }
 
 func rawFilterQuery(f ...client.FilterFn) string {
@@ -421,7 +572,7 @@ func (f fedbox) ToOutbox(ctx context.Context, a pub.Item) (pub.IRI, pub.Item, er
 	if err := validateIRIForRequest(iri); err != nil {
 		return "", nil, errors.Annotatef(err, "Invalid Outbox IRI")
 	}
-	return f.client.CtxToCollection(ctx, f.normaliseIRI(iri), a)
+	return f.toCollection(ctx, f.normaliseIRI(iri), a)
 }
 
 func (f fedbox) ToInbox(ctx context.Context, a pub.Item) (pub.IRI, pub.Item, error) {
@@ -433,7 +584,7 @@ func (f fedbox) ToInbox(ctx context.Context, a pub.Item) (pub.IRI, pub.Item, err
 	if err := validateIRIForRequest(iri); err != nil {
 		return "", nil, errors.Annotatef(err, "Invalid Inbox IRI")
 	}
-	return f.client.CtxToCollection(ctx, f.normaliseIRI(iri), a)
+	return f.toCollection(ctx, f.normaliseIRI(iri), a)
 }
 
 func (f *fedbox) Service() *pub.Service {
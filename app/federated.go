@@ -1,5 +1,13 @@
 package app
 
+import (
+	"context"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/handlers"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
 type FedInstance struct {
 	BaseURL     string
 	SharedInbox string
@@ -7,3 +15,163 @@ type FedInstance struct {
 	Description string
 	Email       string
 }
+
+// DefaultMaxRecipients is the number of personal recipients of an activity
+// above which we address only the shared inboxes of their instances
+const DefaultMaxRecipients = 500
+
+// personalRecipients returns the actors the item is addressed to, or mentions, with their shared inboxes if known
+func personalRecipients(it Item) map[pub.IRI]pub.IRI {
+	rec := make(map[pub.IRI]pub.IRI)
+	if !it.HasMetadata() {
+		return rec
+	}
+	for _, acc := range it.Metadata.To {
+		if acc.HasMetadata() && len(acc.Metadata.ID) > 0 {
+			rec[pub.IRI(acc.Metadata.ID)] = pub.IRI(acc.Metadata.SharedInboxIRI)
+		}
+	}
+	for _, acc := range it.Metadata.CC {
+		if acc.HasMetadata() && len(acc.Metadata.ID) > 0 {
+			rec[pub.IRI(acc.Metadata.ID)] = pub.IRI(acc.Metadata.SharedInboxIRI)
+		}
+	}
+	for _, m := range it.Metadata.Mentions {
+		if m.Metadata != nil && len(m.Metadata.ID) > 0 {
+			if _, ok := rec[pub.IRI(m.Metadata.ID)]; !ok {
+				rec[pub.IRI(m.Metadata.ID)] = ""
+			}
+		}
+	}
+	return rec
+}
+
+// capRecipients replaces the personal recipients in to and cc with the shared inboxes of their instances,
+// if there are more than max of them in both. Recipients that are not in the personal map, like the public namespace
+// or a followers collection, are kept, and so are the personal ones without a known shared inbox.
+// It returns the resulting recipients and the number of personal ones replaced by their shared inboxes.
+func capRecipients(to, cc pub.ItemCollection, personal map[pub.IRI]pub.IRI, max int) (pub.ItemCollection, pub.ItemCollection, int) {
+	if max <= 0 {
+		max = DefaultMaxRecipients
+	}
+	counted := make(map[pub.IRI]bool)
+	for _, col := range []pub.ItemCollection{to, cc} {
+		for _, rec := range col {
+			if _, ok := personal[rec.GetLink()]; ok {
+				counted[rec.GetLink()] = true
+			}
+		}
+	}
+	if len(counted) <= max {
+		return to, cc, 0
+	}
+	replaced := 0
+	seen := make(map[pub.IRI]bool)
+	replace := func(col pub.ItemCollection) pub.ItemCollection {
+		result := make(pub.ItemCollection, 0)
+		for _, rec := range col {
+			iri := rec.GetLink()
+			if shared := personal[iri]; len(shared) > 0 {
+				iri = shared
+				replaced++
+			}
+			if len(iri) == 0 || seen[iri] {
+				continue
+			}
+			seen[iri] = true
+			result = append(result, iri)
+		}
+		return result
+	}
+	to = replace(to)
+	return to, replace(cc), replaced
+}
+
+// mergeRecipients appends to col the recipients from the other collections that it doesn't contain yet
+func mergeRecipients(col pub.ItemCollection, other ...pub.ItemCollection) pub.ItemCollection {
+	for _, o := range other {
+		for _, rec := range o {
+			if rec == nil || len(rec.GetLink()) == 0 || col.Contains(rec.GetLink()) {
+				continue
+			}
+			col = append(col, rec.GetLink())
+		}
+	}
+	return col
+}
+
+// originalAudience returns the recipients of the existing object, so the Update and Delete activities
+// on it reach everyone that received the original Create, including the authors it was replying to.
+func (r *repository) originalAudience(ctx context.Context, id pub.IRI) (pub.ItemCollection, pub.ItemCollection) {
+	ob, err := r.fedbox.Object(ctx, id)
+	if err != nil || ob == nil {
+		r.errFn(log.Ctx{"iri": id, "err": err})("unable to load the recipients of the original object")
+		return nil, nil
+	}
+	return ob.To, ob.CC
+}
+
+// localAudience returns the IRI we address the local only items to, which is the instance's service actor
+func localAudience() pub.IRI {
+	if Instance.Conf == nil {
+		return ""
+	}
+	return pub.IRI(Instance.Conf.APIURL)
+}
+
+// instanceActor returns the actor the activities are addressed to, for the instance to list them, and whose inbox
+// we load the instance's listings from.
+// It's the fedbox service, whose IRI is the API URL, unless the INSTANCE_ACTOR_ADDRESSING option moves them
+// to the instance's application actor.
+func (r *repository) instanceActor() pub.Item {
+	if r.instanceActorAddressing && r.app != nil && r.app.pub != nil {
+		return r.app.pub
+	}
+	return r.fedbox.Service()
+}
+
+// instanceAudience returns the IRI of the instance actor, for the BCC of the activities
+func (r *repository) instanceAudience() pub.IRI {
+	return r.instanceActor().GetLink()
+}
+
+// isLocalOnlyAudience returns true if the recipients are the ones of a local only item:
+// they include the instance's service actor, but not the public namespace.
+func isLocalOnlyAudience(cols ...pub.ItemCollection) bool {
+	local := localAudience()
+	if len(local) == 0 {
+		return false
+	}
+	isLocal := false
+	for _, col := range cols {
+		for _, rec := range col {
+			iri := rec.GetLink()
+			if iri.Equals(pub.PublicNS, true) {
+				return false
+			}
+			if iri.Equals(local, false) {
+				isLocal = true
+			}
+		}
+	}
+	return isLocal
+}
+
+// localRecipients keeps only the recipients hosted on the current instance. The followers and following
+// collections are removed too, as fedbox would deliver to their remote members.
+func localRecipients(col pub.ItemCollection) pub.ItemCollection {
+	result := make(pub.ItemCollection, 0)
+	for _, rec := range col {
+		iri := rec.GetLink()
+		if iri.Equals(pub.PublicNS, true) || !HostIsLocal(iri.String()) {
+			continue
+		}
+		if _, typ := handlers.Split(iri); typ == handlers.Followers || typ == handlers.Following {
+			continue
+		}
+		if !result.Contains(iri) {
+			result = append(result, iri)
+		}
+	}
+	return result
+}
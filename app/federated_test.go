@@ -0,0 +1,265 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"golang.org/x/oauth2"
+)
+
+func Test_capRecipients(t *testing.T) {
+	followers := pub.IRI("https://littr.example/actors/jdoe/followers")
+	personal := make(map[pub.IRI]pub.IRI)
+	to := pub.ItemCollection{pub.PublicNS}
+	cc := pub.ItemCollection{followers}
+	hosts := []struct {
+		host   string
+		shared pub.IRI
+	}{
+		{host: "one.example", shared: "https://one.example/inbox"},
+		{host: "two.example", shared: "https://two.example/inbox"},
+		{host: "no-shared-inbox.example"},
+	}
+	direct := make(pub.ItemCollection, 0)
+	for i := 0; i < 300; i++ {
+		h := hosts[i%len(hosts)]
+		iri := pub.IRI(fmt.Sprintf("https://%s/users/user%d", h.host, i))
+		personal[iri] = h.shared
+		// NOTE(marius): the recipients are split between to and cc, the cap applies to all of them
+		if i%2 == 0 {
+			to = append(to, iri)
+		} else {
+			cc = append(cc, iri)
+		}
+		if len(h.shared) == 0 {
+			direct = append(direct, iri)
+		}
+	}
+
+	t.Run("under the cap", func(t *testing.T) {
+		gotTo, gotCC, skipped := capRecipients(to, cc, personal, 500)
+		if skipped != 0 || len(gotTo) != len(to) || len(gotCC) != len(cc) {
+			t.Errorf("capRecipients() = %d, %d recipients, %d skipped, expected them unchanged", len(gotTo), len(gotCC), skipped)
+		}
+	})
+	t.Run("over the cap", func(t *testing.T) {
+		gotTo, gotCC, skipped := capRecipients(to, cc, personal, 200)
+		if skipped != 200 {
+			t.Errorf("Invalid skipped recipients %d, expected %d", skipped, 200)
+		}
+		if !gotTo.Contains(pub.PublicNS) || !gotCC.Contains(followers) {
+			t.Errorf("The public namespace and the followers collection should be kept")
+		}
+		all := append(append(pub.ItemCollection{}, gotTo...), gotCC...)
+		for _, h := range hosts[:2] {
+			count := 0
+			for _, rec := range all {
+				if rec.GetLink() == h.shared {
+					count++
+				}
+			}
+			if count != 1 {
+				t.Errorf("The shared inbox %s should be addressed once, received %d times", h.shared, count)
+			}
+		}
+		for _, iri := range direct {
+			if !all.Contains(iri) {
+				t.Errorf("The recipient %s without a shared inbox should be addressed directly", iri)
+			}
+		}
+		if len(all) != 2+2+len(direct) {
+			t.Errorf("Invalid number of recipients %d, expected %d", len(all), 4+len(direct))
+		}
+	})
+}
+
+func Test_repository_SaveItemDeleteReachesOriginalAudience(t *testing.T) {
+	const parentAuthorHash = "9b8a7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"
+	var srv *httptest.Server
+	var delivered pub.Item
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		objIRI := srv.URL + "/objects/" + testObjectHash
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/outbox") {
+			body, _ := ioutil.ReadAll(r.Body)
+			delivered, _ = pub.UnmarshalJSON(body)
+			w.Header().Set("Location", srv.URL+"/activities/"+testLikeHash)
+			writeActivityJSON(w, http.StatusCreated, string(body))
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/objects/"+testObjectHash {
+			writeActivityJSON(w, http.StatusOK, `{"id":"`+objIRI+`","type":"Note","content":"reply","to":["`+srv.URL+`/actors/`+parentAuthorHash+`"],"cc":["https://www.w3.org/ns/activitystreams#Public"]}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	author := testVote(srv, 1).SubmittedBy
+	author.Metadata.OAuth.Token = &oauth2.Token{AccessToken: "t0k3n", TokenType: "Bearer"}
+	r.WithAccount(author)
+
+	it := Item{
+		Hash:        HashFromString(testObjectHash),
+		SubmittedBy: author,
+		Data:        "reply",
+		MimeType:    "text/html",
+		Metadata:    &ItemMetadata{ID: srv.URL + "/objects/" + testObjectHash},
+	}
+	it.Delete()
+	if _, err := r.SaveItem(context.Background(), it); err != nil {
+		t.Fatalf("Unable to delete item: %s", err)
+	}
+	if delivered == nil {
+		t.Fatalf("No activity was sent to the outbox")
+	}
+	if typ := delivered.GetType(); typ != pub.DeleteType {
+		t.Errorf("Invalid activity type %s, expected %s", typ, pub.DeleteType)
+	}
+	parentAuthor := pub.IRI(srv.URL + "/actors/" + parentAuthorHash)
+	pub.OnActivity(delivered, func(a *pub.Activity) error {
+		if !a.To.Contains(parentAuthor) && !a.CC.Contains(parentAuthor) {
+			t.Errorf("The Delete activity is not addressed to the parent author %s: to %v, cc %v", parentAuthor, a.To, a.CC)
+		}
+		return nil
+	})
+}
+
+func Test_repository_SaveItemLocalOnly(t *testing.T) {
+	const remote = "https://remote.example/users/jane"
+	var srv *httptest.Server
+	var delivered pub.Item
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/outbox") {
+			body, _ := ioutil.ReadAll(r.Body)
+			delivered, _ = pub.UnmarshalJSON(body)
+			w.Header().Set("Location", srv.URL+"/activities/"+testLikeHash)
+			writeActivityJSON(w, http.StatusCreated, string(body))
+			return
+		}
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/actors") {
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	author := testVote(srv, 1).SubmittedBy
+	author.Metadata.OAuth.Token = &oauth2.Token{AccessToken: "t0k3n", TokenType: "Bearer"}
+	author.Metadata.FollowersIRI = srv.URL + "/actors/" + testActorHash + "/followers"
+	r.WithAccount(author)
+
+	it := Item{
+		SubmittedBy: author,
+		Data:        "internal discussion",
+		MimeType:    "text/html",
+		Metadata: &ItemMetadata{
+			To: AccountCollection{{Handle: "jane", Metadata: &AccountMetadata{ID: remote}}},
+		},
+	}
+	it.MakeLocalOnly()
+	saved, err := r.SaveItem(context.Background(), it)
+	if err != nil {
+		t.Fatalf("Unable to save item: %s", err)
+	}
+	if delivered == nil {
+		t.Fatalf("No activity was sent to the outbox")
+	}
+	pub.OnActivity(delivered, func(a *pub.Activity) error {
+		for _, col := range []pub.ItemCollection{a.To, a.CC, a.BCC} {
+			for _, rec := range col {
+				if rec.GetLink().Equals(pub.PublicNS, true) {
+					t.Errorf("Local only activity is addressed to the public namespace")
+				}
+				if !HostIsLocal(rec.GetLink().String()) {
+					t.Errorf("Local only activity is addressed to remote recipient %s", rec.GetLink())
+				}
+				if rec.GetLink() == pub.IRI(author.Metadata.FollowersIRI) {
+					t.Errorf("Local only activity is addressed to the author's followers")
+				}
+			}
+		}
+		if !a.To.Contains(localAudience()) {
+			t.Errorf("Local only activity is not addressed to the local service %s: %v", localAudience(), a.To)
+		}
+		return nil
+	})
+	if !saved.LocalOnly() {
+		t.Errorf("The saved item should be loaded back as local only")
+	}
+}
+
+func Test_repository_SaveItemInstanceActorAddressing(t *testing.T) {
+	const instance = "https://littr.example/actors/instance"
+	tests := []struct {
+		name                    string
+		instanceActorAddressing bool
+	}{
+		{name: "fedbox service", instanceActorAddressing: false},
+		{name: "instance actor", instanceActorAddressing: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var srv *httptest.Server
+			var delivered pub.Item
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/outbox") {
+					body, _ := ioutil.ReadAll(r.Body)
+					delivered, _ = pub.UnmarshalJSON(body)
+					w.Header().Set("Location", srv.URL+"/activities/"+testLikeHash)
+					writeActivityJSON(w, http.StatusCreated, string(body))
+					return
+				}
+				if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/actors") {
+					writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+					return
+				}
+				w.WriteHeader(http.StatusNotFound)
+			}))
+			defer srv.Close()
+
+			r := testRepository(srv)
+			r.instanceActorAddressing = tt.instanceActorAddressing
+			r.app = &Account{Handle: "instance", pub: &pub.Actor{ID: instance, Type: pub.ApplicationType}}
+			author := testVote(srv, 1).SubmittedBy
+			author.Metadata.OAuth.Token = &oauth2.Token{AccessToken: "t0k3n", TokenType: "Bearer"}
+			r.WithAccount(author)
+
+			it := Item{SubmittedBy: author, Data: "hello", MimeType: "text/html"}
+			if _, err := r.SaveItem(context.Background(), it); err != nil {
+				t.Fatalf("Unable to save item: %s", err)
+			}
+			if delivered == nil {
+				t.Fatalf("No activity was sent to the outbox")
+			}
+			api := pub.IRI(srv.URL)
+			pub.OnActivity(delivered, func(a *pub.Activity) error {
+				if !tt.instanceActorAddressing {
+					if !a.BCC.Contains(api) {
+						t.Errorf("The activity is not addressed to the fedbox service %s: %v", api, a.BCC)
+					}
+					return nil
+				}
+				for _, col := range []pub.ItemCollection{a.To, a.CC, a.BCC} {
+					for _, rec := range col {
+						if rec.GetLink().Equals(api, false) {
+							t.Errorf("The activity is addressed to the API URL %s", api)
+						}
+					}
+				}
+				if !a.BCC.Contains(pub.IRI(instance)) {
+					t.Errorf("The activity is not addressed to the instance actor %s: %v", instance, a.BCC)
+				}
+				return nil
+			})
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package app
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// collectionPageIRI returns the IRI of the page of the collection at the cursor, which is the query string
+// of the page's link, as we keep it in Pagination.
+func collectionPageIRI(col pub.IRI, cursor string) (pub.IRI, error) {
+	u, err := col.URL()
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || len(u.Host) == 0 {
+		return "", errors.BadRequestf("invalid collection IRI %s", col)
+	}
+	if len(cursor) > 0 {
+		if _, err := url.ParseQuery(cursor); err != nil {
+			return "", errors.NewBadRequest(err, "invalid cursor")
+		}
+		u.RawQuery = cursor
+	}
+	return pub.IRI(u.String()), nil
+}
+
+// LoadItemsFromIRI loads the page at cursor of an arbitrary collection, like a remote instance's hashtag,
+// and decodes and enriches its items the same way the listings do. The collection's host must not be blocked.
+func (r *repository) LoadItemsFromIRI(ctx context.Context, col pub.IRI, cursor string) (Cursor, error) {
+	page, err := collectionPageIRI(col, cursor)
+	if err != nil {
+		return emptyCursor, err
+	}
+	if h := host(page.String()); r.peers.IsBlocked(h) {
+		return emptyCursor, errors.Forbiddenf("the %s instance is blocked", strings.ToLower(h))
+	}
+	load := r.fedbox.remoteCollection
+	if HostIsLocal(page.String()) {
+		load = r.fedbox.collection
+	}
+	c, err := load(ctx, page)
+	if err != nil {
+		return emptyCursor, err
+	}
+	// NOTE(marius): Mastodon and others serve only the links to the first page in the collection itself
+	if len(c.Collection()) == 0 && len(cursor) == 0 {
+		if first := paginationFromCollection(c).First; len(first) > 0 {
+			if page, err = collectionPageIRI(col, first); err == nil {
+				if fc, err := load(ctx, page); err == nil {
+					c = fc
+				}
+			}
+		}
+	}
+
+	items := make(ItemCollection, 0)
+	deferred := make(CompStrs, 0)
+	pub.OnCollectionIntf(c, func(c pub.CollectionInterface) error {
+		for _, it := range c.Collection() {
+			if it == nil {
+				continue
+			}
+			if it.IsLink() {
+				deferred = append(deferred, EqualsString(it.GetLink().String()))
+				continue
+			}
+			typ := it.GetType()
+			if typ == pub.CreateType || typ == pub.AnnounceType {
+				pub.OnActivity(it, func(a *pub.Activity) error {
+					it = a.Object
+					return nil
+				})
+				if it == nil {
+					continue
+				}
+				if it.IsLink() {
+					deferred = append(deferred, EqualsString(it.GetLink().String()))
+					continue
+				}
+				typ = it.GetType()
+			}
+			if !ValidContentTypes.Contains(typ) {
+				continue
+			}
+			i := Item{}
+			if err := i.FromActivityPub(it); err == nil && i.IsValid() && !i.Deleted() {
+				items = append(items, i)
+			}
+		}
+		return nil
+	})
+	if len(deferred) > 0 {
+		loaded, err := r.objects(ctx, &Filters{IRI: deferred, MaxItems: len(deferred)})
+		if err != nil {
+			r.errFn(log.Ctx{"iri": col})("unable to load collection objects: %s", err)
+		}
+		for _, it := range loaded {
+			if !items.Contains(it) {
+				items = append(items, it)
+			}
+		}
+	}
+	if items, err = r.loadItemsAuthors(ctx, items...); err != nil {
+		r.errFn(log.Ctx{"iri": col})(err.Error())
+	}
+	if items, err = r.loadItemsVotes(ctx, items...); err != nil {
+		r.errFn(log.Ctx{"iri": col})(err.Error())
+	}
+	if items, err = r.loadItemsQuotes(ctx, items...); err != nil {
+		r.errFn(log.Ctx{"iri": col})(err.Error())
+	}
+
+	result := make(RenderableList, 0)
+	for k := range items {
+		result.Append(&items[k])
+	}
+	return Cursor{
+		items: result,
+		total: uint(len(result)),
+		pages: paginationFromCollection(c),
+	}, nil
+}
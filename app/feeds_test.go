@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_repository_LoadItemsFromIRI(t *testing.T) {
+	fedbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+	}))
+	defer fedbox.Close()
+
+	pages := make([]string, 0)
+	var remote *httptest.Server
+	remote = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages = append(pages, r.URL.RawQuery)
+		tag := remote.URL + "/tags/littr"
+		switch r.URL.RawQuery {
+		case "":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s","type":"OrderedCollection","totalItems":3,"first":"%s?page=1"}`, tag, tag))
+		case "page=1":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s?page=1","type":"OrderedCollectionPage","next":"%s?page=2","orderedItems":[
+				{"id":"%s/objects/%s","type":"Note","content":"hello","attributedTo":"%s/users/jdoe"},
+				{"id":"%s/activities/%s","type":"Create","actor":"%s/users/jdoe","object":{"id":"%s/objects/%s","type":"Article","name":"An article"}}
+			]}`, tag, tag, remote.URL, testObjectHash, remote.URL, remote.URL, testLikeHash, remote.URL, remote.URL, testActorHash))
+		default:
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s?%s","type":"OrderedCollectionPage","orderedItems":[]}`, tag, r.URL.RawQuery))
+		}
+	}))
+	defer remote.Close()
+
+	r := testRepository(fedbox)
+	r.peers = newPeers(nil, nil)
+	col := pub.IRI(remote.URL + "/tags/littr")
+
+	c, err := r.LoadItemsFromIRI(context.Background(), col, "")
+	if err != nil {
+		t.Fatalf("Unable to load the remote collection: %s", err)
+	}
+	if len(c.items) != 2 {
+		t.Fatalf("Invalid items %d, expected %d", len(c.items), 2)
+	}
+	for _, h := range []string{testObjectHash, testActorHash} {
+		if _, ok := c.items[HashFromString(h)]; !ok {
+			t.Errorf("The item %s was not loaded from the collection", h)
+		}
+	}
+	if next := c.Pagination().Next; next != "page=2" {
+		t.Errorf("Invalid next page %q, expected %q", next, "page=2")
+	}
+	if _, err := r.LoadItemsFromIRI(context.Background(), col, c.Pagination().Next); err != nil {
+		t.Fatalf("Unable to load the next page of the remote collection: %s", err)
+	}
+	if len(pages) != 3 || pages[2] != "page=2" {
+		t.Errorf("Invalid pages loaded %v, expected the next page last", pages)
+	}
+
+	t.Run("blocked instance", func(t *testing.T) {
+		loaded := len(pages)
+		r.peers = newPeers([]string{host(remote.URL)}, nil)
+		_, err := r.LoadItemsFromIRI(context.Background(), col, "")
+		if status := httpErrorResponse(err); status != http.StatusForbidden {
+			t.Errorf("Invalid status %d for a blocked instance, expected %d", status, http.StatusForbidden)
+		}
+		if len(pages) != loaded {
+			t.Errorf("The collection of a blocked instance should not be loaded")
+		}
+	})
+	t.Run("invalid IRI", func(t *testing.T) {
+		if _, err := r.LoadItemsFromIRI(context.Background(), "ftp://remote.example/tags/littr", ""); err == nil {
+			t.Errorf("Loading a collection with an invalid IRI should fail")
+		}
+	})
+}
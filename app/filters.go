@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 
 	pub "github.com/go-ap/activitypub"
 	"github.com/go-ap/errors"
@@ -41,6 +42,13 @@ type Filters struct {
 	Object     *Filters `qstring:"object,omitempty"`
 	Tag        *Filters `qstring:"tag,omitempty"`
 	Actor      *Filters `qstring:"actor,omitempty"`
+	// NOTE(marius): fedbox doesn't filter by language, so we filter the loaded items ourselves
+	Languages   []string `qstring:"-"`
+	UnknownLang bool     `qstring:"-"`
+	// Sensitive is the policy for the sensitive items in the listing: hide, collapse or show
+	Sensitive string `qstring:"-"`
+	// MinScore is the score under which the items in the listing are shown collapsed
+	MinScore *int `qstring:"-"`
 }
 
 // FiltersFromRequest loads the filters we use for generating storage queries from the HTTP request
@@ -52,6 +60,13 @@ func FiltersFromRequest(r *http.Request) *Filters {
 	if f.MaxItems <= 0 {
 		f.MaxItems = MaxContentItems
 	}
+	f.Languages, f.UnknownLang = languagesFromRequest(r)
+	f.Sensitive = strings.ToLower(r.URL.Query().Get("sensitive"))
+	if q := r.URL.Query().Get("minScore"); len(q) > 0 {
+		if score, err := parseMinScore(q); err == nil {
+			f.MinScore = &score
+		}
+	}
 	return f
 }
 
@@ -66,7 +81,9 @@ func DefaultFilters(next http.Handler) http.Handler {
 		f := FiltersFromRequest(r)
 		f.Type = CreateActivitiesFilter
 		f.Object = new(Filters)
-		f.Object.InReplTo = nilIRIs
+		if Instance.Conf == nil || Instance.Conf.OnlyTopLevel {
+			f.Object.InReplTo = nilIRIs
+		}
 		f.Object.Type = ActivityTypesFilter(ValidContentTypes...)
 		m := ContextListingModel(r.Context())
 		m.Title = "Newest items"
@@ -75,6 +92,22 @@ func DefaultFilters(next http.Handler) http.Handler {
 	})
 }
 
+// CommentsFiltersMw loads the filters for the listing of the replies, without the top level submissions
+func CommentsFiltersMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := FiltersFromRequest(r)
+		f.Type = CreateActivitiesFilter
+		f.Object = new(Filters)
+		f.Object.InReplTo = notNilIRIs
+		f.Object.Type = ActivityTypesFilter(ValidContentTypes...)
+		m := ContextListingModel(r.Context())
+		m.Title = "Newest comments"
+		m.ShowText = true
+		ctx := context.WithValue(r.Context(), FilterCtxtKey, []*Filters{f})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // FiltersFromRequest loads the filters we use for generating storage queries from the HTTP request
 func ContextActivityFilters(ctx context.Context) []*Filters {
 	if f, ok := ctx.Value(FilterCtxtKey).([]*Filters); ok {
@@ -96,15 +129,19 @@ func SelfFiltersMw(id pub.IRI) func (next http.Handler) http.Handler {
 	}
 }
 
-var CreateFollowActivitiesFilter = CompStrs{
+// FollowedActivitiesFilter are the activities we load from the account's inbox, the Delete activities of
+// the remote accounts aren't shown, but we record the objects we never stored as deleted
+var FollowedActivitiesFilter = CompStrs{
 	CompStr{Str: string(pub.CreateType)},
 	CompStr{Str: string(pub.FollowType)},
+	CompStr{Str: string(pub.AnnounceType)},
+	CompStr{Str: string(pub.DeleteType)},
 }
 
 func FollowedFiltersMw(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		f := FiltersFromRequest(r)
-		f.Type = CreateFollowActivitiesFilter
+		f.Type = FollowedActivitiesFilter
 		m := ContextListingModel(r.Context())
 		m.Title = "Followed items"
 		m.ShowText = true
@@ -132,6 +169,9 @@ func FederatedFiltersMw(id pub.IRI) func (next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			f := fedFilters(r)
 			f.IRI = CompStrs{DifferentThanString(id.String())}
+			if repo := ContextRepository(r.Context()); repo != nil && repo.relays.Enabled() {
+				f.Type = ActivityTypesFilter(pub.CreateType, pub.AnnounceType)
+			}
 			m := ContextListingModel(r.Context())
 			m.Title = "Federated items"
 			ctx := context.WithValue(r.Context(), FilterCtxtKey, []*Filters{f})
@@ -267,6 +307,13 @@ func AccountFiltersMw(next http.Handler) http.Handler {
 		}
 		fc := *f
 		fc.Type = CreateActivitiesFilter
+		if tag := chi.URLParam(r, "tag"); len(tag) > 0 {
+			// NOTE(marius): the /~{handle}/t/{tag} listings, for the tags featured on the profile
+			fc.Object = &Filters{Tag: tagsFilter(tag)}
+			if m := ContextListingModel(r.Context()); m != nil {
+				m.Title = fmt.Sprintf("%s submissions tagged as #%s", genitive(authors[0].Handle), tag)
+			}
+		}
 
 		fv := *f
 		fv.Type = AppreciationActivitiesFilter
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+func Test_FeedFiltersThreadLevel(t *testing.T) {
+	loadItem := func(raw string) Item {
+		ob, err := pub.UnmarshalJSON([]byte(raw))
+		if err != nil {
+			t.Fatalf("Unable to unmarshal %s: %s", raw, err)
+		}
+		i := Item{}
+		if err := i.FromActivityPub(ob); err != nil {
+			t.Fatalf("Unable to load item from %s: %s", raw, err)
+		}
+		return i
+	}
+	base := "https://fedbox.example/objects/"
+	top := loadItem(`{"id":"` + base + testObjectHash + `","type":"Note","content":"top"}`)
+	reply := loadItem(`{"id":"` + base + testLikeHash + `","type":"Note","content":"reply","inReplyTo":["` + base + testObjectHash + `"]}`)
+
+	tests := []struct {
+		name         string
+		mw           func(http.Handler) http.Handler
+		onlyTopLevel bool
+		wantTop      bool
+		wantReply    bool
+	}{
+		{name: "homepage only top level", mw: DefaultFilters, onlyTopLevel: true, wantTop: true, wantReply: false},
+		{name: "homepage with replies", mw: DefaultFilters, onlyTopLevel: false, wantTop: true, wantReply: true},
+		{name: "comments", mw: CommentsFiltersMw, onlyTopLevel: true, wantTop: false, wantReply: true},
+	}
+	prevConf := Instance.Conf
+	defer func() { Instance.Conf = prevConf }()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Instance.Conf = &config.Configuration{OnlyTopLevel: tt.onlyTopLevel}
+			var ff []*Filters
+			h := ListingModelMw(tt.mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ff = ContextActivityFilters(r.Context())
+			})))
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+			if len(ff) != 1 {
+				t.Fatalf("Expected a single filter, got %d", len(ff))
+			}
+			if got := validItem(top, ff[0]); got != tt.wantTop {
+				t.Errorf("validItem() for the top level item = %t, want %t", got, tt.wantTop)
+			}
+			if got := validItem(reply, ff[0]); got != tt.wantReply {
+				t.Errorf("validItem() for the reply = %t, want %t", got, tt.wantReply)
+			}
+		})
+	}
+}
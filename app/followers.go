@@ -0,0 +1,193 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-ap/handlers"
+)
+
+const (
+	// FollowCollectionsPublic shows the followers and the followed accounts of an account to everyone
+	FollowCollectionsPublic = "public"
+	// FollowCollectionsFollowers shows them only to the account and to its followers
+	FollowCollectionsFollowers = "followers"
+	// FollowCollectionsSelf shows them only to the account itself
+	FollowCollectionsSelf = "self"
+)
+
+// followCollection is a page of the followers, or of the followed accounts, of an account.
+// When the viewer isn't allowed to see them, only their number is known.
+type followCollection struct {
+	typ      handlers.CollectionType
+	owner    Account
+	accounts AccountCollection
+	total    int
+	page     int
+	pageSize int
+	hidden   bool
+}
+
+// followCollectionVisible returns true if the viewer can see the followers and the followed accounts of the owner
+func followCollectionVisible(visibility string, viewer, owner *Account) bool {
+	if viewer.IsLogged() && (viewer.Hash == owner.Hash || viewer.IsModerator()) {
+		return true
+	}
+	switch visibility {
+	case FollowCollectionsSelf:
+		return false
+	case FollowCollectionsFollowers:
+		return viewer.IsLogged() && accountInCollection(*viewer, owner.Followers)
+	}
+	return true
+}
+
+// LoadFollowCollection loads the page of the followers, or of the followed accounts, of the owner account,
+// for the viewer. The page numbers start at 1, the page 0 loads only the number of accounts.
+func (r *repository) LoadFollowCollection(ctx context.Context, viewer *Account, owner Account, typ handlers.CollectionType, page, pageSize int) (followCollection, error) {
+	col := followCollection{typ: typ, owner: owner, page: page, pageSize: clampPageSize(pageSize, r.pageSize, r.maxPageSize)}
+	if typ != handlers.Followers && typ != handlers.Following {
+		return col, errors.NotValidf("invalid collection %s", typ)
+	}
+	// NOTE(marius): we need the followers for deciding the visibility of both collections
+	if err := r.loadAccountsFollowers(ctx, &col.owner); err != nil {
+		return col, errors.Annotatef(err, "unable to load the followers of %s", owner.Handle)
+	}
+	all := col.owner.Followers
+	if typ == handlers.Following {
+		if err := r.loadAccountsFollowing(ctx, &col.owner); err != nil {
+			return col, errors.Annotatef(err, "unable to load the accounts followed by %s", owner.Handle)
+		}
+		all = col.owner.Following
+	}
+	col.total = len(all)
+	col.hidden = !followCollectionVisible(r.followCollections, viewer, &col.owner)
+	if col.hidden || page <= 0 {
+		return col, nil
+	}
+	start := (page - 1) * col.pageSize
+	if start > len(all) {
+		start = len(all)
+	}
+	end := start + col.pageSize
+	if end > len(all) {
+		end = len(all)
+	}
+	col.accounts = all[start:end]
+	return col, nil
+}
+
+// iri returns the IRI of the collection, or of its page n
+func (c followCollection) iri(n int) pub.IRI {
+	iri := fmt.Sprintf("%s/%s", accountURL(c.owner), c.typ)
+	if n > 0 {
+		iri = fmt.Sprintf("%s?page=%d", iri, n)
+	}
+	return pub.IRI(iri)
+}
+
+// followCollectionIRI returns the IRI of the followers, or of the followed accounts, of a local account,
+// the one served by HandleFollowCollection
+func followCollectionIRI(owner Account, typ handlers.CollectionType) pub.IRI {
+	return followCollection{typ: typ, owner: owner}.iri(0)
+}
+
+// fedboxFollowIRI returns the IRI of the collection where fedbox keeps the followers, or the followed accounts,
+// of the account. The local actors advertise our collections instead, which load the accounts from there.
+func fedboxFollowIRI(a Account, iri pub.IRI, typ handlers.CollectionType) string {
+	if a.HasMetadata() && len(a.Metadata.ID) > 0 && iri.Equals(followCollectionIRI(a, typ), false) {
+		return pub.IRI(a.Metadata.ID).AddPath(string(typ)).String()
+	}
+	return iri.String()
+}
+
+// AP returns the ActivityPub representation of the collection: an OrderedCollection with only the number of accounts
+// when they're hidden, and a link to its first page otherwise, or the OrderedCollectionPage with the accounts
+func (c followCollection) AP() pub.Item {
+	if c.hidden || c.page <= 0 {
+		col := pub.OrderedCollectionNew(pub.ID(c.iri(0)))
+		col.TotalItems = uint(c.total)
+		if !c.hidden && c.total > 0 {
+			col.First = c.iri(1)
+		}
+		return col
+	}
+	p := pub.OrderedCollectionPageNew(pub.OrderedCollectionNew(pub.ID(c.iri(0))))
+	p.ID = pub.ID(c.iri(c.page))
+	p.TotalItems = uint(c.total)
+	for _, acc := range c.accounts {
+		if acc.HasMetadata() && len(acc.Metadata.ID) > 0 {
+			p.OrderedItems = append(p.OrderedItems, pub.IRI(acc.Metadata.ID))
+		}
+	}
+	if c.page > 1 {
+		p.Prev = c.iri(c.page - 1)
+	}
+	if c.page*c.pageSize < c.total {
+		p.Next = c.iri(c.page + 1)
+	}
+	return p
+}
+
+// acceptsActivityJSON returns true if the client asked for the ActivityPub representation of the resource
+func acceptsActivityJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/activity+json") || strings.Contains(accept, "application/ld+json")
+}
+
+// HandleFollowCollection serves the /~{handle}/followers and /~{handle}/following requests, as an ActivityPub
+// OrderedCollection for the clients that ask for it, or as a listing of the accounts.
+// Depending on the FOLLOW_COLLECTIONS_VISIBILITY, the viewers that can't see the accounts receive only their number.
+func (h *handler) HandleFollowCollection(w http.ResponseWriter, r *http.Request) {
+	authors := ContextAuthors(r.Context())
+	if len(authors) == 0 {
+		h.v.HandleErrors(w, r, errors.NotFoundf("account not found"))
+		return
+	}
+	owner := authors[0]
+	typ := handlers.CollectionType(path.Base(r.URL.Path))
+	activityJSON := acceptsActivityJSON(r)
+
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	maxItems, _ := strconv.Atoi(q.Get("maxItems"))
+	if !activityJSON && page <= 0 {
+		page = 1
+	}
+	col, err := h.storage.LoadFollowCollection(r.Context(), loggedAccount(r), owner, typ, page, maxItems)
+	if err != nil {
+		h.errFn()("Error: %s", err)
+		if activityJSON {
+			writeJSONError(w, err)
+		} else {
+			h.v.HandleErrors(w, r, err)
+		}
+		return
+	}
+	if activityJSON {
+		dat, _ := json.Marshal(col.AP())
+		w.Header().Set("Content-Type", "application/activity+json")
+		w.WriteHeader(http.StatusOK)
+		w.Write(dat)
+		return
+	}
+	m := &listingModel{tpl: "listing", User: &col.owner, Items: make(RenderableList), sortFn: ByDate}
+	m.Title = fmt.Sprintf("%d accounts following %s", col.total, owner.Handle)
+	if typ == handlers.Following {
+		m.Title = fmt.Sprintf("%d accounts followed by %s", col.total, owner.Handle)
+	}
+	for k := range col.accounts {
+		acc := col.accounts[k]
+		m.Items[acc.Hash] = &acc
+	}
+	if err := h.v.RenderTemplate(r, w, m.Template(), m); err != nil {
+		h.v.HandleErrors(w, r, err)
+	}
+}
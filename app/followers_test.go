@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/handlers"
+)
+
+func Test_handler_HandleFollowCollectionHidden(t *testing.T) {
+	const (
+		ownerHash    = "5d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c00"
+		followerHash = "5d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01"
+		otherHash    = "5d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c02"
+	)
+	f := newFakeFedbox()
+	defer f.Close()
+	f.add("/actors/"+ownerHash+"/followers", `{"type":"OrderedCollection","totalItems":2,"orderedItems":[
+		{"id":"%URL%/actors/`+followerHash+`","type":"Person","preferredUsername":"follower"},
+		{"id":"%URL%/actors/`+otherHash+`","type":"Person","preferredUsername":"other"}]}`)
+
+	h := testHandler(f)
+	h.storage.followCollections = FollowCollectionsFollowers
+	owner := Account{
+		Hash:     HashFromString(ownerHash),
+		Handle:   "owner",
+		Metadata: &AccountMetadata{ID: f.URL + "/actors/" + ownerHash, FollowersIRI: f.URL + "/actors/" + ownerHash + "/followers"},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/~owner/followers", nil)
+	req.Header.Set("Accept", "application/activity+json")
+	req = req.WithContext(context.WithValue(req.Context(), AuthorCtxtKey, []Account{owner}))
+	w := httptest.NewRecorder()
+	h.HandleFollowCollection(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Invalid status %d, expected %d", w.Code, http.StatusOK)
+	}
+	col := make(map[string]interface{})
+	if err := json.Unmarshal(w.Body.Bytes(), &col); err != nil {
+		t.Fatalf("Unable to unmarshal the collection: %s", err)
+	}
+	if total, _ := col["totalItems"].(float64); total != 2 {
+		t.Errorf("Invalid totalItems %v, expected 2", col["totalItems"])
+	}
+	for _, prop := range []string{"first", "orderedItems"} {
+		if _, ok := col[prop]; ok {
+			t.Errorf("The hidden followers collection should not contain %q for a stranger: %s", prop, w.Body.String())
+		}
+	}
+
+	follower := &Account{Hash: HashFromString(followerHash), Handle: "follower", Metadata: &AccountMetadata{ID: f.URL + "/actors/" + followerHash}}
+	fc, err := h.storage.LoadFollowCollection(context.Background(), follower, owner, handlers.Followers, 1, 10)
+	if err != nil {
+		t.Fatalf("Unable to load the followers: %s", err)
+	}
+	if fc.hidden || len(fc.accounts) != 2 {
+		t.Errorf("The followers should be visible to a follower, received %d of them, hidden %t", len(fc.accounts), fc.hidden)
+	}
+}
+
+func Test_loadAPPerson_FollowCollections(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	r := testRepository(srv)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(srv.URL), Type: pub.ServiceType}
+	Instance.BaseURL = "https://littr.example"
+	defer func() { Instance.BaseURL = "" }()
+
+	id := srv.URL + "/actors/" + testActorHash
+	acc := Account{
+		Hash:     HashFromString(testActorHash),
+		Handle:   "johndoe",
+		Metadata: &AccountMetadata{ID: id, FollowersIRI: id + "/followers", FollowingIRI: id + "/following"},
+	}
+	p := r.loadAPPerson(acc)
+	if p.Followers.GetLink() != "https://littr.example/~johndoe/followers" {
+		t.Errorf("Invalid followers %s, expected the collection we serve", p.Followers.GetLink())
+	}
+	if p.Following.GetLink() != "https://littr.example/~johndoe/following" {
+		t.Errorf("Invalid following %s, expected the collection we serve", p.Following.GetLink())
+	}
+
+	// NOTE(marius): the accounts loaded back from fedbox keep using its collections
+	loaded := Account{}
+	if err := loaded.FromActivityPub(p); err != nil {
+		t.Fatalf("Unable to load the account: %s", err)
+	}
+	if loaded.Metadata.FollowersIRI != id+"/followers" || loaded.Metadata.FollowingIRI != id+"/following" {
+		t.Errorf("Invalid collections %s, %s, expected the fedbox ones", loaded.Metadata.FollowersIRI, loaded.Metadata.FollowingIRI)
+	}
+}
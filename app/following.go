@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// followedOutboxActivities are the activities of the followed accounts shown in the following feed
+var followedOutboxActivities = ActivityTypesFilter(pub.CreateType, pub.AnnounceType)
+
+// withShares marks the collections loaded with the context as feeds where the shared objects are shown
+func withShares(ctx context.Context) context.Context {
+	return context.WithValue(ctx, SharesCtxtKey, true)
+}
+
+func showShares(ctx context.Context) bool {
+	show, _ := ctx.Value(SharesCtxtKey).(bool)
+	return show
+}
+
+// LoadFollowingFeed loads the home timeline of the account: its inbox, which fedbox fills with the submissions,
+// replies and shares of the accounts it follows. If the inbox can't be loaded, the feed falls back
+// to merging the outboxes of the followed accounts.
+func (r *repository) LoadFollowingFeed(ctx context.Context, acc *Account, f ...*Filters) (*Cursor, error) {
+	if acc == nil || acc.pub == nil {
+		return nil, errors.Errorf("Invalid account")
+	}
+	ctx = withShares(ctx)
+	cursor, err := r.LoadActorInbox(ctx, acc.pub, f...)
+	if err == nil {
+		return cursor, nil
+	}
+	r.errFn(log.Ctx{"err": err.Error(), "handle": acc.Handle})("unable to load the inbox, merging the followed accounts' outboxes")
+	return r.loadFollowedOutboxes(ctx, acc, f...)
+}
+
+// loadFollowedOutboxes merges the first pages of the outboxes of the accounts followed by acc
+// NOTE(marius): there's no pagination for the merged outboxes, as every one of them has its own cursor
+func (r *repository) loadFollowedOutboxes(ctx context.Context, acc *Account, f ...*Filters) (*Cursor, error) {
+	if len(acc.Following) == 0 {
+		if err := r.loadAccountsFollowing(ctx, acc); err != nil {
+			return nil, err
+		}
+	}
+	max := MaxContentItems
+	for _, ff := range f {
+		if ff != nil && ff.MaxItems > 0 {
+			max = ff.MaxItems
+		}
+	}
+	cursor := new(Cursor)
+	cursor.items = make(RenderableList, 0)
+	for _, followed := range acc.Following {
+		if followed.pub == nil {
+			continue
+		}
+		c, err := r.LoadActorOutbox(ctx, followed.pub, &Filters{Type: followedOutboxActivities, MaxItems: max})
+		if err != nil {
+			r.errFn(log.Ctx{"err": err.Error(), "handle": followed.Handle})("unable to load the followed account's outbox")
+			continue
+		}
+		cursor.items.Merge(c.items)
+	}
+	cursor.total = uint(len(cursor.items))
+	return cursor, nil
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_repository_LoadFollowingFeed(t *testing.T) {
+	const (
+		viewerHash = "7b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c00"
+		aliceHash  = "7b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01"
+		bobHash    = "7b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c02"
+		postHash   = "7b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c03"
+		replyHash  = "7b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c04"
+		sharedHash = "7b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c05"
+	)
+	want := []string{postHash, replyHash, sharedHash}
+
+	for _, inboxAvailable := range []bool{true, false} {
+		var srv *httptest.Server
+		actor := func(hash string) string { return fmt.Sprintf("%s/actors/%s", srv.URL, hash) }
+		post := func() string {
+			return fmt.Sprintf(`{"id":"%s/activities/1","type":"Create","actor":"%s","object":{"id":"%s/objects/%s","type":"Note","content":"post","attributedTo":"%s"}}`,
+				srv.URL, actor(aliceHash), srv.URL, postHash, actor(aliceHash))
+		}
+		reply := func() string {
+			return fmt.Sprintf(`{"id":"%s/activities/2","type":"Create","actor":"%s","object":{"id":"%s/objects/%s","type":"Note","content":"reply","attributedTo":"%s","inReplyTo":"%s/objects/%s"}}`,
+				srv.URL, actor(bobHash), srv.URL, replyHash, actor(bobHash), srv.URL, postHash)
+		}
+		share := func() string {
+			return fmt.Sprintf(`{"id":"%s/activities/3","type":"Announce","actor":"%s","object":"%s/objects/%s"}`, srv.URL, actor(bobHash), srv.URL, sharedHash)
+		}
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/actors/" + viewerHash + "/inbox":
+				if !inboxAvailable {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[%s,%s,%s]}`, post(), reply(), share()))
+			case "/actors/" + viewerHash + "/following":
+				writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[
+					{"id":"%s","type":"Person","preferredUsername":"alice"},
+					{"id":"%s","type":"Person","preferredUsername":"bob"}]}`, actor(aliceHash), actor(bobHash)))
+			case "/actors/" + aliceHash + "/outbox":
+				writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[%s]}`, post()))
+			case "/actors/" + bobHash + "/outbox":
+				writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[%s,%s]}`, reply(), share()))
+			case "/objects":
+				writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[{"id":"%s/objects/%s","type":"Note","content":"shared"}]}`, srv.URL, sharedHash))
+			default:
+				writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+			}
+		}))
+
+		r := testRepository(srv)
+		viewer := &Account{
+			Hash:     HashFromString(viewerHash),
+			Handle:   "viewer",
+			Metadata: &AccountMetadata{ID: actor(viewerHash), FollowingIRI: actor(viewerHash) + "/following"},
+			pub:      &pub.Actor{ID: pub.IRI(actor(viewerHash)), Type: pub.PersonType},
+		}
+		cursor, err := r.LoadFollowingFeed(context.Background(), viewer, &Filters{Type: FollowedActivitiesFilter, MaxItems: 10})
+		srv.Close()
+		if err != nil {
+			t.Fatalf("Unable to load the following feed (inbox available: %t): %s", inboxAvailable, err)
+		}
+		if len(cursor.items) != len(want) {
+			t.Errorf("Expected %d items in the following feed (inbox available: %t), received %d", len(want), inboxAvailable, len(cursor.items))
+		}
+		for _, h := range want {
+			if _, ok := cursor.items[HashFromString(h)]; !ok {
+				t.Errorf("The item %s of the followed accounts should be in the feed (inbox available: %t)", h, inboxAvailable)
+			}
+		}
+	}
+}
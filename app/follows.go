@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"time"
 
 	pub "github.com/go-ap/activitypub"
@@ -111,3 +112,32 @@ func (f *FollowRequest) IsValid() bool {
 func (f *FollowRequest) AP() pub.Item {
 	return f.pub
 }
+
+// existingActivity returns the activity of the typ type that er already sent for the ed account, if there is one.
+// It's used for not sending twice the Follow and Block activities, when one is still pending, or when the UI
+// submits the request twice.
+func (r *repository) existingActivity(ctx context.Context, er, ed Account, typ pub.ActivityVocabularyType) (pub.Item, error) {
+	object := r.loadAPPerson(ed).GetLink()
+	f := &Filters{
+		Type:   ActivityTypesFilter(typ),
+		Object: &Filters{IRI: AccountHashFilter(ed)},
+	}
+	col, err := r.fedbox.Outbox(ctx, r.loadAPPerson(er), Values(f))
+	if err != nil {
+		return nil, err
+	}
+	for _, it := range col.Collection() {
+		if it.GetType() != typ {
+			continue
+		}
+		var found bool
+		pub.OnActivity(it, func(a *pub.Activity) error {
+			found = a.Object != nil && a.Object.GetLink().Equals(object, false)
+			return nil
+		})
+		if found {
+			return it, nil
+		}
+	}
+	return nil, nil
+}
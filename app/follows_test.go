@@ -0,0 +1,57 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func Test_repository_FollowAccountIsIdempotent(t *testing.T) {
+	const followedHash = "8c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01"
+	var srv *httptest.Server
+	sent := make([]string, 0)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/outbox") {
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+			return
+		}
+		if r.Method == http.MethodPost {
+			body, _ := ioutil.ReadAll(r.Body)
+			iri := fmt.Sprintf("%s/activities/%d", srv.URL, len(sent)+1)
+			sent = append(sent, strings.Replace(string(body), `{`, fmt.Sprintf(`{"id":"%s",`, iri), 1))
+			w.Header().Set("Location", iri)
+			writeActivityJSON(w, http.StatusCreated, string(body))
+			return
+		}
+		writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[%s]}`, strings.Join(sent, ",")))
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	follower := testVote(srv, 1).SubmittedBy
+	follower.Metadata.OAuth.Token = &oauth2.Token{AccessToken: "t0k3n", TokenType: "Bearer"}
+	r.WithAccount(follower)
+	followed := Account{
+		Hash:     HashFromString(followedHash),
+		Handle:   "janedoe",
+		Metadata: &AccountMetadata{ID: srv.URL + "/actors/" + followedHash},
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := r.FollowAccount(context.Background(), *follower, followed, nil); err != nil {
+			t.Fatalf("Unable to follow account: %s", err)
+		}
+	}
+	if len(sent) != 1 {
+		t.Fatalf("Expected exactly one Follow activity to be sent, %d were", len(sent))
+	}
+	if !strings.Contains(sent[0], `"Follow"`) {
+		t.Errorf("Invalid activity sent %s, expected a Follow", sent[0])
+	}
+}
@@ -3,6 +3,7 @@ package app
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -28,6 +29,9 @@ type handler struct {
 	conf    appConfig
 	v       *view
 	storage *repository
+	cache   *cachedRepository
+	logins  *loginThrottle
+	limits  *rateLimiter
 	logger  log.Logger
 	infoFn  CtxLogFn
 	errFn   CtxLogFn
@@ -84,12 +88,28 @@ func Init(c appConfig) (*handler, error) {
 	c.SessionsBackend = strings.ToLower(c.SessionsBackend)
 	c.SessionKeys = loadEnvSessionKeys()
 	h.conf = c
+	MdPolicy = MarkdownOptionsFromConfig(c.Configuration).Renderer()
+	if instanceEmoji, err = newEmojiStore(c.CustomEmojiPath, c.BaseURL, c.EmojiMaxSize); err != nil {
+		h.errFn()("%s", err)
+	}
+	h.logins = newLoginThrottle(c.LoginMaxFailures, c.LoginFailureWindow, c.LoginLockout)
+	h.limits = newRateLimiter(c.RateLimits, c.RateLimitWindow)
+	if c.ImageProxy {
+		var key []byte
+		if len(c.SessionKeys) > 0 {
+			key = c.SessionKeys[0]
+		}
+		mediaProxy = newImageProxy(key, c.ImageProxyMaxSize, c.ImageProxyCacheSize, c.ImageProxyCacheTTL, c.ImageProxyInsecure)
+	}
 
 	h.storage, err = ActivityPubService(c)
 	if err != nil {
 		h.conf.UserCreatingEnabled = false
 		h.errFn()("Failed to load actor: %s", err)
 	} else {
+		if c.RepositoryCacheTTL > 0 {
+			h.cache = newCachedRepository(h.storage, newMemCache(c.RepositoryCacheTTL, c.RepositoryCacheSize))
+		}
 		provider := "fedbox"
 		config := GetOauth2Config(provider, h.conf.BaseURL)
 		ctx := log.Ctx{
@@ -112,7 +132,7 @@ func Init(c appConfig) (*handler, error) {
 
 				handle := oauth.ID.String()
 				ctx["handle"] = handle
-				tok, err := config.PasswordCredentialsToken(context.TODO(), handle, config.ClientSecret)
+				tok, err := config.PasswordCredentialsToken(withDefaultClient(context.TODO()), handle, config.ClientSecret)
 				if err != nil {
 					h.conf.UserCreatingEnabled = false
 					h.errFn(log.Ctx{"err": err}, ctx)("Failed to authenticate client")
@@ -128,6 +148,9 @@ func Init(c appConfig) (*handler, error) {
 						"type":    tok.TokenType,
 						"refresh": hideString(tok.RefreshToken),
 					})("Loaded valid OAuth2 token for client")
+					if err := h.storage.SyncRelays(context.TODO()); err != nil {
+						h.errFn(log.Ctx{"err": err})("Failed to update the relay subscriptions")
+					}
 
 				}
 			}
@@ -173,7 +196,7 @@ func (h *handler) HandleCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	conf := GetOauth2Config(provider, h.conf.BaseURL)
-	tok, err := conf.Exchange(r.Context(), code)
+	tok, err := conf.Exchange(withDefaultClient(r.Context()), code)
 	if err != nil {
 		h.errFn(log.Ctx{"err": err})("Unable to load token")
 		h.v.HandleErrors(w, r, err)
@@ -347,6 +370,10 @@ func loadAccountData(a *Account, b Account) {
 	if a.Metadata == nil && b.Metadata != nil {
 		a.Metadata = b.Metadata
 	}
+	// NOTE(marius): the preferences are saved with the actor, the ones in the session can be older
+	if a.HasMetadata() && b.HasMetadata() && b.Metadata.Preferences != nil {
+		a.Metadata.Preferences = b.Metadata.Preferences
+	}
 	if a.pub == nil && b.pub != nil {
 		a.pub = b.pub
 	}
@@ -409,6 +436,11 @@ func (h *handler) LoadSession(next http.Handler) http.Handler {
 			}
 
 			h.storage.WithAccount(&acc)
+			// NOTE(marius): the activities held while the account was new get federated on its first request after it's not
+			// at the new trust level anymore
+			if err := h.storage.releaseFederation(ctx, &acc); err != nil {
+				h.errFn(ltx, log.Ctx{"err": err.Error()})("unable to federate the account's held activities")
+			}
 			if time.Now().Sub(acc.Metadata.OutboxUpdated) > 5*time.Minute {
 				if err := h.storage.loadAccountsOutbox(ctx, &acc); err != nil {
 					h.errFn(ltx, log.Ctx{"err": err.Error()})("Unable to load account's Outbox")
@@ -459,6 +491,45 @@ func (h handler) NeedsSessions(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// ReadAccess redirects the anonymous visitors to the login page, if the instance doesn't allow anonymous reads
+func (h handler) ReadAccess(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		if !h.conf.AnonymousReadAccess && !loggedAccount(r).IsLogged() {
+			h.v.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// isSignedRequest returns true for the requests with an HTTP signature, which are signed for the host they were sent to
+func isSignedRequest(r *http.Request) bool {
+	return len(r.Header.Get("Signature")) > 0 || strings.HasPrefix(r.Header.Get("Authorization"), "Signature ")
+}
+
+// CanonicalHostMw redirects the requests for the other hosts the instance is reachable on to the canonical one.
+// The signed server to server requests are not redirected, as the remote servers can't follow them.
+func (h handler) CanonicalHostMw(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		canonical := h.conf.CanonicalHost
+		if len(canonical) == 0 || strings.EqualFold(r.Host, canonical) || isSignedRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if hostname, _, err := net.SplitHostPort(r.Host); err == nil && strings.EqualFold(hostname, canonical) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, fmt.Sprintf("%s%s", h.conf.BaseURL, r.URL.RequestURI()), status)
+	}
+	return http.HandlerFunc(fn)
+}
+
 // HandleAbout serves /about request
 // It's something Mastodon compatible servers should show
 func (h *handler) HandleAbout(w http.ResponseWriter, r *http.Request) {
@@ -476,6 +547,18 @@ func (h *handler) HandleAbout(w http.ResponseWriter, r *http.Request) {
 }
 
 func httpErrorResponse(e error) int {
+	var fe *fedboxError
+	if errors.As(e, &fe) {
+		return fe.status
+	}
+	var le *LockedError
+	if errors.As(e, &le) {
+		return http.StatusForbidden
+	}
+	var ve *ValidationError
+	if errors.As(e, &ve) {
+		return http.StatusBadRequest
+	}
 	if errors.IsBadRequest(e) {
 		return http.StatusBadRequest
 	}
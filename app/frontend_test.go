@@ -0,0 +1,94 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+func Test_handler_ReadAccess(t *testing.T) {
+	logged := &Account{
+		Hash:     HashFromString(testActorHash),
+		Handle:   "johndoe",
+		Metadata: &AccountMetadata{ID: "https://fedbox.example/actors/" + testActorHash},
+	}
+	tests := []struct {
+		name     string
+		enabled  bool
+		account  *Account
+		status   int
+		location string
+	}{
+		{name: "anonymous with access enabled", enabled: true, status: http.StatusOK},
+		{name: "anonymous with access disabled", enabled: false, status: http.StatusSeeOther, location: "/login"},
+		{name: "logged with access disabled", enabled: false, account: logged, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handler{
+				conf: appConfig{Configuration: config.Configuration{AnonymousReadAccess: tt.enabled}},
+				v:    &view{infoFn: defaultCtxLogFn, errFn: defaultCtxLogFn},
+			}
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.account != nil {
+				req = req.WithContext(context.WithValue(req.Context(), LoggedAccountCtxtKey, tt.account))
+			}
+			w := httptest.NewRecorder()
+			h.ReadAccess(next).ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("Invalid status %d, expected %d", w.Code, tt.status)
+			}
+			if loc := w.Header().Get("Location"); loc != tt.location {
+				t.Errorf("Invalid redirect location %q, expected %q", loc, tt.location)
+			}
+		})
+	}
+}
+
+func Test_handler_CanonicalHostMw(t *testing.T) {
+	tests := []struct {
+		name      string
+		canonical string
+		method    string
+		host      string
+		signed    bool
+		status    int
+		location  string
+	}{
+		{name: "disabled", method: http.MethodGet, host: "www.littr.example", status: http.StatusOK},
+		{name: "canonical host", canonical: "littr.example", method: http.MethodGet, host: "littr.example", status: http.StatusOK},
+		{name: "canonical host with port", canonical: "littr.example", method: http.MethodGet, host: "littr.example:443", status: http.StatusOK},
+		{name: "other host", canonical: "littr.example", method: http.MethodGet, host: "www.littr.example", status: http.StatusMovedPermanently, location: "https://littr.example/~johndoe?page=2"},
+		{name: "other host POST", canonical: "littr.example", method: http.MethodPost, host: "old.example", status: http.StatusPermanentRedirect, location: "https://littr.example/~johndoe?page=2"},
+		{name: "signed request", canonical: "littr.example", method: http.MethodPost, host: "www.littr.example", signed: true, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := handler{
+				conf: appConfig{Configuration: config.Configuration{CanonicalHost: tt.canonical}, BaseURL: "https://littr.example"},
+			}
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			req := httptest.NewRequest(tt.method, "/~johndoe?page=2", nil)
+			req.Host = tt.host
+			if tt.signed {
+				req.Header.Set("Signature", `keyId="https://remote.example/actors/jdoe#main-key",signature="c2lnbmF0dXJl"`)
+			}
+			w := httptest.NewRecorder()
+			h.CanonicalHostMw(next).ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("Invalid status %d, expected %d", w.Code, tt.status)
+			}
+			if loc := w.Header().Get("Location"); loc != tt.location {
+				t.Errorf("Invalid redirect location %q, expected %q", loc, tt.location)
+			}
+		})
+	}
+}
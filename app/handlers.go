@@ -67,8 +67,12 @@ func (h *handler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	repo := h.storage
-	if n, err = repo.SaveItem(ctx, n); err != nil {
+	items, votes := ContextItemRepository(r.Context()), ContextVoteRepository(r.Context())
+	if items == nil || votes == nil {
+		h.v.HandleErrors(w, r, errors.Newf("unable to load the repository"))
+		return
+	}
+	if n, err = items.SaveItem(ctx, n); err != nil {
 		h.errFn(log.Ctx{"err": err.Error()})("unable to save item")
 		h.v.HandleErrors(w, r, err)
 		return
@@ -80,7 +84,7 @@ func (h *handler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
 			Item:        &n,
 			Weight:      1 * ScoreMultiplier,
 		}
-		if _, err := repo.SaveVote(ctx, v); err != nil {
+		if _, err := votes.SaveVote(ctx, v); err != nil {
 			h.errFn(log.Ctx{
 				"err":    err.Error(),
 				"hash":   v.Item.Hash,
@@ -89,6 +93,9 @@ func (h *handler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
 			})("unable to save vote for item")
 		}
 	}
+	if h.storage.holds.Holds(acc) {
+		h.v.addFlashMessage(Info, w, r, "Your account is new, your posts are pending federation until it is older")
+	}
 	acc.Metadata.OutboxUpdated = time.Time{}
 	h.v.Redirect(w, r, ItemPermaLink(&n), http.StatusSeeOther)
 }
@@ -97,10 +104,13 @@ func (h *handler) HandleSubmit(w http.ResponseWriter, r *http.Request) {
 // HandleDelete serves /~{handle}/rm GET request
 func (h *handler) HandleDelete(w http.ResponseWriter, r *http.Request) {
 	acc := loggedAccount(r)
-	repo := h.storage
-	iri := objects.IRI(h.storage.fedbox.Service()).AddPath(chi.URLParam(r, "hash"))
+	repo := ContextItemRepository(r.Context())
+	if repo == nil {
+		h.v.HandleErrors(w, r, errors.Newf("unable to load the repository"))
+		return
+	}
 	ctx := context.TODO()
-	p, err := repo.LoadItem(ctx, iri)
+	p, err := repo.LoadItem(ctx, repo.ItemIRI(chi.URLParam(r, "hash")))
 	if err != nil {
 		h.errFn()("Error: %s", err)
 		h.v.HandleErrors(w, r, errors.NewNotFound(err, "not found"))
@@ -125,10 +135,13 @@ func (h *handler) HandleDelete(w http.ResponseWriter, r *http.Request) {
 // HandleVoting serves /~{handle}/{direction} request
 func (h *handler) HandleVoting(w http.ResponseWriter, r *http.Request) {
 	acc := loggedAccount(r)
-	repo := h.storage
+	items, votes := ContextItemRepository(r.Context()), ContextVoteRepository(r.Context())
+	if items == nil || votes == nil {
+		h.v.HandleErrors(w, r, errors.Newf("unable to load the repository"))
+		return
+	}
 	ctx := context.TODO()
-	iri := objects.IRI(h.storage.fedbox.Service()).AddPath(chi.URLParam(r, "hash"))
-	p, err := repo.LoadItem(ctx, iri)
+	p, err := items.LoadItem(ctx, items.ItemIRI(chi.URLParam(r, "hash")))
 	if err != nil {
 		h.errFn()("Error: %s", err)
 		h.v.HandleErrors(w, r, errors.NewNotFound(err, "not found"))
@@ -155,7 +168,7 @@ func (h *handler) HandleVoting(w http.ResponseWriter, r *http.Request) {
 			Item:        &p,
 			Weight:      multiplier * ScoreMultiplier,
 		}
-		if _, err := repo.SaveVote(ctx, v); err != nil {
+		if _, err := votes.SaveVote(ctx, v); err != nil {
 			h.errFn(log.Ctx{
 				"hash":   v.Item.Hash,
 				"author": v.SubmittedBy.Handle,
@@ -279,7 +292,7 @@ func (h *handler) BlockItem(w http.ResponseWriter, r *http.Request) {
 	repo := h.storage
 	reason.Metadata.Tags = loadTagsIfExisting(repo, ctx, reason.Metadata.Tags)
 
-	it, err := repo.LoadItem(ctx, objects.IRI(repo.fedbox.Service()).AddPath(chi.URLParam(r, "hash")))
+	it, err := repo.LoadItem(ctx, repo.ItemIRI(chi.URLParam(r, "hash")))
 	if err != nil {
 		h.errFn(log.Ctx{ "before": err })("invalid item to report")
 		h.v.HandleErrors(w, r, errors.NewNotFound(err, ""))
@@ -342,7 +355,7 @@ func (h *handler) ReportItem(w http.ResponseWriter, r *http.Request) {
 	repo := h.storage
 	reason.Metadata.Tags = loadTagsIfExisting(repo, ctx, reason.Metadata.Tags)
 
-	p, err := repo.LoadItem(ctx, objects.IRI(repo.fedbox.Service()).AddPath(chi.URLParam(r, "hash")))
+	p, err := repo.LoadItem(ctx, repo.ItemIRI(chi.URLParam(r, "hash")))
 	if err != nil {
 		h.errFn(log.Ctx{ "before": err })("invalid item to report")
 		h.v.HandleErrors(w, r, errors.NewNotFound(err, ""))
@@ -371,6 +384,12 @@ func (h *handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	state := r.PostFormValue("state")
 	ctx := context.TODO()
 
+	throttleKeys := []string{loginAccountKey(handle), loginAddrKey(r)}
+	if wait, locked := h.logins.locked(throttleKeys...); locked {
+		h.tooManyLogins(w, r, wait)
+		return
+	}
+
 	config := GetOauth2Config("fedbox", h.conf.BaseURL)
 	// Try to load actor from handle
 	accts, err := h.storage.accounts(ctx, &Filters{
@@ -393,6 +412,7 @@ func (h *handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 			err = errors.NotFoundf(handle)
 		}
 		lCtx["err"] = err.Error()
+		h.logins.fail(throttleKeys...)
 		handleErr("Login failed: invalid username or password", lCtx)
 		return
 	}
@@ -402,7 +422,7 @@ func (h *handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		acct = AnonymousAccount
 	)
 	for _, cur := range accts {
-		if tok, err = config.PasswordCredentialsToken(context.TODO(), cur.Metadata.ID, pw); tok != nil {
+		if tok, err = config.PasswordCredentialsToken(withDefaultClient(context.TODO()), cur.Metadata.ID, pw); tok != nil {
 			acct = cur
 			acct.Metadata.OAuth.Provider = "fedbox"
 			acct.Metadata.OAuth.Token = tok
@@ -414,6 +434,7 @@ func (h *handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 			err = errors.Errorf("unable to authenticate account")
 		}
 		lCtx["err"] = err.Error()
+		h.logins.fail(throttleKeys...)
 		handleErr("Login failed: invalid username or password", lCtx)
 		return
 	}
@@ -423,6 +444,16 @@ func (h *handler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		handleErr("Login failed: unable to save session", lCtx)
 		return
 	}
+	if h.storage.TOTPEnabled(&acct) {
+		// NOTE(marius): the account needs to pass the two-factor authentication check in HandleLoginTOTP
+		// before it becomes the current one
+		s.Values[SessionPendingTOTPKey] = acct
+		h.v.Redirect(w, r, "/login/otp", http.StatusSeeOther)
+		return
+	}
+	// NOTE(marius): we don't reset the failures of the remote address, otherwise logging in to an account
+	// would allow guessing the passwords of the other ones
+	h.logins.reset(loginAccountKey(handle))
 	s.Values[SessionUserKey] = acct
 	h.v.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -466,7 +497,7 @@ func (h *handler) ValidateItemAuthor(op string) Handler {
 			action := path.Base(url.Path)
 			if len(hash) > 0 && action != hash {
 				repo := h.storage
-				m, err := repo.LoadItem(ctx, objects.IRI(repo.fedbox.Service()).AddPath(hash))
+				m, err := repo.LoadItem(ctx, repo.ItemIRI(hash))
 				if err != nil {
 					ctxtErr(next, w, r, errors.NewNotFound(err, "item"))
 					return
@@ -486,11 +517,20 @@ func (h *handler) ValidateItemAuthor(op string) Handler {
 
 // HandleItemRedirect serves /i/{hash} request
 func (h *handler) HandleItemRedirect(w http.ResponseWriter, r *http.Request) {
-	repo := h.storage
+	repo := ContextItemRepository(r.Context())
+	if repo == nil {
+		h.v.HandleErrors(w, r, errors.Newf("unable to load the repository"))
+		return
+	}
 	ctx := context.TODO()
-	p, err := repo.LoadItem(ctx, objects.IRI(repo.fedbox.Service()).AddPath(chi.URLParam(r, "hash")))
+	hash := HashFromString(chi.URLParam(r, "hash"))
+	if !hash.IsValid() {
+		h.v.HandleErrors(w, r, errors.NotFoundf("%q item", chi.URLParam(r, "hash")))
+		return
+	}
+	p, err := repo.LoadItem(ctx, repo.ItemIRI(hash.String()))
 	if err != nil {
-		h.v.HandleErrors(w, r, errors.NewNotValid(err, "oops!"))
+		h.v.HandleErrors(w, r, errors.NewNotFound(err, "item %s", hash))
 		return
 	}
 	url := ItemPermaLink(&p)
@@ -509,7 +549,7 @@ func getPassCode(h *handler, acc *Account, invitee *Account, r *http.Request) (s
 	config.Scopes = []string{scopeAnonymousUserCreate}
 	param := oauth2.SetAuthURLParam("actor", invitee.pub.GetLink().String())
 	sessUrl := config.AuthCodeURL(csrf.Token(r), param)
-	res, err := http.Get(sessUrl)
+	res, err := defaultClient.Get(sessUrl)
 	if err != nil {
 		return "", err
 	}
@@ -639,14 +679,14 @@ func (h *handler) HandleRegister(w http.ResponseWriter, r *http.Request) {
 	form.Add("pw", pw)
 	form.Add("pw-confirm", pwConfirm)
 
-	pwChRes, err := http.Post(u.String(), "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	pwChRes, err := defaultClient.Post(u.String(), "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
 	if body, err = ioutil.ReadAll(pwChRes.Body); err != nil {
 		h.errFn()("Error: %s", err)
 		h.v.HandleErrors(w, r, err)
 		return
 	}
 	if pwChRes.StatusCode != http.StatusOK {
-		h.v.HandleErrors(w, r, h.storage.handlerErrorResponse(body))
+		h.v.HandleErrors(w, r, h.storage.handlerErrorResponse(pwChRes.StatusCode, body))
 		return
 	}
 	h.v.Redirect(w, r, "/", http.StatusSeeOther)
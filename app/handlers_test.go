@@ -0,0 +1,109 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-chi/chi"
+)
+
+// fakeFedbox is an in-memory fedbox instance for the handler tests, it serves the canned objects added to it,
+// fails with the injected status for the paths in errs, and returns empty collections for everything else.
+type fakeFedbox struct {
+	*httptest.Server
+	m       sync.RWMutex
+	objects map[string]string
+	errs    map[string]int
+}
+
+func newFakeFedbox() *fakeFedbox {
+	f := &fakeFedbox{objects: make(map[string]string), errs: make(map[string]int)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	return f
+}
+
+// add makes the fake serve the raw JSON document at path, the document can use the %URL% placeholder
+func (f *fakeFedbox) add(path, raw string) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.objects[path] = strings.ReplaceAll(raw, "%URL%", f.URL)
+}
+
+// fail makes the requests to path fail with the status
+func (f *fakeFedbox) fail(path string, status int) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.errs[path] = status
+}
+
+func (f *fakeFedbox) serve(w http.ResponseWriter, r *http.Request) {
+	f.m.RLock()
+	defer f.m.RUnlock()
+	if status, ok := f.errs[r.URL.Path]; ok {
+		msg, _ := json.Marshal(http.StatusText(status))
+		writeActivityJSON(w, status, `{"errors":[{"message":`+string(msg)+`}]}`)
+		return
+	}
+	if raw, ok := f.objects[r.URL.Path]; ok {
+		writeActivityJSON(w, http.StatusOK, raw)
+		return
+	}
+	writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+}
+
+// testHandler returns a handler using the fake fedbox, with the sessions disabled
+func testHandler(f *fakeFedbox) *handler {
+	repo := testRepository(f.Server)
+	repo.fedbox.pub = &pub.Actor{ID: pub.IRI(f.URL), Type: pub.ServiceType}
+	return &handler{
+		storage: repo,
+		v:       &view{c: Instance.Conf, infoFn: defaultCtxLogFn, errFn: defaultCtxLogFn},
+		infoFn:  defaultCtxLogFn,
+		errFn:   defaultCtxLogFn,
+	}
+}
+
+func Test_handler_HandleItemRedirect(t *testing.T) {
+	const federatedHash = "8b2d3f4e-5c6a-4b7f-9d8e-0f1a2b3c4d05"
+	f := newFakeFedbox()
+	defer f.Close()
+	f.add("/objects/"+testObjectHash, `{"id":"%URL%/objects/`+testObjectHash+`","type":"Note","content":"local","published":"2020-04-01T10:00:00Z"}`)
+	f.add("/objects/"+federatedHash, `{"id":"%URL%/objects/`+federatedHash+`","type":"Note","content":"remote","url":"https://remote.example/notes/1"}`)
+	f.fail("/objects/"+testLikeHash, http.StatusNotFound)
+
+	h := testHandler(f)
+	rt := chi.NewRouter()
+	rt.With(h.Repository).Get("/i/{hash}", h.HandleItemRedirect)
+	rt.Get("/no-repository/i/{hash}", h.HandleItemRedirect)
+
+	tests := []struct {
+		name     string
+		path     string
+		hash     string
+		status   int
+		location string
+	}{
+		{name: "local item", hash: testObjectHash, status: http.StatusMovedPermanently, location: "/2020/04/01/" + testObjectHash},
+		{name: "federated item", hash: federatedHash, status: http.StatusMovedPermanently, location: "https://remote.example/notes/1"},
+		{name: "missing item", hash: testLikeHash, status: http.StatusNotFound},
+		{name: "invalid hash", hash: "not-a-hash", status: http.StatusNotFound},
+		{name: "missing repository", path: "/no-repository", hash: testObjectHash, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rt.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path+"/i/"+tt.hash, nil))
+			if w.Code != tt.status {
+				t.Errorf("HandleItemRedirect() status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Errorf("HandleItemRedirect() location = %q, want %q", got, tt.location)
+			}
+		})
+	}
+}
@@ -56,6 +56,12 @@ func (h Hash) MarshalText() ([]byte, error) {
 	return []byte(h.String()), nil
 }
 
+// UnmarshalText
+func (h *Hash) UnmarshalText(data []byte) error {
+	*h = HashFromString(string(data))
+	return nil
+}
+
 func (h Hash) IsValid() bool {
 	return uuid.UUID(h).Time() > 0
 }
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"context"
+	"sync"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// HeldActivity is an item, or a vote, of an account at the new trust level, which was addressed only to the
+// local instance. It is saved in the account preferences, with the recipients it will be addressed to once released.
+type HeldActivity struct {
+	IRI    pub.IRI                    `json:"iri"`
+	Type   pub.ActivityVocabularyType `json:"type"`
+	Object pub.IRI                    `json:"object,omitempty"`
+	To     []pub.IRI                  `json:"to,omitempty"`
+	CC     []pub.IRI                  `json:"cc,omitempty"`
+}
+
+func heldRecipients(col pub.ItemCollection) []pub.IRI {
+	result := make([]pub.IRI, 0, len(col))
+	for _, it := range col {
+		if it != nil {
+			result = append(result, it.GetLink())
+		}
+	}
+	return result
+}
+
+func recipientsCollection(iris []pub.IRI) pub.ItemCollection {
+	result := make(pub.ItemCollection, 0, len(iris))
+	for _, iri := range iris {
+		result = append(result, iri)
+	}
+	return result
+}
+
+// federationHold decides which accounts have their activities kept on the current instance, the ones at the
+// new trust level. Their held activities are saved in their preferences, and they get federated on the first
+// request of their author after leaving the level.
+type federationHold struct {
+	m     sync.Mutex
+	trust *trustLevels
+}
+
+func newFederationHold(trust *trustLevels) *federationHold {
+	return &federationHold{trust: trust}
+}
+
+// Holds returns true if the activities of the account don't federate yet
+func (h *federationHold) Holds(acc *Account) bool {
+	if h == nil || acc == nil {
+		return false
+	}
+	return h.trust.For(acc) == TrustLevelNew
+}
+
+// holdFederation saves the activity with the account, so it can be addressed to its full audience later
+func (r *repository) holdFederation(ctx context.Context, acc *Account, held HeldActivity) error {
+	if len(held.IRI) == 0 {
+		return nil
+	}
+	return r.SavePreferences(ctx, acc, func(p *AccountPreferences) {
+		p.Held = append(p.Held, held)
+	})
+}
+
+// forgetHeld removes the activity from the ones held for the account, for the votes that were retracted
+func (r *repository) forgetHeld(ctx context.Context, acc *Account, iri pub.IRI) error {
+	found := false
+	for _, held := range accountPreferences(acc).Held {
+		found = found || held.IRI.Equals(iri, false)
+	}
+	if !found {
+		return nil
+	}
+	return r.SavePreferences(ctx, acc, func(p *AccountPreferences) {
+		remaining := make([]HeldActivity, 0, len(p.Held))
+		for _, held := range p.Held {
+			if !held.IRI.Equals(iri, false) {
+				remaining = append(remaining, held)
+			}
+		}
+		p.Held = remaining
+	})
+}
+
+// releaseFederation sends the held activities of the account to their full audience, once it's not at the new
+// trust level anymore. The items get Update activities, and the votes are undone locally and sent again.
+func (r *repository) releaseFederation(ctx context.Context, acc *Account) error {
+	if r.holds == nil || r.holds.Holds(acc) || len(accountPreferences(acc).Held) == 0 {
+		return nil
+	}
+	// NOTE(marius): we don't want concurrent requests of the same account to federate its activities twice
+	r.holds.m.Lock()
+	defer r.holds.m.Unlock()
+
+	author := r.loadAPPerson(*acc).GetLink()
+	failed := make([]HeldActivity, 0)
+	var err error
+	for _, held := range accountPreferences(acc).Held {
+		var rerr error
+		if ValidAppreciationTypes.Contains(held.Type) {
+			rerr = r.releaseVote(ctx, author, held)
+		} else {
+			rerr = r.releaseItem(ctx, author, held)
+		}
+		if rerr != nil {
+			err = rerr
+			failed = append(failed, held)
+			r.errFn(log.Ctx{"iri": held.IRI, "err": rerr})("unable to federate held activity")
+		}
+	}
+	if serr := r.SavePreferences(ctx, acc, func(p *AccountPreferences) { p.Held = failed }); serr != nil {
+		return serr
+	}
+	return err
+}
+
+func (r *repository) releaseItem(ctx context.Context, author pub.IRI, held HeldActivity) error {
+	ob, err := r.fedbox.Object(ctx, held.IRI)
+	if err != nil {
+		return errors.Annotatef(err, "unable to load held item %s", held.IRI)
+	}
+	if ob == nil || ob.GetType() == pub.TombstoneType {
+		// NOTE(marius): the item was deleted while it was held
+		return nil
+	}
+	to, cc := recipientsCollection(held.To), recipientsCollection(held.CC)
+	ob.To, ob.CC = to, cc
+	upd := &pub.Activity{
+		Type:   pub.UpdateType,
+		To:     to,
+		CC:     cc,
+		BCC:    pub.ItemCollection{r.instanceAudience()},
+		Actor:  author,
+		Object: ob,
+	}
+	_, _, err = r.fedbox.ToOutbox(ctx, upd)
+	return err
+}
+
+func (r *repository) releaseVote(ctx context.Context, author pub.IRI, held HeldActivity) error {
+	undo := &pub.Activity{
+		Type:   pub.UndoType,
+		To:     pub.ItemCollection{localAudience()},
+		BCC:    pub.ItemCollection{r.instanceAudience()},
+		Actor:  author,
+		Object: held.IRI,
+	}
+	if _, _, err := r.fedbox.ToOutbox(ctx, undo); err != nil {
+		return errors.Annotatef(err, "unable to undo held vote %s", held.IRI)
+	}
+	vote := &pub.Activity{
+		Type:   held.Type,
+		To:     recipientsCollection(held.To),
+		BCC:    pub.ItemCollection{r.instanceAudience()},
+		Actor:  author,
+		Object: held.Object,
+	}
+	_, _, err := r.fedbox.ToOutbox(ctx, vote)
+	return err
+}
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"golang.org/x/oauth2"
+)
+
+func Test_repository_SaveItemHeldForNewAccounts(t *testing.T) {
+	const remote = "https://remote.example/users/jane"
+	f := newAccountFedbox()
+	defer f.Close()
+
+	r := testRepository(f.Server)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(f.URL), Type: pub.ServiceType}
+	r.holds = newFederationHold(newTrustLevels(72*time.Hour, 0, 0))
+	author := testVote(f.Server, 1).SubmittedBy
+	author.CreatedAt = time.Now().Add(-time.Hour)
+	author.Metadata.OAuth.Token = &oauth2.Token{AccessToken: "t0k3n", TokenType: "Bearer"}
+	r.WithAccount(author)
+
+	it := Item{
+		SubmittedBy: author,
+		Data:        "hello",
+		MimeType:    "text/plain",
+		Metadata: &ItemMetadata{
+			To: AccountCollection{{Handle: "jane", Metadata: &AccountMetadata{ID: remote}}},
+		},
+	}
+	if _, err := r.SaveItem(context.Background(), it); err != nil {
+		t.Fatalf("Unable to save item: %s", err)
+	}
+	posted := f.activities()
+	if len(posted) != 1 || posted[0].Type != pub.CreateType {
+		t.Fatalf("Expected the Create activity to be stored, received %d activities", len(posted))
+	}
+	for _, col := range []pub.ItemCollection{posted[0].To, posted[0].CC, posted[0].BCC} {
+		for _, rec := range col {
+			if rec.GetLink().Equals(pub.PublicNS, true) || !HostIsLocal(rec.GetLink().String()) {
+				t.Errorf("The activity of a new account is addressed to %s", rec.GetLink())
+			}
+		}
+	}
+	stored := f.storedAccount(t, r)
+	stored.CreatedAt = author.CreatedAt
+	if held := accountPreferences(stored).Held; len(held) != 1 {
+		t.Fatalf("Expected the item to be saved as held with the account, got %d held items", len(held))
+	}
+
+	// NOTE(marius): the held items survive restarts, and are released on the first request of the account
+	// after it gets old enough
+	r.holds = newFederationHold(newTrustLevels(72*time.Hour, 0, 0))
+	if err := r.releaseFederation(context.Background(), stored); err != nil {
+		t.Fatalf("Unable to release the held items: %s", err)
+	}
+	if len(f.activities()) != 1 {
+		t.Errorf("The items of a new account should not be released")
+	}
+	stored.CreatedAt = time.Now().Add(-96 * time.Hour)
+	if err := r.releaseFederation(context.Background(), stored); err != nil {
+		t.Fatalf("Unable to release the held items: %s", err)
+	}
+	posted = f.activities()
+	if len(posted) != 2 || posted[1].Type != pub.UpdateType {
+		t.Fatalf("Expected an Update activity for the held item, received %d activities", len(posted))
+	}
+	if !posted[1].To.Contains(pub.PublicNS) || !posted[1].To.Contains(pub.IRI(remote)) {
+		t.Errorf("The released item should be addressed to its full audience, received %v", posted[1].To)
+	}
+	if len(accountPreferences(stored).Held) > 0 || len(accountPreferences(f.storedAccount(t, r)).Held) > 0 {
+		t.Errorf("The released items should not be held anymore")
+	}
+}
+
+func Test_repository_SaveVoteHeldForNewAccounts(t *testing.T) {
+	f := newAccountFedbox()
+	defer f.Close()
+
+	r := testRepository(f.Server)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(f.URL), Type: pub.ServiceType}
+	r.holds = newFederationHold(newTrustLevels(72*time.Hour, 0, 0))
+	v := testVote(f.Server, 1)
+	v.SubmittedBy.CreatedAt = time.Now().Add(-time.Hour)
+	v.SubmittedBy.Metadata.OAuth.Token = &oauth2.Token{AccessToken: "t0k3n", TokenType: "Bearer"}
+
+	if _, err := r.SaveVote(context.Background(), v); err != nil {
+		t.Fatalf("Unable to save vote: %s", err)
+	}
+	posted := f.activities()
+	if len(posted) != 1 || posted[0].Type != pub.LikeType || posted[0].To.Contains(pub.PublicNS) {
+		t.Fatalf("Expected a local only Like activity, received %v", posted)
+	}
+	stored := f.storedAccount(t, r)
+	held := accountPreferences(stored).Held
+	if len(held) != 1 || held[0].Type != pub.LikeType {
+		t.Fatalf("Expected the vote to be saved as held with the account, received %v", held)
+	}
+
+	stored.CreatedAt = time.Now().Add(-96 * time.Hour)
+	if err := r.releaseFederation(context.Background(), stored); err != nil {
+		t.Fatalf("Unable to release the held vote: %s", err)
+	}
+	posted = f.activities()
+	if len(posted) != 3 || posted[1].Type != pub.UndoType || posted[2].Type != pub.LikeType {
+		t.Fatalf("Expected the local vote to be undone and sent again, received %d activities", len(posted))
+	}
+	if !posted[2].To.Contains(pub.PublicNS) || !posted[2].Object.GetLink().Equals(pub.IRI(v.Item.Metadata.ID), false) {
+		t.Errorf("The released vote should be public, and for the same item, received %v", posted[2])
+	}
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi"
+)
+
+const (
+	// AvatarIdenticon generates a symmetric pattern from the account's hash for the accounts without an avatar
+	AvatarIdenticon = "identicon"
+	// AvatarInitials uses the initial of the account's handle for the accounts without an avatar
+	AvatarInitials = "initials"
+	// AvatarNone leaves the accounts without an avatar
+	AvatarNone = "none"
+
+	// identiconSize is the number of cells on each side of the identicon
+	identiconSize = 5
+)
+
+// avatarStyle returns the configured style of the default avatars
+func avatarStyle() string {
+	if Instance.Conf == nil || len(Instance.Conf.AvatarStyle) == 0 {
+		return AvatarIdenticon
+	}
+	return Instance.Conf.AvatarStyle
+}
+
+// identiconURL returns the stable URL of the generated avatar of the account with the h hash
+func identiconURL(h Hash) string {
+	return fmt.Sprintf("%s/avatar/%s.svg", Instance.BaseURL, h)
+}
+
+// identicon returns the SVG image generated from the h hash: a grid of cells mirrored on the vertical axis,
+// in a color picked from the hash, so the same account always gets the same image
+func identicon(h Hash) []byte {
+	sum := sha256.Sum256([]byte(h.String()))
+	hue := int(sum[0]) * 360 / 256
+	buf := bytes.Buffer{}
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" class="icon avatar" width="48" height="48" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, identiconSize, identiconSize)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="#f0f0f0"/><g fill="hsl(%d, 55%%, 50%%)">`, hue)
+	half := (identiconSize + 1) / 2
+	for y := 0; y < identiconSize; y++ {
+		for x := 0; x < half; x++ {
+			if sum[1+y*half+x]&1 == 0 {
+				continue
+			}
+			fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="1" height="1"/>`, x, y)
+			if mirror := identiconSize - 1 - x; mirror != x {
+				fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="1" height="1"/>`, mirror, y)
+			}
+		}
+	}
+	buf.WriteString(`</g></svg>`)
+	return buf.Bytes()
+}
+
+// HandleIdenticon serves the /avatar/{hash}.svg generated avatars
+func (h *handler) HandleIdenticon(w http.ResponseWriter, r *http.Request) {
+	hash := HashFromString(strings.TrimSuffix(chi.URLParam(r, "hash"), ".svg"))
+	if !hash.IsValid() || avatarStyle() != AvatarIdenticon {
+		h.v.HandleErrors(w, r, errors.NotFoundf("avatar %q", chi.URLParam(r, "hash")))
+		return
+	}
+	w.Header().Set("Content-Type", MimeTypeSVG)
+	w.Header().Set("Cache-Control", "public, max-age=604800, immutable")
+	w.WriteHeader(http.StatusOK)
+	w.Write(identicon(hash))
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"bytes"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+func Test_accountDefaultAvatarIdenticon(t *testing.T) {
+	Instance.Conf = &config.Configuration{HostName: "littr.example", APIURL: "https://fedbox.example", AvatarStyle: AvatarIdenticon}
+	Instance.BaseURL = "https://littr.example"
+	defer func() { Instance.BaseURL = "" }()
+
+	actor := &pub.Actor{
+		ID:                pub.IRI("https://fedbox.example/actors/" + testActorHash),
+		Type:              pub.PersonType,
+		PreferredUsername: pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content("johndoe")}},
+	}
+	want := "https://littr.example/avatar/" + testActorHash + ".svg"
+	for i := 0; i < 2; i++ {
+		acc := Account{}
+		if err := acc.FromActivityPub(actor); err != nil {
+			t.Fatalf("unable to load account: %s", err)
+		}
+		if acc.Metadata.Icon.URI != want || acc.Metadata.Icon.MimeType != MimeTypeSVG {
+			t.Errorf("Invalid default avatar %q %s, expected %q", acc.Metadata.Icon.URI, acc.Metadata.Icon.MimeType, want)
+		}
+	}
+
+	r := repository{fedbox: &fedbox{}}
+	p := r.loadAPPerson(Account{Hash: HashFromString(testActorHash), Handle: "johndoe", Metadata: &AccountMetadata{}})
+	if p.Icon == nil || p.Icon.(*pub.Object).URL.GetLink() != pub.IRI(want) {
+		t.Errorf("The generated avatar should be the federated icon of the actor, received %v", p.Icon)
+	}
+
+	one, other := identicon(HashFromString(testActorHash)), identicon(HashFromString(testObjectHash))
+	if !bytes.Equal(one, identicon(HashFromString(testActorHash))) {
+		t.Errorf("The identicon of an account should always be the same")
+	}
+	if bytes.Equal(one, other) {
+		t.Errorf("Different accounts should get different identicons")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	pub "github.com/go-ap/activitypub"
 	"github.com/go-ap/errors"
 	"github.com/go-chi/chi"
+	"github.com/mariusor/go-littr/internal/config"
 )
 
 type ItemMetadata struct {
@@ -24,6 +25,28 @@ type ItemMetadata struct {
 	SharesURI  string            `json:"shares,omitempty"`
 	AuthorURI  string            `json:"author,omitempty"`
 	Icon       ImageMetadata     `json:"icon,omitempty"`
+	Emoji      TagCollection     `json:"emoji,omitempty"`
+	Alternates []LinkMetadata    `json:"alternates,omitempty"`
+	Lang       string            `json:"lang,omitempty"`
+	Alt        string            `json:"alt,omitempty"`
+	Domain     string            `json:"domain,omitempty"`
+	// Attachments are the media objects attached to the item
+	Attachments []AttachmentMetadata `json:"attachments,omitempty"`
+}
+
+// AttachmentMetadata is a media object attached to an item, received in the attachment collection of its object
+type AttachmentMetadata struct {
+	URI      string `json:"uri,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Alt      string `json:"alt,omitempty"`
+	Width    uint   `json:"width,omitempty"`
+	Height   uint   `json:"height,omitempty"`
+}
+
+// LinkMetadata is one of the representations of an item, received in the url array of its object
+type LinkMetadata struct {
+	URI      string `json:"uri,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
 }
 
 var ValidContentTypes = pub.ActivityVocabularyTypes{
@@ -70,6 +93,14 @@ func (i Item) Mentions() TagCollection {
 	return i.Metadata.Mentions
 }
 
+// Emoji returns the custom emoji used in the current Item
+func (i Item) Emoji() TagCollection {
+	if i.Metadata == nil {
+		return nil
+	}
+	return i.Metadata.Emoji
+}
+
 func (i *Item) Deleted() bool {
 	return i != nil && (i.Flags&FlagsDeleted) == FlagsDeleted
 }
@@ -100,6 +131,74 @@ func (i *Item) MakePublic() {
 	i.Flags ^= FlagsPrivate
 }
 
+// Brigaded returns true if the votes on the item look like a coordinated brigade
+func (i *Item) Brigaded() bool {
+	return i != nil && (i.Flags&FlagsBrigaded) == FlagsBrigaded
+}
+
+// LocalOnly returns true if the item is not supposed to federate outside the current instance
+func (i *Item) LocalOnly() bool {
+	return i != nil && (i.Flags&FlagsLocalOnly) == FlagsLocalOnly
+}
+
+// MakeLocalOnly marks the item as visible only for the current instance
+func (i *Item) MakeLocalOnly() {
+	i.Flags |= FlagsLocalOnly
+}
+
+// Locked returns true if the item doesn't accept new replies
+func (i *Item) Locked() bool {
+	return i != nil && (i.Flags&FlagsLocked) == FlagsLocked
+}
+
+// Lock marks the item as not accepting new replies
+func (i *Item) Lock() {
+	i.Flags |= FlagsLocked
+}
+
+// Unlock marks the item as accepting new replies again
+func (i *Item) Unlock() {
+	i.Flags &^= FlagsLocked
+}
+
+// Sensitive returns true if the item was marked as sensitive by its author
+func (i *Item) Sensitive() bool {
+	return i != nil && (i.Flags&FlagsSensitive) == FlagsSensitive
+}
+
+// MarkSensitive marks the item as sensitive
+func (i *Item) MarkSensitive() {
+	i.Flags |= FlagsSensitive
+}
+
+// LowScore returns true if the item's content is shown collapsed in the listing for its low score
+func (i *Item) LowScore() bool {
+	return i != nil && (i.Flags&FlagsLowScore) == FlagsLowScore
+}
+
+// CollapseLowScore marks the item to be shown collapsed in the listing for its low score
+func (i *Item) CollapseLowScore() {
+	i.Flags |= FlagsLowScore
+}
+
+// Collapsed returns true if the item's content is shown collapsed in the listing
+func (i *Item) Collapsed() bool {
+	return i != nil && (i.Flags&FlagsCollapsed) == FlagsCollapsed
+}
+
+// Collapse marks the item's content to be shown collapsed
+func (i *Item) Collapse() {
+	i.Flags |= FlagsCollapsed
+}
+
+// Alt returns the description of the item's image
+func (i *Item) Alt() string {
+	if i == nil || !i.HasMetadata() {
+		return ""
+	}
+	return i.Metadata.Alt
+}
+
 func (i *Item) IsLink() bool {
 	return i != nil && i.MimeType == MimeTypeURL
 }
@@ -118,8 +217,69 @@ func (i ItemCollection) First() (*Item, error) {
 
 const (
 	MaxContentItems = 35
+	MaxPageSize     = 100
 )
 
+// clampPageSize returns the page size n bound to the (0, max] interval, or def if n is not set
+func clampPageSize(n, def, max int) int {
+	if def <= 0 {
+		def = MaxContentItems
+	}
+	if max <= 0 {
+		max = MaxPageSize
+	}
+	if def > max {
+		def = max
+	}
+	if n <= 0 {
+		return def
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// validMimeType checks that the content type of an item is in the allowed list,
+// or in config.DefaultMimeTypes if the list is empty
+func validMimeType(allowed []string, typ string) error {
+	if len(allowed) == 0 {
+		allowed = strings.Split(config.DefaultMimeTypes, ",")
+	}
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	for _, m := range allowed {
+		if len(typ) > 0 && typ == m {
+			return nil
+		}
+	}
+	return errors.BadRequestf("unsupported content type %q", typ)
+}
+
+const (
+	// HTMLPolicySanitize runs the HTML submissions through the same sanitizer as the federated content
+	HTMLPolicySanitize = "sanitize"
+	// HTMLPolicyReject refuses the HTML submissions
+	HTMLPolicyReject = "reject"
+	// HTMLPolicyAllow saves the HTML submissions as they are
+	HTMLPolicyAllow = "allow"
+)
+
+// applyHTMLPolicy sanitizes, or rejects, the content of an HTML item depending on the policy.
+// An unknown policy is treated as HTMLPolicySanitize.
+func applyHTMLPolicy(policy string, i *Item) error {
+	if i == nil || !strings.EqualFold(i.MimeType, MimeTypeHTML) {
+		return nil
+	}
+	switch policy {
+	case HTMLPolicyAllow:
+		return nil
+	case HTMLPolicyReject:
+		return errors.BadRequestf("HTML submissions are not allowed")
+	}
+	i.Data = LocalHTMLPolicy.Sanitize(i.Data)
+	return nil
+}
+
 func detectMimeType(data string) string {
 	u, err := url.ParseRequestURI(data)
 	if err == nil && u != nil && !bytes.ContainsRune([]byte(data), '\n') {
@@ -154,6 +314,9 @@ func updateItemFromRequest(r *http.Request, author Account, i *Item) error {
 	if tit := r.PostFormValue("title"); len(tit) > 0 {
 		i.Title = tit
 	}
+	if lang := normalizeLang(r.PostFormValue("lang")); len(lang) > 0 {
+		i.Metadata.Lang = lang
+	}
 	if dat := r.PostFormValue("data"); len(dat) > 0 {
 		i.Data = dat
 	}
@@ -162,12 +325,16 @@ func updateItemFromRequest(r *http.Request, author Account, i *Item) error {
 	i.MimeType = detectMimeType(i.Data)
 
 	i.Metadata.Tags, i.Metadata.Mentions = loadTags(i.Data)
+	i.Metadata.Emoji = loadEmoji(i.Data)
 	if !i.IsLink() {
 		i.MimeType = r.PostFormValue("mime-type")
 	}
 	if len(i.Data) > 0 {
 		now := time.Now().UTC()
-		i.SubmittedAt = now
+		// NOTE(marius): an edit keeps the original publish time, so it doesn't move the item in the "new" listings
+		if i.SubmittedAt.IsZero() {
+			i.SubmittedAt = now
+		}
 		i.UpdatedAt = now
 	}
 	if parent := HashFromString(r.PostFormValue("parent")); parent.IsValid() {
@@ -175,6 +342,20 @@ func updateItemFromRequest(r *http.Request, author Account, i *Item) error {
 			i.Parent = &Item{Hash: parent}
 		}
 	}
+	if q := r.PostFormValue("quote"); len(q) > 0 {
+		if u, err := url.ParseRequestURI(q); err == nil && len(u.Host) > 0 {
+			i.Quote = &Item{Hash: HashFromIRI(pub.IRI(q)), Metadata: &ItemMetadata{ID: q}}
+		}
+	}
+	if r.PostFormValue("local-only") == "on" {
+		i.MakeLocalOnly()
+	}
+	if r.PostFormValue("sensitive") == "on" {
+		i.MarkSensitive()
+	}
+	if alt := strings.TrimSpace(r.PostFormValue("alt")); len(alt) > 0 {
+		i.Metadata.Alt = alt
+	}
 	if op := HashFromString(r.PostFormValue("op")); op.IsValid() {
 		if i.OP != nil || i.OP.Hash != op {
 			i.OP = &Item{Hash: op}
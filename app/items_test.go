@@ -0,0 +1,253 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_clampPageSize(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		def  int
+		max  int
+		want int
+	}{
+		{
+			name: "not set",
+			n:    0,
+			def:  20,
+			max:  50,
+			want: 20,
+		},
+		{
+			name: "within bounds",
+			n:    30,
+			def:  20,
+			max:  50,
+			want: 30,
+		},
+		{
+			name: "over large",
+			n:    5000,
+			def:  20,
+			max:  50,
+			want: 50,
+		},
+		{
+			name: "no configuration",
+			n:    5000,
+			want: MaxPageSize,
+		},
+		{
+			name: "default larger than max",
+			n:    -1,
+			def:  200,
+			max:  50,
+			want: 50,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clampPageSize(tt.n, tt.def, tt.max); got != tt.want {
+				t.Errorf("clampPageSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_repository_clampPageSize(t *testing.T) {
+	r := repository{pageSize: 10, maxPageSize: 40}
+	f1 := &Filters{MaxItems: 1000}
+	f2 := &Filters{}
+	r.clampPageSize(f1, f2, nil)
+	if f1.MaxItems != 40 {
+		t.Errorf("Invalid MaxItems %d, expected it to be clamped to %d", f1.MaxItems, 40)
+	}
+	if f2.MaxItems != 10 {
+		t.Errorf("Invalid MaxItems %d, expected the default %d", f2.MaxItems, 10)
+	}
+}
+
+func Test_validMimeType(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		typ     string
+		valid   bool
+	}{
+		{name: "markdown with defaults", typ: MimeTypeMarkdown, valid: true},
+		{name: "url with defaults", typ: MimeTypeURL, valid: true},
+		{name: "empty type", typ: "", valid: false},
+		{name: "unknown type", typ: "application/x-shockwave-flash", valid: false},
+		{name: "html disabled", allowed: []string{MimeTypeMarkdown, MimeTypeText}, typ: MimeTypeHTML, valid: false},
+		{name: "text allowed", allowed: []string{MimeTypeMarkdown, MimeTypeText}, typ: "Text/Plain", valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validMimeType(tt.allowed, tt.typ)
+			if tt.valid && err != nil {
+				t.Errorf("validMimeType(%v, %q) returned error %s", tt.allowed, tt.typ, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("validMimeType(%v, %q) should have returned an error", tt.allowed, tt.typ)
+			}
+		})
+	}
+}
+
+func Test_repository_SaveItemRejectsMimeType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("No request should be made for an unsupported content type, got %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.mimeTypes = []string{MimeTypeMarkdown, MimeTypeText}
+	author := testVote(srv, 1).SubmittedBy
+
+	_, err := r.SaveItem(context.Background(), Item{SubmittedBy: author, MimeType: MimeTypeHTML, Data: "<p>raw</p>"})
+	if err == nil {
+		t.Fatalf("SaveItem should reject the disabled %s content type", MimeTypeHTML)
+	}
+	if status := httpErrorResponse(err); status != http.StatusBadRequest {
+		t.Errorf("Invalid status %d for unsupported content type, expected %d", status, http.StatusBadRequest)
+	}
+}
+
+func Test_repository_SaveItemRequiresAltText(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("No request should be made for an image without description, got %s %s", r.Method, r.URL)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.requireAltText = true
+	author := testVote(srv, 1).SubmittedBy
+
+	it := Item{SubmittedBy: author, MimeType: MimeTypeURL, Data: "https://images.example/cat.png", Metadata: &ItemMetadata{}}
+	_, err := r.SaveItem(context.Background(), it)
+	if err == nil {
+		t.Fatalf("SaveItem should reject an image without description")
+	}
+	if status := httpErrorResponse(err); status != http.StatusBadRequest {
+		t.Errorf("Invalid status %d for an image without description, expected %d", status, http.StatusBadRequest)
+	}
+
+	it.Metadata.Alt = "A cat sleeping on a keyboard"
+	if err := r.checkAltText(it); err != nil {
+		t.Errorf("The image with a description should be accepted: %s", err)
+	}
+	ob := new(pub.Object)
+	if err := loadAPItem(ob, it); err != nil {
+		t.Fatalf("Unable to convert the item: %s", err)
+	}
+	if ob.Type != pub.ImageType {
+		t.Errorf("Invalid type %s for the link to an image, expected %s", ob.Type, pub.ImageType)
+	}
+	ob.ID = pub.IRI(srv.URL + "/objects/" + testObjectHash)
+	loaded := Item{}
+	if err := loaded.FromActivityPub(ob); err != nil {
+		t.Fatalf("Unable to load the item: %s", err)
+	}
+	if loaded.Alt() != it.Metadata.Alt {
+		t.Errorf("Invalid description %q after the round trip, expected %q", loaded.Alt(), it.Metadata.Alt)
+	}
+}
+
+func Test_applyHTMLPolicy(t *testing.T) {
+	const data = `<p>hello</p><script>alert("xss")</script>`
+	tests := []struct {
+		name     string
+		policy   string
+		mimeType string
+		wantErr  bool
+		want     string
+	}{
+		{name: "sanitize", policy: HTMLPolicySanitize, mimeType: MimeTypeHTML, want: "<p>hello</p>"},
+		{name: "unknown policy sanitizes", policy: "", mimeType: MimeTypeHTML, want: "<p>hello</p>"},
+		{name: "reject", policy: HTMLPolicyReject, mimeType: MimeTypeHTML, wantErr: true},
+		{name: "allow", policy: HTMLPolicyAllow, mimeType: MimeTypeHTML, want: data},
+		{name: "not html", policy: HTMLPolicyReject, mimeType: MimeTypeMarkdown, want: data},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := Item{MimeType: tt.mimeType, Data: data}
+			err := applyHTMLPolicy(tt.policy, &it)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("applyHTMLPolicy(%q) should have rejected the submission", tt.policy)
+				}
+				if status := httpErrorResponse(err); status != http.StatusBadRequest {
+					t.Errorf("Invalid status %d, expected %d", status, http.StatusBadRequest)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyHTMLPolicy(%q) returned error %s", tt.policy, err)
+			}
+			if it.Data != tt.want {
+				t.Errorf("Invalid content %q, expected %q", it.Data, tt.want)
+			}
+		})
+	}
+}
+
+func Test_Item_FromActivityPubURLArray(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		wantURL    string
+		alternates []LinkMetadata
+	}{
+		{
+			name:    "single IRI",
+			url:     `"https://remote.example/@jdoe/1"`,
+			wantURL: "https://remote.example/@jdoe/1",
+		},
+		{
+			name: "array of links",
+			url: `[
+				{"type":"Link","href":"https://remote.example/objects/1.json","mediaType":"application/activity+json"},
+				{"type":"Link","href":"https://remote.example/@jdoe/1","mediaType":"text/html"},
+				"https://remote.example/objects/1.txt"
+			]`,
+			wantURL: "https://remote.example/@jdoe/1",
+			alternates: []LinkMetadata{
+				{URI: "https://remote.example/objects/1.json", MimeType: "application/activity+json"},
+				{URI: "https://remote.example/objects/1.txt"},
+			},
+		},
+		{
+			name:    "array without an html link",
+			url:     `[{"type":"Link","href":"https://remote.example/objects/1.json","mediaType":"application/activity+json"}]`,
+			wantURL: "https://remote.example/objects/1.json",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := `{"id":"https://remote.example/objects/` + testObjectHash + `","type":"Note","content":"hello","url":` + tt.url + `}`
+			it, err := pub.UnmarshalJSON([]byte(raw))
+			if err != nil {
+				t.Fatalf("Unable to unmarshal the object: %s", err)
+			}
+			i := Item{}
+			if err := i.FromActivityPub(it); err != nil {
+				t.Fatalf("Unable to load the item: %s", err)
+			}
+			if i.Metadata.URL != tt.wantURL {
+				t.Errorf("Invalid URL %q, expected %q", i.Metadata.URL, tt.wantURL)
+			}
+			if !reflect.DeepEqual(i.Metadata.Alternates, tt.alternates) {
+				t.Errorf("Invalid alternates %v, expected %v", i.Metadata.Alternates, tt.alternates)
+			}
+		})
+	}
+}
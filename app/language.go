@@ -0,0 +1,154 @@
+package app
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+const (
+	// minLanguageWords is the minimum number of common words a text must have for its language to be detected
+	minLanguageWords = 2
+)
+
+// languageWords are the most common words of the languages we can detect, which are rarely used by the others
+var languageWords = map[string][]string{
+	"en": {"the", "and", "is", "are", "was", "were", "of", "to", "this", "that", "with", "have", "for", "not", "you", "it", "be", "what", "which", "they"},
+	"fr": {"le", "la", "les", "des", "est", "et", "une", "un", "du", "pour", "pas", "que", "qui", "dans", "sur", "avec", "nous", "vous", "ce", "je", "c'est", "mais"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "ich", "zu", "mit", "sich", "auf", "für", "auch", "es", "wir", "sind", "dem", "den"},
+	"es": {"el", "los", "las", "es", "y", "un", "una", "que", "por", "para", "con", "no", "pero", "como", "está", "del", "lo", "muy", "yo"},
+	"it": {"il", "lo", "gli", "della", "di", "che", "non", "è", "per", "una", "sono", "con", "anche", "questo", "ma", "io", "nel"},
+	"pt": {"o", "os", "as", "não", "uma", "um", "que", "com", "para", "é", "do", "da", "mas", "em", "eu", "você", "muito"},
+	"nl": {"de", "het", "een", "en", "is", "niet", "van", "dat", "die", "ik", "je", "op", "voor", "zijn", "met", "ook", "maar"},
+	"ro": {"și", "este", "nu", "în", "cu", "pe", "care", "la", "mai", "pentru", "sunt", "fost", "dar", "acest", "un", "o"},
+}
+
+var (
+	// langCodeRegexp matches the language codes users can set for their items, eg: "fr", "pt-BR"
+	langCodeRegexp = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+	// langSkipRegexp matches the parts of the content that aren't prose: the links, code, mentions and tags
+	langSkipRegexp = regexp.MustCompile("(?s)```.*?```|`[^`]*`|https?://\\S+|[@#]\\S+")
+)
+
+// normalizeLang returns the lower case language code, or an empty string if it's not a valid one
+func normalizeLang(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if !langCodeRegexp.MatchString(lang) {
+		return ""
+	}
+	return lang
+}
+
+// detectLanguage returns the code of the language the text is written in, from the number of common words
+// of every language it contains. It returns an empty string if it doesn't find enough of them,
+// or if two languages match equally.
+func detectLanguage(text string) string {
+	text = langSkipRegexp.ReplaceAllString(strings.ToLower(text), " ")
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	scores := make(map[string]int)
+	for _, w := range words {
+		for lang, common := range languageWords {
+			for _, c := range common {
+				if w == c {
+					scores[lang]++
+					break
+				}
+			}
+		}
+	}
+	best, bestScore, tied := "", 0, false
+	for lang, score := range scores {
+		switch {
+		case score > bestScore:
+			best, bestScore, tied = lang, score, false
+		case score == bestScore:
+			tied = true
+		}
+	}
+	if bestScore < minLanguageWords || tied {
+		return ""
+	}
+	return best
+}
+
+// detectItemLanguage sets the language of the item to the one its title and content are written in,
+// if its author didn't choose one
+func detectItemLanguage(it *Item) {
+	if !it.HasMetadata() || len(it.Metadata.Lang) > 0 || it.IsLink() {
+		return
+	}
+	it.Metadata.Lang = detectLanguage(it.Title + "\n" + it.Data)
+}
+
+// defaultLangRef returns the configured language reference of the content we don't know the language of,
+// or the nil one if the instance doesn't have a default language
+func defaultLangRef() pub.LangRef {
+	if Instance.Conf == nil {
+		return pub.NilLangRef
+	}
+	if lang := normalizeLang(Instance.Conf.DefaultLanguage); len(lang) > 0 {
+		return pub.LangRef(lang)
+	}
+	return pub.NilLangRef
+}
+
+// itemLangRef returns the language reference the item's content is published under: the item's language,
+// or the instance's default one
+func itemLangRef(it Item) pub.LangRef {
+	if it.HasMetadata() && len(it.Metadata.Lang) > 0 {
+		return pub.LangRef(it.Metadata.Lang)
+	}
+	return defaultLangRef()
+}
+
+// langFromValues returns the language of the natural language values, if it's known
+func langFromValues(v pub.NaturalLanguageValues) string {
+	for _, val := range v {
+		if val.Ref != pub.NilLangRef && len(val.Ref) > 0 {
+			return normalizeLang(string(val.Ref))
+		}
+	}
+	return ""
+}
+
+// languagesFromRequest loads the languages the listing is restricted to, from the comma separated lang query values,
+// and if the items of unknown language are shown too
+func languagesFromRequest(r *http.Request) ([]string, bool) {
+	q := r.URL.Query()
+	langs := make([]string, 0)
+	for _, val := range q["lang"] {
+		for _, l := range strings.Split(val, ",") {
+			if l = normalizeLang(l); len(l) > 0 {
+				langs = append(langs, l)
+			}
+		}
+	}
+	unknown := q.Get("unknown-lang") == "true" || q.Get("unknown-lang") == "on"
+	return langs, unknown
+}
+
+// validLanguage returns true if the item is in one of the languages of the filter, or a regional variant of one.
+// The items of unknown language are kept only if the filter allows them.
+func validLanguage(i Item, f *Filters) bool {
+	if f == nil || len(f.Languages) == 0 {
+		return true
+	}
+	var lang string
+	if i.HasMetadata() {
+		lang = i.Metadata.Lang
+	}
+	if len(lang) == 0 {
+		return f.UnknownLang
+	}
+	for _, l := range f.Languages {
+		if lang == l || strings.HasPrefix(lang, l+"-") {
+			return true
+		}
+	}
+	return false
+}
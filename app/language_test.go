@@ -0,0 +1,135 @@
+package app
+
+import (
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+func Test_detectLanguage(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "french", text: "Bonjour à tous, c'est une belle journée et nous allons au marché pour acheter des légumes.", want: "fr"},
+		{name: "english", text: "This is the best thing that happened to the project, and we are happy with it.", want: "en"},
+		{name: "german", text: "Das ist nicht so einfach, wie es aussieht, und ich bin auch nicht sicher.", want: "de"},
+		{name: "too short", text: "Merci!", want: ""},
+		{name: "links and tags", text: "https://example.com/the/and/is #the @and", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectLanguage(tt.text); got != tt.want {
+				t.Errorf("detectLanguage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_detectItemLanguage(t *testing.T) {
+	it := Item{
+		Hash:     HashFromString(testObjectHash),
+		Title:    "Une question pour les développeurs",
+		Data:     "Est-ce que vous avez déjà utilisé ce logiciel? Je cherche une solution pour mon serveur et je ne sais pas par où commencer.",
+		MimeType: MimeTypeMarkdown,
+		Metadata: &ItemMetadata{},
+	}
+	detectItemLanguage(&it)
+	if it.Metadata.Lang != "fr" {
+		t.Fatalf("The french post should be tagged %q, received %q", "fr", it.Metadata.Lang)
+	}
+	ob := new(pub.Object)
+	if err := loadAPItem(ob, it); err != nil {
+		t.Fatalf("Unable to load the item: %s", err)
+	}
+	if !ob.Content.Get("fr").Equals(pub.Content(Markdown(it.Data))) || len(ob.Name.Get("fr")) == 0 {
+		t.Errorf("The content of the french post should be published under the %q language, received %v", "fr", ob.Content)
+	}
+
+	overridden := Item{Data: it.Data, MimeType: MimeTypeMarkdown, Metadata: &ItemMetadata{Lang: "ca"}}
+	detectItemLanguage(&overridden)
+	if overridden.Metadata.Lang != "ca" {
+		t.Errorf("The language chosen by the author should be kept, received %q", overridden.Metadata.Lang)
+	}
+}
+
+func Test_filterItems_Languages(t *testing.T) {
+	note := func(hash string, lang pub.LangRef, content string) Item {
+		ob := &pub.Object{
+			ID:      pub.IRI("https://fedbox.example/objects/" + hash),
+			Type:    pub.NoteType,
+			Content: pub.NaturalLanguageValues{{Ref: lang, Value: pub.Content(content)}},
+		}
+		it := Item{}
+		if err := it.FromActivityPub(ob); err != nil {
+			t.Fatalf("Unable to load the item: %s", err)
+		}
+		return it
+	}
+	items := ItemCollection{
+		note("9d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01", "en", "Hello"),
+		note("9d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c02", "fr", "Bonjour"),
+		note("9d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c03", "en-GB", "Cheers"),
+		note("9d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c04", "de", "Hallo"),
+		note("9d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c05", pub.NilLangRef, "Hi"),
+	}
+
+	english := filterItems(items, &Filters{Languages: []string{"en"}})
+	if len(english) != 2 {
+		t.Fatalf("Expected 2 english items, received %d", len(english))
+	}
+	for _, it := range english {
+		if it.Metadata.Lang != "en" && it.Metadata.Lang != "en-gb" {
+			t.Errorf("Invalid item language %q, expected english", it.Metadata.Lang)
+		}
+	}
+	if withUnknown := filterItems(items, &Filters{Languages: []string{"en"}, UnknownLang: true}); len(withUnknown) != 3 {
+		t.Errorf("Expected 3 english items, or of unknown language, received %d", len(withUnknown))
+	}
+	if all := filterItems(items, &Filters{}); len(all) != len(items) {
+		t.Errorf("Expected all the %d items without a language filter, received %d", len(items), len(all))
+	}
+}
+
+func Test_loadAPItem_Language(t *testing.T) {
+	prevConf := Instance.Conf
+	defer func() { Instance.Conf = prevConf }()
+
+	tests := []struct {
+		name        string
+		defaultLang string
+		lang        string
+		want        pub.LangRef
+	}{
+		{name: "item language", defaultLang: "fr", lang: "de", want: "de"},
+		{name: "instance default", defaultLang: "fr", want: "fr"},
+		{name: "unknown", want: pub.NilLangRef},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Instance.Conf = &config.Configuration{DefaultLanguage: tt.defaultLang}
+			it := Item{
+				Hash:     HashFromString(testObjectHash),
+				Title:    "Ein Titel",
+				Data:     "Ein *kurzer* Text",
+				MimeType: MimeTypeMarkdown,
+				Metadata: &ItemMetadata{Lang: tt.lang},
+			}
+			ob := new(pub.Object)
+			if err := loadAPItem(ob, it); err != nil {
+				t.Fatalf("Unable to load the item: %s", err)
+			}
+			if len(ob.Content) != 1 || ob.Content[0].Ref != tt.want {
+				t.Errorf("The content should be published under the %q language, received %v", tt.want, ob.Content)
+			}
+			if len(ob.Source.Content) != 1 || ob.Source.Content[0].Ref != tt.want {
+				t.Errorf("The source should be published under the %q language, received %v", tt.want, ob.Source.Content)
+			}
+			if len(ob.Name) != 1 || ob.Name[0].Ref != tt.want {
+				t.Errorf("The title should be published under the %q language, received %v", tt.want, ob.Name)
+			}
+		})
+	}
+}
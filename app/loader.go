@@ -15,6 +15,8 @@ var (
 	AuthorCtxtKey        CtxtKey = "__author"
 	CursorCtxtKey        CtxtKey = "__cursor"
 	ContentCtxtKey       CtxtKey = "__content"
+	UserAgentCtxtKey     CtxtKey = "__ua"
+	SharesCtxtKey        CtxtKey = "__shares"
 )
 
 type WebInfo struct {
@@ -60,7 +62,12 @@ func ContextModerationModel(ctx context.Context) *moderationModel {
 
 func ContextRepository(ctx context.Context) *repository {
 	var r *repository
-	r, _ = ctx.Value(RepositoryCtxtKey).(*repository)
+	switch s := ctx.Value(RepositoryCtxtKey).(type) {
+	case *repository:
+		r = s
+	case *cachedRepository:
+		r, _ = s.Repository.(*repository)
+	}
 	return r
 }
 
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// LockedIRI is the Href of the Link tag that marks an item as not accepting new replies,
+// it's the "locked" term of our JSON-LD namespace
+const LockedIRI = pub.IRI("https://littr.me/ns#locked")
+
+// lockedLink returns the tag we add to a locked object
+func lockedLink() *pub.Link {
+	return &pub.Link{
+		Type: pub.LinkType,
+		Href: LockedIRI,
+		Name: pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content("locked")}},
+	}
+}
+
+// isLocked returns true if there's a locked Link in the tags
+func isLocked(tags pub.ItemCollection) bool {
+	for _, t := range tags {
+		if l, ok := t.(*pub.Link); ok && l.Href.Equals(LockedIRI, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// LockedError is returned for the new replies to a locked item
+type LockedError struct {
+	IRI pub.IRI
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s is locked, it doesn't accept new replies", e.IRI)
+}
+
+// LockItem stops the item from accepting new replies, only its author and the moderators can lock it
+func (r *repository) LockItem(ctx context.Context, by Account, it Item) (Item, error) {
+	return r.setLocked(ctx, by, it, true)
+}
+
+// UnlockItem allows new replies to a locked item again
+func (r *repository) UnlockItem(ctx context.Context, by Account, it Item) (Item, error) {
+	return r.setLocked(ctx, by, it, false)
+}
+
+func (r *repository) setLocked(ctx context.Context, by Account, it Item, lock bool) (Item, error) {
+	if !by.IsLogged() {
+		return it, errors.Unauthorizedf("invalid account %s", by.Handle)
+	}
+	if !by.IsModerator() && (it.SubmittedBy == nil || it.SubmittedBy.Hash != by.Hash) {
+		return it, errors.Forbiddenf("only the author and the moderators can lock an item")
+	}
+	if it.Locked() == lock {
+		return it, nil
+	}
+	if lock {
+		it.Lock()
+	} else {
+		it.Unlock()
+	}
+	it, err := r.SaveItem(ctx, it)
+	if err != nil {
+		return it, err
+	}
+	r.infoFn(log.Ctx{"item": it.Hash, "locked": lock, "by": by.Handle})("updated item lock")
+	return it, nil
+}
+
+// lockedObject returns true if the object at iri is tagged as locked
+func (r *repository) lockedObject(ctx context.Context, iri pub.IRI) bool {
+	if len(iri) == 0 {
+		return false
+	}
+	ob, err := r.fedbox.Object(ctx, iri)
+	if err != nil || ob == nil {
+		return false
+	}
+	return isLocked(ob.Tag)
+}
+
+// checkLocked refuses a new reply when the item it replies to, or the top level item of its thread, is locked.
+// The edits of the existing replies are still accepted.
+func (r *repository) checkLocked(ctx context.Context, it Item) error {
+	if it.Parent == nil {
+		return nil
+	}
+	if _, ok := BuildIDFromItem(it); ok {
+		return nil
+	}
+	for _, anc := range []*Item{it.Parent, it.OP} {
+		if anc == nil {
+			continue
+		}
+		iri, _ := BuildIDFromItem(*anc)
+		if anc.Locked() || r.lockedObject(ctx, iri) {
+			return &LockedError{IRI: iri}
+		}
+	}
+	return nil
+}
+
+// processReply checks the object of a remote Create activity, and refuses it if the object replies to
+// a locked item, so the caller can reject the activity.
+func (r *repository) processReply(ctx context.Context, act *pub.Activity) error {
+	if act == nil || act.Type != pub.CreateType || act.Object == nil {
+		return errors.BadRequestf("invalid Create activity")
+	}
+	return pub.OnObject(act.Object, func(o *pub.Object) error {
+		iris := make(pub.IRIs, 0)
+		if o.InReplyTo != nil {
+			if col, ok := o.InReplyTo.(pub.ItemCollection); ok {
+				for _, it := range col {
+					iris = append(iris, it.GetLink())
+				}
+			} else {
+				iris = append(iris, o.InReplyTo.GetLink())
+			}
+		}
+		if o.Context != nil && !iris.Contains(o.Context.GetLink()) {
+			iris = append(iris, o.Context.GetLink())
+		}
+		for _, iri := range iris {
+			if r.lockedObject(ctx, iri) {
+				r.infoFn(log.Ctx{"iri": o.ID, "inReplyTo": iri})("refused reply to locked item")
+				return &LockedError{IRI: iri}
+			}
+		}
+		return nil
+	})
+}
+
+// isRemoteReply returns true if the object of the Create activity of a remote actor is a reply
+func isRemoteReply(act *pub.Activity) bool {
+	if act == nil || act.Actor == nil || HostIsLocal(act.Actor.GetLink().String()) {
+		return false
+	}
+	reply := false
+	pub.OnObject(act.Object, func(o *pub.Object) error {
+		reply = o.InReplyTo != nil
+		return nil
+	})
+	return reply
+}
+
+// lockedReplies returns the IRIs of the remote Create activities that reply to locked items.
+// The activities of the remote accounts are received by fedbox, in the inboxes, so we refuse them when
+// we load them from there.
+func (r *repository) lockedReplies(ctx context.Context, creates ...*pub.Activity) pub.IRIs {
+	refused := make(pub.IRIs, 0)
+	for _, act := range creates {
+		var le *LockedError
+		if err := r.processReply(ctx, act); errors.As(err, &le) {
+			refused = append(refused, act.GetLink())
+		}
+	}
+	return refused
+}
+
+// HandleLockItem serves the /lock and /unlock requests of the item's author and of the moderators
+func (h *handler) HandleLockItem(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	ctx := context.TODO()
+	p, err := h.storage.LoadItem(ctx, h.storage.ItemIRI(chi.URLParam(r, "hash")))
+	if err != nil {
+		h.errFn()("Error: %s", err)
+		h.v.HandleErrors(w, r, errors.NewNotFound(err, "not found"))
+		return
+	}
+	if path.Base(r.URL.Path) == "unlock" {
+		p, err = h.storage.UnlockItem(ctx, *acc, p)
+	} else {
+		p, err = h.storage.LockItem(ctx, *acc, p)
+	}
+	if err != nil {
+		h.errFn()("Error: %s", err)
+		h.v.addFlashMessage(Error, w, r, "Unable to update the item lock")
+	}
+	h.v.Redirect(w, r, ItemPermaLink(&p), http.StatusFound)
+}
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"golang.org/x/oauth2"
+)
+
+func Test_repository_SaveItemRejectsReplyToLocked(t *testing.T) {
+	var posted bool
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posted = true
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch r.URL.Path {
+		case "/objects/a":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s/objects/a","type":"Note","tag":[{"type":"Link","href":"%s"}]}`, srv.URL, LockedIRI))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	author := testVote(srv, 1).SubmittedBy
+	author.Metadata.OAuth.Token = &oauth2.Token{AccessToken: "t0k3n", TokenType: "Bearer"}
+	r.WithAccount(author)
+	it := Item{
+		SubmittedBy: author,
+		Data:        "reply",
+		MimeType:    "text/plain",
+		Parent:      &Item{Hash: HashFromString(testThreadHashes["a"]), Metadata: &ItemMetadata{ID: srv.URL + "/objects/a"}},
+		Metadata:    &ItemMetadata{},
+	}
+
+	_, err := r.SaveItem(context.Background(), it)
+	var le *LockedError
+	if !errors.As(err, &le) {
+		t.Fatalf("Expected a locked error for a reply to a locked item, received: %v", err)
+	}
+	if le.IRI != pub.IRI(srv.URL+"/objects/a") {
+		t.Errorf("Expected the locked error for %s/objects/a, received %s", srv.URL, le.IRI)
+	}
+	if httpErrorResponse(err) != http.StatusForbidden {
+		t.Errorf("Expected the locked error to be served as %d, received %d", http.StatusForbidden, httpErrorResponse(err))
+	}
+	if posted {
+		t.Errorf("The reply to the locked item should not have been sent to the outbox")
+	}
+
+	reply := &pub.Activity{
+		Type:   pub.CreateType,
+		Object: &pub.Object{Type: pub.NoteType, InReplyTo: pub.IRI(srv.URL + "/objects/a")},
+	}
+	if err := r.processReply(context.Background(), reply); !errors.As(err, &le) {
+		t.Errorf("Expected a locked error for a remote reply to a locked item, received: %v", err)
+	}
+
+	// NOTE(marius): the remote replies arrive in the inboxes through fedbox, so they're refused when they're loaded
+	remote := &pub.Activity{ID: "https://remote.example/activities/1", Type: pub.CreateType, Actor: pub.IRI("https://remote.example/users/jdoe"), Object: reply.Object}
+	unlocked := &pub.Activity{
+		ID:     "https://remote.example/activities/2",
+		Type:   pub.CreateType,
+		Actor:  remote.Actor,
+		Object: &pub.Object{Type: pub.NoteType, InReplyTo: pub.IRI(srv.URL + "/objects/b")},
+	}
+	local := &pub.Activity{Type: pub.CreateType, Actor: pub.IRI(srv.URL + "/actors/" + testActorHash), Object: reply.Object}
+	if !isRemoteReply(remote) || isRemoteReply(local) {
+		t.Errorf("Only the replies of the remote accounts should be checked when they're loaded")
+	}
+	if refused := r.lockedReplies(context.Background(), remote, unlocked); len(refused) != 1 || refused[0] != remote.ID {
+		t.Errorf("Expected only the remote reply to the locked item to be refused, received %v", refused)
+	}
+}
@@ -64,6 +64,8 @@ func LoadOutboxMw(next http.Handler) http.Handler {
 				cursor.after = c.after
 			}
 		}
+		repo.filterSensitive(loggedAccount(r), cursor.items, f...)
+		repo.filterMinScore(loggedAccount(r), cursor.items, f...)
 		ctx := context.WithValue(r.Context(), CursorCtxtKey, cursor)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -78,11 +80,15 @@ func LoadInboxMw(next http.Handler) http.Handler {
 			ctxtErr(next, w, r, errors.MethodNotAllowedf("nil account"))
 			return
 		}
-		cursor, err := repo.LoadActorInbox(context.TODO(), acc.pub, f...)
+		cursor, err := repo.LoadFollowingFeed(context.TODO(), acc, f...)
 		if err != nil {
 			ctxtErr(next, w, r, errors.Annotatef(err, "unable to load current account's inbox"))
 			return
 		}
+		repo.mutes.Filter(acc, cursor.items)
+		repo.filterDismissed(acc, cursor.items)
+		repo.filterSensitive(acc, cursor.items, f...)
+		repo.filterMinScore(acc, cursor.items, f...)
 		ctx := context.WithValue(r.Context(), CursorCtxtKey, cursor)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -92,11 +98,15 @@ func LoadServiceInboxMw(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		f := ContextActivityFilters(r.Context())
 		repo := ContextRepository(r.Context())
-		cursor, err := repo.LoadActorInbox(context.TODO(), repo.fedbox.Service(), f...)
+		cursor, err := repo.LoadActorInbox(context.TODO(), repo.instanceActor(), f...)
 		if err != nil {
-			ctxtErr(next, w, r, errors.Annotatef(err, "unable to load the %s's inbox", repo.fedbox.Service().Type))
+			ctxtErr(next, w, r, errors.Annotatef(err, "unable to load the %s's inbox", repo.instanceActor().GetType()))
 			return
 		}
+		repo.filterDismissed(loggedAccount(r), cursor.items)
+		repo.filterReported(r.Context(), loggedAccount(r), cursor.items)
+		repo.filterSensitive(loggedAccount(r), cursor.items, f...)
+		repo.filterMinScore(loggedAccount(r), cursor.items, f...)
 		ctx := context.WithValue(r.Context(), CursorCtxtKey, cursor)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -107,9 +117,9 @@ func LoadServiceWithSelfAuthInboxMw(next http.Handler) http.Handler {
 		f := ContextActivityFilters(r.Context())
 		repo := ContextRepository(r.Context())
 		repo.fedbox.SignBy(repo.app)
-		cursor, err := repo.LoadActorInbox(context.TODO(), repo.fedbox.Service(), f...)
+		cursor, err := repo.LoadActorInbox(context.TODO(), repo.instanceActor(), f...)
 		if err != nil {
-			ctxtErr(next, w, r, errors.Annotatef(err, "unable to load the %s's inbox", repo.fedbox.Service().Type))
+			ctxtErr(next, w, r, errors.Annotatef(err, "unable to load the %s's inbox", repo.instanceActor().GetType()))
 			return
 		}
 		ctx := context.WithValue(r.Context(), CursorCtxtKey, cursor)
@@ -143,7 +153,7 @@ func LoadObjectFromInboxMw(next http.Handler) http.Handler {
 		}
 		f := ff[0]
 		// we first try to load from the service's inbox
-		col, err = repo.fedbox.Inbox(ctx, repo.fedbox.Service(), Values(f))
+		col, err = repo.fedbox.Inbox(ctx, repo.instanceActor(), Values(f))
 		if err != nil {
 			repo.errFn()("unable to load item")
 			ctxtErr(next, w, r, errors.NotFoundf("Object not found"))
@@ -184,6 +194,11 @@ func LoadObjectFromInboxMw(next http.Handler) http.Handler {
 			ctxtErr(next, w, r, errors.NotFoundf("Object not found"))
 			return
 		}
+		if i.LocalOnly() && !ContextAccount(r.Context()).IsLogged() {
+			// NOTE(marius): local only items are not shown to anonymous visitors, which includes the remote servers
+			ctxtErr(next, w, r, errors.NotFoundf("Object not found"))
+			return
+		}
 		items := ItemCollection{i}
 		if comments, err := repo.loadItemsReplies(ctx, i); err == nil {
 			items = append(items, comments...)
@@ -197,9 +212,15 @@ func LoadObjectFromInboxMw(next http.Handler) http.Handler {
 		c := &Cursor{
 			items: make(RenderableList),
 		}
+		replies := make(RenderableList)
 		for k := range items {
 			c.items.Append(Renderable(&items[k]))
+			if k > 0 {
+				replies.Append(Renderable(&items[k]))
+			}
 		}
+		// NOTE(marius): only the replies with low scores are collapsed, not the item the viewer opened
+		repo.filterMinScore(loggedAccount(r), replies, ff...)
 		m := ContextContentModel(r.Context())
 		m.Title = "Replies to item"
 		if i.SubmittedBy != nil {
@@ -230,6 +251,9 @@ func ListingModelMw(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		m := new(listingModel)
 		m.sortFn = ByDate
+		if repo := ContextRepository(r.Context()); repo != nil {
+			m.Announcements = repo.LoadAnnouncements(r.Context(), loggedAccount(r))
+		}
 		ctx := context.WithValue(r.Context(), ModelCtxtKey, m)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -470,6 +494,9 @@ func ThreadedListingMw(next http.Handler) http.Handler {
 
 		reparentComments(&comments)
 		addLevelComments(comments)
+		if Instance.Conf != nil {
+			comments = limitCommentsDepth(comments, 0, Instance.Conf.MaxThreadDepth)
+		}
 
 		reparentAccounts(&accounts)
 		addLevelAccounts(accounts)
@@ -536,3 +563,14 @@ func SortByDate(next http.Handler) http.Handler {
 		m.sortFn = ByDate
 	})
 }
+
+func SortByUpdated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer next.ServeHTTP(w, r)
+		m := ContextListingModel(r.Context())
+		if m == nil {
+			return
+		}
+		m.sortFn = ByUpdated
+	})
+}
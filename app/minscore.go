@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+// minScorePreferences has the instance's minimum score for the items shown expanded in the listings, for the
+// anonymous viewers and the accounts which didn't choose one. The accounts' minimum scores are saved in their preferences.
+type minScorePreferences struct {
+	def int
+}
+
+func newMinScorePreferences(def int) *minScorePreferences {
+	return &minScorePreferences{def: def}
+}
+
+// For returns the minimum score of the account, or the instance's one for the anonymous viewers,
+// and the accounts which didn't choose one
+func (s *minScorePreferences) For(acc *Account) int {
+	if s == nil {
+		return config.NoMinDisplayScore
+	}
+	if score := accountPreferences(acc).MinScore; acc.IsLogged() && score != nil {
+		return *score
+	}
+	return s.def
+}
+
+// minScore returns the minimum score for the items in the listing: the one in the filters, if there is one,
+// or the viewer's
+func (r *repository) minScore(acc *Account, ff ...*Filters) int {
+	for _, f := range ff {
+		if f != nil && f.MinScore != nil {
+			return *f.MinScore
+		}
+	}
+	return r.minScores.For(acc)
+}
+
+// applyMinScore collapses the items in the list with a score lower than min, except the viewer's own.
+// They're not removed, so the threads they're part of stay intact.
+func applyMinScore(min int, viewer *Account, list RenderableList) {
+	if min == config.NoMinDisplayScore {
+		return
+	}
+	for _, ren := range list {
+		it, ok := ren.(*Item)
+		if !ok || it.Deleted() || it.Score >= min {
+			continue
+		}
+		if viewer.IsLogged() && it.SubmittedBy.IsValid() && it.SubmittedBy.Hash == viewer.Hash {
+			continue
+		}
+		it.CollapseLowScore()
+	}
+}
+
+// filterMinScore applies the viewer's minimum score to the loaded listing, after the items' scores were loaded
+func (r *repository) filterMinScore(acc *Account, list RenderableList, ff ...*Filters) {
+	applyMinScore(r.minScore(acc, ff...), acc, list)
+}
+
+// parseMinScore returns the minimum score in s, an empty value or "off" disables it
+func parseMinScore(s string) (int, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if len(s) == 0 || s == "off" {
+		return config.NoMinDisplayScore, nil
+	}
+	score, err := strconv.Atoi(s)
+	if err != nil || score == config.NoMinDisplayScore {
+		return config.NoMinDisplayScore, errors.NotValidf("invalid minimum score %q", s)
+	}
+	return score, nil
+}
+
+// SetMinScore saves the minimum score of the account for the items shown expanded in its listings,
+// config.NoMinDisplayScore disables it
+func (r *repository) SetMinScore(ctx context.Context, acc *Account, score int) error {
+	return r.SavePreferences(ctx, acc, func(p *AccountPreferences) {
+		p.MinScore = &score
+	})
+}
+
+// HandleMinScore saves the minimum score of the logged account for the items shown expanded in its listings
+func (h *handler) HandleMinScore(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	score, err := parseMinScore(r.PostFormValue("score"))
+	if err == nil {
+		err = h.storage.SetMinScore(context.TODO(), acc, score)
+	}
+	if err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	h.v.Redirect(w, r, AccountPermaLink(acc), http.StatusFound)
+}
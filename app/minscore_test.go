@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+func Test_repository_filterMinScore(t *testing.T) {
+	r := repository{minScores: newMinScorePreferences(config.NoMinDisplayScore)}
+	author := &Account{Hash: HashFromString(testActorHash), Handle: "johndoe", Metadata: &AccountMetadata{ID: "https://fedbox.example/actors/" + testActorHash}}
+	other := &Account{Hash: HashFromString(testLikeHash), Handle: "janedoe", Metadata: &AccountMetadata{ID: "https://fedbox.example/actors/" + testLikeHash}}
+	zero := 0
+	other.Metadata.Preferences = &AccountPreferences{MinScore: &zero}
+
+	newList := func() (*Item, RenderableList) {
+		it := &Item{Hash: HashFromString(testObjectHash), Data: "downvoted", Score: -2, SubmittedBy: author}
+		list := make(RenderableList, 0)
+		list.Append(it)
+		return it, list
+	}
+
+	it, list := newList()
+	r.filterMinScore(other, list)
+	if _, ok := list[it.Hash]; !ok {
+		t.Fatalf("The items below the minimum score should be kept in the listing")
+	}
+	if !it.LowScore() {
+		t.Errorf("The item below the minimum score should be collapsed for the other accounts")
+	}
+
+	it, list = newList()
+	author.Metadata.Preferences = &AccountPreferences{MinScore: &zero}
+	r.filterMinScore(author, list)
+	if it.LowScore() {
+		t.Errorf("The item below the minimum score should be shown to its author")
+	}
+
+	it, list = newList()
+	r.filterMinScore(&AnonymousAccount, list)
+	if it.LowScore() {
+		t.Errorf("The items shouldn't be collapsed without a minimum score")
+	}
+
+	min := 5
+	it, list = newList()
+	it.Score = 3
+	r.filterMinScore(&AnonymousAccount, list, &Filters{MinScore: &min})
+	if !it.LowScore() {
+		t.Errorf("The minimum score in the filters should override the viewer's")
+	}
+}
+
+func Test_repository_SetMinScore(t *testing.T) {
+	f := newAccountFedbox()
+	defer f.Close()
+	r := testRepository(f.Server)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(f.URL), Type: pub.ServiceType}
+	r.minScores = newMinScorePreferences(0)
+
+	acc := testVote(f.Server, 1).SubmittedBy
+	if err := r.SetMinScore(context.Background(), acc, config.NoMinDisplayScore); err != nil {
+		t.Fatalf("Unable to save the minimum score: %s", err)
+	}
+	if min := r.minScore(f.storedAccount(t, r)); min != config.NoMinDisplayScore {
+		t.Errorf("The disabled minimum score should be saved with the account, received %d", min)
+	}
+	if min := r.minScore(&AnonymousAccount); min != 0 {
+		t.Errorf("The anonymous viewers should get the instance minimum score, received %d", min)
+	}
+}
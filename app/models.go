@@ -24,6 +24,9 @@ type listingModel struct {
 	after    Hash
 	before   Hash
 	sortFn   func(list RenderableList) []Renderable
+
+	// Announcements are the instance's announcements shown above the items
+	Announcements []Announcement
 }
 
 func (m listingModel) NextPage() Hash {
@@ -211,6 +214,7 @@ type loginModel struct {
 	Title   string
 	Account Account
 	OAuth   bool
+	OTP     bool
 }
 
 func (m *loginModel) SetTitle(s string) {
@@ -223,6 +227,25 @@ func (loginModel) Template() string {
 
 func (*loginModel) SetCursor(c *Cursor) {}
 
+type totpModel struct {
+	Title    string
+	Account  Account
+	Enabled  bool
+	Secret   string
+	URI      string
+	Recovery []string
+}
+
+func (m *totpModel) SetTitle(s string) {
+	m.Title = s
+}
+
+func (totpModel) Template() string {
+	return "totp"
+}
+
+func (*totpModel) SetCursor(c *Cursor) {}
+
 type registerModel struct {
 	Title   string
 	Account Account
@@ -0,0 +1,244 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi"
+)
+
+// maxMutedThreads is the number of threads an account can mute, or un-mute, the oldest ones are dropped after it
+const maxMutedThreads = 500
+
+// maxIndexedThreads is the number of threads for which we keep the author and the replies,
+// the oldest ones are dropped after it
+const maxIndexedThreads = 10000
+
+// maxIndexedReplies is the number of replies we keep for a thread, it only needs to be over the auto-mute thresholds
+const maxIndexedReplies = 1000
+
+// threadMutes keeps the authors and the replies of the threads, so they can be muted automatically once they
+// have more replies than their author's threshold.
+// The threads the accounts muted, or un-muted, and their thresholds are saved in the account preferences,
+// the mutes are local to this instance, they are not federated.
+// A thread is identified by the hash of its top level item.
+type threadMutes struct {
+	m         sync.RWMutex
+	threshold int
+	threads   Hashes
+	owners    map[Hash]Hash
+	replies   map[Hash]Hashes
+}
+
+func newThreadMutes(threshold int) *threadMutes {
+	return &threadMutes{
+		threshold: threshold,
+		threads:   make(Hashes, 0),
+		owners:    make(map[Hash]Hash),
+		replies:   make(map[Hash]Hashes),
+	}
+}
+
+// threadRoot returns the hash of the top level item of the thread the item is part of
+func threadRoot(i Item) Hash {
+	if i.OP != nil && i.OP.Hash.IsValid() {
+		return i.OP.Hash
+	}
+	if i.Parent != nil && i.Parent.Hash.IsValid() {
+		return i.Parent.Hash
+	}
+	return i.Hash
+}
+
+// threadOwner returns the hash of the author of the thread the item is part of
+func threadOwner(i Item) Hash {
+	top := &i
+	if i.OP != nil && i.OP.Hash.IsValid() {
+		top = i.OP
+	} else if i.Parent != nil && i.Parent.Hash.IsValid() {
+		top = i.Parent
+	}
+	if !top.SubmittedBy.IsValid() {
+		return AnonymousHash
+	}
+	return top.SubmittedBy.Hash
+}
+
+// AutoMute returns the number of replies after which the threads started by the account get muted
+func (t *threadMutes) AutoMute(acc *Account) int {
+	if th := accountPreferences(acc).AutoMute; th != nil {
+		return *th
+	}
+	return t.threshold
+}
+
+// RecordThread marks the account as the author of the thread started by root
+func (t *threadMutes) RecordThread(acc, root Hash) {
+	if t == nil {
+		return
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.recordThread(acc, root)
+}
+
+func (t *threadMutes) recordThread(acc, root Hash) {
+	if _, ok := t.owners[root]; !ok {
+		t.threads = append(t.threads, root)
+	}
+	t.owners[root] = acc
+	for len(t.threads) > maxIndexedThreads {
+		old := t.threads[0]
+		t.threads = t.threads[1:]
+		delete(t.owners, old)
+		delete(t.replies, old)
+	}
+}
+
+// recordReply counts the reply to its thread, if the thread has a known author
+func (t *threadMutes) recordReply(i Item) {
+	root := threadRoot(i)
+	if root == i.Hash {
+		return
+	}
+	owner, ok := t.owners[root]
+	if !ok {
+		if owner = threadOwner(i); !owner.IsValid() {
+			return
+		}
+		t.recordThread(owner, root)
+	}
+	if i.SubmittedBy != nil && i.SubmittedBy.Hash == owner {
+		return
+	}
+	if replies := t.replies[root]; len(replies) < maxIndexedReplies && !replies.Contains(i.Hash) {
+		t.replies[root] = append(replies, i.Hash)
+	}
+}
+
+// isMuted returns true if the account muted the thread started by root, or if it is the thread's author
+// and the thread has more replies than its threshold, unless it explicitly un-muted it
+func (t *threadMutes) isMuted(acc *Account, root Hash) bool {
+	prefs := accountPreferences(acc)
+	if prefs.MutedThreads.Contains(root) {
+		return true
+	}
+	if prefs.UnmutedThreads.Contains(root) || t.owners[root] != acc.Hash {
+		return false
+	}
+	th := t.AutoMute(acc)
+	return th > 0 && len(t.replies[root]) > th
+}
+
+// IsMuted returns true if the account doesn't get notifications for the thread started by root
+func (t *threadMutes) IsMuted(acc *Account, root Hash) bool {
+	if t == nil || !acc.IsLogged() {
+		return false
+	}
+	t.m.RLock()
+	defer t.m.RUnlock()
+	return t.isMuted(acc, root)
+}
+
+// Filter removes from the list the replies and mentions belonging to the threads muted by the account
+func (t *threadMutes) Filter(acc *Account, list RenderableList) {
+	if t == nil || !acc.IsLogged() {
+		return
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	for _, r := range list {
+		if i, ok := r.(*Item); ok {
+			t.recordReply(*i)
+		}
+	}
+	for k, r := range list {
+		i, ok := r.(*Item)
+		if !ok {
+			continue
+		}
+		if root := threadRoot(*i); root != i.Hash && t.isMuted(acc, root) {
+			delete(list, k)
+		}
+	}
+}
+
+// threadIsMuted returns true if the account doesn't get notifications for the thread the item is part of
+func threadIsMuted(repo *repository, acc *Account, i *Item) bool {
+	if repo == nil || i == nil {
+		return false
+	}
+	return repo.mutes.IsMuted(acc, threadRoot(*i))
+}
+
+// MuteThread stops the notifications for the replies and mentions in the thread the item is part of
+func (r *repository) MuteThread(ctx context.Context, acc *Account, it Item) error {
+	root := threadRoot(it)
+	return r.SavePreferences(ctx, acc, func(p *AccountPreferences) {
+		p.UnmutedThreads = removeHash(p.UnmutedThreads, root)
+		p.MutedThreads = appendBounded(p.MutedThreads, root, maxMutedThreads)
+	})
+}
+
+// UnmuteThread resumes the notifications for the replies and mentions in the thread the item is part of
+func (r *repository) UnmuteThread(ctx context.Context, acc *Account, it Item) error {
+	root := threadRoot(it)
+	return r.SavePreferences(ctx, acc, func(p *AccountPreferences) {
+		p.MutedThreads = removeHash(p.MutedThreads, root)
+		// NOTE(marius): explicitly un-muting a thread prevents it from being automatically muted again
+		if threadOwner(it) == acc.Hash {
+			p.UnmutedThreads = appendBounded(p.UnmutedThreads, root, maxMutedThreads)
+		}
+	})
+}
+
+// SetThreadAutoMute sets the number of replies after which the threads started by the account stop generating notifications
+func (r *repository) SetThreadAutoMute(ctx context.Context, acc *Account, threshold int) error {
+	if threshold < 0 {
+		return errors.NotValidf("invalid auto-mute threshold %d", threshold)
+	}
+	return r.SavePreferences(ctx, acc, func(p *AccountPreferences) {
+		p.AutoMute = &threshold
+	})
+}
+
+// HandleMuteThread mutes or un-mutes the thread of the current item for the logged account
+func (h *handler) HandleMuteThread(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	repo := h.storage
+	ctx := context.TODO()
+	iri := h.storage.ItemIRI(chi.URLParam(r, "hash"))
+	p, err := repo.LoadItem(ctx, iri)
+	if err != nil {
+		h.errFn()("Error: %s", err)
+		h.v.HandleErrors(w, r, errors.NewNotFound(err, "not found"))
+		return
+	}
+	if path.Base(r.URL.Path) == "unmute" {
+		err = repo.UnmuteThread(ctx, acc, p)
+	} else {
+		err = repo.MuteThread(ctx, acc, p)
+	}
+	if err != nil {
+		h.v.addFlashMessage(Error, w, r, "Unable to update the thread notifications")
+	}
+	h.v.Redirect(w, r, ItemPermaLink(&p), http.StatusFound)
+}
+
+// HandleThreadAutoMute saves the auto-mute threshold of the logged account
+func (h *handler) HandleThreadAutoMute(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	th, err := strconv.Atoi(r.PostFormValue("threshold"))
+	if err == nil {
+		err = h.storage.SetThreadAutoMute(context.TODO(), acc, th)
+	}
+	if err != nil {
+		h.v.HandleErrors(w, r, errors.NewNotValid(err, "invalid threshold"))
+		return
+	}
+	h.v.Redirect(w, r, AccountPermaLink(acc), http.StatusFound)
+}
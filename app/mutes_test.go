@@ -0,0 +1,113 @@
+package app
+
+import "testing"
+
+func Test_threadMutes_Filter(t *testing.T) {
+	var (
+		author = HashFromString(testActorHash)
+		other  = HashFromString("7d1c2b3a-4e5f-4a6b-8c7d-9e0f1a2b3c4d")
+		root   = HashFromString(testObjectHash)
+		free   = HashFromString("1b2c3d4e-5f6a-4b7c-9d8e-0f1a2b3c4d5e")
+	)
+	reply := func(hash string, op Hash) *Item {
+		return &Item{
+			Hash:        HashFromString(hash),
+			SubmittedBy: &Account{Hash: other},
+			Parent:      &Item{Hash: op},
+			OP:          &Item{Hash: op},
+		}
+	}
+	replies := func() RenderableList {
+		return RenderableList{
+			HashFromString("3c4d5e6f-7a8b-4c9d-8e0f-1a2b3c4d5e6f"): reply("3c4d5e6f-7a8b-4c9d-8e0f-1a2b3c4d5e6f", root),
+			HashFromString("4d5e6f7a-8b9c-4d0e-9f1a-2b3c4d5e6f7a"): reply("4d5e6f7a-8b9c-4d0e-9f1a-2b3c4d5e6f7a", root),
+			HashFromString("5e6f7a8b-9c0d-4e1f-8a2b-3c4d5e6f7a8b"): reply("5e6f7a8b-9c0d-4e1f-8a2b-3c4d5e6f7a8b", free),
+		}
+	}
+
+	account := func(prefs *AccountPreferences) *Account {
+		return &Account{Hash: author, Handle: "johndoe", Metadata: &AccountMetadata{Preferences: prefs}}
+	}
+
+	t.Run("muted thread", func(t *testing.T) {
+		m := newThreadMutes(0)
+		acc := account(&AccountPreferences{MutedThreads: Hashes{root}})
+		list := replies()
+		m.Filter(acc, list)
+		if len(list) != 1 {
+			t.Fatalf("Invalid notifications count %d, expected %d", len(list), 1)
+		}
+		for _, r := range list {
+			if threadRoot(*r.(*Item)) != free {
+				t.Errorf("Reply from a muted thread was not filtered")
+			}
+		}
+		list = replies()
+		m.Filter(&Account{Hash: other, Handle: "jane"}, list)
+		if len(list) != 3 {
+			t.Errorf("The mute should apply only to the account that muted, got %d notifications", len(list))
+		}
+	})
+	t.Run("auto mute", func(t *testing.T) {
+		m := newThreadMutes(0)
+		m.RecordThread(author, root)
+		m.RecordThread(author, free)
+		th := 1
+		acc := account(&AccountPreferences{AutoMute: &th})
+		if th := m.AutoMute(acc); th != 1 {
+			t.Errorf("Invalid auto-mute threshold %d, expected %d", th, 1)
+		}
+		list := replies()
+		m.Filter(acc, list)
+		if !m.IsMuted(acc, root) {
+			t.Errorf("Thread with more replies than the threshold should have been muted")
+		}
+		if m.IsMuted(acc, free) {
+			t.Errorf("Thread with fewer replies than the threshold should not have been muted")
+		}
+		if len(list) != 1 {
+			t.Errorf("Invalid notifications count %d, expected %d", len(list), 1)
+		}
+	})
+	t.Run("auto mute from the instance threshold", func(t *testing.T) {
+		m := newThreadMutes(1)
+		m.RecordThread(author, root)
+		m.Filter(account(nil), replies())
+		if !m.IsMuted(account(nil), root) {
+			t.Errorf("Thread with more replies than the instance threshold should have been muted")
+		}
+	})
+	t.Run("un-muted thread is not auto muted", func(t *testing.T) {
+		m := newThreadMutes(1)
+		m.RecordThread(author, root)
+		acc := account(&AccountPreferences{UnmutedThreads: Hashes{root}})
+		list := replies()
+		m.Filter(acc, list)
+		if m.IsMuted(acc, root) || len(list) != 3 {
+			t.Errorf("Thread explicitly un-muted should not be muted automatically")
+		}
+	})
+	t.Run("auto mute disabled", func(t *testing.T) {
+		m := newThreadMutes(0)
+		m.RecordThread(author, root)
+		acc := account(nil)
+		list := replies()
+		m.Filter(acc, list)
+		if m.IsMuted(acc, root) || len(list) != 3 {
+			t.Errorf("Threads should not be muted when the threshold is 0")
+		}
+	})
+	t.Run("bounded index", func(t *testing.T) {
+		m := newThreadMutes(0)
+		m.RecordThread(author, root)
+		for i := 0; i < maxIndexedThreads; i++ {
+			m.RecordThread(author, Hash{0, 0, 0, 2, byte(i >> 8), byte(i)})
+		}
+		if len(m.owners) != maxIndexedThreads || len(m.threads) != maxIndexedThreads {
+			t.Errorf("Invalid number of indexed threads %d, expected %d", len(m.owners), maxIndexedThreads)
+		}
+		if _, ok := m.owners[root]; ok {
+			t.Errorf("The oldest thread should have been dropped from the index")
+		}
+	})
+}
@@ -0,0 +1,173 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// DefaultNodeInfoTTL is how long we keep the NodeInfo of a remote instance before fetching it again
+const DefaultNodeInfoTTL = 24 * time.Hour
+
+// nodeInfoSchemas are the NodeInfo schema versions we can read, in order of preference
+var nodeInfoSchemas = []string{
+	"http://nodeinfo.diaspora.software/ns/schema/2.0",
+	"http://nodeinfo.diaspora.software/ns/schema/2.1",
+}
+
+// maxNodeInfoSize limits how much of a remote NodeInfo document we read
+const maxNodeInfoSize = 1 << 20
+
+type NodeInfoSoftware struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// RemoteNodeInfo is the part of a remote instance's NodeInfo that we use
+type RemoteNodeInfo struct {
+	Host              string           `json:"-"`
+	Version           string           `json:"version"`
+	Software          NodeInfoSoftware `json:"software"`
+	Protocols         []string         `json:"protocols"`
+	OpenRegistrations bool             `json:"openRegistrations"`
+}
+
+type cachedNodeInfo struct {
+	ni  *RemoteNodeInfo
+	err error
+	at  time.Time
+}
+
+// nodeInfoCache holds the NodeInfo of the remote instances, including the failures to load it,
+// so we don't retry for the instances that don't have one on every request.
+// The documents are fetched with the same client as the remote media, which connects only to public addresses.
+type nodeInfoCache struct {
+	m      sync.RWMutex
+	ttl    time.Duration
+	c      map[string]cachedNodeInfo
+	client *http.Client
+}
+
+func newNodeInfoCache(ttl time.Duration) *nodeInfoCache {
+	if ttl <= 0 {
+		ttl = DefaultNodeInfoTTL
+	}
+	return &nodeInfoCache{ttl: ttl, c: make(map[string]cachedNodeInfo), client: newMediaClient(false)}
+}
+
+func (n *nodeInfoCache) get(host string) (cachedNodeInfo, bool) {
+	n.m.RLock()
+	defer n.m.RUnlock()
+	c, ok := n.c[host]
+	if !ok || time.Since(c.at) > n.ttl {
+		return c, false
+	}
+	return c, true
+}
+
+func (n *nodeInfoCache) set(host string, ni *RemoteNodeInfo, err error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+	n.c[host] = cachedNodeInfo{ni: ni, err: err, at: time.Now()}
+}
+
+// nodeInfoBaseURL returns the base URL of the instance, host can be a bare host name, or an URL if we need a specific scheme
+func nodeInfoBaseURL(host string) (*url.URL, error) {
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil || len(u.Host) == 0 {
+		return nil, errors.Newf("invalid host %s", host)
+	}
+	return &url.URL{Scheme: u.Scheme, Host: strings.ToLower(u.Host)}, nil
+}
+
+func getJSON(ctx context.Context, cl *http.Client, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxNodeInfoSize))
+	if err != nil {
+		return errors.Annotatef(err, "unable to read response from %s", u)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errorFromResponse(resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, v)
+}
+
+func fetchNodeInfo(ctx context.Context, cl *http.Client, host string) (*RemoteNodeInfo, error) {
+	base, err := nodeInfoBaseURL(host)
+	if err != nil {
+		return nil, err
+	}
+	disc := node{}
+	if err := getJSON(ctx, cl, fmt.Sprintf("%s/.well-known/nodeinfo", base), &disc); err != nil {
+		return nil, errors.NewNotFound(err, "unable to load NodeInfo discovery document for %s", base.Host)
+	}
+	href := ""
+	for _, schema := range nodeInfoSchemas {
+		for _, l := range disc.Links {
+			if l.Rel == schema && len(href) == 0 {
+				href = l.Href
+			}
+		}
+	}
+	if len(href) == 0 {
+		return nil, errors.NotFoundf("no supported NodeInfo version for %s", base.Host)
+	}
+	ni := RemoteNodeInfo{}
+	if err := getJSON(ctx, cl, href, &ni); err != nil {
+		return nil, errors.Annotatef(err, "unable to load NodeInfo for %s", base.Host)
+	}
+	ni.Host = base.Host
+	return &ni, nil
+}
+
+// LoadRemoteNodeInfo returns the NodeInfo of a remote instance, from the cache if we loaded it recently
+func (r *repository) LoadRemoteNodeInfo(ctx context.Context, host string) (*RemoteNodeInfo, error) {
+	base, err := nodeInfoBaseURL(host)
+	if err != nil {
+		return nil, err
+	}
+	if r.nodeInfo == nil {
+		r.nodeInfo = newNodeInfoCache(DefaultNodeInfoTTL)
+	}
+	if c, ok := r.nodeInfo.get(base.Host); ok {
+		return c.ni, c.err
+	}
+	ni, err := fetchNodeInfo(ctx, r.nodeInfo.client, host)
+	if err != nil {
+		r.infoFn(log.Ctx{"host": base.Host, "err": err.Error()})("unable to load remote NodeInfo")
+	}
+	r.nodeInfo.set(base.Host, ni, err)
+	return ni, err
+}
+
+// cachedRemoteNodeInfo returns the NodeInfo of a remote instance only if we already loaded it, it never fetches it
+func (r *repository) cachedRemoteNodeInfo(host string) *RemoteNodeInfo {
+	base, err := nodeInfoBaseURL(host)
+	if err != nil || r.nodeInfo == nil {
+		return nil
+	}
+	c, _ := r.nodeInfo.get(base.Host)
+	return c.ni
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_repository_LoadRemoteNodeInfo(t *testing.T) {
+	requests := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/nodeinfo":
+			w.Write([]byte(`{"links":[{"rel":"http://nodeinfo.diaspora.software/ns/schema/1.0","href":"` + srv.URL + `/nodeinfo/1.0"},{"rel":"http://nodeinfo.diaspora.software/ns/schema/2.0","href":"` + srv.URL + `/nodeinfo/2.0"}]}`))
+		case "/nodeinfo/2.0":
+			w.Write([]byte(`{"version":"2.0","software":{"name":"mastodon","version":"3.4.1"},"protocols":["activitypub"],"openRegistrations":true,"usage":{"users":{"total":42}},"metadata":{"nodeName":{"unexpected":"shape"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	empty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer empty.Close()
+
+	r := &repository{infoFn: defaultCtxLogFn, errFn: defaultCtxLogFn, nodeInfo: newNodeInfoCache(DefaultNodeInfoTTL)}
+	// NOTE(marius): the default client connects only to public addresses, so it refuses the test servers
+	if _, err := r.LoadRemoteNodeInfo(context.Background(), srv.URL); err == nil {
+		t.Fatalf("LoadRemoteNodeInfo() expected error for an instance on a loopback address")
+	}
+	if requests != 0 {
+		t.Fatalf("Invalid number of requests %d for an instance on a loopback address, expected none", requests)
+	}
+
+	r.nodeInfo = newNodeInfoCache(DefaultNodeInfoTTL)
+	r.nodeInfo.client = http.DefaultClient
+	ni, err := r.LoadRemoteNodeInfo(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("LoadRemoteNodeInfo() error: %s", err)
+	}
+	if ni.Software.Name != "mastodon" || ni.Software.Version != "3.4.1" {
+		t.Errorf("Invalid software %v, expected mastodon 3.4.1", ni.Software)
+	}
+	if !ni.OpenRegistrations {
+		t.Errorf("Invalid open registrations, expected true")
+	}
+	if requests != 2 {
+		t.Errorf("Invalid number of requests %d, expected %d", requests, 2)
+	}
+	if _, err := r.LoadRemoteNodeInfo(context.Background(), srv.URL); err != nil {
+		t.Errorf("LoadRemoteNodeInfo() error from cache: %s", err)
+	}
+	if requests != 2 {
+		t.Errorf("The NodeInfo should have been loaded from the cache, got %d requests", requests)
+	}
+
+	requests = 0
+	if _, err := r.LoadRemoteNodeInfo(context.Background(), empty.URL); err == nil {
+		t.Errorf("LoadRemoteNodeInfo() expected error for an instance without NodeInfo")
+	}
+	if _, err := r.LoadRemoteNodeInfo(context.Background(), empty.URL); err == nil {
+		t.Errorf("LoadRemoteNodeInfo() expected the cached error for an instance without NodeInfo")
+	}
+	if requests != 1 {
+		t.Errorf("The failure should have been cached, got %d requests", requests)
+	}
+}
@@ -0,0 +1,364 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi"
+	"github.com/gorilla/csrf"
+)
+
+// notificationTypes are the activities of the other accounts, in an account's inbox, we notify it about
+var notificationTypes = pub.ActivityVocabularyTypes{
+	pub.CreateType,
+	pub.LikeType,
+	pub.DislikeType,
+	pub.AnnounceType,
+	pub.FollowType,
+}
+
+// Notification is an activity of another account that concerns the account: a reply or a mention,
+// a vote or a share of its items, or a follow.
+// Its Count is the number of the notifications about the same thing coalesced in it, including itself.
+type Notification struct {
+	Hash      Hash                       `json:"hash"`
+	Type      pub.ActivityVocabularyType `json:"type"`
+	Actor     pub.IRI                    `json:"actor,omitempty"`
+	Object    pub.IRI                    `json:"object,omitempty"`
+	Target    pub.IRI                    `json:"target,omitempty"`
+	Published time.Time                  `json:"published"`
+	Read      bool                       `json:"read"`
+	Count     int                        `json:"count"`
+	pub       pub.Item                   `json:"-"`
+}
+
+// maxReadNotifications is the number of notifications an account can mark as read one by one,
+// the oldest ones are dropped after it
+const maxReadNotifications = 500
+
+// notificationIsRead returns true if the account read the notification: it was published before the time the account
+// marked all of them as read, or the account read it by itself after it. Both are saved in the account preferences.
+func notificationIsRead(acc *Account, nn Notification) bool {
+	prefs := accountPreferences(acc)
+	if !prefs.NotificationsRead.IsZero() && !nn.Published.After(prefs.NotificationsRead) {
+		return true
+	}
+	return prefs.ReadNotifications.Contains(nn.Hash)
+}
+
+// NotificationsCursor is the position in the notifications of an account a page is loaded from:
+// the clients polling for new notifications load the ones published after Since, the others load the MaxItems ones
+// published before Before, or the newest ones if it's not set
+type NotificationsCursor struct {
+	Since    time.Time
+	Before   time.Time
+	MaxItems int
+}
+
+// NotificationsCursorFromRequest loads the notifications cursor from the since, before and maxItems query values,
+// the times are in the RFC3339 format
+func NotificationsCursorFromRequest(r *http.Request) NotificationsCursor {
+	q := r.URL.Query()
+	cur := NotificationsCursor{}
+	cur.Since, _ = time.Parse(time.RFC3339Nano, q.Get("since"))
+	cur.Before, _ = time.Parse(time.RFC3339Nano, q.Get("before"))
+	cur.MaxItems, _ = strconv.Atoi(q.Get("maxItems"))
+	return cur
+}
+
+// notificationKey identifies the notifications about the same thing: the same account following, or voting on,
+// or sharing the same object, or replying in the same thread
+func notificationKey(n Notification) string {
+	return string(n.Type) + " " + n.Actor.String() + " " + n.Target.String()
+}
+
+// notificationTarget returns what the activity is about: the item its object replies to, for the replies
+// and the mentions, or its object for the others
+func notificationTarget(a *pub.Activity) pub.IRI {
+	if a.Object == nil {
+		return ""
+	}
+	target := a.Object.GetLink()
+	if a.Type != pub.CreateType {
+		return target
+	}
+	pub.OnObject(a.Object, func(o *pub.Object) error {
+		if o.InReplyTo == nil {
+			return nil
+		}
+		if repl, ok := o.InReplyTo.(pub.ItemCollection); ok {
+			if len(repl) > 0 {
+				target = repl[0].GetLink()
+			}
+		} else {
+			target = o.InReplyTo.GetLink()
+		}
+		return nil
+	})
+	return target
+}
+
+// undoneActivity returns the activity the Undo in the inbox of the account retracts, and the account that made it,
+// if the account didn't make it itself
+func undoneActivity(it pub.Item, self pub.Item) (pub.IRI, pub.IRI, bool) {
+	var undone, actor pub.IRI
+	pub.OnActivity(it, func(a *pub.Activity) error {
+		if a.Type != pub.UndoType || a.Actor == nil || a.Object == nil || a.Actor.GetLink().Equals(self.GetLink(), false) {
+			return nil
+		}
+		undone, actor = a.Object.GetLink(), a.Actor.GetLink()
+		return nil
+	})
+	return undone, actor, len(undone) > 0
+}
+
+// notificationFromActivity returns the notification for the activity in the inbox of the account,
+// if it's one of the activities we notify about, and the account didn't make it itself
+func notificationFromActivity(it pub.Item, self pub.Item) (Notification, bool) {
+	n := Notification{}
+	pub.OnActivity(it, func(a *pub.Activity) error {
+		if !notificationTypes.Contains(a.Type) || a.Actor == nil || a.Actor.GetLink().Equals(self.GetLink(), false) {
+			return nil
+		}
+		n.Hash = HashFromIRI(a.GetLink())
+		n.Type = a.Type
+		n.Actor = a.Actor.GetLink()
+		n.Published = a.Published
+		n.pub = a
+		if a.Object != nil {
+			n.Object = a.Object.GetLink()
+		}
+		n.Target = notificationTarget(a)
+		n.Count = 1
+		return nil
+	})
+	return n, n.Hash.IsValid()
+}
+
+// coalesceNotifications returns the notifications, newest first, regardless of the order they were loaded in.
+// The ones about the same thing, like an account liking our item again, or replying more than once in a thread,
+// are coalesced in the newest of them when they're published in the window before it, or all of them when the window
+// is zero. The count of the newest one is the number of the coalesced notifications.
+func coalesceNotifications(all []Notification, window time.Duration) []Notification {
+	sorted := make([]Notification, len(all))
+	copy(sorted, all)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Published.Equal(sorted[j].Published) {
+			return sorted[i].Hash.String() < sorted[j].Hash.String()
+		}
+		return sorted[i].Published.After(sorted[j].Published)
+	})
+	result := make([]Notification, 0)
+	groups := make(map[string]int)
+	for _, n := range sorted {
+		key := notificationKey(n)
+		if i, ok := groups[key]; ok && (window <= 0 || result[i].Published.Sub(n.Published) <= window) {
+			result[i].Count++
+			continue
+		}
+		if n.Count <= 0 {
+			n.Count = 1
+		}
+		groups[key] = len(result)
+		result = append(result, n)
+	}
+	return result
+}
+
+// selectNotifications returns the coalesced notifications at the cursor, newest first.
+// As the notifications are coalesced in the newest one before applying the cursor, the older ones are skipped
+// on the following pages too.
+func selectNotifications(all []Notification, cur NotificationsCursor, window time.Duration) []Notification {
+	result := make([]Notification, 0)
+	for _, n := range coalesceNotifications(all, window) {
+		if !cur.Since.IsZero() && !n.Published.After(cur.Since) {
+			break
+		}
+		if !cur.Before.IsZero() && !n.Published.Before(cur.Before) {
+			continue
+		}
+		result = append(result, n)
+		if cur.MaxItems > 0 && len(result) >= cur.MaxItems {
+			break
+		}
+	}
+	return result
+}
+
+// withoutUndone removes the notifications for the activities their accounts retracted, like a like that was undone
+func withoutUndone(all []Notification, undone map[pub.IRI]pub.IRI) []Notification {
+	if len(undone) == 0 {
+		return all
+	}
+	result := make([]Notification, 0, len(all))
+	for _, n := range all {
+		if n.pub != nil {
+			if actor, ok := undone[n.pub.GetLink()]; ok && actor.Equals(n.Actor, false) {
+				continue
+			}
+		}
+		result = append(result, n)
+	}
+	return result
+}
+
+// LoadNotifications returns the page of notifications of the account at the cursor, newest first.
+// The notifications for the activities that were undone are left out, and the ones about the same thing are coalesced
+// depending on the NOTIFICATIONS_COALESCE_WINDOW.
+// When the instance trusts fedbox to return the inbox ordered newest first we stop loading it once we reach the cursor,
+// otherwise we load all of it, because an older activity could come after the ones on the page.
+// A cursor without MaxItems loads all the notifications.
+func (r *repository) LoadNotifications(ctx context.Context, acc Account, cur NotificationsCursor) ([]Notification, error) {
+	if !acc.IsLogged() {
+		return make([]Notification, 0), errors.Unauthorizedf("invalid account %s", acc.Handle)
+	}
+	self := r.loadAPPerson(acc)
+	types := append(pub.ActivityVocabularyTypes{pub.UndoType}, notificationTypes...)
+	f := &Filters{Type: ActivityTypesFilter(types...), MaxItems: cur.MaxItems}
+	r.clampPageSize(f)
+	collFn := func(ctx context.Context, f *Filters) (pub.CollectionInterface, error) {
+		return r.fedbox.Inbox(ctx, self, Values(f))
+	}
+	all := make([]Notification, 0)
+	undone := make(map[pub.IRI]pub.IRI)
+	err := LoadFromCollection(ctx, collFn, &colCursor{filters: f}, func(c pub.CollectionInterface) (bool, error) {
+		for _, it := range c.Collection() {
+			if iri, actor, ok := undoneActivity(it, self); ok {
+				undone[iri] = actor
+				continue
+			}
+			n, ok := notificationFromActivity(it, self)
+			if !ok {
+				continue
+			}
+			if r.orderedCollections && !cur.Since.IsZero() && !n.Published.After(cur.Since) {
+				// NOTE(marius): the inbox is ordered newest first, the rest of them are older than the cursor
+				return true, nil
+			}
+			all = append(all, n)
+		}
+		if !r.orderedCollections || cur.MaxItems <= 0 {
+			return false, nil
+		}
+		return len(selectNotifications(withoutUndone(all, undone), cur, r.notificationsWindow)) >= cur.MaxItems, nil
+	})
+	result := selectNotifications(withoutUndone(all, undone), cur, r.notificationsWindow)
+	for i := range result {
+		result[i].Read = notificationIsRead(&acc, result[i])
+	}
+	if err != nil {
+		return result, errors.Annotatef(err, "unable to load the notifications")
+	}
+	return result, nil
+}
+
+// UnreadNotificationsCount returns the number of notifications of the account it didn't read yet
+func (r *repository) UnreadNotificationsCount(ctx context.Context, acc Account) (int, error) {
+	nn, err := r.LoadNotifications(ctx, acc, NotificationsCursor{})
+	if err != nil {
+		return 0, err
+	}
+	unread := 0
+	for _, n := range nn {
+		if !n.Read {
+			unread++
+		}
+	}
+	return unread, nil
+}
+
+// MarkNotificationRead marks the notification with the id hash as read, marking it again doesn't change anything
+func (r *repository) MarkNotificationRead(ctx context.Context, acc *Account, id Hash) error {
+	if !id.IsValid() {
+		return errors.NotValidf("invalid notification %q", id)
+	}
+	if accountPreferences(acc).ReadNotifications.Contains(id) {
+		return nil
+	}
+	return r.SavePreferences(ctx, acc, func(p *AccountPreferences) {
+		p.ReadNotifications = appendBounded(p.ReadNotifications, id, maxReadNotifications)
+	})
+}
+
+// MarkAllNotificationsRead marks all the current notifications of the account as read
+func (r *repository) MarkAllNotificationsRead(ctx context.Context, acc *Account) error {
+	now := time.Now().UTC()
+	return r.SavePreferences(ctx, acc, func(p *AccountPreferences) {
+		if now.After(p.NotificationsRead) {
+			p.NotificationsRead = now
+		}
+		// NOTE(marius): the notifications read one by one are older than the mark, we don't need to keep them anymore
+		p.ReadNotifications = nil
+	})
+}
+
+type notificationsJSON struct {
+	Unread int            `json:"unread"`
+	Items  []Notification `json:"items"`
+	// Since is the cursor for polling the notifications newer than the ones loaded
+	Since string `json:"since,omitempty"`
+	// Next is the cursor for the page of notifications older than the ones loaded
+	Next string `json:"next,omitempty"`
+}
+
+func (h *handler) writeNotifications(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	cur := NotificationsCursorFromRequest(r)
+	cur.MaxItems = clampPageSize(cur.MaxItems, h.storage.notificationsPageSize, h.storage.maxPageSize)
+	nn, err := h.storage.LoadNotifications(r.Context(), *acc, cur)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	result := notificationsJSON{Items: nn}
+	if result.Unread, err = h.storage.UnreadNotificationsCount(r.Context(), *acc); err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	since := cur.Since
+	if len(nn) > 0 && nn[0].Published.After(since) {
+		since = nn[0].Published
+	}
+	if !since.IsZero() {
+		result.Since = since.UTC().Format(time.RFC3339Nano)
+	}
+	if cur.Since.IsZero() && len(nn) == cur.MaxItems {
+		result.Next = nn[len(nn)-1].Published.UTC().Format(time.RFC3339Nano)
+	}
+	dat, _ := json.Marshal(result)
+	// NOTE(marius): the clients send the token back with the POST /notifications/read requests
+	w.Header().Set("X-CSRF-Token", csrf.Token(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dat)
+}
+
+// HandleListNotifications serves the GET /notifications requests, with a page of the notifications of the logged account
+// and the number of unread ones. The since query value loads only the ones newer than it, the before one the page
+// of the ones older than it.
+func (h *handler) HandleListNotifications(w http.ResponseWriter, r *http.Request) {
+	h.writeNotifications(w, r)
+}
+
+// HandleMarkNotificationsRead serves the POST /notifications/read requests, which mark all the notifications
+// of the logged account as read, and the POST /notifications/{hash}/read ones, which mark a single one
+func (h *handler) HandleMarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	var err error
+	if hash := chi.URLParam(r, "hash"); len(hash) > 0 {
+		err = h.storage.MarkNotificationRead(r.Context(), acc, HashFromString(hash))
+	} else {
+		err = h.storage.MarkAllNotificationsRead(r.Context(), acc)
+	}
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	h.writeNotifications(w, r)
+}
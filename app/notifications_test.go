@@ -0,0 +1,358 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_repository_NotificationsReadState(t *testing.T) {
+	const (
+		viewerHash = "9a1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c00"
+		aliceHash  = "9a1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01"
+		postHash   = "9a1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c02"
+		likeHash   = "9a1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c03"
+		replyHash  = "9a1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c04"
+		followHash = "9a1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c05"
+		ownHash    = "9a1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c06"
+	)
+	f := newAccountFedbox()
+	defer f.Close()
+	alice := fmt.Sprintf("%s/actors/%s", f.URL, aliceHash)
+	viewerIRI := fmt.Sprintf("%s/actors/%s", f.URL, viewerHash)
+	post := fmt.Sprintf("%s/objects/%s", f.URL, postHash)
+	f.actor = `{"id":"` + viewerIRI + `","type":"Person","preferredUsername":"viewer"}`
+	f.add("/actors/"+viewerHash+"/inbox", fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[
+		{"id":"%s/activities/%s","type":"Like","actor":"%s","object":"%s","published":"2020-01-01T10:00:00Z"},
+		{"id":"%s/activities/%s","type":"Create","actor":"%s","object":{"id":"%s/objects/%s","type":"Note","inReplyTo":"%s"},"published":"2020-01-01T11:00:00Z"},
+		{"id":"%s/activities/%s","type":"Follow","actor":"%s","object":"%s","published":"2020-01-01T12:00:00Z"},
+		{"id":"%s/activities/%s","type":"Like","actor":"%s","object":"%s","published":"2020-01-01T13:00:00Z"}]}`,
+		f.URL, likeHash, alice, post,
+		f.URL, replyHash, alice, f.URL, replyHash, post,
+		f.URL, followHash, alice, viewerIRI,
+		f.URL, ownHash, viewerIRI, post,
+	))
+
+	r := testRepository(f.Server)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(f.URL), Type: pub.ServiceType}
+	viewer := Account{
+		Hash:     HashFromString(viewerHash),
+		Handle:   "viewer",
+		Metadata: &AccountMetadata{ID: viewerIRI},
+		pub:      &pub.Actor{ID: pub.IRI(viewerIRI), Type: pub.PersonType},
+	}
+	ctx := context.Background()
+	unread := func() int {
+		cnt, err := r.UnreadNotificationsCount(ctx, viewer)
+		if err != nil {
+			t.Fatalf("Unable to count the unread notifications: %s", err)
+		}
+		return cnt
+	}
+
+	if cnt := unread(); cnt != 3 {
+		t.Fatalf("Expected 3 unread notifications, received %d", cnt)
+	}
+	for i := 0; i < 2; i++ {
+		if err := r.MarkNotificationRead(ctx, &viewer, HashFromString(likeHash)); err != nil {
+			t.Fatalf("Unable to mark the notification as read: %s", err)
+		}
+		if cnt := unread(); cnt != 2 {
+			t.Errorf("Expected 2 unread notifications after marking one as read %d times, received %d", i+1, cnt)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := r.MarkAllNotificationsRead(ctx, &viewer); err != nil {
+			t.Fatalf("Unable to mark all the notifications as read: %s", err)
+		}
+		if cnt := unread(); cnt != 0 {
+			t.Errorf("Expected no unread notifications after marking all of them as read %d times, received %d", i+1, cnt)
+		}
+	}
+	// NOTE(marius): the read state is saved with the account, it's the same after loading it again
+	stored := f.storedAccount(t, r)
+	stored.pub = viewer.pub
+	if cnt, err := r.UnreadNotificationsCount(ctx, *stored); err != nil || cnt != 0 {
+		t.Errorf("Expected no unread notifications for the account loaded again, received %d", cnt)
+	}
+}
+
+func Test_repository_LoadNotificationsSince(t *testing.T) {
+	const (
+		viewerHash  = "9b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c00"
+		aliceHash   = "9b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01"
+		postHash    = "9b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c02"
+		likeHash    = "9b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c03"
+		replyHash   = "9b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c04"
+		followHash  = "9b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c05"
+		oldLikeHash = "9b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c06"
+	)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/actors/"+viewerHash+"/inbox" {
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+			return
+		}
+		alice := fmt.Sprintf("%s/actors/%s", srv.URL, aliceHash)
+		viewer := fmt.Sprintf("%s/actors/%s", srv.URL, viewerHash)
+		post := fmt.Sprintf("%s/objects/%s", srv.URL, postHash)
+		writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[
+			{"id":"%s/activities/%s","type":"Follow","actor":"%s","object":"%s","published":"2020-01-01T12:00:00Z"},
+			{"id":"%s/activities/%s","type":"Create","actor":"%s","object":{"id":"%s/objects/%s","type":"Note","inReplyTo":"%s"},"published":"2020-01-01T11:00:00Z"},
+			{"id":"%s/activities/%s","type":"Like","actor":"%s","object":"%s","published":"2020-01-01T10:00:00Z"},
+			{"id":"%s/activities/%s","type":"Like","actor":"%s","object":"%s","published":"2020-01-01T09:00:00Z"}]}`,
+			srv.URL, followHash, alice, viewer,
+			srv.URL, replyHash, alice, srv.URL, replyHash, post,
+			srv.URL, likeHash, alice, post,
+			srv.URL, oldLikeHash, alice, post,
+		))
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	viewer := Account{
+		Hash:     HashFromString(viewerHash),
+		Handle:   "viewer",
+		Metadata: &AccountMetadata{ID: fmt.Sprintf("%s/actors/%s", srv.URL, viewerHash)},
+		pub:      &pub.Actor{ID: pub.IRI(fmt.Sprintf("%s/actors/%s", srv.URL, viewerHash)), Type: pub.PersonType},
+	}
+	hashes := func(nn []Notification) []Hash {
+		h := make([]Hash, len(nn))
+		for i, n := range nn {
+			h[i] = n.Hash
+		}
+		return h
+	}
+	tests := []struct {
+		name string
+		cur  NotificationsCursor
+		want []Hash
+	}{
+		{
+			name: "since",
+			cur:  NotificationsCursor{Since: time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)},
+			want: []Hash{HashFromString(followHash), HashFromString(replyHash)},
+		},
+		{
+			name: "since the newest",
+			cur:  NotificationsCursor{Since: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)},
+			want: []Hash{},
+		},
+		{
+			name: "first page",
+			cur:  NotificationsCursor{MaxItems: 1},
+			want: []Hash{HashFromString(followHash)},
+		},
+		{
+			name: "next page without the older duplicate",
+			cur:  NotificationsCursor{Before: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC), MaxItems: 5},
+			want: []Hash{HashFromString(replyHash), HashFromString(likeHash)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nn, err := r.LoadNotifications(context.Background(), viewer, tt.cur)
+			if err != nil {
+				t.Fatalf("Unable to load the notifications: %s", err)
+			}
+			if got := hashes(nn); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Invalid notifications loaded %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_repository_LoadNotificationsOutOfOrder(t *testing.T) {
+	const (
+		viewerHash    = "9c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c00"
+		aliceHash     = "9c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01"
+		postHash      = "9c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c02"
+		likeHash      = "9c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c03"
+		replyHash     = "9c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c04"
+		followHash    = "9c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c05"
+		oldFollowHash = "9c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c06"
+	)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/actors/"+viewerHash+"/inbox" {
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+			return
+		}
+		alice := fmt.Sprintf("%s/actors/%s", srv.URL, aliceHash)
+		viewer := fmt.Sprintf("%s/actors/%s", srv.URL, viewerHash)
+		post := fmt.Sprintf("%s/objects/%s", srv.URL, postHash)
+		writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[
+			{"id":"%s/activities/%s","type":"Like","actor":"%s","object":"%s","published":"2020-01-01T10:00:00Z"},
+			{"id":"%s/activities/%s","type":"Follow","actor":"%s","object":"%s","published":"2020-01-01T09:00:00Z"},
+			{"id":"%s/activities/%s","type":"Follow","actor":"%s","object":"%s","published":"2020-01-01T12:00:00Z"},
+			{"id":"%s/activities/%s","type":"Create","actor":"%s","object":{"id":"%s/objects/%s","type":"Note","inReplyTo":"%s"},"published":"2020-01-01T11:00:00Z"}]}`,
+			srv.URL, likeHash, alice, post,
+			srv.URL, oldFollowHash, alice, viewer,
+			srv.URL, followHash, alice, viewer,
+			srv.URL, replyHash, alice, srv.URL, replyHash, post,
+		))
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	viewer := Account{
+		Hash:     HashFromString(viewerHash),
+		Handle:   "viewer",
+		Metadata: &AccountMetadata{ID: fmt.Sprintf("%s/actors/%s", srv.URL, viewerHash)},
+		pub:      &pub.Actor{ID: pub.IRI(fmt.Sprintf("%s/actors/%s", srv.URL, viewerHash)), Type: pub.PersonType},
+	}
+	hashes := func(nn []Notification) []Hash {
+		h := make([]Hash, len(nn))
+		for i, n := range nn {
+			h[i] = n.Hash
+		}
+		return h
+	}
+	tests := []struct {
+		name string
+		cur  NotificationsCursor
+		want []Hash
+	}{
+		{
+			name: "all, newest first, without the older duplicate",
+			cur:  NotificationsCursor{},
+			want: []Hash{HashFromString(followHash), HashFromString(replyHash), HashFromString(likeHash)},
+		},
+		{
+			name: "first page",
+			cur:  NotificationsCursor{MaxItems: 2},
+			want: []Hash{HashFromString(followHash), HashFromString(replyHash)},
+		},
+		{
+			name: "since",
+			cur:  NotificationsCursor{Since: time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)},
+			want: []Hash{HashFromString(followHash), HashFromString(replyHash)},
+		},
+		{
+			name: "next page",
+			cur:  NotificationsCursor{Before: time.Date(2020, 1, 1, 11, 0, 0, 0, time.UTC), MaxItems: 2},
+			want: []Hash{HashFromString(likeHash)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nn, err := r.LoadNotifications(context.Background(), viewer, tt.cur)
+			if err != nil {
+				t.Fatalf("Unable to load the notifications: %s", err)
+			}
+			if got := hashes(nn); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Invalid notifications loaded %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_repository_LoadNotificationsUndone(t *testing.T) {
+	const (
+		viewerHash = "9d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c00"
+		aliceHash  = "9d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01"
+		postHash   = "9d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c02"
+		likeHash   = "9d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c03"
+		undoHash   = "9d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c04"
+		followHash = "9d1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c05"
+	)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/actors/"+viewerHash+"/inbox" {
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+			return
+		}
+		alice := fmt.Sprintf("%s/actors/%s", srv.URL, aliceHash)
+		viewer := fmt.Sprintf("%s/actors/%s", srv.URL, viewerHash)
+		post := fmt.Sprintf("%s/objects/%s", srv.URL, postHash)
+		writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[
+			{"id":"%s/activities/%s","type":"Undo","actor":"%s","object":"%s/activities/%s","published":"2020-01-01T11:00:00Z"},
+			{"id":"%s/activities/%s","type":"Like","actor":"%s","object":"%s","published":"2020-01-01T10:00:00Z"},
+			{"id":"%s/activities/%s","type":"Follow","actor":"%s","object":"%s","published":"2020-01-01T09:00:00Z"}]}`,
+			srv.URL, undoHash, alice, srv.URL, likeHash,
+			srv.URL, likeHash, alice, post,
+			srv.URL, followHash, alice, viewer,
+		))
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	viewer := Account{
+		Hash:     HashFromString(viewerHash),
+		Handle:   "viewer",
+		Metadata: &AccountMetadata{ID: fmt.Sprintf("%s/actors/%s", srv.URL, viewerHash)},
+		pub:      &pub.Actor{ID: pub.IRI(fmt.Sprintf("%s/actors/%s", srv.URL, viewerHash)), Type: pub.PersonType},
+	}
+	nn, err := r.LoadNotifications(context.Background(), viewer, NotificationsCursor{})
+	if err != nil {
+		t.Fatalf("Unable to load the notifications: %s", err)
+	}
+	if len(nn) != 1 || nn[0].Hash != HashFromString(followHash) {
+		t.Errorf("Expected only the follow notification, the undone like shouldn't show up, received %v", nn)
+	}
+}
+
+func Test_coalesceNotifications(t *testing.T) {
+	const (
+		alice = pub.IRI("https://littr.example/actors/alice")
+		bob   = pub.IRI("https://littr.example/actors/bob")
+		post  = pub.IRI("https://littr.example/objects/post")
+	)
+	at := func(h int) time.Time {
+		return time.Date(2020, 1, 1, h, 0, 0, 0, time.UTC)
+	}
+	like := func(hash string, actor pub.IRI, h int) Notification {
+		return Notification{Hash: HashFromString(hash), Type: pub.LikeType, Actor: actor, Object: post, Target: post, Published: at(h), Count: 1}
+	}
+	reply := func(hash string, actor pub.IRI, h int) Notification {
+		ob := pub.IRI("https://littr.example/objects/" + hash)
+		return Notification{Hash: HashFromString(hash), Type: pub.CreateType, Actor: actor, Object: ob, Target: post, Published: at(h), Count: 1}
+	}
+	all := []Notification{
+		like("like-1", alice, 1),
+		reply("reply-1", bob, 2),
+		like("like-2", alice, 3),
+		like("like-3", bob, 4),
+		reply("reply-2", bob, 5),
+		like("like-4", alice, 20),
+	}
+	type group struct {
+		hash  Hash
+		count int
+	}
+	tests := []struct {
+		name   string
+		window time.Duration
+		want   []group
+	}{
+		{
+			name: "without a window",
+			want: []group{{HashFromString("like-4"), 3}, {HashFromString("reply-2"), 2}, {HashFromString("like-3"), 1}},
+		},
+		{
+			name:   "in a window",
+			window: 6 * time.Hour,
+			want: []group{
+				{HashFromString("like-4"), 1}, {HashFromString("reply-2"), 2}, {HashFromString("like-3"), 1},
+				{HashFromString("like-2"), 2},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make([]group, 0)
+			for _, n := range coalesceNotifications(all, tt.window) {
+				got = append(got, group{n.Hash, n.Count})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Invalid notifications coalesced %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+const (
+	PasswordClassLower  = "lower"
+	PasswordClassUpper  = "upper"
+	PasswordClassDigit  = "digit"
+	PasswordClassSymbol = "symbol"
+)
+
+// PasswordPolicy are the rules the passwords of the accounts need to follow
+type PasswordPolicy struct {
+	MinLength   int      `json:"minLength"`
+	Classes     []string `json:"classes,omitempty"`
+	BlockCommon bool     `json:"blockCommon"`
+}
+
+// PasswordPolicyFromConfig returns the password policy of the instance
+func PasswordPolicyFromConfig(c config.Configuration) PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:   c.PasswordMinLength,
+		Classes:     c.PasswordClasses,
+		BlockCommon: c.PasswordBlockCommon,
+	}
+}
+
+// ClassList returns the required character classes as a comma separated list, for the client side validation
+func (p PasswordPolicy) ClassList() string {
+	return strings.Join(p.Classes, ",")
+}
+
+// commonPasswords is a short list of the most used passwords, which are the first ones tried by any attacker
+var commonPasswords = []string{
+	"123456", "123456789", "12345678", "1234567890", "password", "password1", "password123", "qwerty", "qwerty123",
+	"qwertyuiop", "111111", "123123", "abc123", "1q2w3e4r", "1qaz2wsx", "iloveyou", "admin", "administrator",
+	"welcome", "welcome1", "letmein", "monkey", "dragon", "sunshine", "princess", "football", "baseball",
+	"master", "shadow", "superman", "trustno1", "passw0rd", "p@ssw0rd", "p@ssword", "zaq12wsx", "starwars",
+	"whatever", "freedom", "changeme", "secret", "asdfghjkl", "asdfasdf", "hello123", "michael", "charlie",
+	"littr", "littr.me",
+}
+
+// keyboardSequences are runs of characters which make for easily guessable passwords
+var keyboardSequences = []string{
+	"abcdefghijklmnopqrstuvwxyz",
+	"01234567890",
+	"09876543210",
+	"qwertyuiopasdfghjklzxcvbnm",
+	"1qaz2wsx3edc4rfv5tgb6yhn7ujm8ik9ol0p",
+}
+
+// isCommonPassword returns true if the password is one of the common ones, it's derived from the handle,
+// it's a sequence of keys or it repeats the same character
+func isCommonPassword(pw, handle string) bool {
+	lower := strings.ToLower(pw)
+	for _, c := range commonPasswords {
+		if lower == c {
+			return true
+		}
+	}
+	if len(handle) > 0 && strings.Contains(lower, strings.ToLower(handle)) {
+		return true
+	}
+	for _, seq := range keyboardSequences {
+		if strings.Contains(seq, lower) {
+			return true
+		}
+	}
+	return len(strings.Trim(lower, lower[:1])) == 0
+}
+
+func passwordHasClass(pw string, class string) bool {
+	var isFn func(rune) bool
+	switch class {
+	case PasswordClassLower:
+		isFn = unicode.IsLower
+	case PasswordClassUpper:
+		isFn = unicode.IsUpper
+	case PasswordClassDigit:
+		isFn = unicode.IsDigit
+	case PasswordClassSymbol:
+		isFn = func(r rune) bool {
+			return unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r)
+		}
+	default:
+		return true
+	}
+	return strings.IndexFunc(pw, isFn) >= 0
+}
+
+// Validate returns the rules of the policy the password for the account with handle doesn't follow
+func (p PasswordPolicy) Validate(pw, handle string) []error {
+	errs := make([]error, 0)
+	invalid := func(s string, args ...interface{}) {
+		errs = append(errs, &fieldError{field: "pw", error: errors.BadRequestf(s, args...)})
+	}
+	if len(pw) == 0 {
+		invalid("the password can not be empty")
+		return errs
+	}
+	if l := len([]rune(pw)); l < p.MinLength {
+		invalid("the password must be at least %d characters long", p.MinLength)
+	}
+	for _, class := range p.Classes {
+		if !passwordHasClass(pw, class) {
+			invalid("the password must contain at least one %s character", class)
+		}
+	}
+	if p.BlockCommon && isCommonPassword(pw, handle) {
+		invalid("the password is too common or easy to guess")
+	}
+	return errs
+}
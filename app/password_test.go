@@ -0,0 +1,43 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/go-ap/errors"
+)
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policy := PasswordPolicy{
+		MinLength:   10,
+		Classes:     []string{PasswordClassLower, PasswordClassDigit},
+		BlockCommon: true,
+	}
+	tests := []struct {
+		name     string
+		pw       string
+		handle   string
+		wantErrs int
+	}{
+		{name: "valid", pw: "correct horse 42 battery", handle: "johndoe"},
+		{name: "too short", pw: "h0rse", handle: "johndoe", wantErrs: 1},
+		{name: "common password", pw: "Password123", handle: "johndoe", wantErrs: 1},
+		{name: "keyboard sequence", pw: "1qaz2wsx3edc", handle: "johndoe", wantErrs: 1},
+		{name: "contains handle", pw: "johndoe2020!", handle: "johndoe", wantErrs: 1},
+		{name: "missing classes", pw: "CORRECTHORSEBATTERY", handle: "johndoe", wantErrs: 2},
+		{name: "empty", pw: "", handle: "johndoe", wantErrs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := policy.Validate(tt.pw, tt.handle)
+			if len(errs) != tt.wantErrs {
+				t.Fatalf("Validate() returned %d errors %v, expected %d", len(errs), errs, tt.wantErrs)
+			}
+			for _, err := range errs {
+				var fe *fieldError
+				if !errors.As(err, &fe) || fe.Field() != "pw" {
+					t.Errorf("Validate() error %q should belong to the pw field", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+// Peer is a remote instance we exchanged activities with
+type Peer struct {
+	Host      string    `json:"host"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Software  string    `json:"software,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	Blocked   bool      `json:"blocked,omitempty"`
+	Trusted   bool      `json:"trusted,omitempty"`
+}
+
+// peers holds the distinct remote hosts that show up in the activities we process
+type peers struct {
+	m       sync.RWMutex
+	p       map[string]*Peer
+	blocked []string
+	trusted []string
+}
+
+func hostList(hosts []string) []string {
+	l := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if h = strings.ToLower(strings.TrimSpace(h)); len(h) > 0 {
+			l = append(l, h)
+		}
+	}
+	return l
+}
+
+func newPeers(blocked, trusted []string) *peers {
+	return &peers{p: make(map[string]*Peer), blocked: hostList(blocked), trusted: hostList(trusted)}
+}
+
+func matchesHost(host string, list []string) bool {
+	host = strings.ToLower(host)
+	for _, b := range list {
+		if host == b || strings.HasSuffix(host, "."+b) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBlocked returns true if the host, or one of its parent domains, is in the blocked instances list
+func (p *peers) IsBlocked(host string) bool {
+	if p == nil {
+		return false
+	}
+	return matchesHost(host, p.blocked)
+}
+
+// IsTrusted returns true if the host, or one of its parent domains, is in the trusted instances list.
+// A blocked host is never trusted.
+func (p *peers) IsTrusted(host string) bool {
+	if p == nil || p.IsBlocked(host) {
+		return false
+	}
+	return matchesHost(host, p.trusted)
+}
+
+// Record adds the host of the IRI to the list of peers, if it's not a local one
+func (p *peers) Record(iri pub.IRI) {
+	if p == nil || len(iri) == 0 || iri == pub.PublicNS {
+		return
+	}
+	u, err := url.Parse(iri.String())
+	if err != nil || len(u.Host) == 0 || HostIsLocal(iri.String()) {
+		return
+	}
+	host := strings.ToLower(u.Host)
+	now := time.Now().UTC()
+
+	p.m.Lock()
+	defer p.m.Unlock()
+	if peer, ok := p.p[host]; ok {
+		peer.LastSeen = now
+		return
+	}
+	p.p[host] = &Peer{Host: host, FirstSeen: now, LastSeen: now}
+}
+
+// RecordActivity adds the hosts of the activity's actor, object and recipients to the list of peers
+func (p *peers) RecordActivity(it pub.Item) {
+	if p == nil || it == nil {
+		return
+	}
+	p.Record(it.GetLink())
+	pub.OnActivity(it, func(a *pub.Activity) error {
+		if a.Actor != nil {
+			p.Record(a.Actor.GetLink())
+		}
+		if a.Object != nil {
+			p.Record(a.Object.GetLink())
+			pub.OnObject(a.Object, func(o *pub.Object) error {
+				if o.AttributedTo != nil {
+					p.Record(o.AttributedTo.GetLink())
+				}
+				return nil
+			})
+		}
+		for _, rec := range a.Recipients() {
+			p.Record(rec.GetLink())
+		}
+		return nil
+	})
+}
+
+// List returns the peers ordered by host, with their blocked and trusted state
+func (p *peers) List() []Peer {
+	if p == nil {
+		return nil
+	}
+	p.m.RLock()
+	defer p.m.RUnlock()
+	result := make([]Peer, 0, len(p.p))
+	for _, peer := range p.p {
+		pp := *peer
+		pp.Blocked = p.IsBlocked(pp.Host)
+		pp.Trusted = p.IsTrusted(pp.Host)
+		result = append(result, pp)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Host < result[j].Host
+	})
+	return result
+}
+
+// LoadPeers returns the known peers, with their NodeInfo software if withInfo is true.
+// The NodeInfo is fetched from the remote instances only if fetchInfo is true, otherwise we use only what we already loaded.
+// The blocked ones are returned only if showBlocked is true.
+func (r *repository) LoadPeers(ctx context.Context, withInfo, fetchInfo, showBlocked bool) []Peer {
+	result := make([]Peer, 0)
+	for _, peer := range r.peers.List() {
+		if peer.Blocked && !showBlocked {
+			continue
+		}
+		if withInfo && !peer.Blocked {
+			ni := r.cachedRemoteNodeInfo(peer.Host)
+			if fetchInfo {
+				ni, _ = r.LoadRemoteNodeInfo(ctx, peer.Host)
+			}
+			if ni != nil {
+				peer.Software = ni.Software.Name
+				peer.Version = ni.Software.Version
+			}
+		}
+		result = append(result, peer)
+	}
+	return result
+}
+
+// HandlePeers serves /peers
+// The blocked instances are visible only to moderators, and the NodeInfo details are added only if requested with ?nodeinfo.
+// Only the moderators make us fetch the NodeInfo of the peers, everyone else gets the details we already loaded.
+func (h *handler) HandlePeers(w http.ResponseWriter, r *http.Request) {
+	_, withInfo := r.URL.Query()["nodeinfo"]
+	isModerator := loggedAccount(r).IsModerator()
+
+	dat, _ := json.Marshal(h.storage.LoadPeers(r.Context(), withInfo, isModerator, isModerator))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dat)
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+func Test_peers_RecordActivity(t *testing.T) {
+	Instance.Conf = &config.Configuration{HostName: "littr.example", APIURL: "https://fedbox.littr.example"}
+
+	p := newPeers([]string{"blocked.example"}, nil)
+	act := &pub.Activity{
+		ID:    "https://remote.example/activities/1",
+		Type:  pub.CreateType,
+		Actor: pub.IRI("https://remote.example/users/jdoe"),
+		To:    pub.ItemCollection{pub.PublicNS, pub.IRI("https://fedbox.littr.example/actors/1")},
+		CC:    pub.ItemCollection{pub.IRI("https://spam.blocked.example/users/spammer")},
+		Object: &pub.Object{
+			ID:           "https://remote.example/objects/1",
+			Type:         pub.NoteType,
+			AttributedTo: pub.IRI("https://remote.example/users/jdoe"),
+		},
+	}
+	if len(p.List()) != 0 {
+		t.Fatalf("The peers list should be empty")
+	}
+	p.RecordActivity(act)
+
+	peers := p.List()
+	if len(peers) != 2 {
+		t.Fatalf("Invalid peers %v, expected %d", peers, 2)
+	}
+	if peers[0].Host != "remote.example" || peers[0].Blocked {
+		t.Errorf("Invalid peer %v, expected remote.example to be added", peers[0])
+	}
+	if peers[1].Host != "spam.blocked.example" || !peers[1].Blocked {
+		t.Errorf("Invalid peer %v, expected spam.blocked.example to be marked as blocked", peers[1])
+	}
+
+	r := &repository{peers: p, infoFn: defaultCtxLogFn, errFn: defaultCtxLogFn}
+	if visible := r.LoadPeers(context.Background(), false, false, false); len(visible) != 1 || visible[0].Host != "remote.example" {
+		t.Errorf("Invalid visible peers %v, expected the blocked ones to be hidden", visible)
+	}
+
+	// NOTE(marius): without fetchInfo only the NodeInfo we already loaded is used, remote.example isn't reachable
+	r.nodeInfo = newNodeInfoCache(DefaultNodeInfoTTL)
+	if visible := r.LoadPeers(context.Background(), true, false, false); len(visible) != 1 || len(visible[0].Software) > 0 {
+		t.Errorf("Invalid visible peers %v, expected no NodeInfo details before they were loaded", visible)
+	}
+	r.nodeInfo.set("remote.example", &RemoteNodeInfo{Software: NodeInfoSoftware{Name: "mastodon", Version: "3.4.1"}}, nil)
+	if visible := r.LoadPeers(context.Background(), true, false, false); len(visible) != 1 || visible[0].Software != "mastodon" {
+		t.Errorf("Invalid visible peers %v, expected the cached NodeInfo details", visible)
+	}
+}
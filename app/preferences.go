@@ -0,0 +1,135 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+)
+
+// preferencesName is the name of the object, in the actor's streams, with the account's preferences
+const preferencesName = "preferences"
+
+// AccountPreferences are the settings of an account that only make sense on this instance.
+// They are saved with the actor, in its streams, the same way as the featured tags.
+type AccountPreferences struct {
+	MutedThreads           Hashes         `json:"mutedThreads,omitempty"`
+	UnmutedThreads         Hashes         `json:"unmutedThreads,omitempty"`
+	AutoMute               *int           `json:"autoMute,omitempty"`
+	Held                   []HeldActivity `json:"held,omitempty"`
+	DismissedItems         Hashes         `json:"dismissedItems,omitempty"`
+	SensitivePolicy        string         `json:"sensitive,omitempty"`
+	NotificationsRead      time.Time      `json:"notificationsRead,omitempty"`
+	ReadNotifications      Hashes         `json:"readNotifications,omitempty"`
+	MinScore               *int           `json:"minScore,omitempty"`
+	DismissedAnnouncements Hashes         `json:"dismissedAnnouncements,omitempty"`
+	Trust                  TrustLevel     `json:"trust,omitempty"`
+}
+
+// loadAPPreferences returns the object with the account's preferences, which we add to the actor's streams
+func loadAPPreferences(acc Account) (*pub.Object, error) {
+	raw, err := json.Marshal(acc.Metadata.Preferences)
+	if err != nil {
+		return nil, err
+	}
+	ob := pub.ObjectNew(pub.ObjectType)
+	ob.ID = pub.ID(fmt.Sprintf("%s/%s", acc.Metadata.ID, preferencesName))
+	ob.Name = pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content(preferencesName)}}
+	ob.MediaType = "application/json"
+	ob.Content = pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content(raw)}}
+	return ob, nil
+}
+
+// setAPPreferences replaces the preferences object in the actor's streams with the account's
+func setAPPreferences(p *pub.Actor, acc Account) error {
+	ob, err := loadAPPreferences(acc)
+	if err != nil {
+		return err
+	}
+	streams := make(pub.ItemCollection, 0)
+	for _, s := range p.Streams {
+		if !isNamedStream(s, preferencesName) {
+			streams = append(streams, s)
+		}
+	}
+	p.Streams = append(streams, ob)
+	return nil
+}
+
+// preferencesFromStreams returns the account preferences in the actor's streams, or nil if there are none
+func preferencesFromStreams(streams pub.ItemCollection) *AccountPreferences {
+	var prefs *AccountPreferences
+	for _, s := range streams {
+		if !isNamedStream(s, preferencesName) {
+			continue
+		}
+		pub.OnObject(s, func(o *pub.Object) error {
+			p := new(AccountPreferences)
+			if err := json.Unmarshal([]byte(o.Content.First().Value), p); err != nil {
+				return err
+			}
+			prefs = p
+			return nil
+		})
+	}
+	return prefs
+}
+
+// SavePreferences changes the account's preferences with fn, and saves them with the account.
+// The account is updated in place, so the rest of the request sees the new preferences.
+func (r *repository) SavePreferences(ctx context.Context, acc *Account, fn func(*AccountPreferences)) error {
+	if !acc.IsLogged() || !acc.HasMetadata() || len(acc.Metadata.ID) == 0 {
+		return errors.Unauthorizedf("invalid account %s", acc.Handle)
+	}
+	// NOTE(marius): we change the actor as it is stored, the account we received can be out of date,
+	// or only partially loaded, and saving it would overwrite the rest of the actor
+	stored, err := r.account(ctx, &Filters{IRI: CompStrs{EqualsString(acc.Metadata.ID)}})
+	if err != nil {
+		return errors.Annotatef(err, "unable to load account %s", acc.Handle)
+	}
+	prefs := stored.Metadata.Preferences
+	if prefs == nil {
+		prefs = new(AccountPreferences)
+	}
+	fn(prefs)
+	stored.Metadata.Preferences = prefs
+	if _, err := r.SaveAccount(ctx, stored); err != nil {
+		return err
+	}
+	acc.Metadata.Preferences = prefs
+	return nil
+}
+
+// appendBounded adds h to the list, if it's not already there, dropping the oldest ones if it has more than max
+func appendBounded(list Hashes, h Hash, max int) Hashes {
+	if list.Contains(h) {
+		return list
+	}
+	list = append(list, h)
+	if len(list) > max {
+		list = list[len(list)-max:]
+	}
+	return list
+}
+
+// removeHash returns the list without h
+func removeHash(list Hashes, h Hash) Hashes {
+	result := make(Hashes, 0, len(list))
+	for _, hh := range list {
+		if hh != h {
+			result = append(result, hh)
+		}
+	}
+	return result
+}
+
+// accountPreferences returns the preferences of the account, or the empty ones if it didn't save any
+func accountPreferences(acc *Account) AccountPreferences {
+	if !acc.HasMetadata() || acc.Metadata.Preferences == nil {
+		return AccountPreferences{}
+	}
+	return *acc.Metadata.Preferences
+}
@@ -0,0 +1,207 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+// accountFedbox is a fake fedbox that stores the actor it receives in Update activities, and records the other ones
+type accountFedbox struct {
+	*httptest.Server
+	m       sync.Mutex
+	actor   string
+	objects map[string]string
+	posted  []*pub.Activity
+}
+
+func newAccountFedbox() *accountFedbox {
+	f := &accountFedbox{objects: make(map[string]string)}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	f.actor = `{"id":"` + f.URL + `/actors/` + testActorHash + `","type":"Person","preferredUsername":"johndoe"}`
+	return f
+}
+
+// add makes the fake serve the raw JSON document at path
+func (f *accountFedbox) add(path, raw string) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.objects[path] = raw
+}
+
+func (f *accountFedbox) serve(w http.ResponseWriter, r *http.Request) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if raw, ok := f.objects[r.URL.Path]; ok && r.Method == http.MethodGet {
+		writeActivityJSON(w, http.StatusOK, raw)
+		return
+	}
+	objIRI := pub.IRI(f.URL + "/objects/" + testObjectHash)
+	if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/outbox") {
+		body, _ := ioutil.ReadAll(r.Body)
+		it, _ := pub.UnmarshalJSON(body)
+		pub.OnActivity(it, func(a *pub.Activity) error {
+			if a.Object != nil && ValidActorTypes.Contains(a.Object.GetType()) {
+				raw, _ := json.Marshal(a.Object)
+				f.actor = string(raw)
+				return nil
+			}
+			if a.Type == pub.CreateType {
+				pub.OnObject(a.Object, func(o *pub.Object) error {
+					o.ID = objIRI
+					return nil
+				})
+			}
+			if a.Type == pub.LikeType {
+				a.ID = pub.IRI(f.URL + "/activities/" + testLikeHash)
+			}
+			f.posted = append(f.posted, a)
+			return nil
+		})
+		body, _ = json.Marshal(it)
+		w.Header().Set("Location", f.URL+"/activities/"+testLikeHash)
+		writeActivityJSON(w, http.StatusCreated, string(body))
+		return
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/objects/"+testObjectHash {
+		writeActivityJSON(w, http.StatusOK, `{"id":"`+objIRI.String()+`","type":"Note","content":"hello"}`)
+		return
+	}
+	if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/actors") {
+		writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[`+f.actor+`]}`)
+		return
+	}
+	if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/likes") {
+		writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+// storedAccount returns the account as it's saved in the fake, like the sessions load it on every request
+func (f *accountFedbox) storedAccount(t *testing.T, r *repository) *Account {
+	acc, err := r.account(context.Background(), &Filters{IRI: CompStrs{EqualsString(f.URL + "/actors/" + testActorHash)}})
+	if err != nil {
+		t.Fatalf("Unable to load the account: %s", err)
+	}
+	return &acc
+}
+
+func (f *accountFedbox) activities() []*pub.Activity {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.posted
+}
+
+func Test_loadAPPerson_PreferencesRoundTrip(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	r := testRepository(srv)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(srv.URL), Type: pub.ServiceType}
+
+	threshold := 10
+	prefs := &AccountPreferences{
+		MutedThreads: Hashes{HashFromString(testObjectHash)},
+		AutoMute:     &threshold,
+	}
+	acc := Account{
+		Hash:     HashFromString(testActorHash),
+		Handle:   "johndoe",
+		Metadata: &AccountMetadata{ID: srv.URL + "/actors/" + testActorHash, FeaturedTags: []string{"golang"}, Preferences: prefs},
+	}
+	raw, err := json.Marshal(r.loadAPPerson(acc))
+	if err != nil {
+		t.Fatalf("unable to marshal actor: %s", err)
+	}
+	it, err := pub.UnmarshalJSON(raw)
+	if err != nil {
+		t.Fatalf("unable to unmarshal actor: %s", err)
+	}
+	loaded := Account{}
+	if err := loaded.FromActivityPub(it); err != nil {
+		t.Fatalf("unable to load account: %s", err)
+	}
+	if !reflect.DeepEqual(loaded.Metadata.Preferences, prefs) {
+		t.Errorf("Invalid preferences %v, expected %v", loaded.Metadata.Preferences, prefs)
+	}
+	if !reflect.DeepEqual(loaded.Metadata.FeaturedTags, []string{"golang"}) {
+		t.Errorf("The preferences should not replace the featured tags, received %v", loaded.Metadata.FeaturedTags)
+	}
+
+	// NOTE(marius): saving the account again replaces the preferences object in the actor's streams
+	loaded.Metadata.Preferences = &AccountPreferences{}
+	p := r.loadAPPerson(loaded)
+	count := 0
+	for _, s := range p.Streams {
+		if isNamedStream(s, preferencesName) {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("Invalid number of preferences objects %d in the actor's streams, expected 1", count)
+	}
+	if saved := preferencesFromStreams(p.Streams); saved == nil || len(saved.MutedThreads) > 0 {
+		t.Errorf("Invalid preferences %v, expected empty ones", saved)
+	}
+}
+
+func Test_repository_SavePreferences(t *testing.T) {
+	f := newAccountFedbox()
+	defer f.Close()
+	r := testRepository(f.Server)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(f.URL), Type: pub.ServiceType}
+
+	// NOTE(marius): the account in the session can be out of date, the preferences are changed on the stored actor
+	threshold := 5
+	f.actor = `{"id":"` + f.URL + `/actors/` + testActorHash + `","type":"Person","preferredUsername":"johndoe",` +
+		`"streams":[{"type":"Object","name":"preferences","mediaType":"application/json","content":"{\"autoMute\":5}"}]}`
+	acc := testVote(f.Server, 1).SubmittedBy
+	root := HashFromString(testObjectHash)
+	err := r.SavePreferences(context.Background(), acc, func(p *AccountPreferences) {
+		p.MutedThreads = append(p.MutedThreads, root)
+	})
+	if err != nil {
+		t.Fatalf("Unable to save the preferences: %s", err)
+	}
+	want := &AccountPreferences{MutedThreads: Hashes{root}, AutoMute: &threshold}
+	if saved := accountPreferences(f.storedAccount(t, r)); !reflect.DeepEqual(&saved, want) {
+		t.Errorf("Invalid preferences saved with the actor %v, expected %v", saved, want)
+	}
+	if !reflect.DeepEqual(acc.Metadata.Preferences, want) {
+		t.Errorf("Invalid account preferences %v, expected %v", acc.Metadata.Preferences, want)
+	}
+
+	f.Close()
+	err = r.SavePreferences(context.Background(), acc, func(p *AccountPreferences) {
+		p.MutedThreads = nil
+	})
+	if err == nil {
+		t.Errorf("Expected an error when the account can't be saved")
+	}
+	if !accountPreferences(acc).MutedThreads.Contains(root) {
+		t.Errorf("The account should keep its preferences when they can't be saved")
+	}
+}
+
+func Test_appendBounded(t *testing.T) {
+	list := Hashes{}
+	for i := 0; i < 5; i++ {
+		list = appendBounded(list, Hash{0, 0, 0, 2, byte(i)}, 3)
+	}
+	list = appendBounded(list, Hash{0, 0, 0, 2, 4}, 3)
+	want := Hashes{{0, 0, 0, 2, 2}, {0, 0, 0, 2, 3}, {0, 0, 0, 2, 4}}
+	if !reflect.DeepEqual(list, want) {
+		t.Errorf("Invalid hashes %v, expected %v", list, want)
+	}
+	if list = removeHash(list, Hash{0, 0, 0, 2, 3}); len(list) != 2 || list.Contains(Hash{0, 0, 0, 2, 3}) {
+		t.Errorf("Invalid hashes %v after removing one", list)
+	}
+}
@@ -0,0 +1,344 @@
+package app
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-ap/errors"
+)
+
+const (
+	// DefaultProxyMaxSize is the maximum size of the media files we proxy, if not configured
+	DefaultProxyMaxSize = 5 << 20
+	// DefaultProxyCacheTTL is how long we keep the proxied media files, if not configured
+	DefaultProxyCacheTTL = time.Hour
+	// DefaultProxyCacheSize is the total size of the media files we keep in memory, if not configured
+	DefaultProxyCacheSize = 64 << 20
+	// maxProxyRedirects bounds the number of redirects we follow when loading a media file
+	maxProxyRedirects = 5
+)
+
+// proxyMimeTypes are the media types we accept to re-serve. SVG is not in the list, as it can contain scripts.
+var proxyMimeTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"image/avif",
+	"video/mp4",
+	"video/webm",
+	"audio/mpeg",
+	"audio/ogg",
+}
+
+// mediaProxy is the proxy used for rewriting remote media URLs, it's nil when proxying is disabled
+var mediaProxy *imageProxy
+
+type proxiedMedia struct {
+	mimeType string
+	data     []byte
+	expires  time.Time
+}
+
+// imageProxy fetches remote avatars and media, and re-serves them from our domain,
+// so the visitors' browsers don't connect to the remote hosts.
+type imageProxy struct {
+	key     []byte
+	maxSize int64
+	ttl     time.Duration
+	client  *http.Client
+	m       sync.RWMutex
+	cache   map[string]*proxiedMedia
+	// cacheSize bounds the total size of the media files in the cache, used is their current size
+	cacheSize int64
+	used      int64
+}
+
+// blockedAddressError is returned when a media host resolves to an address we don't connect to
+type blockedAddressError struct {
+	addr string
+}
+
+func (e *blockedAddressError) Error() string {
+	return fmt.Sprintf("connecting to %s is not allowed", e.addr)
+}
+
+// publicAddress returns false for the loopback, private, link-local, unspecified and multicast addresses,
+// which the remote media can't be hosted on
+func publicAddress(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, cidr := range privateNetworks {
+		if cidr.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// privateNetworks are the ranges, besides the loopback and link-local ones, that aren't reachable from the internet
+var privateNetworks = func() []*net.IPNet {
+	nets := make([]*net.IPNet, 0)
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "0.0.0.0/8", "fc00::/7"} {
+		if _, n, err := net.ParseCIDR(cidr); err == nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}()
+
+// dialPublicOnly refuses the connections to the addresses that aren't public. It runs after the host name was resolved,
+// so the names that resolve, or get rebound, to internal addresses are refused too.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !publicAddress(net.ParseIP(host)) {
+		return &blockedAddressError{addr: host}
+	}
+	return nil
+}
+
+// newMediaClient returns the client we load the remote media with. It connects only to public addresses, over http(s),
+// and verifies the TLS certificates of the remote hosts unless insecure is set.
+func newMediaClient(insecure bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: dialPublicOnly}
+	tr := &http.Transport{
+		// NOTE(marius): we don't use the environment's proxy, as it would connect to the media hosts on our behalf
+		Proxy:               nil,
+		DialContext:         dialer.DialContext,
+		TLSClientConfig:     &tls.Config{InsecureSkipVerify: insecure},
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        16,
+		IdleConnTimeout:     90 * time.Second,
+	}
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: tr,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxProxyRedirects {
+				return errors.Newf("stopped after %d redirects", maxProxyRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.NotValidf("invalid redirect to %s", req.URL)
+			}
+			return nil
+		},
+	}
+}
+
+func newImageProxy(key []byte, maxSize, cacheSize int64, ttl time.Duration, insecure bool) *imageProxy {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultProxyMaxSize
+	}
+	if cacheSize <= 0 {
+		cacheSize = DefaultProxyCacheSize
+	}
+	if ttl <= 0 {
+		ttl = DefaultProxyCacheTTL
+	}
+	return &imageProxy{
+		key:       key,
+		maxSize:   maxSize,
+		ttl:       ttl,
+		client:    newMediaClient(insecure),
+		cache:     make(map[string]*proxiedMedia),
+		cacheSize: cacheSize,
+	}
+}
+
+func (p *imageProxy) sign(u string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(u))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// isRemoteMediaURL returns true if s is an http(s) URL not hosted on the current instance
+func isRemoteMediaURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil || len(u.Host) == 0 || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	return !HostIsLocal(s)
+}
+
+// ProxiedURL returns the URL through which we serve the remote media at u, when proxying is enabled
+func ProxiedURL(u string) string {
+	if mediaProxy == nil || !isRemoteMediaURL(u) {
+		return u
+	}
+	q := url.Values{}
+	q.Set("url", u)
+	q.Set("s", mediaProxy.sign(u))
+	return fmt.Sprintf("%s/proxy?%s", Instance.BaseURL, q.Encode())
+}
+
+// unproxiedURL returns the original URL of the media if u points to our proxy
+func unproxiedURL(u string) string {
+	if !strings.HasPrefix(u, Instance.BaseURL+"/proxy?") {
+		return u
+	}
+	pu, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	if orig := pu.Query().Get("url"); len(orig) > 0 {
+		return orig
+	}
+	return u
+}
+
+func validProxyMimeType(typ string) (string, bool) {
+	m, _, err := mime.ParseMediaType(typ)
+	if err != nil {
+		return "", false
+	}
+	for _, valid := range proxyMimeTypes {
+		if m == valid {
+			return m, true
+		}
+	}
+	return m, false
+}
+
+func (p *imageProxy) cached(u string) *proxiedMedia {
+	p.m.RLock()
+	defer p.m.RUnlock()
+	if m, ok := p.cache[u]; ok && time.Now().Before(m.expires) {
+		return m
+	}
+	return nil
+}
+
+func (p *imageProxy) drop(u string) {
+	if c, ok := p.cache[u]; ok {
+		p.used -= int64(len(c.data))
+		delete(p.cache, u)
+	}
+}
+
+// store keeps the media file in the cache, while the total size of the cached files stays under the cacheSize
+func (p *imageProxy) store(u string, m *proxiedMedia) {
+	size := int64(len(m.data))
+	if size > p.cacheSize {
+		return
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	p.drop(u)
+	if p.used+size > p.cacheSize {
+		now := time.Now()
+		for k, c := range p.cache {
+			if now.After(c.expires) {
+				p.drop(k)
+			}
+		}
+		// NOTE(marius): if there's still not enough room, we drop random entries
+		for k := range p.cache {
+			if p.used+size <= p.cacheSize {
+				break
+			}
+			p.drop(k)
+		}
+	}
+	p.cache[u] = m
+	p.used += size
+}
+
+// load returns the remote media at u, from the cache if we have it
+func (p *imageProxy) load(u string) (*proxiedMedia, error) {
+	if m := p.cached(u); m != nil {
+		return m, nil
+	}
+	resp, err := p.client.Get(u)
+	if err != nil {
+		var blocked *blockedAddressError
+		if stderrors.As(err, &blocked) {
+			return nil, errors.Forbiddenf("remote media %s is not on a public address", u)
+		}
+		return nil, errors.Annotatef(err, "unable to load %s", u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.NotFoundf("remote media %s returned %s", u, resp.Status)
+	}
+	typ, ok := validProxyMimeType(resp.Header.Get("Content-Type"))
+	if !ok {
+		return nil, errors.NotValidf("invalid media type %q for %s", typ, u)
+	}
+	if resp.ContentLength > p.maxSize {
+		return nil, errors.NotValidf("remote media %s is larger than %d bytes", u, p.maxSize)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, p.maxSize+1))
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to read %s", u)
+	}
+	if int64(len(data)) > p.maxSize {
+		return nil, errors.NotValidf("remote media %s is larger than %d bytes", u, p.maxSize)
+	}
+	m := &proxiedMedia{mimeType: typ, data: data, expires: time.Now().Add(p.ttl)}
+	p.store(u, m)
+	return m, nil
+}
+
+// HandleImageProxy serves GET /proxy?url=...&s=... requests for remote media
+func (h *handler) HandleImageProxy(w http.ResponseWriter, r *http.Request) {
+	if mediaProxy == nil {
+		http.NotFound(w, r)
+		return
+	}
+	u := r.URL.Query().Get("url")
+	sig := r.URL.Query().Get("s")
+	if !isRemoteMediaURL(u) || !hmac.Equal([]byte(sig), []byte(mediaProxy.sign(u))) {
+		http.Error(w, "invalid media URL", http.StatusBadRequest)
+		return
+	}
+	m, err := mediaProxy.load(u)
+	if err != nil {
+		h.errFn()("Error: %s", err)
+		status := http.StatusBadGateway
+		if errors.IsNotValid(err) {
+			status = http.StatusUnsupportedMediaType
+		}
+		if errors.IsForbidden(err) {
+			status = http.StatusForbidden
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	w.Header().Set("Content-Type", m.mimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(m.data)))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(mediaProxy.ttl.Seconds())))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	w.WriteHeader(http.StatusOK)
+	w.Write(m.data)
+}
+
+// isMediaURL returns true if the media data is a link instead of base64 encoded content
+func isMediaURL(data string) bool {
+	return strings.HasPrefix(data, "http://") || strings.HasPrefix(data, "https://")
+}
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+func testImageProxy(t *testing.T, maxSize int64) func() {
+	prevConf, prevBase := Instance.Conf, Instance.BaseURL
+	Instance.Conf = &config.Configuration{HostName: "littr.example", APIURL: "https://littr.example/api"}
+	Instance.BaseURL = "https://littr.example"
+	mediaProxy = newImageProxy([]byte("0123456789abcdef"), maxSize, 0, 0, false)
+	return func() {
+		mediaProxy = nil
+		Instance.Conf, Instance.BaseURL = prevConf, prevBase
+	}
+}
+
+func Test_ProxiedURL_RemoteAvatar(t *testing.T) {
+	defer testImageProxy(t, 0)()
+
+	remote := "https://remote.example/media/avatar.png"
+	p := &pub.Person{
+		ID:                "https://remote.example/users/jane",
+		Type:              pub.PersonType,
+		PreferredUsername: pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content("jane")}},
+		Icon:              &pub.Object{Type: pub.ImageType, MediaType: "image/png", URL: pub.IRI(remote)},
+	}
+	a := Account{}
+	if err := a.FromActivityPub(p); err != nil {
+		t.Fatalf("Unable to load account: %s", err)
+	}
+	got := a.Metadata.Icon.URI
+	if !strings.HasPrefix(got, Instance.BaseURL+"/proxy?") {
+		t.Fatalf("Remote avatar URL %q was not rewritten to the proxy", got)
+	}
+	u, _ := url.Parse(got)
+	if orig := u.Query().Get("url"); orig != remote {
+		t.Errorf("Invalid proxied URL %q, expected %q", orig, remote)
+	}
+	if sig := u.Query().Get("s"); sig != mediaProxy.sign(remote) {
+		t.Errorf("Invalid proxied URL signature %q", sig)
+	}
+	if orig := unproxiedURL(got); orig != remote {
+		t.Errorf("Invalid original URL %q, expected %q", orig, remote)
+	}
+	local := "https://littr.example/avatar.png"
+	if got := ProxiedURL(local); got != local {
+		t.Errorf("Local URL %q should not be proxied, got %q", local, got)
+	}
+}
+
+func Test_handler_HandleImageProxy(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 64)...)
+	remote := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/avatar.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(png)
+		case "/large.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(bytes.Repeat([]byte{0}, 1024))
+		case "/avatar.svg":
+			w.Header().Set("Content-Type", "image/svg+xml")
+			w.Write([]byte(`<svg onload="alert(1)"/>`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer remote.Close()
+	defer testImageProxy(t, 512)()
+	// NOTE(marius): the test server listens on the loopback address, which the media client refuses
+	mediaProxy.client = remote.Client()
+
+	h := &handler{infoFn: defaultCtxLogFn, errFn: defaultCtxLogFn}
+	tests := []struct {
+		name   string
+		path   string
+		sign   bool
+		status int
+	}{
+		{name: "valid image", path: "/avatar.png", sign: true, status: http.StatusOK},
+		{name: "invalid signature", path: "/avatar.png", sign: false, status: http.StatusBadRequest},
+		{name: "too large", path: "/large.png", sign: true, status: http.StatusUnsupportedMediaType},
+		{name: "svg", path: "/avatar.svg", sign: true, status: http.StatusUnsupportedMediaType},
+		{name: "missing", path: "/missing.png", sign: true, status: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := remote.URL + tt.path
+			q := url.Values{"url": {u}, "s": {"invalid"}}
+			if tt.sign {
+				q.Set("s", mediaProxy.sign(u))
+			}
+			w := httptest.NewRecorder()
+			h.HandleImageProxy(w, httptest.NewRequest(http.MethodGet, "/proxy?"+q.Encode(), nil))
+			if w.Code != tt.status {
+				t.Fatalf("Invalid status %d, expected %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			if typ := w.Header().Get("Content-Type"); typ != "image/png" {
+				t.Errorf("Invalid Content-Type %q, expected %q", typ, "image/png")
+			}
+			if !bytes.Equal(w.Body.Bytes(), png) {
+				t.Errorf("Invalid proxied body")
+			}
+		})
+	}
+}
+
+func Test_handler_HandleImageProxyRefusesInternalAddresses(t *testing.T) {
+	var fetched bool
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = true
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG\r\n\x1a\n"))
+	}))
+	defer internal.Close()
+	defer testImageProxy(t, 0)()
+
+	h := &handler{infoFn: defaultCtxLogFn, errFn: defaultCtxLogFn}
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{name: "loopback", url: internal.URL + "/avatar.png"},
+		{name: "metadata service", url: "http://169.254.169.254/latest/meta-data/avatar.png"},
+		{name: "private network", url: "http://10.0.0.1/avatar.png"},
+		{name: "ipv6 loopback", url: "http://[::1]/avatar.png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := url.Values{"url": {tt.url}, "s": {mediaProxy.sign(tt.url)}}
+			w := httptest.NewRecorder()
+			h.HandleImageProxy(w, httptest.NewRequest(http.MethodGet, "/proxy?"+q.Encode(), nil))
+			if w.Code != http.StatusForbidden {
+				t.Errorf("Invalid status %d, expected %d", w.Code, http.StatusForbidden)
+			}
+		})
+	}
+	if fetched {
+		t.Errorf("The proxy connected to the server on the loopback address")
+	}
+	if ok := isRemoteMediaURL("file:///etc/passwd"); ok {
+		t.Errorf("Non http(s) URLs should not be proxied")
+	}
+}
+
+func Test_imageProxy_storeBoundsCacheSize(t *testing.T) {
+	p := newImageProxy([]byte("0123456789abcdef"), 0, 10, 0, false)
+	media := func(size int) *proxiedMedia {
+		return &proxiedMedia{mimeType: "image/png", data: make([]byte, size), expires: time.Now().Add(time.Hour)}
+	}
+	p.store("https://remote.example/a.png", media(4))
+	p.store("https://remote.example/b.png", media(4))
+	if p.used != 8 || len(p.cache) != 2 {
+		t.Errorf("Invalid cache size %d bytes in %d entries, expected 8 bytes in 2 entries", p.used, len(p.cache))
+	}
+	// NOTE(marius): replacing an entry doesn't count its previous size
+	p.store("https://remote.example/a.png", media(4))
+	if p.used != 8 {
+		t.Errorf("Invalid cache size %d bytes after replacing an entry, expected 8", p.used)
+	}
+	p.store("https://remote.example/c.png", media(6))
+	if p.used > p.cacheSize {
+		t.Errorf("Invalid cache size %d bytes, expected at most %d", p.used, p.cacheSize)
+	}
+	if p.cached("https://remote.example/c.png") == nil {
+		t.Errorf("The last stored media should be in the cache")
+	}
+	p.store("https://remote.example/large.png", media(11))
+	if p.cached("https://remote.example/large.png") != nil {
+		t.Errorf("The media larger than the whole cache should not be stored")
+	}
+}
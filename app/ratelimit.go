@@ -0,0 +1,167 @@
+package app
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ap/errors"
+)
+
+const (
+	DefaultRateLimitWindow = time.Minute
+
+	// The scopes of the read requests which can be rate limited separately
+	RateLimitFeeds       = "feeds"
+	RateLimitItems       = "items"
+	RateLimitProfiles    = "profiles"
+	RateLimitCollections = "collections"
+)
+
+// rateWindow is the number of requests made with a key in the current window
+type rateWindow struct {
+	count int
+	start time.Time
+}
+
+// rateLimiter counts the read requests per scope and per token, or remote address for the anonymous visitors,
+// in fixed windows, and refuses the ones over the limit of their scope.
+type rateLimiter struct {
+	m      sync.Mutex
+	limits map[string]int
+	window time.Duration
+	pruned time.Time
+	c      map[string]*rateWindow
+}
+
+func newRateLimiter(limits map[string]int, window time.Duration) *rateLimiter {
+	if len(limits) == 0 {
+		return nil
+	}
+	if window <= 0 {
+		window = DefaultRateLimitWindow
+	}
+	return &rateLimiter{limits: limits, window: window, c: make(map[string]*rateWindow)}
+}
+
+// rateLimitKey returns the key the request is counted against: the logged account, or the remote address
+// for the anonymous visitors.
+// NOTE(marius): we don't verify the bearer tokens of the requests, so keying on them would let anyone get a new
+// window by sending a random one. The account's token was verified when it logged in.
+func rateLimitKey(r *http.Request) string {
+	if acc := loggedAccount(r); acc.IsLogged() && acc.Hash.IsValid() {
+		return "account:" + acc.Hash.String()
+	}
+	return loginAddrKey(r)
+}
+
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < l.window {
+		return
+	}
+	for k, w := range l.c {
+		if now.Sub(w.start) > l.window {
+			delete(l.c, k)
+		}
+	}
+	l.pruned = now
+}
+
+// allow counts a request with the key for the scope, and returns the scope's limit, the number of requests remaining,
+// and how long until the current window resets. The requests for the scopes without a limit are always allowed.
+func (l *rateLimiter) allow(scope, key string) (limit, remaining int, reset time.Duration, ok bool) {
+	if l == nil {
+		return 0, 0, 0, true
+	}
+	limit, limited := l.limits[scope]
+	if !limited || limit <= 0 {
+		return 0, 0, 0, true
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+	k := scope + "/" + key
+	w, exists := l.c[k]
+	if !exists || now.Sub(w.start) > l.window {
+		w = &rateWindow{start: now}
+		l.c[k] = w
+	}
+	reset = w.start.Add(l.window).Sub(now)
+	if w.count >= limit {
+		return limit, 0, reset, false
+	}
+	w.count++
+	return limit, limit - w.count, reset, true
+}
+
+// rateLimitExempt returns true for the accounts at the leader trust level, and for the requests signed by the actors
+// of the trusted instances.
+// The trusted instances are exempt only through their signed requests: the trusted list has host names, which we can
+// only match against the verified signer's host, never against the remote address of the request.
+func (h *handler) rateLimitExempt(r *http.Request) bool {
+	if h.storage == nil {
+		return false
+	}
+	if acc := loggedAccount(r); acc.IsLogged() && h.storage.trust.For(acc) >= TrustLevelLeader {
+		return true
+	}
+	if !isSignedRequest(r) {
+		return false
+	}
+	_, err := h.storage.verifiedSigner(r)
+	return err == nil
+}
+
+// RateLimit refuses with a 429 status the read requests over the limit of the scope, and adds the RateLimit headers
+// to the ones that are allowed
+func (h *handler) RateLimit(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if h.limits == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, limited := h.limits.limits[scope]; !limited || h.rateLimitExempt(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limit, remaining, reset, ok := h.limits.allow(scope, rateLimitKey(r))
+			retry := int(math.Ceil(reset.Seconds()))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(retry))
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(retry))
+				h.tooManyRequests(w, r, time.Duration(retry)*time.Second)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tooManyRequests responds with a 429 status to the read requests over their rate limit
+func (h *handler) tooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	err := errors.Newf("Too many requests, try again in %s", wait.String())
+	w.Header().Set("Cache-Control", " no-store, must-revalidate")
+	if h.v == nil || strings.Contains(r.Header.Get("Accept"), "json") {
+		dat, _ := json.Marshal(map[string]string{"error": err.Error()})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write(dat)
+		return
+	}
+	d := &errorModel{
+		Status:     http.StatusTooManyRequests,
+		StatusText: http.StatusText(http.StatusTooManyRequests),
+		Title:      "Error 429",
+		Errors:     []error{err},
+	}
+	w.WriteHeader(d.Status)
+	h.v.RenderTemplate(r, w, "error", d)
+}
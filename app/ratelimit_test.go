@@ -0,0 +1,187 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_handler_RateLimit(t *testing.T) {
+	const max = 2
+	h := &handler{
+		storage: &repository{peers: newPeers(nil, []string{"10.0.0.1"})},
+		limits:  newRateLimiter(map[string]int{RateLimitFeeds: max}, time.Minute),
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	feeds, items := h.RateLimit(RateLimitFeeds)(ok), h.RateLimit(RateLimitItems)(ok)
+
+	get := func(next http.Handler, addr, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = addr
+		req.Header.Set("Accept", "application/json")
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		next.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 1; i <= max; i++ {
+		w := get(feeds, "192.0.2.1:1234", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("Request %d should be allowed, received %d", i, w.Code)
+		}
+		if rem := w.Header().Get("RateLimit-Remaining"); rem != strconv.Itoa(max-i) {
+			t.Errorf("Invalid RateLimit-Remaining header %q for request %d", rem, i)
+		}
+	}
+	w := get(feeds, "192.0.2.1:4321", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Request %d should be refused, received %d", max+1, w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Errorf("The refused request should have a Retry-After header")
+	}
+	if l := w.Header().Get("RateLimit-Limit"); l != "2" {
+		t.Errorf("Invalid RateLimit-Limit header %q, expected %d", l, max)
+	}
+	if rem := w.Header().Get("RateLimit-Remaining"); rem != "0" {
+		t.Errorf("Invalid RateLimit-Remaining header %q, expected 0", rem)
+	}
+	if w.Header().Get("RateLimit-Reset") == "" {
+		t.Errorf("The refused request should have a RateLimit-Reset header")
+	}
+
+	if w := get(feeds, "192.0.2.1:1234", "random"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("The requests with an unverified token should be counted against their address, received %d", w.Code)
+	}
+	if w := get(feeds, "192.0.2.2:1234", ""); w.Code != http.StatusOK {
+		t.Errorf("The requests from other addresses should be allowed, received %d", w.Code)
+	}
+	if w := get(items, "192.0.2.1:1234", ""); w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("The scopes without a limit should not be rate limited, received %d", w.Code)
+	}
+	for i := 0; i < max; i++ {
+		get(feeds, "10.0.0.1:1234", "")
+	}
+	if w := get(feeds, "10.0.0.1:1234", ""); w.Code != http.StatusTooManyRequests {
+		t.Errorf("The unsigned requests can't be matched to a trusted host by their address, received %d", w.Code)
+	}
+	if len(h.limits.c) != 3 {
+		t.Errorf("Invalid number of rate limit windows %d, expected one per address", len(h.limits.c))
+	}
+}
+
+func Test_handler_RateLimitSignedRequests(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unable to generate RSA key: %s", err)
+	}
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	var srv *httptest.Server
+	fetches := 0
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		actor := srv.URL + r.URL.Path
+		if r.URL.Path == "/actors/impostor" {
+			// NOTE(marius): this document claims to be another actor, with the key of the impostor
+			actor = srv.URL + "/actors/jdoe"
+		}
+		raw, _ := json.Marshal(map[string]interface{}{
+			"id":        actor,
+			"type":      "Person",
+			"publicKey": map[string]string{"id": actor + "#main-key", "owner": actor, "publicKeyPem": pemKey},
+		})
+		writeActivityJSON(w, http.StatusOK, string(raw))
+	}))
+	defer srv.Close()
+
+	const max = 1
+	repo := testRepository(srv)
+	repo.peers = newPeers(nil, []string{host(srv.URL)})
+	repo.signers = newSignerKeys()
+	// NOTE(marius): the default client connects only to public addresses, so it refuses the test server
+	repo.signers.client = http.DefaultClient
+	h := &handler{storage: repo, limits: newRateLimiter(map[string]int{RateLimitFeeds: max}, time.Minute)}
+	feeds := h.RateLimit(RateLimitFeeds)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	get := func(addr string, s httpSigner) int {
+		req, _ := http.NewRequest(http.MethodGet, "https://littr.example/", nil)
+		req.RemoteAddr = addr
+		if err := s.Sign(req); err != nil {
+			t.Fatalf("Unable to sign request: %s", err)
+		}
+		w := httptest.NewRecorder()
+		feeds.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	keyID := srv.URL + "/actors/jdoe#main-key"
+	valid := httpSigner{keyID: keyID, key: key, algorithm: SignatureAlgorithmHS2019}
+	for i := 0; i <= max; i++ {
+		if code := get("192.0.2.1:1234", valid); code != http.StatusOK {
+			t.Fatalf("The requests with a valid hs2019 signature should not be rate limited, received %d", code)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("The verified key should be loaded once, received %d requests", fetches)
+	}
+	invalid := httpSigner{keyID: keyID, key: otherKey, algorithm: SignatureAlgorithmHS2019}
+	get("192.0.2.2:1234", invalid)
+	if code := get("192.0.2.2:1234", invalid); code != http.StatusTooManyRequests {
+		t.Errorf("The requests with an invalid signature should be rate limited, received %d", code)
+	}
+	impostor := httpSigner{keyID: srv.URL + "/actors/impostor#main-key", key: key, algorithm: SignatureAlgorithmHS2019}
+	get("192.0.2.4:1234", impostor)
+	if code := get("192.0.2.4:1234", impostor); code != http.StatusTooManyRequests {
+		t.Errorf("The requests signed with the key of a document claiming another actor should be rate limited, received %d", code)
+	}
+
+	// NOTE(marius): the keys of the signers that aren't on a trusted instance are never loaded
+	repo.peers = newPeers(nil, nil)
+	fetches = 0
+	untrusted := httpSigner{keyID: srv.URL + "/actors/janedoe#main-key", key: key, algorithm: SignatureAlgorithmHS2019}
+	get("192.0.2.5:1234", untrusted)
+	if code := get("192.0.2.5:1234", untrusted); code != http.StatusTooManyRequests || fetches != 0 {
+		t.Errorf("The requests signed by untrusted instances should be rate limited without loading their keys, received %d, %d requests", code, fetches)
+	}
+	repo.peers = newPeers(nil, []string{host(srv.URL)})
+
+	// NOTE(marius): a captured signed request can't be replayed after the clock skew to get around the limits
+	stale := func(addr string) int {
+		req, _ := http.NewRequest(http.MethodGet, "https://littr.example/", nil)
+		req.RemoteAddr = addr
+		req.Header.Set("Date", time.Now().Add(-2*DefaultMaxClockSkew).UTC().Format(http.TimeFormat))
+		s := httpSigner{keyID: keyID, key: key, algorithm: SignatureAlgorithmRSASHA256}
+		if err := s.Sign(req); err != nil {
+			t.Fatalf("Unable to sign request: %s", err)
+		}
+		w := httptest.NewRecorder()
+		feeds.ServeHTTP(w, req)
+		return w.Code
+	}
+	stale("192.0.2.3:1234")
+	if code := stale("192.0.2.3:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("The requests signed with a Date outside the clock skew should be rate limited, received %d", code)
+	}
+
+	// NOTE(marius): the keys are loaded only from public addresses, and the test server is on the loopback one
+	repo.signers = newSignerKeys()
+	fetches = 0
+	get("192.0.2.6:1234", valid)
+	if code := get("192.0.2.6:1234", valid); code != http.StatusTooManyRequests || fetches != 0 {
+		t.Errorf("The keys should not be loaded from internal addresses, received %d, %d requests", code, fetches)
+	}
+}
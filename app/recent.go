@@ -0,0 +1,122 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+)
+
+// suspendedAccounts returns the hashes of the accounts that have been blocked by one of the instance's moderators.
+// The blocks of the regular users are personal, so they don't count.
+func (r *repository) suspendedAccounts(ctx context.Context, accounts ...Account) (Hashes, error) {
+	suspended := make(Hashes, 0)
+	if len(accounts) == 0 {
+		return suspended, nil
+	}
+	f := &Filters{
+		Type:     ActivityTypesFilter(pub.BlockType),
+		Object:   &Filters{IRI: AccountHashFilter(accounts...)},
+		MaxItems: MaxPageSize,
+	}
+	col, err := r.fedbox.Inbox(ctx, r.instanceActor(), Values(f))
+	if err != nil {
+		return suspended, errors.Annotatef(err, "unable to load the blocked accounts")
+	}
+	if col == nil {
+		return suspended, nil
+	}
+	moderators := make(map[pub.IRI]bool)
+	isModerator := func(iri pub.IRI) bool {
+		if mod, ok := moderators[iri]; ok {
+			return mod
+		}
+		mod := false
+		if act, err := r.fedbox.Actor(ctx, iri); err == nil && act != nil {
+			acc := Account{}
+			if err := acc.FromActivityPub(act); err == nil {
+				mod = acc.IsModerator()
+			}
+		}
+		moderators[iri] = mod
+		return mod
+	}
+	for _, it := range col.Collection() {
+		pub.OnActivity(it, func(a *pub.Activity) error {
+			if a.Type != pub.BlockType || a.Actor == nil || a.Object == nil {
+				return nil
+			}
+			h := HashFromIRI(a.Object.GetLink())
+			if !h.IsValid() || suspended.Contains(h) || !isModerator(a.Actor.GetLink()) {
+				return nil
+			}
+			suspended = append(suspended, h)
+			return nil
+		})
+	}
+	return suspended, nil
+}
+
+// LoadRecentAccounts returns a page of at most limit accounts, the most recently created first,
+// leaving out the accounts suspended by the moderators.
+// The after value is the cursor of the page, as returned in the Pagination.
+func (r *repository) LoadRecentAccounts(ctx context.Context, limit int, after string) (AccountCollection, Pagination, error) {
+	f := &Filters{
+		Type:     ActivityTypesFilter(pub.PersonType),
+		MaxItems: limit,
+		Next:     after,
+	}
+	accounts, pages, err := r.LoadAccounts(ctx, f)
+	if err != nil {
+		return accounts, pages, err
+	}
+	suspended, err := r.suspendedAccounts(ctx, accounts...)
+	if err != nil {
+		r.errFn()(err.Error())
+	}
+	recent := make(AccountCollection, 0, len(accounts))
+	for _, acc := range accounts {
+		if acc.Deleted() || suspended.Contains(acc.Hash) {
+			continue
+		}
+		recent = append(recent, acc)
+	}
+	sort.SliceStable(recent, func(i, j int) bool {
+		if !recent[i].CreatedAt.Equal(recent[j].CreatedAt) {
+			return recent[i].CreatedAt.After(recent[j].CreatedAt)
+		}
+		return hashLess(recent[i].Hash, recent[j].Hash)
+	})
+	return recent, pages, nil
+}
+
+// LoadRecentAccountsMw loads the page of the newest accounts in the cursor for the listing
+func LoadRecentAccountsMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := FiltersFromRequest(r)
+		if f == nil {
+			f = new(Filters)
+		}
+		repo := ContextRepository(r.Context())
+		accounts, pages, err := repo.LoadRecentAccounts(r.Context(), f.MaxItems, f.Next)
+		if err != nil {
+			ctxtErr(next, w, r, errors.Annotatef(err, "unable to load the recent accounts"))
+			return
+		}
+		c := &Cursor{
+			items: make(RenderableList),
+			total: uint(len(accounts)),
+			after: HashFromString(pages.NextCursor()),
+			pages: pages,
+		}
+		for k := range accounts {
+			c.items.Append(&accounts[k])
+		}
+		if m := ContextListingModel(r.Context()); m != nil {
+			m.Title = "Newest accounts"
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), CursorCtxtKey, c)))
+	})
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_repository_LoadRecentAccountsExcludesSuspended(t *testing.T) {
+	const (
+		oldHash       = "7a1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01"
+		newHash       = "7a1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c02"
+		suspendedHash = "7a1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c03"
+		modHash       = "7a1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c04"
+	)
+	var srv *httptest.Server
+	person := func(hash, handle, published string) string {
+		return fmt.Sprintf(`{"id":"%s/actors/%s","type":"Person","preferredUsername":"%s","published":"%s"}`, srv.URL, hash, handle, published)
+	}
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/actors":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[%s,%s,%s]}`,
+				person(oldHash, "oldie", "2020-01-01T00:00:00Z"),
+				person(suspendedHash, "spammer", "2021-06-01T00:00:00Z"),
+				person(newHash, "newbie", "2021-05-01T00:00:00Z"),
+			))
+		case "/actors/" + modHash:
+			writeActivityJSON(w, http.StatusOK, person(modHash, "mod", "2019-01-01T00:00:00Z"))
+		case "/inbox":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[{"type":"Block","actor":"%s/actors/%s","object":"%s/actors/%s"}]}`,
+				srv.URL, modHash, srv.URL, suspendedHash))
+		default:
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+		}
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(srv.URL), Type: pub.ServiceType}
+	Instance.Conf.Moderators = []string{"mod"}
+
+	accounts, _, err := r.LoadRecentAccounts(context.Background(), 10, "")
+	if err != nil {
+		t.Fatalf("Unable to load the recent accounts: %s", err)
+	}
+	if len(accounts) != 2 {
+		t.Fatalf("Expected 2 accounts, received %d", len(accounts))
+	}
+	for _, acc := range accounts {
+		if acc.Hash == HashFromString(suspendedHash) {
+			t.Errorf("The suspended account %s should not be listed", acc.Handle)
+		}
+	}
+	if accounts[0].Hash != HashFromString(newHash) || accounts[1].Hash != HashFromString(oldHash) {
+		t.Errorf("Expected the accounts ordered by creation date, newest first, received %s, %s", accounts[0].Handle, accounts[1].Handle)
+	}
+}
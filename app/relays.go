@@ -0,0 +1,166 @@
+package app
+
+import (
+	"context"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// relays holds the IRIs of the relay actors the instance subscribes to.
+// The objects they announce to the service's inbox are shown in the federated feed.
+type relays struct {
+	iri pub.IRIs
+}
+
+func newRelays(list []string) *relays {
+	r := &relays{iri: make(pub.IRIs, 0)}
+	for _, s := range list {
+		if iri := pub.IRI(s); len(iri) > 0 && !r.iri.Contains(iri) {
+			r.iri = append(r.iri, iri)
+		}
+	}
+	return r
+}
+
+// Enabled returns true if the instance subscribes to any relay
+func (r *relays) Enabled() bool {
+	return r != nil && len(r.iri) > 0
+}
+
+// Contains returns true if iri is one of the relays the instance subscribes to
+func (r *relays) Contains(iri pub.IRI) bool {
+	if !r.Enabled() {
+		return false
+	}
+	for _, rel := range r.iri {
+		if rel.Equals(iri, false) {
+			return true
+		}
+	}
+	return false
+}
+
+// Relayed returns true if the activity is an Announce sent by one of the relays
+func (r *relays) Relayed(a *pub.Activity) bool {
+	if a == nil || a.Type != pub.AnnounceType || a.Actor == nil || a.Object == nil {
+		return false
+	}
+	return r.Contains(a.Actor.GetLink())
+}
+
+// relayFollows returns the IRIs of the Follow activities the instance sent to the relays, by the relay's IRI.
+// Following a relay means following the public namespace, with the relay as the recipient.
+func (r *repository) relayFollows(ctx context.Context) (map[pub.IRI]pub.IRI, error) {
+	follows := make(map[pub.IRI]pub.IRI)
+	f := &Filters{
+		Type:     ActivityTypesFilter(pub.FollowType),
+		Object:   &Filters{IRI: CompStrs{EqualsString(pub.PublicNS.String())}},
+		MaxItems: MaxPageSize,
+	}
+	col, err := r.fedbox.Outbox(ctx, r.app.pub, Values(f))
+	if err != nil {
+		return follows, errors.Annotatef(err, "unable to load the relay subscriptions")
+	}
+	if col == nil {
+		return follows, nil
+	}
+	for _, it := range col.Collection() {
+		pub.OnActivity(it, func(a *pub.Activity) error {
+			if a.Type != pub.FollowType || a.Object == nil || !a.Object.GetLink().Equals(pub.PublicNS, true) {
+				return nil
+			}
+			for _, rec := range a.To {
+				if iri := rec.GetLink(); !iri.Equals(pub.PublicNS, true) {
+					follows[iri] = a.GetLink()
+				}
+			}
+			return nil
+		})
+	}
+	return follows, nil
+}
+
+func (r *repository) relayActivity(typ pub.ActivityVocabularyType, relay pub.IRI, ob pub.Item) *pub.Activity {
+	act := new(pub.Activity)
+	act.Type = typ
+	act.Actor = r.app.pub.GetLink()
+	act.Object = ob
+	act.To = pub.ItemCollection{relay}
+	act.BCC = pub.ItemCollection{r.instanceAudience()}
+	return act
+}
+
+// SubscribeRelay sends the Follow of the instance's application actor to the relay, if it didn't follow it already
+func (r *repository) SubscribeRelay(ctx context.Context, relay pub.IRI) error {
+	if r.app == nil || r.app.pub == nil {
+		return errors.NotValidf("the instance doesn't have an application actor to subscribe with")
+	}
+	follows, err := r.relayFollows(ctx)
+	if err != nil {
+		return err
+	}
+	if _, ok := follows[relay]; ok {
+		return nil
+	}
+	r.WithAccount(r.app)
+	if _, _, err = r.fedbox.ToOutbox(ctx, r.relayActivity(pub.FollowType, relay, pub.PublicNS)); err != nil {
+		r.errFn(log.Ctx{"relay": relay})(err.Error())
+		return err
+	}
+	r.infoFn(log.Ctx{"relay": relay})("subscribed to relay")
+	return nil
+}
+
+// UnsubscribeRelay undoes the Follow of the instance to the relay
+func (r *repository) UnsubscribeRelay(ctx context.Context, relay pub.IRI) error {
+	if r.app == nil || r.app.pub == nil {
+		return errors.NotValidf("the instance doesn't have an application actor to unsubscribe with")
+	}
+	follows, err := r.relayFollows(ctx)
+	if err != nil {
+		return err
+	}
+	follow, ok := follows[relay]
+	if !ok {
+		return nil
+	}
+	r.WithAccount(r.app)
+	if _, _, err = r.fedbox.ToOutbox(ctx, r.relayActivity(pub.UndoType, relay, follow)); err != nil {
+		r.errFn(log.Ctx{"relay": relay})(err.Error())
+		return err
+	}
+	r.infoFn(log.Ctx{"relay": relay})("unsubscribed from relay")
+	return nil
+}
+
+// SyncRelays subscribes to the configured relays, and unsubscribes from the ones that aren't configured anymore
+func (r *repository) SyncRelays(ctx context.Context) error {
+	if r.app == nil || r.app.pub == nil {
+		return errors.NotValidf("the instance doesn't have an application actor to subscribe with")
+	}
+	follows, err := r.relayFollows(ctx)
+	if err != nil {
+		return err
+	}
+	for iri := range follows {
+		if !r.relays.Contains(iri) {
+			if err := r.UnsubscribeRelay(ctx, iri); err != nil {
+				return err
+			}
+		}
+	}
+	if !r.relays.Enabled() {
+		return nil
+	}
+	for _, iri := range r.relays.iri {
+		if _, ok := follows[iri]; ok {
+			continue
+		}
+		if err := r.SubscribeRelay(ctx, iri); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_repository_RelayedAnnounceShownOnce(t *testing.T) {
+	const (
+		directHash  = "6a1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01"
+		relayedHash = "6a1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c02"
+		boostedHash = "6a1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c03"
+		relay       = "https://relay.example/actor"
+	)
+	var srv *httptest.Server
+	note := func(hash string) string {
+		return fmt.Sprintf(`{"id":"%s/objects/%s","type":"Note","content":"%s"}`, srv.URL, hash, hash)
+	}
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/inbox":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[
+				{"id":"%s/activities/1","type":"Create","actor":"https://remote.example/users/jdoe","object":%s},
+				{"id":"%s/activities/2","type":"Announce","actor":"%s","object":"%s/objects/%s"},
+				{"id":"%s/activities/3","type":"Announce","actor":"%s","object":"%s/objects/%s"},
+				{"id":"%s/activities/4","type":"Announce","actor":"https://remote.example/users/jdoe","object":"%s/objects/%s"}]}`,
+				srv.URL, note(directHash),
+				srv.URL, relay, srv.URL, directHash,
+				srv.URL, relay, srv.URL, relayedHash,
+				srv.URL, srv.URL, boostedHash))
+		case "/objects":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[%s,%s]}`, note(directHash), note(relayedHash)))
+		default:
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+		}
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(srv.URL), Type: pub.ServiceType}
+	r.relays = newRelays([]string{relay})
+
+	cursor, err := r.LoadActorInbox(context.Background(), r.fedbox.Service(), &Filters{MaxItems: 10})
+	if err != nil {
+		t.Fatalf("Unable to load the inbox: %s", err)
+	}
+	if len(cursor.items) != 2 {
+		t.Fatalf("Expected 2 items in the feed, received %d", len(cursor.items))
+	}
+	if _, ok := cursor.items[HashFromString(directHash)]; !ok {
+		t.Errorf("The item received both directly and from the relay should be in the feed")
+	}
+	if _, ok := cursor.items[HashFromString(relayedHash)]; !ok {
+		t.Errorf("The item announced by the relay should be in the feed")
+	}
+	if _, ok := cursor.items[HashFromString(boostedHash)]; ok {
+		t.Errorf("The item announced by an account that isn't a relay should not be in the feed")
+	}
+}
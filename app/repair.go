@@ -0,0 +1,180 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// ItemRepair is the report of recomputing the score and the counts of an item from the votes and replies in fedbox
+type ItemRepair struct {
+	Hash     Hash `json:"hash"`
+	Cached   int  `json:"cached"`
+	Score    int  `json:"score"`
+	Likes    int  `json:"likes"`
+	Dislikes int  `json:"dislikes"`
+	Replies  int  `json:"replies"`
+}
+
+// Discrepancy returns true if the score we had for the item didn't match the one computed from fedbox
+func (ir ItemRepair) Discrepancy() bool {
+	return ir.Cached != ir.Score
+}
+
+// RepairAllScores recomputes the scores of the items from the votes in fedbox and overwrites the ones they had.
+// It returns a report for every item, with the previous and the current values.
+func (r *repository) RepairAllScores(ctx context.Context, items ItemCollection) ([]ItemRepair, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	votes, err := r.loadVotesOnItems(ctx, items...)
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to load the votes")
+	}
+	replies, err := r.loadItemsReplies(ctx, items...)
+	if err != nil {
+		r.errFn(log.Ctx{"err": err.Error()})("unable to load the replies")
+	}
+	fresh := make(ItemCollection, len(items))
+	for k, it := range items {
+		it.Score = 0
+		it.Flags &^= FlagsBrigaded
+		fresh[k] = it
+	}
+	fresh = scoreItems(fresh, votes, r.voteWeight, r.brigade)
+
+	report := make([]ItemRepair, len(items))
+	for k := range items {
+		it := &items[k]
+		rep := ItemRepair{Hash: it.Hash, Cached: it.Score, Score: fresh[k].Score}
+		for _, v := range votes {
+			if v.Item == nil || !itemsEqual(*v.Item, *it) {
+				continue
+			}
+			if v.IsYay() {
+				rep.Likes++
+			}
+			if v.IsNay() {
+				rep.Dislikes++
+			}
+		}
+		for _, rep2 := range replies {
+			if (rep2.Parent.IsValid() && rep2.Parent.Hash == it.Hash) || (rep2.OP.IsValid() && rep2.OP.Hash == it.Hash) {
+				rep.Replies++
+			}
+		}
+		if rep.Discrepancy() {
+			r.infoFn(log.Ctx{"hash": it.Hash, "cached": rep.Cached, "score": rep.Score})("repaired item score")
+		}
+		it.Score = fresh[k].Score
+		it.Flags = fresh[k].Flags
+		report[k] = rep
+	}
+	return report, nil
+}
+
+// RepairItem recomputes the score of the item from the votes in fedbox and overwrites the one it had
+func (r *repository) RepairItem(ctx context.Context, it *Item) (ItemRepair, error) {
+	if !it.IsValid() {
+		return ItemRepair{}, errors.NotValidf("invalid item")
+	}
+	items := ItemCollection{*it}
+	report, err := r.RepairAllScores(ctx, items)
+	if err != nil || len(report) == 0 {
+		return ItemRepair{}, err
+	}
+	*it = items[0]
+	return report[0], nil
+}
+
+// refreshItem replaces the cached item with it, under all the IRIs it can be loaded by
+func (c *cachedRepository) refreshItem(it Item) {
+	c.invalidateItem(it)
+	for _, iri := range c.itemIRIs(it) {
+		c.c.save(itemCacheKey(iri), it)
+	}
+}
+
+// RepairAllScores recomputes the scores of the items, and replaces the cached items with the repaired ones,
+// so we stop serving the scores that drifted from the votes in fedbox
+func (c *cachedRepository) RepairAllScores(ctx context.Context, items ItemCollection) ([]ItemRepair, error) {
+	report, err := c.Repository.RepairAllScores(ctx, items)
+	if err != nil {
+		return report, err
+	}
+	c.c.removePrefix(votesCachePrefix)
+	for _, it := range items {
+		c.refreshItem(it)
+	}
+	return report, nil
+}
+
+// RepairItem recomputes the score of the item, and replaces the cached item with the repaired one
+func (c *cachedRepository) RepairItem(ctx context.Context, it *Item) (ItemRepair, error) {
+	report, err := c.Repository.RepairItem(ctx, it)
+	if err != nil {
+		return report, err
+	}
+	c.c.removePrefix(votesCachePrefix)
+	c.refreshItem(*it)
+	return report, nil
+}
+
+// RepairCachedScores recomputes the scores of all the cached items from the votes in fedbox
+func (c *cachedRepository) RepairCachedScores(ctx context.Context) ([]ItemRepair, error) {
+	items := make(ItemCollection, 0)
+	seen := make(map[Hash]bool)
+	c.c.each(func(key string, v interface{}) {
+		it, ok := v.(Item)
+		if !ok || !strings.HasPrefix(key, itemsCachePrefix) || seen[it.Hash] {
+			return
+		}
+		seen[it.Hash] = true
+		items = append(items, it)
+	})
+	return c.RepairAllScores(ctx, items)
+}
+
+// RepairScores recomputes the scores of the items in the repository cache, it's what the SIGUSR2 signal runs.
+// Without the cache there's nothing to repair, as the scores are computed every time the items are loaded.
+func (a *Application) RepairScores(ctx context.Context) ([]ItemRepair, error) {
+	if a.front == nil || a.front.cache == nil {
+		return nil, nil
+	}
+	return a.front.cache.RepairCachedScores(ctx)
+}
+
+// HandleRepairItem serves the POST /{year}/{month}/{day}/{hash}/repair requests of the moderators,
+// returning the report of recomputing the item's score.
+func (h *handler) HandleRepairItem(w http.ResponseWriter, r *http.Request) {
+	if !loggedAccount(r).IsModerator() {
+		h.v.HandleErrors(w, r, errors.Forbiddenf("only moderators can repair items"))
+		return
+	}
+	var it *Item
+	if c := ContextCursor(r.Context()); c != nil {
+		it = getItemFromList(HashFromString(chi.URLParam(r, "hash")), c.items)
+	}
+	if !it.IsValid() {
+		h.v.HandleErrors(w, r, errors.NotFoundf("item not found"))
+		return
+	}
+	var repo ItemRepository = h.storage
+	if h.cache != nil {
+		repo = h.cache
+	}
+	report, err := repo.RepairItem(r.Context(), it)
+	if err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	dat, _ := json.Marshal(report)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dat)
+}
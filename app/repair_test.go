@@ -0,0 +1,58 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_repository_RepairItemFixesCorruptedScore(t *testing.T) {
+	const (
+		otherVoterHash = "8b2d3f4e-5c6a-4b7f-9d8e-0f1a2b3c4d01"
+		replyHash      = "8b2d3f4e-5c6a-4b7f-9d8e-0f1a2b3c4d02"
+	)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		obj := srv.URL + "/objects/" + testObjectHash
+		switch r.URL.Path {
+		case "/inbox":
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[`+
+				`{"id":"`+srv.URL+`/activities/`+testLikeHash+`","type":"Like","actor":"`+srv.URL+`/actors/`+testActorHash+`","object":"`+obj+`"},`+
+				`{"id":"`+srv.URL+`/activities/`+otherVoterHash+`","type":"Like","actor":"`+srv.URL+`/actors/`+otherVoterHash+`","object":"`+obj+`"}]}`)
+		case "/objects/" + testObjectHash + "/replies":
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[`+
+				`{"id":"`+srv.URL+`/objects/`+replyHash+`","type":"Note","content":"reply","inReplyTo":["`+obj+`"]}]}`)
+		default:
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+		}
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(srv.URL), Type: pub.ServiceType}
+
+	it := Item{
+		Hash:     HashFromString(testObjectHash),
+		Score:    999,
+		Metadata: &ItemMetadata{ID: srv.URL + "/objects/" + testObjectHash},
+	}
+	report, err := r.RepairItem(context.Background(), &it)
+	if err != nil {
+		t.Fatalf("Unable to repair item: %s", err)
+	}
+	if !report.Discrepancy() || report.Cached != 999 {
+		t.Errorf("Expected the corrupted score to be reported, got %#v", report)
+	}
+	if want := 2 * ScoreMultiplier; it.Score != want || report.Score != want {
+		t.Errorf("Item score %d, report score %d, expected %d", it.Score, report.Score, want)
+	}
+	if report.Likes != 2 || report.Dislikes != 0 {
+		t.Errorf("Invalid vote tallies %d/%d, expected 2/0", report.Likes, report.Dislikes)
+	}
+	if report.Replies != 1 {
+		t.Errorf("Invalid replies count %d, expected 1", report.Replies)
+	}
+}
@@ -0,0 +1,184 @@
+package app
+
+import (
+	"context"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// itemIRI returns the IRI of the item, including the remote ones which don't have a hash we understand
+func itemIRI(it *Item) (pub.IRI, bool) {
+	if it == nil {
+		return "", false
+	}
+	if id, ok := BuildIDFromItem(*it); ok {
+		return id, true
+	}
+	if it.HasMetadata() && len(it.Metadata.ID) > 0 {
+		return pub.IRI(it.Metadata.ID), true
+	}
+	return "", false
+}
+
+// accountIRI returns the IRI of the account, including the remote ones which don't have a hash we understand
+func accountIRI(a *Account) (pub.IRI, bool) {
+	if a.IsValid() {
+		return BuildActorID(*a), true
+	}
+	if a != nil && a.HasMetadata() && len(a.Metadata.ID) > 0 {
+		return pub.IRI(a.Metadata.ID), true
+	}
+	return "", false
+}
+
+// resolveRemoteObject dereferences the object at iri, together with its author
+func (r *repository) resolveRemoteObject(ctx context.Context, iri pub.IRI) (Item, error) {
+	it := Item{}
+	ob, err := r.fedbox.Object(ctx, iri)
+	if err != nil {
+		return it, err
+	}
+	if ob == nil {
+		return it, errors.NotFoundf("object %s not found", iri)
+	}
+	if err = it.FromActivityPub(ob); err != nil {
+		return it, err
+	}
+	if !it.HasMetadata() || len(it.Metadata.ID) == 0 {
+		it.Metadata = &ItemMetadata{ID: iri.String()}
+	}
+	if auth, ok := accountIRI(it.SubmittedBy); ok {
+		// NOTE(marius): we need the author's inbox for delivering the replies to it
+		if act, err := r.fedbox.Actor(ctx, auth); err == nil && act != nil && len(act.ID) > 0 {
+			a := Account{}
+			if err := a.FromActivityPub(act); err == nil {
+				if !a.HasMetadata() || len(a.Metadata.ID) == 0 {
+					a.Metadata = &AccountMetadata{ID: auth.String()}
+				}
+				it.SubmittedBy = &a
+			}
+		}
+	}
+	return it, nil
+}
+
+// ResolveRemoteItem dereferences the object at iri, which we might not have seen before, together with its author,
+// and the items it replies to, up to the MAX_REMOTE_FETCH_DEPTH ancestors. The ones further up the thread are kept
+// as bare IRIs.
+// Every IRI is dereferenced only once, so the reply chains that loop back, on the same host or across hosts,
+// stop at the first item we've already seen.
+func (r *repository) ResolveRemoteItem(ctx context.Context, iri pub.IRI) (Item, error) {
+	it, err := r.resolveRemoteObject(ctx, iri)
+	if err != nil {
+		return it, err
+	}
+	seen := pub.IRIs{iri}
+	cur := &it
+	for depth := 0; depth < r.maxFetchDepth; depth++ {
+		par, ok := itemIRI(cur.Parent)
+		if !ok || seen.Contains(par) {
+			break
+		}
+		seen = append(seen, par)
+		p, err := r.resolveRemoteObject(ctx, par)
+		if err != nil {
+			r.errFn(log.Ctx{"iri": par, "err": err})("unable to resolve the parent of the remote item")
+			break
+		}
+		cur.Parent = &p
+		cur = &p
+	}
+	return it, nil
+}
+
+// SaveReply saves the item as a reply to the object at parent, which can be a remote one we didn't load yet.
+// The parent is dereferenced for its author and the thread it belongs to. When that fails, the reply is still saved,
+// replying to the parent's IRI.
+func (r *repository) SaveReply(ctx context.Context, it Item, parent pub.IRI) (Item, error) {
+	if len(parent) == 0 {
+		return it, errors.NotValidf("missing the object to reply to")
+	}
+	if it.Metadata == nil {
+		it.Metadata = &ItemMetadata{}
+	}
+	par, err := r.ResolveRemoteItem(ctx, parent)
+	if err != nil {
+		r.errFn(log.Ctx{"iri": parent, "err": err})("unable to resolve the object replied to, replying to its IRI")
+		par = Item{Hash: HashFromIRI(parent), Metadata: &ItemMetadata{ID: parent.String()}}
+	}
+	it.Parent = &par
+	if auth, ok := accountIRI(par.SubmittedBy); ok {
+		found := false
+		for _, rec := range it.Metadata.To {
+			if rec.HasMetadata() && pub.IRI(rec.Metadata.ID).Equals(auth, false) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			it.Metadata.To = append(it.Metadata.To, *par.SubmittedBy)
+		}
+	}
+	if par.Private() {
+		it.MakePrivate()
+	}
+	if _, ok := itemIRI(par.OP); ok {
+		it.OP = par.OP
+	} else {
+		it.OP = &par
+	}
+	return r.SaveItem(ctx, it)
+}
+
+// LoadAncestors returns the items the item with the hash replies to, from the first item of its thread to its
+// direct parent, for rendering it in context. At most MAX_REMOTE_FETCH_DEPTH ancestors are loaded, the closest ones.
+// The remote ancestors we might not have seen before are dereferenced together with their authors, the way
+// ResolveRemoteItem does it, and then the authors and the votes of all of them are loaded at once.
+func (r *repository) LoadAncestors(ctx context.Context, hash Hash) (ItemCollection, error) {
+	ancestors := make(ItemCollection, 0)
+	iri := r.ItemIRI(hash.String())
+	ob, err := r.fedbox.Object(ctx, iri)
+	if err != nil {
+		return ancestors, errors.Annotatef(err, "unable to load item %s", hash)
+	}
+	it := Item{}
+	if err = it.FromActivityPub(ob); err != nil {
+		return ancestors, errors.Annotatef(err, "unable to load item %s", hash)
+	}
+	seen := pub.IRIs{iri}
+	cur := &it
+	for len(ancestors) < r.maxFetchDepth {
+		par, ok := itemIRI(cur.Parent)
+		if !ok || seen.Contains(par) {
+			break
+		}
+		seen = append(seen, par)
+		p := Item{}
+		if HostIsLocal(par.String()) {
+			if ob, err = r.fedbox.Object(ctx, par); err == nil {
+				err = p.FromActivityPub(ob)
+			}
+		} else {
+			p, err = r.resolveRemoteObject(ctx, par)
+		}
+		if err != nil {
+			r.errFn(log.Ctx{"iri": par, "err": err})("unable to load the ancestor of the item")
+			break
+		}
+		ancestors = append(ancestors, p)
+		cur = &ancestors[len(ancestors)-1]
+	}
+	// NOTE(marius): the ancestors were loaded from the parent up, we return them from the thread's first item down
+	for i, j := 0, len(ancestors)-1; i < j; i, j = i+1, j-1 {
+		ancestors[i], ancestors[j] = ancestors[j], ancestors[i]
+	}
+	if ancestors, err = r.loadItemsAuthors(ctx, ancestors...); err != nil {
+		r.errFn(log.Ctx{"err": err})("unable to load the authors of the ancestors")
+	}
+	if ancestors, err = r.loadItemsVotes(ctx, ancestors...); err != nil {
+		r.errFn(log.Ctx{"err": err})("unable to load the votes of the ancestors")
+	}
+	return ancestors, nil
+}
@@ -0,0 +1,211 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"golang.org/x/oauth2"
+)
+
+func Test_repository_SaveReplyToUncachedRemoteItem(t *testing.T) {
+	tests := []struct {
+		name      string
+		reachable bool
+	}{
+		{name: "resolved parent", reachable: true},
+		{name: "unreachable parent", reachable: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var srv *httptest.Server
+			var delivered pub.Item
+			srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/outbox") {
+					body, _ := ioutil.ReadAll(r.Body)
+					delivered, _ = pub.UnmarshalJSON(body)
+					w.Header().Set("Location", srv.URL+"/activities/"+testLikeHash)
+					writeActivityJSON(w, http.StatusCreated, string(body))
+					return
+				}
+				if tt.reachable && r.URL.Path == "/notes/1" {
+					writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s/notes/1","type":"Note","content":"hello",
+						"attributedTo":"%s/users/alice","context":"%s/notes/0","inReplyTo":"%s/notes/0"}`,
+						srv.URL, srv.URL, srv.URL, srv.URL))
+					return
+				}
+				if tt.reachable && r.URL.Path == "/users/alice" {
+					writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s/users/alice","type":"Person",
+						"preferredUsername":"alice","inbox":"%s/users/alice/inbox"}`, srv.URL, srv.URL))
+					return
+				}
+				if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/actors") {
+					writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+					return
+				}
+				w.WriteHeader(http.StatusNotFound)
+			}))
+			defer srv.Close()
+
+			r := testRepository(srv)
+			author := testVote(srv, 1).SubmittedBy
+			author.Metadata.OAuth.Token = &oauth2.Token{AccessToken: "t0k3n", TokenType: "Bearer"}
+			r.WithAccount(author)
+
+			parent := pub.IRI(srv.URL + "/notes/1")
+			it := Item{SubmittedBy: author, Data: "a reply", MimeType: "text/html"}
+			if _, err := r.SaveReply(context.Background(), it, parent); err != nil {
+				t.Fatalf("Unable to save the reply: %s", err)
+			}
+			if delivered == nil {
+				t.Fatalf("No activity was sent to the outbox")
+			}
+			pub.OnActivity(delivered, func(a *pub.Activity) error {
+				alice := pub.IRI(srv.URL + "/users/alice")
+				if tt.reachable && !a.To.Contains(alice) {
+					t.Errorf("The reply is not addressed to the parent's author %s: %v", alice, a.To)
+				}
+				return pub.OnObject(a.Object, func(o *pub.Object) error {
+					var inReplyTo pub.ItemCollection
+					if o.InReplyTo != nil {
+						pub.OnCollectionIntf(o.InReplyTo, func(col pub.CollectionInterface) error {
+							inReplyTo = col.Collection()
+							return nil
+						})
+						if inReplyTo == nil {
+							inReplyTo = pub.ItemCollection{o.InReplyTo.GetLink()}
+						}
+					}
+					if !inReplyTo.Contains(parent) {
+						t.Errorf("The reply is not in reply to %s: %v", parent, o.InReplyTo)
+					}
+					if tt.reachable && (o.Context == nil || !o.Context.GetLink().Equals(pub.IRI(srv.URL+"/notes/0"), false)) {
+						t.Errorf("The reply's context is not the thread's first item %s/notes/0: %v", srv.URL, o.Context)
+					}
+					return nil
+				})
+			})
+		})
+	}
+}
+
+func Test_repository_ResolveRemoteItemFetchDepth(t *testing.T) {
+	fetched := make(map[string]int)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched[r.URL.Path]++
+		if strings.HasPrefix(r.URL.Path, "/notes/") {
+			// NOTE(marius): every note replies to the next one, in a 100 items deep thread
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/notes/"))
+			if n >= 100 {
+				writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s/notes/%d","type":"Note"}`, srv.URL, n))
+				return
+			}
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s/notes/%d","type":"Note","inReplyTo":"%s/notes/%d"}`,
+				srv.URL, n, srv.URL, n+1))
+			return
+		}
+		loop := map[string]string{"/loop/a": "b", "/loop/b": "a"}
+		if par, ok := loop[r.URL.Path]; ok {
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s%s","type":"Note","inReplyTo":"%s/loop/%s"}`,
+				srv.URL, r.URL.Path, srv.URL, par))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.maxFetchDepth = 5
+
+	it, err := r.ResolveRemoteItem(context.Background(), pub.IRI(srv.URL+"/notes/1"))
+	if err != nil {
+		t.Fatalf("Unable to resolve the remote item: %s", err)
+	}
+	if len(fetched) != 6 {
+		t.Errorf("Expected the item and its 5 ancestors to be fetched, received %d requests: %v", len(fetched), fetched)
+	}
+	depth := 0
+	for p := it.Parent; p != nil; p = p.Parent {
+		depth++
+		if depth > 6 {
+			break
+		}
+	}
+	if depth != 6 {
+		t.Errorf("Expected 5 resolved ancestors and the IRI of the next one, received %d", depth)
+	}
+
+	fetched = make(map[string]int)
+	r.maxFetchDepth = 50
+	if _, err = r.ResolveRemoteItem(context.Background(), pub.IRI(srv.URL+"/loop/a")); err != nil {
+		t.Fatalf("Unable to resolve the remote item: %s", err)
+	}
+	for path, cnt := range fetched {
+		if cnt > 1 {
+			t.Errorf("The item at %s of the looping thread was fetched %d times", path, cnt)
+		}
+	}
+}
+
+func Test_repository_LoadAncestors(t *testing.T) {
+	var remote *httptest.Server
+	remote = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/notes/0":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s/notes/0","type":"Note","content":"first",
+				"attributedTo":"%s/users/alice"}`, remote.URL, remote.URL))
+		case "/notes/1", "/notes/2":
+			n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/notes/"))
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s/notes/%d","type":"Note","content":"reply",
+				"attributedTo":"%s/users/alice","inReplyTo":"%s/notes/%d"}`, remote.URL, n, remote.URL, remote.URL, n-1))
+		case "/users/alice":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s/users/alice","type":"Person",
+				"preferredUsername":"alice","inbox":"%s/users/alice/inbox"}`, remote.URL, remote.URL))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer remote.Close()
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/objects/"+testObjectHash {
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s/objects/%s","type":"Note","content":"our reply",
+				"inReplyTo":"%s/notes/2"}`, srv.URL, testObjectHash, remote.URL))
+			return
+		}
+		if r.Method == http.MethodGet && (strings.HasSuffix(r.URL.Path, "/actors") || strings.HasSuffix(r.URL.Path, "/inbox")) {
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.maxFetchDepth = 8
+
+	ancestors, err := r.LoadAncestors(context.Background(), HashFromString(testObjectHash))
+	if err != nil {
+		t.Fatalf("Unable to load the ancestors: %s", err)
+	}
+	if len(ancestors) != 3 {
+		t.Fatalf("Expected 3 ancestors, received %d", len(ancestors))
+	}
+	for i, it := range ancestors {
+		want := fmt.Sprintf("%s/notes/%d", remote.URL, i)
+		if !it.HasMetadata() || it.Metadata.ID != want {
+			t.Errorf("Expected the ancestor %d to be %s, received %v", i, want, it.Metadata)
+		}
+		if it.SubmittedBy == nil || it.SubmittedBy.Handle != "alice" {
+			t.Errorf("Expected the author of the ancestor %d to be resolved, received %v", i, it.SubmittedBy)
+		}
+	}
+}
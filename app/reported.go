@@ -0,0 +1,162 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// reportedRefresh is how long we use the hidden items computed from the open reports, before loading them again
+const reportedRefresh = 5 * time.Minute
+
+// reportedItems hides from the public listings the items reported by at least threshold distinct accounts,
+// until a moderator resolves their reports. The hidden items are not deleted.
+// The hidden items are computed from the Flag activities of the open reports, the same ones LoadReports
+// returns to the moderators, we only keep the last result.
+type reportedItems struct {
+	m         sync.RWMutex
+	threshold int
+	loadedAt  time.Time
+	hidden    map[Hash]bool
+}
+
+func newReportedItems(threshold int) *reportedItems {
+	return &reportedItems{
+		threshold: threshold,
+		hidden:    make(map[Hash]bool),
+	}
+}
+
+// Enabled returns true if the items get hidden after a number of reports
+func (r *reportedItems) Enabled() bool {
+	return r != nil && r.threshold > 0
+}
+
+// stale returns true if the hidden items were never computed, or were computed too long ago
+func (r *reportedItems) stale() bool {
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return time.Since(r.loadedAt) > reportedRefresh
+}
+
+// set replaces the hidden items, and returns the ones that weren't hidden before
+func (r *reportedItems) set(hidden map[Hash]bool) Hashes {
+	r.m.Lock()
+	defer r.m.Unlock()
+	added := make(Hashes, 0)
+	for h := range hidden {
+		if !r.hidden[h] {
+			added = append(added, h)
+		}
+	}
+	r.hidden = hidden
+	r.loadedAt = time.Now()
+	return added
+}
+
+// keep uses the hidden items we have for another while, when they can't be computed again
+func (r *reportedItems) keep() {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.loadedAt = time.Now()
+}
+
+// IsHidden returns true if the item is hidden pending the review of its reports
+func (r *reportedItems) IsHidden(it Hash) bool {
+	if !r.Enabled() {
+		return false
+	}
+	r.m.RLock()
+	defer r.m.RUnlock()
+	return r.hidden[it]
+}
+
+// Filter removes from the list the hidden items
+func (r *reportedItems) Filter(list RenderableList) {
+	if !r.Enabled() {
+		return
+	}
+	r.m.RLock()
+	defer r.m.RUnlock()
+	if len(r.hidden) == 0 {
+		return
+	}
+	for k, it := range list {
+		if i, ok := it.(*Item); ok && r.hidden[i.Hash] {
+			delete(list, k)
+		}
+	}
+}
+
+// loadReported computes the hidden items from the open reports: the items reported by at least threshold
+// distinct accounts. The reports of the accounts suspended by the moderators, and of the ones too new
+// to federate, don't count.
+func (r *repository) loadReported(ctx context.Context) error {
+	if !r.reported.Enabled() {
+		return nil
+	}
+	reports, err := r.LoadReports(ctx, ReportsFilter{})
+	if err != nil {
+		return err
+	}
+	reporters := make(map[Hash]AccountCollection)
+	all := make(AccountCollection, 0)
+	for _, g := range reports {
+		it, ok := g.Object.(*Item)
+		if !ok {
+			continue
+		}
+		for _, req := range g.Requests {
+			by := req.SubmittedBy
+			if by == nil || !by.Hash.IsValid() || reporters[it.Hash].Contains(*by) || r.holds.Holds(by) {
+				continue
+			}
+			reporters[it.Hash] = append(reporters[it.Hash], *by)
+			if !all.Contains(*by) {
+				all = append(all, *by)
+			}
+		}
+	}
+	suspended, err := r.suspendedAccounts(ctx, all...)
+	if err != nil {
+		return err
+	}
+	hidden := make(map[Hash]bool)
+	for it, accounts := range reporters {
+		count := 0
+		for _, acc := range accounts {
+			if !suspended.Contains(acc.Hash) {
+				count++
+			}
+		}
+		if count >= r.reported.threshold {
+			hidden[it] = true
+		}
+	}
+	for _, it := range r.reported.set(hidden) {
+		r.infoFn(log.Ctx{"item": it, "reports": r.reported.threshold})("item hidden pending the review of its reports")
+	}
+	return nil
+}
+
+// refreshReported computes the hidden items again, after the reports changed
+func (r *repository) refreshReported(ctx context.Context) {
+	if err := r.loadReported(ctx); err != nil {
+		r.reported.keep()
+		r.errFn()("unable to load the reported items: %s", err)
+	}
+}
+
+// filterReported removes from the loaded listing the items hidden pending the review of their reports,
+// the moderators still see them
+func (r *repository) filterReported(ctx context.Context, acc *Account, list RenderableList) {
+	if !r.reported.Enabled() || acc.IsModerator() {
+		return
+	}
+	if r.reported.stale() {
+		r.refreshReported(ctx)
+	}
+	r.reported.Filter(list)
+}
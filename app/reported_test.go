@@ -0,0 +1,133 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_repository_ReportItemHidesAfterThreshold(t *testing.T) {
+	const (
+		modHash       = "5c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c00"
+		suspendedHash = "5c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c09"
+	)
+	var (
+		srv      *httptest.Server
+		m        sync.Mutex
+		flags    []string
+		resolved bool
+	)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		defer m.Unlock()
+		types := r.URL.Query()["type"]
+		switch {
+		case r.Method == http.MethodPost:
+			body, _ := ioutil.ReadAll(r.Body)
+			it, _ := pub.UnmarshalJSON(body)
+			iri := fmt.Sprintf("%s/activities/5c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3d%02d", srv.URL, len(flags))
+			pub.OnActivity(it, func(a *pub.Activity) error {
+				flags = append(flags, fmt.Sprintf(`{"id":"%s","type":"Flag","actor":"%s","object":"%s/objects/%s","published":"2021-06-01T00:00:00Z"}`,
+					iri, a.Actor.GetLink(), srv.URL, testObjectHash))
+				return nil
+			})
+			w.Header().Set("Location", iri)
+			writeActivityJSON(w, http.StatusCreated, `{"id":"`+iri+`","type":"Flag"}`)
+		case r.URL.Path == "/inbox" && len(types) > 0 && types[0] == string(pub.FlagType):
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[`+strings.Join(flags, ",")+`]}`)
+		case r.URL.Path == "/inbox":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[{"type":"Block","actor":"%s/actors/%s","object":"%s/actors/%s"}]}`,
+				srv.URL, modHash, srv.URL, suspendedHash))
+		case r.URL.Path == "/outbox" && resolved:
+			inReplyTo := make([]string, len(flags))
+			for i := range flags {
+				inReplyTo[i] = fmt.Sprintf(`"%s/activities/5c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3d%02d"`, srv.URL, i)
+			}
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[{"id":"%s/activities/ignore","type":"Ignore","actor":"%s/actors/%s","object":"%s/objects/%s","inReplyTo":[%s]}]}`,
+				srv.URL, srv.URL, modHash, srv.URL, testObjectHash, strings.Join(inReplyTo, ",")))
+		case r.URL.Path == "/objects/"+testObjectHash:
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s/objects/%s","type":"Article","name":"Spam"}`, srv.URL, testObjectHash))
+		case strings.HasPrefix(r.URL.Path, "/actors/"):
+			handle := "reporter"
+			if r.URL.Path == "/actors/"+modHash {
+				handle = "mod"
+			}
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s%s","type":"Person","preferredUsername":"%s"}`, srv.URL, r.URL.Path, handle))
+		default:
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+		}
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(srv.URL), Type: pub.ServiceType}
+	r.reported = newReportedItems(3)
+	Instance.Conf.Moderators = []string{"mod"}
+
+	reporter := func(hash, handle string) Account {
+		return Account{
+			Hash:   HashFromString(hash),
+			Handle: handle,
+			Metadata: &AccountMetadata{
+				ID:        srv.URL + "/actors/" + hash,
+				OutboxIRI: srv.URL + "/actors/" + hash + "/outbox",
+			},
+		}
+	}
+	it := Item{
+		Hash:     HashFromString(testObjectHash),
+		Metadata: &ItemMetadata{ID: srv.URL + "/objects/" + testObjectHash},
+	}
+	listing := func() RenderableList {
+		return RenderableList{it.Hash: &Item{Hash: it.Hash}}
+	}
+	report := func(acc Account) {
+		if err := r.ReportItem(context.Background(), acc, it, nil); err != nil {
+			t.Fatalf("Unable to report the item: %s", err)
+		}
+	}
+
+	first := reporter("5c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01", "first")
+	report(first)
+	report(first)
+	report(reporter(suspendedHash, "suspended"))
+	report(reporter("5c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c02", "second"))
+	if r.reported.IsHidden(it.Hash) {
+		t.Fatalf("The item should be visible before the third distinct report, the repeated and suspended ones don't count")
+	}
+	report(reporter("5c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c03", "third"))
+	if !r.reported.IsHidden(it.Hash) {
+		t.Fatalf("The item should be hidden after the third distinct report")
+	}
+
+	// NOTE(marius): the hidden items are computed from the stored reports, so they survive restarts
+	r.reported = newReportedItems(3)
+	list := listing()
+	r.filterReported(context.Background(), &first, list)
+	if len(list) != 0 {
+		t.Errorf("The hidden item should be absent from the public listings")
+	}
+	mod := reporter(modHash, "mod")
+	list = listing()
+	r.filterReported(context.Background(), &mod, list)
+	if len(list) != 1 {
+		t.Errorf("The hidden item should be present for the moderators")
+	}
+
+	m.Lock()
+	resolved = true
+	m.Unlock()
+	r.refreshReported(context.Background())
+	list = listing()
+	r.filterReported(context.Background(), &first, list)
+	if len(list) != 1 {
+		t.Errorf("The item should be visible again after its reports were resolved")
+	}
+}
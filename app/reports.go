@@ -0,0 +1,309 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi"
+	"github.com/gorilla/csrf"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// ReportAction is the outcome a moderator picks when resolving a report
+type ReportAction string
+
+const (
+	// ReportDismiss closes the report without acting on the reported item or account
+	ReportDismiss = ReportAction("dismiss")
+	// ReportRemove deletes the reported item
+	ReportRemove = ReportAction("remove")
+	// ReportBan suspends the reported account, or the author of the reported item
+	ReportBan = ReportAction("ban")
+)
+
+// reportActionTypes are the activities that record the outcome of a report in the moderation log
+var reportActionTypes = map[ReportAction]pub.ActivityVocabularyType{
+	ReportDismiss: pub.IgnoreType,
+	ReportRemove:  pub.DeleteType,
+	ReportBan:     pub.BlockType,
+}
+
+// ReportsFilter selects the open reports loaded for the moderators
+type ReportsFilter struct {
+	// Anonymize hides the accounts that submitted the reports
+	Anonymize bool
+	// MaxItems is the maximum number of reports loaded, grouping can return fewer entries
+	MaxItems int
+}
+
+// LoadReports returns the reports that weren't resolved by a moderator yet, grouped by the reported item or account.
+// The groups are ordered by their oldest report, so the moderators can work through them as a queue.
+func (r *repository) LoadReports(ctx context.Context, rf ReportsFilter) ([]*ModerationGroup, error) {
+	reports := make([]*ModerationGroup, 0)
+	max := rf.MaxItems
+	if max <= 0 || max > MaxPageSize {
+		max = MaxPageSize
+	}
+	f := &Filters{
+		Type:     ActivityTypesFilter(pub.FlagType),
+		Object:   &Filters{IRI: notNilIRIs},
+		MaxItems: max,
+	}
+	col, err := r.fedbox.Inbox(ctx, r.instanceActor(), Values(f))
+	if err != nil {
+		return reports, errors.Annotatef(err, "unable to load the reports")
+	}
+	if col == nil {
+		return reports, nil
+	}
+
+	loaded := make(map[pub.IRI]pub.Item)
+	load := func(it pub.Item) pub.Item {
+		if it == nil || !it.IsLink() {
+			return it
+		}
+		iri := it.GetLink()
+		if ob, ok := loaded[iri]; ok {
+			return ob
+		}
+		ob, err := r.fedbox.object(ctx, iri)
+		if err != nil {
+			r.errFn(log.Ctx{"iri": iri})(err.Error())
+			ob = iri
+		}
+		loaded[iri] = ob
+		return ob
+	}
+	open := make(RenderableList)
+	for _, it := range col.Collection() {
+		pub.OnActivity(it, func(a *pub.Activity) error {
+			if a.Type != pub.FlagType || a.Actor == nil || a.Object == nil {
+				return nil
+			}
+			a.Actor = load(a.Actor)
+			a.Object = load(a.Object)
+			op := new(ModerationOp)
+			if err := op.FromActivityPub(a); err != nil || op.Object == nil || !op.Hash.IsValid() {
+				return nil
+			}
+			if it, ok := op.Object.(*Item); ok && it.SubmittedBy.HasMetadata() && len(it.SubmittedBy.Metadata.ID) > 0 {
+				author := new(Account)
+				if err := author.FromActivityPub(load(pub.IRI(it.SubmittedBy.Metadata.ID))); err == nil {
+					it.SubmittedBy = author
+				}
+			}
+			open[op.Hash] = op
+			return nil
+		})
+	}
+	if len(open) == 0 {
+		return reports, nil
+	}
+
+	followups, err := r.loadModerationFollowups(ctx, open)
+	if err != nil {
+		return reports, errors.Annotatef(err, "unable to load the resolved reports")
+	}
+	for k, it := range open {
+		flag := it.AP().GetLink()
+		for _, fw := range followups {
+			if fw.Metadata != nil && fw.Metadata.InReplyTo.Contains(flag) {
+				delete(open, k)
+				break
+			}
+		}
+	}
+	if rf.Anonymize {
+		for _, it := range open {
+			if op, ok := it.(*ModerationOp); ok {
+				op.SubmittedBy = &AnonymousAccount
+			}
+		}
+	}
+
+	for _, it := range aggregateModeration(open, nil) {
+		g, ok := it.(*ModerationGroup)
+		if !ok {
+			continue
+		}
+		sort.SliceStable(g.Requests, func(i, j int) bool {
+			if g.Requests[i].SubmittedAt.Equal(g.Requests[j].SubmittedAt) {
+				return g.Requests[i].Hash.String() < g.Requests[j].Hash.String()
+			}
+			return g.Requests[i].SubmittedAt.Before(g.Requests[j].SubmittedAt)
+		})
+		g.Hash = g.Requests[0].Hash
+		g.SubmittedAt = g.Requests[0].SubmittedAt
+		reports = append(reports, g)
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		if reports[i].SubmittedAt.Equal(reports[j].SubmittedAt) {
+			return reports[i].Hash.String() < reports[j].Hash.String()
+		}
+		return reports[i].SubmittedAt.Before(reports[j].SubmittedAt)
+	})
+	return reports, nil
+}
+
+// ResolveReport records the outcome of the open report with the iri IRI, and of the other reports of the same
+// item or account, in the moderation log. The activity recording it replies to the reports, and for the
+// remove and ban actions it is the Delete of the item, or the Block that suspends the account.
+func (r *repository) ResolveReport(ctx context.Context, mod Account, iri pub.IRI, action ReportAction, note string) (*ModerationGroup, error) {
+	if !mod.IsModerator() {
+		return nil, errors.Forbiddenf("only moderators can resolve reports")
+	}
+	typ, ok := reportActionTypes[action]
+	if !ok {
+		return nil, errors.NotValidf("invalid report action %q", action)
+	}
+	reports, err := r.LoadReports(ctx, ReportsFilter{})
+	if err != nil {
+		return nil, err
+	}
+	var report *ModerationGroup
+	for _, g := range reports {
+		for _, req := range g.Requests {
+			if req.AP().GetLink().Equals(iri, false) {
+				report = g
+			}
+		}
+	}
+	if report == nil {
+		return nil, errors.NotFoundf("open report %s", iri)
+	}
+
+	var reason *Item
+	if note = strings.TrimSpace(note); len(note) > 0 {
+		reason = &Item{Data: note, MimeType: MimeTypeText, SubmittedBy: &mod, SubmittedAt: time.Now().UTC()}
+	}
+	var act *pub.Activity
+	switch ob := report.Object.(type) {
+	case *Item:
+		if action == ReportBan {
+			if !ob.SubmittedBy.IsValid() {
+				return nil, errors.NotValidf("the reported item doesn't have an author to ban")
+			}
+			act, err = r.moderationActivityOnAccount(ctx, mod, *ob.SubmittedBy, reason)
+		} else {
+			act, err = r.moderationActivityOnItem(ctx, mod, *ob, reason)
+		}
+	case *Account:
+		if action == ReportRemove {
+			return nil, errors.NotValidf("accounts can't be removed, only banned")
+		}
+		act, err = r.moderationActivityOnAccount(ctx, mod, *ob, reason)
+	default:
+		return nil, errors.NotValidf("invalid reported object")
+	}
+	if err != nil {
+		r.errFn()(err.Error())
+		return nil, err
+	}
+	flags := make(pub.ItemCollection, 0, len(report.Requests))
+	for _, req := range report.Requests {
+		flags = append(flags, req.AP().GetLink())
+	}
+	act.Type = typ
+	act.InReplyTo = flags
+	if _, _, err = r.fedbox.ToOutbox(ctx, act); err != nil {
+		r.errFn()(err.Error())
+		return nil, err
+	}
+	if _, ok := report.Object.(*Item); ok {
+		r.refreshReported(ctx)
+	}
+	r.infoFn(log.Ctx{"report": iri, "action": action, "by": mod.Handle})("resolved report")
+	return report, nil
+}
+
+type reportEntryJSON struct {
+	ID        pub.IRI   `json:"id"`
+	By        string    `json:"by,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Published time.Time `json:"published"`
+}
+
+type reportJSON struct {
+	Hash    Hash              `json:"hash"`
+	Object  pub.IRI           `json:"object"`
+	Type    string            `json:"type"`
+	Title   string            `json:"title,omitempty"`
+	Author  string            `json:"author,omitempty"`
+	Hidden  bool              `json:"hidden,omitempty"`
+	Reports []reportEntryJSON `json:"reports"`
+}
+
+func reportToJSON(g *ModerationGroup, hidden *reportedItems) reportJSON {
+	rep := reportJSON{Hash: g.Hash, Object: g.AP().GetLink(), Reports: make([]reportEntryJSON, 0, len(g.Requests))}
+	switch ob := g.Object.(type) {
+	case *Item:
+		rep.Type = "item"
+		rep.Title = ob.Title
+		rep.Hidden = hidden.IsHidden(ob.Hash)
+		if ob.SubmittedBy != nil {
+			rep.Author = ob.SubmittedBy.Handle
+		}
+	case *Account:
+		rep.Type = "account"
+		rep.Author = ob.Handle
+	}
+	for _, req := range g.Requests {
+		e := reportEntryJSON{ID: req.AP().GetLink(), Reason: req.Data, Published: req.SubmittedAt}
+		if req.SubmittedBy != nil {
+			e.By = req.SubmittedBy.Handle
+		}
+		rep.Reports = append(rep.Reports, e)
+	}
+	return rep
+}
+
+// HandleListReports serves the moderators' GET /moderation/reports requests, with the queue of the open reports
+func (h *handler) HandleListReports(w http.ResponseWriter, r *http.Request) {
+	if !loggedAccount(r).IsModerator() {
+		writeJSONError(w, errors.Forbiddenf("only moderators can list the reports"))
+		return
+	}
+	reports, err := h.storage.LoadReports(r.Context(), ReportsFilter{Anonymize: h.conf.AnonymousReports})
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	result := make([]reportJSON, 0, len(reports))
+	for _, g := range reports {
+		result = append(result, reportToJSON(g, h.storage.reported))
+	}
+	dat, _ := json.Marshal(result)
+	// NOTE(marius): the moderators' clients send the token back with the POST /moderation/reports,
+	// and the POST and DELETE /emojis requests
+	w.Header().Set("X-CSRF-Token", csrf.Token(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dat)
+}
+
+// HandleResolveReport serves the moderators' POST /moderation/reports/{hash} requests, which resolve the report
+// with the action and note form fields
+func (h *handler) HandleResolveReport(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	if !acc.IsModerator() {
+		writeJSONError(w, errors.Forbiddenf("only moderators can resolve reports"))
+		return
+	}
+	iri := activities.IRI(h.storage.fedbox.Service()).AddPath(chi.URLParam(r, "hash"))
+	action := ReportAction(strings.ToLower(r.PostFormValue("action")))
+	g, err := h.storage.ResolveReport(r.Context(), *acc, iri, action, r.PostFormValue("note"))
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	dat, _ := json.Marshal(reportToJSON(g, h.storage.reported))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dat)
+}
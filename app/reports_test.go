@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_repository_ResolveReportRemove(t *testing.T) {
+	const (
+		reporterHash = "6b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01"
+		otherHash    = "6b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c02"
+		authorHash   = "6b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c03"
+		modHash      = "6b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c04"
+		flag1Hash    = "6b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c05"
+		flag2Hash    = "6b1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c06"
+	)
+	var srv *httptest.Server
+	posted := make([]map[string]interface{}, 0)
+	person := func(hash, handle string) string {
+		return fmt.Sprintf(`{"id":"%s/actors/%s","type":"Person","preferredUsername":"%s"}`, srv.URL, hash, handle)
+	}
+	flag := func(hash, reporter, published string) string {
+		return fmt.Sprintf(`{"id":"%s/activities/%s","type":"Flag","actor":"%s/actors/%s","object":"%s/objects/%s","content":"spam","mediaType":"text/plain","published":"%s"}`,
+			srv.URL, hash, srv.URL, reporter, srv.URL, testObjectHash, published)
+	}
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/actors/"+modHash+"/outbox":
+			body, _ := ioutil.ReadAll(r.Body)
+			act := map[string]interface{}{}
+			json.Unmarshal(body, &act)
+			posted = append(posted, act)
+			w.Header().Set("Location", srv.URL+"/activities/delete")
+			writeActivityJSON(w, http.StatusCreated, `{"id":"`+srv.URL+`/activities/delete","type":"Delete"}`)
+		case r.URL.Path == "/inbox":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[%s,%s]}`,
+				flag(flag1Hash, reporterHash, "2021-06-01T00:00:00Z"),
+				flag(flag2Hash, otherHash, "2021-06-02T00:00:00Z"),
+			))
+		case r.URL.Path == "/objects/"+testObjectHash:
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s/objects/%s","type":"Article","name":"Spam","attributedTo":"%s/actors/%s"}`,
+				srv.URL, testObjectHash, srv.URL, authorHash))
+		case r.URL.Path == "/actors/"+reporterHash:
+			writeActivityJSON(w, http.StatusOK, person(reporterHash, "reporter"))
+		case r.URL.Path == "/actors/"+otherHash:
+			writeActivityJSON(w, http.StatusOK, person(otherHash, "other"))
+		case r.URL.Path == "/actors/"+authorHash:
+			writeActivityJSON(w, http.StatusOK, person(authorHash, "spammer"))
+		default:
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+		}
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(srv.URL), Type: pub.ServiceType}
+	Instance.Conf.Moderators = []string{"mod"}
+	mod := Account{
+		Hash:   HashFromString(modHash),
+		Handle: "mod",
+		Metadata: &AccountMetadata{
+			ID:        srv.URL + "/actors/" + modHash,
+			OutboxIRI: srv.URL + "/actors/" + modHash + "/outbox",
+		},
+	}
+
+	reports, err := r.LoadReports(context.Background(), ReportsFilter{})
+	if err != nil {
+		t.Fatalf("Unable to load the reports: %s", err)
+	}
+	if len(reports) != 1 || len(reports[0].Requests) != 2 {
+		t.Fatalf("Expected the two reports of the item to be grouped, received %d groups", len(reports))
+	}
+	if by := reports[0].Requests[0].SubmittedBy; by == nil || by.Handle != "reporter" {
+		t.Errorf("Expected the oldest report first, submitted by reporter, received %v", by)
+	}
+	if it, ok := reports[0].Object.(*Item); !ok || it.SubmittedBy == nil || it.SubmittedBy.Handle != "spammer" {
+		t.Errorf("Expected the reported item with its author resolved, received %v", reports[0].Object)
+	}
+
+	flag2 := pub.IRI(srv.URL + "/activities/" + flag2Hash)
+	if _, err := r.ResolveReport(context.Background(), mod, flag2, ReportRemove, "removed as spam"); err != nil {
+		t.Fatalf("Unable to resolve the report: %s", err)
+	}
+	if len(posted) != 1 {
+		t.Fatalf("Expected one activity posted to the moderator's outbox, received %d", len(posted))
+	}
+	act := posted[0]
+	if act["type"] != string(pub.DeleteType) {
+		t.Errorf("Invalid activity type posted %v, expected %s", act["type"], pub.DeleteType)
+	}
+	if act["object"] != srv.URL+"/objects/"+testObjectHash {
+		t.Errorf("Invalid object of the Delete %v, expected the reported item", act["object"])
+	}
+	inReplyTo, _ := act["inReplyTo"].([]interface{})
+	if len(inReplyTo) != 2 {
+		t.Errorf("Expected the Delete to reply to both reports, received %v", act["inReplyTo"])
+	}
+
+	other := Account{Hash: HashFromString(otherHash), Handle: "other", Metadata: &AccountMetadata{ID: srv.URL + "/actors/" + otherHash}}
+	if _, err := r.ResolveReport(context.Background(), other, flag2, ReportRemove, ""); err == nil {
+		t.Errorf("Only the moderators should be able to resolve reports")
+	}
+	if _, err := r.ResolveReport(context.Background(), mod, flag2, ReportAction("ignore"), ""); err == nil {
+		t.Errorf("Invalid actions should be rejected")
+	}
+}
@@ -1,13 +1,16 @@
 package app
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -15,7 +18,6 @@ import (
 	pub "github.com/go-ap/activitypub"
 	"github.com/go-ap/errors"
 	"github.com/go-ap/handlers"
-	j "github.com/go-ap/jsonld"
 	"github.com/mariusor/go-littr/internal/log"
 	"github.com/mariusor/qstring"
 	"github.com/spacemonkeygo/httpsig"
@@ -29,11 +31,49 @@ var notNilIRI = DifferentThanString("-")
 var notNilIRIs = CompStrs{notNilIRI}
 
 type repository struct {
-	SelfURL string
-	app     *Account
-	fedbox  *fedbox
-	infoFn  CtxLogFn
-	errFn   CtxLogFn
+	SelfURL                 string
+	app                     *Account
+	fedbox                  *fedbox
+	voteWeight              VoteWeightFn
+	brigade                 *BrigadePolicy
+	pageSize                int
+	maxPageSize             int
+	maxRecipients           int
+	nodeInfo                *nodeInfoCache
+	signers                 *signerKeys
+	peers                   *peers
+	mutes                   *threadMutes
+	mimeTypes               []string
+	htmlPolicy              string
+	trustedHTMLPolicy       string
+	trustedMarkdown         string
+	trustedMarkdownKarma    int
+	maxThreadDepth          int
+	threadDepthPolicy       string
+	autoLinkContent         bool
+	languageDetection       bool
+	sensitive               *sensitivePreferences
+	minScores               *minScorePreferences
+	notificationsPageSize   int
+	notificationsWindow     time.Duration
+	followCollections       string
+	requireAltText          bool
+	instanceActorAddressing bool
+	maxFetchDepth           int
+	orderedCollections      bool
+	maxFeaturedTags         int
+	maxTags                 int
+	tagsLimitPolicy         string
+	trust                   *trustLevels
+	holds                   *federationHold
+	deleted                 *tombstones
+	announcements           *announcementStore
+	reported                *reportedItems
+	explore                 *memCache
+	relays                  *relays
+	totp                    *totpStore
+	infoFn                  CtxLogFn
+	errFn                   CtxLogFn
 }
 
 func (r repository) BaseURL() pub.IRI {
@@ -43,14 +83,18 @@ func (r repository) BaseURL() pub.IRI {
 // Repository middleware
 func (h handler) Repository(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		ctx := context.WithValue(r.Context(), RepositoryCtxtKey, h.storage)
+		var repo Repository = h.storage
+		if h.cache != nil {
+			repo = h.cache
+		}
+		ctx := context.WithValue(r.Context(), RepositoryCtxtKey, repo)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 	return http.HandlerFunc(fn)
 }
 
 func ActivityPubService(c appConfig) (*repository, error) {
-	pub.ItemTyperFunc = pub.GetItemByType
+	pub.ItemTyperFunc = itemByType
 
 	infoFn := func(ctx ...log.Ctx) LogFn {
 		return c.Logger.WithContext(append(ctx, log.Ctx{"client": "api"})...).Debugf
@@ -58,12 +102,84 @@ func ActivityPubService(c appConfig) (*repository, error) {
 	errFn := func(ctx ...log.Ctx) LogFn {
 		return c.Logger.WithContext(append(ctx, log.Ctx{"client": "api"})...).Warnf
 	}
-	ua := fmt.Sprintf("%s-%s", c.HostName, Instance.Version)
+	ua := c.UserAgent
+	if len(ua) == 0 {
+		ua = fmt.Sprintf("%s-%s", c.HostName, Instance.Version)
+	}
+	trust := newTrustLevels(c.NewAccountAge, c.TrustMemberAge, c.TrustMemberKarma)
 
 	repo := &repository{
-		SelfURL: c.BaseURL,
-		infoFn:  infoFn,
-		errFn:   errFn,
+		SelfURL:                 c.BaseURL,
+		pageSize:                c.DefaultPageSize,
+		maxPageSize:             c.MaxPageSize,
+		maxRecipients:           c.MaxRecipients,
+		nodeInfo:                newNodeInfoCache(c.NodeInfoTTL),
+		signers:                 newSignerKeys(),
+		peers:                   newPeers(c.BlockedInstances, c.TrustedInstances),
+		mutes:                   newThreadMutes(c.AutoMuteThreshold),
+		mimeTypes:               c.MimeTypes,
+		htmlPolicy:              c.HTMLPolicy,
+		trustedHTMLPolicy:       c.TrustedHTMLPolicy,
+		trustedMarkdown:         c.TrustedMarkdown,
+		trustedMarkdownKarma:    c.TrustedMarkdownKarma,
+		maxThreadDepth:          c.MaxThreadDepth,
+		threadDepthPolicy:       c.ThreadDepthPolicy,
+		autoLinkContent:         c.AutoLinkContent,
+		languageDetection:       c.DetectLanguage,
+		sensitive:               newSensitivePreferences(c.SensitivePolicy),
+		minScores:               newMinScorePreferences(c.MinDisplayScore),
+		notificationsPageSize:   c.NotificationsPageSize,
+		notificationsWindow:     c.NotificationsGroupWindow,
+		followCollections:       c.FollowCollections,
+		requireAltText:          c.RequireAltText,
+		instanceActorAddressing: c.InstanceActorAddressing,
+		maxFetchDepth:           c.MaxRemoteFetchDepth,
+		orderedCollections:      c.OrderedCollections,
+		maxFeaturedTags:         c.MaxFeaturedTags,
+		maxTags:                 c.MaxTags,
+		tagsLimitPolicy:         c.TagsLimitPolicy,
+		trust:                   trust,
+		holds:                   newFederationHold(trust),
+		deleted:                 newTombstones(),
+		reported:                newReportedItems(c.ReportHideThreshold),
+		explore:                 newMemCache(c.ExploreCacheTTL, 0),
+		relays:                  newRelays(c.Relays),
+		infoFn:                  infoFn,
+		errFn:                   errFn,
+	}
+	if len(c.SessionKeys) > 0 {
+		// NOTE(marius): the secrets are encrypted with the same key as the sessions
+		key := c.SessionKeys[len(c.SessionKeys)-1]
+		totpPath := path.Join(c.SessionsPath, "totp", string(c.Env), c.HostName)
+		if st, err := newTOTPStore(totpPath, key); err == nil {
+			repo.totp = st
+		} else {
+			errFn(log.Ctx{"err": err.Error()})("two-factor authentication is disabled")
+		}
+	}
+	if len(c.AnnouncementsPath) > 0 {
+		if st, err := loadAnnouncementsFile(c.AnnouncementsPath); err == nil {
+			repo.announcements = st
+		} else {
+			errFn(log.Ctx{"err": err.Error()})("the announcements are disabled")
+		}
+	}
+	if c.MaxClockSkew > 0 {
+		defaultSignatureVerifier.maxSkew = c.MaxClockSkew
+	}
+	if c.VoteDecayAge > 0 {
+		// NOTE(marius): without a weight function we don't need to load the voters with the votes
+		repo.voteWeight = AccountAgeVoteWeight(c.VoteDecayAge, c.VoteMinWeight)
+	}
+	if c.BrigadeWindow > 0 {
+		repo.brigade = &BrigadePolicy{
+			Window:     c.BrigadeWindow,
+			AccountAge: c.BrigadeAccountAge,
+			Ratio:      c.BrigadeRatio,
+			MinVotes:   c.BrigadeMinVotes,
+			Discount:   c.BrigadeDiscount,
+			LocalHosts: []string{c.HostName, host(c.APIURL)},
+		}
 	}
 	var err error
 	repo.fedbox, err = NewClient(
@@ -71,7 +187,12 @@ func ActivityPubService(c appConfig) (*repository, error) {
 		SetInfoLogger(infoFn),
 		SetErrorLogger(errFn),
 		SetUA(ua),
-		SkipTLSCheck(!c.Env.IsProd()),
+		SetPeerUA(parsePeerUserAgents(c.PeerUserAgents)),
+		SetRootCAs(c.TLSRootCAs),
+		SkipTLSCheck(c.InsecureSkipVerify),
+		LogTraffic(c.DebugFederation),
+		SetSignatureSchemeTTL(c.SignatureSchemeTTL),
+		SetRetries(c.APIMaxAttempts, c.APIRetryBackoff),
 	)
 	if err != nil {
 		return repo, err
@@ -101,6 +222,7 @@ func BuildActorID(a Account) pub.ID {
 }
 
 func loadAPItem(it pub.Item, item Item) error {
+	lang := itemLangRef(item)
 	return pub.OnObject(it, func(o *pub.Object) error {
 		if id, ok := BuildIDFromItem(item); ok {
 			o.ID = id
@@ -108,6 +230,14 @@ func loadAPItem(it pub.Item, item Item) error {
 		if item.MimeType == MimeTypeURL {
 			o.Type = pub.PageType
 			o.URL = pub.IRI(item.Data)
+			if mime := imageURLMimeType(item.Data); len(mime) > 0 {
+				// NOTE(marius): the links to images are published as Image objects, with their description as content
+				o.Type = pub.ImageType
+				o.MediaType = pub.MimeType(mime)
+				if alt := item.Alt(); len(alt) > 0 {
+					o.Content.Set(lang, pub.Content(alt))
+				}
+			}
 		} else {
 			wordCount := strings.Count(item.Data, " ") +
 				strings.Count(item.Data, "\t") +
@@ -128,14 +258,14 @@ func loadAPItem(it pub.Item, item Item) error {
 				o.Source.MediaType = pub.MimeType(item.MimeType)
 				o.MediaType = MimeTypeHTML
 				if item.Data != "" {
-					o.Source.Content.Set("en", pub.Content(item.Data))
-					o.Content.Set("en", pub.Content(Markdown(item.Data)))
+					o.Source.Content.Set(lang, pub.Content(item.Data))
+					o.Content.Set(lang, pub.Content(Markdown(item.Data)))
 				}
 			case MimeTypeText:
 				fallthrough
 			case MimeTypeHTML:
 				o.MediaType = pub.MimeType(item.MimeType)
-				o.Content.Set("en", pub.Content(item.Data))
+				o.Content.Set(lang, pub.Content(item.Data))
 			}
 		}
 
@@ -175,7 +305,7 @@ func loadAPItem(it pub.Item, item Item) error {
 		}
 
 		if item.Title != "" {
-			o.Name.Set("en", pub.Content(item.Title))
+			o.Name.Set(lang, pub.Content(item.Title))
 		}
 		if item.SubmittedBy != nil {
 			o.AttributedTo = BuildActorID(*item.SubmittedBy)
@@ -190,11 +320,11 @@ func loadAPItem(it pub.Item, item Item) error {
 			p := item.Parent
 			first := true
 			for {
-				if par, ok := BuildIDFromItem(*p); ok {
+				if par, ok := itemIRI(p); ok {
 					repl = append(repl, par)
 				}
-				if p.SubmittedBy.IsValid() {
-					if pAuth := BuildActorID(*p.SubmittedBy); !pub.PublicNS.Equals(pAuth, true) {
+				if pAuth, ok := accountIRI(p.SubmittedBy); ok {
+					if !pub.PublicNS.Equals(pAuth, true) {
 						if first {
 							if !to.Contains(pAuth) {
 								to = append(to, pAuth)
@@ -211,10 +341,8 @@ func loadAPItem(it pub.Item, item Item) error {
 				p = p.Parent
 			}
 		}
-		if item.OP != nil {
-			if op, ok := BuildIDFromItem(*item.OP); ok {
-				o.Context = op
-			}
+		if op, ok := itemIRI(item.OP); ok {
+			o.Context = op
 		}
 		if len(repl) > 0 {
 			o.InReplyTo = repl
@@ -239,32 +367,35 @@ func loadAPItem(it pub.Item, item Item) error {
 				}
 			}
 			if m.Mentions != nil || m.Tags != nil {
-				o.Tag = make(pub.ItemCollection, 0)
-				for _, men := range m.Mentions {
-					// todo(marius): retrieve object ids of each mention and add it to the CC of the object
-					t := pub.Mention{
-						Type: pub.MentionType,
-						Name: pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content(men.Name)}},
-						Href: pub.IRI(men.URL),
-					}
-					if men.Metadata != nil && len(men.Metadata.ID) > 0 {
-						t.ID = pub.IRI(men.Metadata.ID)
-					}
-					o.Tag.Append(t)
-				}
-				for _, tag := range m.Tags {
-					t := pub.Object{
-						URL:  pub.ID(tag.URL),
-						To:   pub.ItemCollection{pub.PublicNS},
-						Name: pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content("#" + tag.Name)}},
-					}
-					if tag.Metadata != nil && len(tag.Metadata.ID) > 0 {
-						t.ID = pub.IRI(tag.Metadata.ID)
-					}
-					o.Tag.Append(t)
+				o.Tag = loadAPTags(m.Mentions, m.Tags)
+			}
+			for _, e := range m.Emoji {
+				o.Tag.Append(emojiObject(e))
+			}
+			if len(m.Attachments) > 0 {
+				o.Attachment = loadAPAttachments(m.Attachments, lang)
+			}
+		}
+		if item.Quote.HasMetadata() && len(item.Quote.Metadata.ID) > 0 {
+			q := pub.IRI(item.Quote.Metadata.ID)
+			o.Tag.Append(quoteLink(q))
+			if o.MediaType == MimeTypeHTML {
+				for i := range o.Content {
+					o.Content[i].Value = pub.Content(string(o.Content[i].Value) + quoteFallback(q))
 				}
 			}
 		}
+		if item.Locked() {
+			o.Tag.Append(lockedLink())
+		}
+		if item.Sensitive() {
+			o.Tag.Append(sensitiveLink())
+		}
+		if item.LocalOnly() {
+			to = mergeRecipients(pub.ItemCollection{localAudience()}, localRecipients(to))
+			cc = localRecipients(cc)
+			bcc = localRecipients(bcc)
+		}
 		o.To = to
 		o.CC = cc
 		o.BCC = bcc
@@ -286,6 +417,35 @@ func anonymousPerson(url pub.IRI) *pub.Actor {
 	return p
 }
 
+// loadAPTags returns the Mention and hashtag objects for the mentions and tags of an item, or of an account's bio
+func loadAPTags(mentions, tags TagCollection) pub.ItemCollection {
+	col := make(pub.ItemCollection, 0)
+	for _, men := range mentions {
+		// todo(marius): retrieve object ids of each mention and add it to the CC of the object
+		t := pub.Mention{
+			Type: pub.MentionType,
+			Name: pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content(men.Name)}},
+			Href: pub.IRI(men.URL),
+		}
+		if men.Metadata != nil && len(men.Metadata.ID) > 0 {
+			t.ID = pub.IRI(men.Metadata.ID)
+		}
+		col.Append(t)
+	}
+	for _, tag := range tags {
+		t := pub.Object{
+			URL:  pub.ID(tag.URL),
+			To:   pub.ItemCollection{pub.PublicNS},
+			Name: pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content("#" + tag.Name)}},
+		}
+		if tag.Metadata != nil && len(tag.Metadata.ID) > 0 {
+			t.ID = pub.IRI(tag.Metadata.ID)
+		}
+		col.Append(t)
+	}
+	return col
+}
+
 func (r *repository) loadAPPerson(a Account) *pub.Actor {
 	var p *pub.Actor
 	if act, ok := a.pub.(*pub.Actor); ok {
@@ -299,15 +459,35 @@ func (r *repository) loadAPPerson(a Account) *pub.Actor {
 
 	if a.HasMetadata() {
 		if p.Summary.Count() == 0 && a.Metadata.Blurb != nil && len(a.Metadata.Blurb) > 0 {
+			summary, tags := renderBlurb(a.Metadata.Blurb)
 			p.Summary = pub.NaturalLanguageValuesNew()
-			p.Summary.Set(pub.NilLangRef, a.Metadata.Blurb)
+			p.Summary.Set(pub.NilLangRef, summary)
+			p.Source.MediaType = MimeTypeMarkdown
+			p.Source.Content = pub.NaturalLanguageValuesNew()
+			p.Source.Content.Set(pub.NilLangRef, pub.Content(a.Metadata.Blurb))
+			if len(p.Tag) == 0 && len(tags) > 0 {
+				p.Tag = tags
+			}
+		}
+		img := a.Metadata.Icon
+		if len(img.URI) == 0 {
+			img = accountDefaultAvatar(&a)
 		}
-		if p.Icon == nil && len(a.Metadata.Icon.URI) > 0 {
+		// NOTE(marius): the default avatars with the initials are inline SVG, they don't have a URL we can federate
+		if p.Icon == nil && len(img.URI) > 0 && !(img.MimeType == MimeTypeSVG && !isMediaURL(img.URI)) {
 			avatar := pub.ObjectNew(pub.ImageType)
-			avatar.MediaType = pub.MimeType(a.Metadata.Icon.MimeType)
-			avatar.URL = pub.IRI(a.Metadata.Icon.URI)
+			avatar.MediaType = pub.MimeType(img.MimeType)
+			avatar.URL = pub.IRI(unproxiedURL(img.URI))
 			p.Icon = avatar
 		}
+		if a.Metadata.FeaturedTags != nil {
+			setAPFeaturedTags(p, a)
+		}
+		if a.Metadata.Preferences != nil {
+			if err := setAPPreferences(p, a); err != nil {
+				r.errFn(log.Ctx{"handle": a.Handle, "err": err.Error()})("unable to save the account preferences")
+			}
+		}
 	}
 
 	if p.PreferredUsername.Count() == 0 {
@@ -321,7 +501,7 @@ func (r *repository) loadAPPerson(a Account) *pub.Actor {
 		}
 		if p.Name.Count() == 0 && a.Metadata.Name != "" {
 			p.Name = pub.NaturalLanguageValuesNew()
-			p.Name.Set("en", pub.Content(a.Metadata.Name))
+			p.Name.Set(defaultLangRef(), pub.Content(a.Metadata.Name))
 		}
 		if p.Inbox == nil && len(a.Metadata.InboxIRI) > 0 {
 			p.Inbox = pub.IRI(a.Metadata.InboxIRI)
@@ -332,6 +512,11 @@ func (r *repository) loadAPPerson(a Account) *pub.Actor {
 		if p.Liked == nil && len(a.Metadata.LikedIRI) > 0 {
 			p.Liked = pub.IRI(a.Metadata.LikedIRI)
 		}
+		if a.IsLocal() {
+			// NOTE(marius): we advertise the collections we serve, which apply the FOLLOW_COLLECTIONS_VISIBILITY
+			p.Followers = followCollectionIRI(a, handlers.Followers)
+			p.Following = followCollectionIRI(a, handlers.Following)
+		}
 		if p.Followers == nil && len(a.Metadata.FollowersIRI) > 0 {
 			p.Followers = pub.IRI(a.Metadata.FollowersIRI)
 		}
@@ -373,8 +558,21 @@ func (r *repository) WithAccount(a *Account) *repository {
 	return r
 }
 
+// clampPageSize bounds the number of items the filters request to the configured page sizes
+func (r *repository) clampPageSize(ff ...*Filters) {
+	for _, f := range ff {
+		if f == nil {
+			continue
+		}
+		f.MaxItems = clampPageSize(f.MaxItems, r.pageSize, r.maxPageSize)
+	}
+}
+
 func (r *repository) LoadItem(ctx context.Context, iri pub.IRI) (Item, error) {
 	var item Item
+	if r.deleted.Deleted(iri) {
+		return item, goneError(iri)
+	}
 	art, err := r.fedbox.Object(ctx, iri)
 	if err != nil {
 		r.errFn()(err.Error())
@@ -384,6 +582,10 @@ func (r *repository) LoadItem(ctx context.Context, iri pub.IRI) (Item, error) {
 		var items ItemCollection
 		items, err = r.loadItemsAuthors(ctx, item)
 		items, err = r.loadItemsVotes(ctx, items...)
+		if items, err = r.loadItemsQuotes(ctx, items...); err != nil {
+			r.errFn()(err.Error())
+			err = nil
+		}
 		if len(items) > 0 {
 			item = items[0]
 		}
@@ -449,7 +651,7 @@ func (r *repository) loadAccountsFollowers(ctx context.Context, acc *Account) er
 }
 
 func (r *repository) loadAccountsFollowing(ctx context.Context, acc *Account) error {
-	if !acc.HasMetadata() || len(acc.Metadata.FollowersIRI) == 0 {
+	if !acc.HasMetadata() || len(acc.Metadata.FollowingIRI) == 0 {
 		return nil
 	}
 	collFn := func(ctx context.Context, f *Filters) (pub.CollectionInterface, error) {
@@ -588,6 +790,59 @@ func (r *repository) loadItemsReplies(ctx context.Context, items ...Item) (ItemC
 	return allReplies, nil
 }
 
+// loadItemsRepliesCount sets the number of direct replies of the items using a single query for the objects
+// replying to any of them, instead of loading the replies collection of every item.
+// The items for which fedbox has no replies are left with a zero count.
+func (r *repository) loadItemsRepliesCount(ctx context.Context, items ...Item) (ItemCollection, error) {
+	if len(items) == 0 {
+		return items, nil
+	}
+	f := &Filters{MaxItems: MaxContentItems}
+	for _, it := range items {
+		if it.pub == nil {
+			continue
+		}
+		iri := EqualsString(it.pub.GetLink().String())
+		if !f.InReplTo.Contains(iri) {
+			f.InReplTo = append(f.InReplTo, iri)
+		}
+	}
+	if len(f.InReplTo) == 0 {
+		return items, nil
+	}
+	collFn := func(ctx context.Context, f *Filters) (pub.CollectionInterface, error) {
+		return r.fedbox.Objects(ctx, Values(f))
+	}
+	counts := make(map[pub.IRI]int)
+	err := LoadFromCollection(ctx, collFn, &colCursor{filters: f}, func(c pub.CollectionInterface) (bool, error) {
+		for _, it := range c.Collection() {
+			pub.OnObject(it, func(o *pub.Object) error {
+				if o.InReplyTo == nil {
+					return nil
+				}
+				if repl, ok := o.InReplyTo.(pub.ItemCollection); ok {
+					for _, par := range repl {
+						counts[par.GetLink()]++
+					}
+				} else {
+					counts[o.InReplyTo.GetLink()]++
+				}
+				return nil
+			})
+		}
+		return false, nil
+	})
+	if err != nil {
+		return items, err
+	}
+	for k, it := range items {
+		if it.pub != nil {
+			items[k].ReplyCount = counts[it.pub.GetLink()]
+		}
+	}
+	return items, nil
+}
+
 func (r *repository) loadAccountVotes(ctx context.Context, acc *Account, items ItemCollection) error {
 	if acc == nil || acc.pub == nil {
 		return nil
@@ -615,10 +870,225 @@ func (r *repository) loadAccountVotes(ctx context.Context, acc *Account, items I
 	})
 }
 
+// CurrentAccountVotes loads in one request the votes of the viewer on the items,
+// and returns them indexed by the hash of the item they were cast on
+func (r *repository) CurrentAccountVotes(ctx context.Context, viewer Account, items ...Item) (map[Hash]Vote, error) {
+	result := make(map[Hash]Vote)
+	if !viewer.HasMetadata() || len(viewer.Metadata.ID) == 0 || len(items) == 0 {
+		return result, nil
+	}
+	iris := ItemHashFilter(items...)
+	if len(iris) == 0 {
+		return result, nil
+	}
+	f := &Filters{
+		Type:   AppreciationActivitiesFilter,
+		Actor:  &Filters{IRI: CompStrs{EqualsString(viewer.Metadata.ID)}},
+		Object: &Filters{IRI: iris},
+	}
+	collFn := func(ctx context.Context, f *Filters) (pub.CollectionInterface, error) {
+		return r.fedbox.Inbox(ctx, r.instanceActor(), Values(f))
+	}
+	votes := make(VoteCollection, 0)
+	err := LoadFromCollection(ctx, collFn, &colCursor{filters: f}, func(c pub.CollectionInterface) (bool, error) {
+		for _, it := range c.Collection() {
+			if !it.IsObject() || !ValidAppreciationTypes.Contains(it.GetType()) {
+				continue
+			}
+			v := Vote{}
+			if err := v.FromActivityPub(it); err == nil && v.Item != nil {
+				votes = append(votes, v)
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return result, err
+	}
+	for _, v := range votes.Active() {
+		for _, it := range items {
+			if !itemsEqual(*v.Item, it) {
+				continue
+			}
+			if prev, ok := result[it.Hash]; !ok || v.SubmittedAt.After(prev.SubmittedAt) {
+				result[it.Hash] = v
+			}
+		}
+	}
+	return result, nil
+}
+
+// VotesFilter restricts the votes loaded by LoadVotes
+type VotesFilter struct {
+	// Types can contain pub.LikeType and pub.DislikeType, empty means both
+	Types pub.ActivityVocabularyTypes
+	// After and Before limit the votes to the ones published in the time window, if set
+	After  time.Time
+	Before time.Time
+	// Cursor is the "after" value of the page to load
+	Cursor   string
+	MaxItems int
+}
+
+// VotesPage is a page of the votes cast by an actor
+type VotesPage struct {
+	Votes      VoteCollection
+	Pagination Pagination
+}
+
+// LoadVotes loads a page of the votes cast by the actor.
+// The Undo activities are loaded separately for the votes on the page, so a vote that was undone
+// doesn't show up no matter on which page of the outbox its Undo is.
+// The votes on the page are returned newest first, whatever the order of the outbox.
+func (r *repository) LoadVotes(ctx context.Context, actor pub.Item, vf VotesFilter) (VotesPage, error) {
+	result := VotesPage{Votes: make(VoteCollection, 0)}
+	if actor == nil {
+		return result, errors.NotValidf("invalid actor")
+	}
+	types := make(pub.ActivityVocabularyTypes, 0)
+	for _, typ := range vf.Types {
+		if (typ == pub.LikeType || typ == pub.DislikeType) && !types.Contains(typ) {
+			types = append(types, typ)
+		}
+	}
+	if len(types) == 0 {
+		types = pub.ActivityVocabularyTypes{pub.LikeType, pub.DislikeType}
+	}
+	f := &Filters{Type: ActivityTypesFilter(types...), Next: vf.Cursor, MaxItems: vf.MaxItems}
+	r.clampPageSize(f)
+
+	col, err := r.fedbox.Outbox(ctx, actor, Values(f))
+	if err != nil {
+		return result, err
+	}
+	votes := make(VoteCollection, 0)
+	iris := make(CompStrs, 0)
+	pub.OnCollectionIntf(col, func(c pub.CollectionInterface) error {
+		for _, it := range c.Collection() {
+			if !types.Contains(it.GetType()) {
+				continue
+			}
+			v := Vote{}
+			if err := v.FromActivityPub(it); err != nil || !v.HasMetadata() {
+				continue
+			}
+			// NOTE(marius): the storage filters don't support the published date, so the time window is applied here
+			if !vf.After.IsZero() && !v.SubmittedAt.After(vf.After) {
+				continue
+			}
+			if !vf.Before.IsZero() && !v.SubmittedAt.Before(vf.Before) {
+				continue
+			}
+			votes = append(votes, v)
+			iris = append(iris, EqualsString(v.Metadata.IRI))
+		}
+		return nil
+	})
+	if len(iris) > 0 {
+		undos, err := r.loadVotesUndos(ctx, actor, iris)
+		if err != nil {
+			r.errFn(log.Ctx{"actor": actor.GetLink(), "err": err.Error()})("unable to load the undone votes")
+		}
+		votes = append(votes, undos...)
+	}
+	result.Votes = votes.Active()
+	// NOTE(marius): we don't rely on the order of the outbox, the page of votes is sorted newest first
+	sort.SliceStable(result.Votes, func(i, j int) bool {
+		vi, vj := result.Votes[i], result.Votes[j]
+		if vi.SubmittedAt.Equal(vj.SubmittedAt) {
+			return vi.Metadata.IRI < vj.Metadata.IRI
+		}
+		return vi.SubmittedAt.After(vj.SubmittedAt)
+	})
+	result.Pagination = paginationFromCollection(col)
+	result.Pagination.Count = len(result.Votes)
+	return result, nil
+}
+
+// loadVotesUndos loads the Undo activities of the actor for the votes with the iris
+func (r *repository) loadVotesUndos(ctx context.Context, actor pub.Item, iris CompStrs) (VoteCollection, error) {
+	f := &Filters{
+		Type:     ActivityTypesFilter(pub.UndoType),
+		Object:   &Filters{IRI: iris},
+		MaxItems: len(iris),
+	}
+	collFn := func(ctx context.Context, f *Filters) (pub.CollectionInterface, error) {
+		return r.fedbox.Outbox(ctx, actor, Values(f))
+	}
+	undos := make(VoteCollection, 0)
+	err := LoadFromCollection(ctx, collFn, &colCursor{filters: f}, func(c pub.CollectionInterface) (bool, error) {
+		for _, it := range c.Collection() {
+			if it.GetType() != pub.UndoType {
+				continue
+			}
+			v := Vote{}
+			if err := v.FromActivityPub(it); err == nil && v.HasMetadata() && len(v.Metadata.OriginalIRI) > 0 {
+				undos = append(undos, v)
+			}
+		}
+		return true, nil
+	})
+	return undos, err
+}
+
+// loadItemsQuotes loads in one request the items quoted by the items
+func (r *repository) loadItemsQuotes(ctx context.Context, items ...Item) (ItemCollection, error) {
+	iris := make(CompStrs, 0)
+	for _, it := range items {
+		if it.Quote == nil || !it.Quote.HasMetadata() || len(it.Quote.Metadata.ID) == 0 {
+			continue
+		}
+		if iri := EqualsString(it.Quote.Metadata.ID); !iris.Contains(iri) {
+			iris = append(iris, iri)
+		}
+	}
+	if len(iris) == 0 {
+		return items, nil
+	}
+	col, err := r.fedbox.Objects(ctx, Values(&Filters{IRI: iris, MaxItems: len(iris)}))
+	if err != nil {
+		return items, errors.Annotatef(err, "unable to load quoted items")
+	}
+	quoted := make(ItemCollection, 0)
+	pub.OnCollectionIntf(col, func(c pub.CollectionInterface) error {
+		for _, it := range c.Collection() {
+			q := Item{}
+			if err := q.FromActivityPub(it); err == nil && q.IsValid() {
+				quoted = append(quoted, q)
+			}
+		}
+		return nil
+	})
+	if quoted, err = r.loadItemsAuthors(ctx, quoted...); err != nil {
+		return items, errors.Annotatef(err, "unable to load quoted items authors")
+	}
+	for k, it := range items {
+		if it.Quote == nil || !it.Quote.HasMetadata() {
+			continue
+		}
+		for j := range quoted {
+			if quoted[j].HasMetadata() && quoted[j].Metadata.ID == it.Quote.Metadata.ID {
+				q := quoted[j]
+				items[k].Quote = &q
+			}
+		}
+	}
+	return items, nil
+}
+
 func (r *repository) loadItemsVotes(ctx context.Context, items ...Item) (ItemCollection, error) {
 	if len(items) == 0 {
 		return items, nil
 	}
+	votes, err := r.loadVotesOnItems(ctx, items...)
+	if err != nil {
+		return items, err
+	}
+	return scoreItems(items, votes, r.voteWeight, r.brigade), nil
+}
+
+// loadVotesOnItems loads the active votes on the items, with their authors if we need them for weighting the score
+func (r *repository) loadVotesOnItems(ctx context.Context, items ...Item) (VoteCollection, error) {
 	voteActivities := pub.ActivityVocabularyTypes{pub.LikeType, pub.DislikeType, pub.UndoType}
 	f := &Filters{
 		Object: &Filters{},
@@ -628,25 +1098,95 @@ func (r *repository) loadItemsVotes(ctx context.Context, items ...Item) (ItemCol
 		f.Object.IRI = append(f.Object.IRI, LikeString(it.Hash.String()))
 	}
 	collFn := func(ctx context.Context, f *Filters) (pub.CollectionInterface, error) {
-		return r.fedbox.Inbox(ctx, r.fedbox.Service(), Values(f))
+		return r.fedbox.Inbox(ctx, r.instanceActor(), Values(f))
 	}
+	votes := make(VoteCollection, 0)
 	err := LoadFromCollection(ctx, collFn, &colCursor{filters: f}, func(c pub.CollectionInterface) (bool, error) {
 		for _, vAct := range c.Collection() {
 			if !vAct.IsObject() || !voteActivities.Contains(vAct.GetType()) {
 				continue
 			}
-			v := new(Vote)
-			if err := v.FromActivityPub(vAct); err == nil {
-				for k, ob := range items {
-					if itemsEqual(*v.Item, ob) {
-						items[k].Score += v.Weight
-					}
-				}
+			v := Vote{}
+			if err := v.FromActivityPub(vAct); err == nil && v.Item != nil {
+				votes = append(votes, v)
 			}
 		}
 		return true, nil
 	})
-	return items, err
+	if err != nil {
+		return nil, err
+	}
+	votes = votes.Active()
+	if r.voteWeight != nil || r.brigade != nil {
+		if votes, err = r.loadVotesAuthors(ctx, votes); err != nil {
+			r.errFn(log.Ctx{"err": err.Error()})("unable to load voters, using raw vote weights")
+		}
+	}
+	return votes, nil
+}
+
+// scoreItems adds to the items' score the weight of the votes cast on them, using the weightFn multiplier.
+// If a brigade policy is present, the items that look brigaded get flagged for review
+// and, if the policy requires it, the suspect votes are discounted.
+func scoreItems(items ItemCollection, votes VoteCollection, weightFn VoteWeightFn, bp *BrigadePolicy) ItemCollection {
+	now := time.Now().UTC()
+	for k, ob := range items {
+		itemVotes := make(VoteCollection, 0)
+		for _, v := range votes {
+			if v.Item != nil && itemsEqual(*v.Item, ob) {
+				itemVotes = append(itemVotes, v)
+			}
+		}
+		if bp != nil {
+			if suspect := bp.Detect(itemVotes, now); len(suspect) > 0 {
+				items[k].Flags |= FlagsBrigaded
+				if bp.Discount {
+					itemVotes = itemVotes.Without(suspect)
+				}
+			}
+		}
+		items[k].Score += itemVotes.WeightedScore(weightFn)
+		up, down := itemVotes.Directions()
+		items[k].Upvotes += up
+		items[k].Downvotes += down
+	}
+	return items
+}
+
+// loadVotesAuthors loads the accounts that submitted the votes, as we need their details for the score weighting
+func (r *repository) loadVotesAuthors(ctx context.Context, votes VoteCollection) (VoteCollection, error) {
+	voters := make(AccountCollection, 0)
+	for _, v := range votes {
+		if v.SubmittedBy.IsValid() {
+			voters = append(voters, *v.SubmittedBy)
+		}
+	}
+	if len(voters) == 0 {
+		return votes, nil
+	}
+	fActors := Filters{
+		Type: ActivityTypesFilter(ValidActorTypes...),
+		IRI:  AccountHashFilter(voters...),
+	}
+	if len(fActors.IRI) == 0 {
+		return votes, nil
+	}
+	accounts, err := r.accounts(ctx, &fActors)
+	if err != nil {
+		return votes, errors.Annotatef(err, "unable to load votes authors")
+	}
+	for k, v := range votes {
+		if !v.SubmittedBy.IsValid() {
+			continue
+		}
+		for i := range accounts {
+			if accountsEqual(*v.SubmittedBy, accounts[i]) {
+				votes[k].SubmittedBy = &accounts[i]
+				break
+			}
+		}
+	}
+	return votes, nil
 }
 
 func EqualsString(s string) CompStr {
@@ -773,7 +1313,7 @@ func (r *repository) loadModerationFollowups(ctx context.Context, items Renderab
 	}
 
 	modActions := new(Filters)
-	modActions.Type = ActivityTypesFilter(pub.DeleteType, pub.UpdateType)
+	modActions.Type = ActivityTypesFilter(pub.DeleteType, pub.UpdateType, pub.IgnoreType, pub.BlockType)
 	modActions.InReplTo = IRIsFilter(inReplyTo...)
 	modActions.Actor = &Filters{
 		IRI: notNilIRIs,
@@ -934,6 +1474,9 @@ func (r *repository) loadItemsAuthors(ctx context.Context, items ...Item) (ItemC
 	if err != nil {
 		return items, errors.Annotatef(err, "unable to load items authors")
 	}
+	for a := range authors {
+		r.authorTrustLevel(ctx, &authors[a])
+	}
 	col := make(ItemCollection, 0)
 	for _, it := range items {
 		for a := range authors {
@@ -1055,6 +1598,9 @@ func LoadFromCollection(ctx context.Context, loadColFn CollectionFn, cur *colCur
 		prev, cur.filters.Next = getCollectionPrevNext(col)
 		if processed == 0 {
 			cur.filters.Prev = prev
+			cur.pages = paginationFromCollection(col)
+		} else {
+			cur.pages.followedBy(paginationFromCollection(col))
 		}
 		processed += len(col.Collection())
 		st := accumContinue
@@ -1167,10 +1713,14 @@ func (r *repository) objects(ctx context.Context, ff ...*Filters) (ItemCollectio
 }
 
 func (r *repository) Objects(ctx context.Context, ff ...*Filters) (Cursor, error) {
+	r.clampPageSize(ff...)
 	items, err := r.objects(ctx, ff...)
 	if err != nil {
 		return emptyCursor, err
 	}
+	if items, err = r.loadItemsQuotes(ctx, items...); err != nil {
+		r.errFn()(err.Error())
+	}
 	result := make(RenderableList, 0)
 	for _, it := range items {
 		if it.Hash.IsValid() {
@@ -1215,6 +1765,24 @@ func validFederated(i Item, f *Filters) bool {
 	return ob != nil && ob.Generator == nil
 }
 
+// validThreadLevel checks the item against the inReplyTo object filter, for the cases where fedbox doesn't apply it:
+// the nil IRI keeps only the top level items, and the not nil one keeps only the replies.
+func validThreadLevel(i Item, f *Filters) bool {
+	if f == nil || f.Object == nil {
+		return true
+	}
+	isReply := i.Parent.IsValid()
+	for _, repl := range f.Object.InReplTo {
+		if repl == nilIRI && isReply {
+			return false
+		}
+		if repl == notNilIRI && !isReply {
+			return false
+		}
+	}
+	return true
+}
+
 func validRecipients(i Item, f *Filters) bool {
 	if len(f.Recipients) > 0 {
 		for _, r := range f.Recipients {
@@ -1233,6 +1801,12 @@ func validItem(it Item, f *Filters) bool {
 	if keep := validFederated(it, f); !keep {
 		return keep
 	}
+	if keep := validThreadLevel(it, f); !keep {
+		return keep
+	}
+	if keep := validLanguage(it, f); !keep {
+		return keep
+	}
 	return true
 }
 
@@ -1264,12 +1838,15 @@ func IRIsFilter(iris ...pub.IRI) CompStrs {
 //  With the resulting Object IRIs we load from the objects collection with our matching filters
 //  With the resulting Actor IRIs we load from the accounts collection with matching filters
 func (r *repository) ActorCollection(ctx context.Context, fn CollectionFn, ff ...*Filters) (Cursor, error) {
+	r.clampPageSize(ff...)
 	items := make(ItemCollection, 0)
 	follows := make(FollowRequests, 0)
 	accounts := make(AccountCollection, 0)
 	moderations := make(ModerationRequests, 0)
 	appreciations := make(VoteCollection, 0)
 	relations := make(map[pub.IRI]pub.IRI)
+	remoteReplies := make([]*pub.Activity, 0)
+	remoteDeletes := make([]*pub.Activity, 0)
 	relM := new(sync.RWMutex)
 
 	deferredItems := make(CompStrs, 0)
@@ -1293,23 +1870,31 @@ func (r *repository) ActorCollection(ctx context.Context, fn CollectionFn, ff ..
 	}
 	result := make(RenderableList, 0)
 	resM := new(sync.RWMutex)
+	cursors := make([]*colCursor, len(ff))
 	// TODO(marius): see how we can use the context returned by errgroup.WithContext()
 	g, _ := errgroup.WithContext(ctx)
 	for j := range ff {
 		f := ff[j]
+		cur := &colCursor{filters: f}
+		cursors[j] = cur
 		g.Go(func() error {
-			err := LoadFromCollection(ctx, fn, &colCursor{filters: f}, func(col pub.CollectionInterface) (bool, error) {
+			err := LoadFromCollection(ctx, fn, cur, func(col pub.CollectionInterface) (bool, error) {
 				for _, it := range col.Collection() {
 					pub.OnActivity(it, func(a *pub.Activity) error {
 						relM.Lock()
 						defer relM.Unlock()
 
+						r.peers.RecordActivity(a)
+
 						typ := it.GetType()
 						if typ == pub.CreateType {
 							ob := a.Object
 							if ob == nil {
 								return nil
 							}
+							if isRemoteReply(a) {
+								remoteReplies = append(remoteReplies, a)
+							}
 							if ob.IsObject() {
 								if ValidContentTypes.Contains(ob.GetType()) {
 									i := Item{}
@@ -1330,6 +1915,24 @@ func (r *repository) ActorCollection(ctx context.Context, fn CollectionFn, ff ..
 							}
 							relations[a.GetLink()] = ob.GetLink()
 						}
+						if r.relays.Relayed(a) || (typ == pub.AnnounceType && showShares(ctx)) {
+							// NOTE(marius): the objects announced by the relays, or shared by the followed accounts,
+							// can arrive directly too, so we load them only once
+							ob := a.Object
+							if ob.IsObject() {
+								i := Item{}
+								i.FromActivityPub(ob)
+								if validItem(i, f) && !items.Contains(i) {
+									items = append(items, i)
+								}
+							} else if iri := EqualsString(ob.GetLink().String()); !deferredItems.Contains(iri) {
+								deferredItems = append(deferredItems, iri)
+							}
+							relations[a.GetLink()] = ob.GetLink()
+						}
+						if typ == pub.DeleteType && a.Actor != nil && !HostIsLocal(a.Actor.GetLink().String()) {
+							remoteDeletes = append(remoteDeletes, a)
+						}
 						if it.GetType() == pub.FollowType {
 							f := FollowRequest{}
 							f.FromActivityPub(a)
@@ -1368,7 +1971,7 @@ func (r *repository) ActorCollection(ctx context.Context, fn CollectionFn, ff ..
 				ff.IRI = deferredItems
 				objects, _ := r.objects(ctx, ff)
 				for _, d := range objects {
-					if !d.IsValid() {
+					if !d.IsValid() || !validThreadLevel(d, f) || !validLanguage(d, f) {
 						continue
 					}
 					if !items.Contains(d) {
@@ -1398,6 +2001,10 @@ func (r *repository) ActorCollection(ctx context.Context, fn CollectionFn, ff ..
 	if err := g.Wait(); err != nil {
 		return emptyCursor, err
 	}
+	for _, iri := range r.lockedReplies(ctx, remoteReplies...) {
+		delete(relations, iri)
+	}
+	r.processDeletes(ctx, remoteDeletes...)
 	var err error
 	items, err = r.loadItemsAuthors(ctx, items...)
 	if err != nil {
@@ -1407,10 +2014,16 @@ func (r *repository) ActorCollection(ctx context.Context, fn CollectionFn, ff ..
 	if err != nil {
 		return emptyCursor, err
 	}
+	if items, err = r.loadItemsQuotes(ctx, items...); err != nil {
+		r.errFn()(err.Error())
+	}
 	_, err = r.loadItemsReplies(ctx, items...)
 	if err != nil {
 		return emptyCursor, err
 	}
+	if items, err = r.loadItemsRepliesCount(ctx, items...); err != nil {
+		r.errFn()(err.Error())
+	}
 	follows, err = r.loadFollowsAuthors(ctx, follows...)
 	if err != nil {
 		return emptyCursor, err
@@ -1470,12 +2083,19 @@ func (r *repository) ActorCollection(ctx context.Context, fn CollectionFn, ff ..
 			prev = HashFromString(f.Prev)
 		}
 	}
+	var pages Pagination
+	for _, cur := range cursors {
+		if pages.Count == 0 {
+			pages = cur.pages
+		}
+	}
 
 	return Cursor{
 		after:  next,
 		before: prev,
 		items:  result,
 		total:  uint(len(result)),
+		pages:  pages,
 	}, nil
 }
 
@@ -1516,24 +2136,45 @@ func (r *repository) SaveVote(ctx context.Context, v Vote) (Vote, error) {
 	act := &pub.Activity{
 		Type:  pub.UndoType,
 		To:    pub.ItemCollection{pub.PublicNS},
-		BCC:   pub.ItemCollection{r.fedbox.Service().ID},
+		BCC:   pub.ItemCollection{r.instanceAudience()},
 		Actor: author.GetLink(),
 	}
+	held := r.holds.Holds(v.SubmittedBy)
+	heldTo := act.To
+	if held {
+		// NOTE(marius): the votes of the accounts younger than the minimum federation age stay on the instance
+		act.To = pub.ItemCollection{localAudience()}
+	}
 
 	if exists.HasMetadata() {
 		act.Object = pub.IRI(exists.Metadata.IRI)
 		if _, _, err := r.fedbox.ToOutbox(ctx, act); err != nil {
 			r.errFn()(err.Error())
+			// NOTE(marius): we don't post the new vote, as it would leave two active votes for the same item
+			return v, errors.Annotatef(err, "unable to undo previous vote")
+		}
+		if err := r.forgetHeld(ctx, v.SubmittedBy, act.Object.GetLink()); err != nil {
+			r.errFn(log.Ctx{"account": v.SubmittedBy.Handle, "err": err.Error()})("unable to forget the held vote")
 		}
 	}
 
+	newVote := false
 	if v.Weight > 0 && exists.Weight <= 0 {
-		act.Type = pub.LikeType
+		act = &pub.Activity{Type: pub.LikeType, To: act.To, BCC: act.BCC, Actor: act.Actor}
 		act.Object = o.GetLink()
+		newVote = true
 	}
 	if v.Weight < 0 && exists.Weight >= 0 {
-		act.Type = pub.DislikeType
+		act = &pub.Activity{Type: pub.DislikeType, To: act.To, BCC: act.BCC, Actor: act.Actor}
 		act.Object = o.GetLink()
+		newVote = true
+	}
+	if !newVote {
+		if !exists.HasMetadata() {
+			return v, nil
+		}
+		// NOTE(marius): the previous vote was only retracted
+		return v, v.FromActivityPub(act)
 	}
 
 	var (
@@ -1545,14 +2186,46 @@ func (r *repository) SaveVote(ctx context.Context, v Vote) (Vote, error) {
 		r.errFn()(err.Error())
 		return v, err
 	}
-	r.infoFn(log.Ctx{"act": iri, "obj": it.GetLink(), "type": it.GetType()})("saved activity")
-	err = v.FromActivityPub(act)
+	saved := voteFromResponse(act, iri, it)
+	r.infoFn(log.Ctx{"act": iri, "obj": saved.GetLink(), "type": saved.GetType()})("saved activity")
+	if held {
+		h := HeldActivity{IRI: saved.GetLink(), Type: act.Type, Object: act.Object.GetLink(), To: heldRecipients(heldTo)}
+		if err := r.holdFederation(ctx, v.SubmittedBy, h); err != nil {
+			r.errFn(log.Ctx{"account": v.SubmittedBy.Handle, "err": err.Error()})("unable to save the held vote")
+		}
+	}
+	err = v.FromActivityPub(saved)
 	return v, err
 }
 
+// voteFromResponse returns the vote activity as stored by the server.
+// The response can be the stored activity itself, or an Accept having it as an object,
+// otherwise we fall back to the posted activity, with the IRI received in the Location header.
+func voteFromResponse(act *pub.Activity, iri pub.IRI, it pub.Item) pub.Item {
+	if it != nil && it.IsObject() && it.GetType() == pub.AcceptType {
+		pub.OnActivity(it, func(accept *pub.Activity) error {
+			it = accept.Object
+			return nil
+		})
+	}
+	if it != nil && len(it.GetLink()) > 0 {
+		if it.IsObject() && ValidAppreciationTypes.Contains(it.GetType()) {
+			return it
+		}
+		if it.IsLink() {
+			iri = it.GetLink()
+		}
+	}
+	if len(iri) > 0 {
+		act.ID = iri
+	}
+	return act
+}
+
 func (r *repository) loadVotesCollection(ctx context.Context, iri pub.IRI, actors ...pub.IRI) ([]Vote, error) {
 	cntActors := len(actors)
 	f := &Filters{}
+	r.clampPageSize(f)
 	if cntActors > 0 {
 		f.AttrTo = make(CompStrs, cntActors)
 		for i, a := range actors {
@@ -1584,22 +2257,66 @@ type _errors struct {
 	Errors []errors.Http `jsonld:"errors"`
 }
 
-func (r *repository) handlerErrorResponse(body []byte) error {
-	errs := _errors{}
-	if err := j.Unmarshal(body, &errs); err != nil {
-		r.errFn()("Unable to unmarshal error response: %s", err.Error())
-		return nil
+func (r *repository) handlerErrorResponse(status int, body []byte) error {
+	err := errorFromResponse(status, body)
+	r.errFn(log.Ctx{"status": status})("Error response: %s", err)
+	return err
+}
+
+// bareIRIFromBody checks if the response body is just a JSON string containing an IRI
+func bareIRIFromBody(body []byte) (pub.IRI, bool) {
+	var s string
+	if err := json.Unmarshal(bytes.TrimSpace(body), &s); err != nil || len(s) == 0 {
+		return "", false
 	}
-	if len(errs.Errors) == 0 {
-		return nil
+	if u, err := url.ParseRequestURI(s); err != nil || len(u.Host) == 0 {
+		return "", false
+	}
+	return pub.IRI(s), true
+}
+
+// hydrateSavedItem makes sure we have the full object after saving it, as fedbox can respond with just
+// the IRI of the created object, or with an activity that references the object only by its IRI.
+func (r *repository) hydrateSavedItem(ctx context.Context, loc pub.IRI, ob pub.Item) (pub.Item, error) {
+	if ob == nil || (ob.IsLink() && len(ob.GetLink()) == 0) {
+		if len(loc) == 0 {
+			return ob, errors.Newf("empty response for saved item")
+		}
+		ob = loc
+	}
+	var err error
+	if ob.IsLink() {
+		if ob, err = r.fedbox.object(ctx, ob.GetLink()); err != nil {
+			return ob, errors.Annotatef(err, "unable to load saved item")
+		}
 	}
-	err := errs.Errors[0]
-	return errors.WrapWithStatus(err.Code, nil, err.Message)
+	if ob == nil || !(pub.ActivityVocabularyTypes{pub.CreateType, pub.UpdateType}).Contains(ob.GetType()) {
+		return ob, nil
+	}
+	err = pub.OnActivity(ob, func(act *pub.Activity) error {
+		if act.Object == nil || !act.Object.IsLink() {
+			return nil
+		}
+		full, err := r.fedbox.object(ctx, act.Object.GetLink())
+		if err != nil {
+			return errors.Annotatef(err, "unable to load saved item")
+		}
+		act.Object = full
+		return nil
+	})
+	return ob, err
 }
 
 func (r *repository) handleItemSaveSuccessResponse(ctx context.Context, it Item, body []byte) (Item, error) {
-	ap, err := pub.UnmarshalJSON(body)
-	if err != nil {
+	var ap pub.Item
+	var err error
+	if iri, ok := bareIRIFromBody(body); ok {
+		ap = iri
+	} else if ap, err = pub.UnmarshalJSON(body); err != nil {
+		r.errFn()(err.Error())
+		return it, err
+	}
+	if ap, err = r.hydrateSavedItem(ctx, "", ap); err != nil {
 		r.errFn()(err.Error())
 		return it, err
 	}
@@ -1761,6 +2478,41 @@ func (r *repository) SaveItem(ctx context.Context, it Item) (Item, error) {
 	if !accountValidForC2S(it.SubmittedBy) {
 		return it, errors.Unauthorizedf("invalid account %s", it.SubmittedBy.Handle)
 	}
+	if it.SubmittedBy.IsLogged() {
+		if _, err := r.LoadTrustLevel(ctx, it.SubmittedBy); err != nil {
+			r.errFn(log.Ctx{"account": it.SubmittedBy.Handle, "err": err})("unable to load the account's trust level")
+		}
+	}
+	if !it.Deleted() {
+		if err := validMimeType(r.mimeTypes, it.MimeType); err != nil {
+			return it, err
+		}
+		if err := r.checkAltText(it); err != nil {
+			return it, err
+		}
+		policy := r.htmlPolicy
+		if it.SubmittedBy.IsModerator() || isTrustedAuthor(r.trustedMarkdown, r.trustedMarkdownKarma, it.SubmittedBy) {
+			policy = r.trustedHTMLPolicy
+		}
+		if err := applyHTMLPolicy(policy, &it); err != nil {
+			return it, err
+		}
+		if err := r.limitThreadDepth(ctx, &it); err != nil {
+			return it, err
+		}
+		if err := r.checkLocked(ctx, it); err != nil {
+			return it, err
+		}
+		if r.autoLinkContent {
+			autoLinkTags(&it)
+		}
+		if err := r.limitTags(&it); err != nil {
+			return it, err
+		}
+		if r.languageDetection {
+			detectItemLanguage(&it)
+		}
+	}
 
 	to := make(pub.ItemCollection, 0)
 	cc := make(pub.ItemCollection, 0)
@@ -1791,12 +2543,43 @@ func (r *repository) SaveItem(ctx context.Context, it Item) (Item, error) {
 		if it.Parent == nil && it.SubmittedBy.HasMetadata() && len(it.SubmittedBy.Metadata.FollowersIRI) > 0 {
 			cc = append(cc, pub.IRI(it.SubmittedBy.Metadata.FollowersIRI))
 		}
-		bcc = append(bcc, r.fedbox.Service().ID)
+		bcc = append(bcc, r.instanceAudience())
 	}
-
 	art := new(pub.Object)
 	loadAPItem(art, it)
 	id := art.GetLink()
+	if len(id) > 0 {
+		origTo, origCC := r.originalAudience(ctx, id)
+		to = mergeRecipients(to, origTo, art.To)
+		cc = mergeRecipients(cc, origCC, art.CC)
+	}
+	if it.LocalOnly() {
+		// NOTE(marius): local only items are addressed to the instance's service actor and the local accounts,
+		// so fedbox doesn't have anyone to deliver them to outside the instance
+		to = mergeRecipients(pub.ItemCollection{localAudience()}, localRecipients(to))
+		cc = localRecipients(cc)
+		bcc = localRecipients(bcc)
+	}
+	personal := r.untrustedRecipients(personalRecipients(it))
+	var skipped int
+	if to, cc, skipped = capRecipients(to, cc, personal, r.maxRecipients); skipped > 0 {
+		r.infoFn(log.Ctx{
+			"item":       it.Hash,
+			"recipients": skipped,
+			"max":        r.maxRecipients,
+		})("too many recipients, addressing only the shared inboxes")
+	}
+	held := !it.LocalOnly() && r.holds.Holds(it.SubmittedBy)
+	var heldTo, heldCC pub.ItemCollection
+	if held {
+		// NOTE(marius): the items of the accounts younger than the minimum federation age are addressed
+		// like the local only ones, we keep their full audience for when the account is old enough
+		heldTo, heldCC = to, cc
+		to = mergeRecipients(pub.ItemCollection{localAudience()}, localRecipients(to))
+		cc = localRecipients(cc)
+		bcc = localRecipients(bcc)
+		art.To, art.CC = localRecipients(art.To), localRecipients(art.CC)
+	}
 
 	act := &pub.Activity{
 		To:     to,
@@ -1832,12 +2615,32 @@ func (r *repository) SaveItem(ctx context.Context, it Item) (Item, error) {
 		r.errFn()(err.Error())
 		return it, err
 	}
+	if loadAuthors {
+		if ob, err = r.hydrateSavedItem(ctx, i, ob); err != nil {
+			r.errFn()(err.Error())
+			return it, err
+		}
+	}
+	if ob == nil {
+		ob = act
+	}
 	r.infoFn(log.Ctx{"act": i, "obj": ob.GetLink(), "type": ob.GetType()})("saved activity")
 	err = it.FromActivityPub(ob)
 	if err != nil {
 		r.errFn()(err.Error())
 		return it, err
 	}
+	if act.Type == pub.CreateType && it.Parent == nil && it.SubmittedBy.IsValid() {
+		r.mutes.RecordThread(it.SubmittedBy.Hash, it.Hash)
+	}
+	if held {
+		if id, ok := BuildIDFromItem(it); ok && act.Type == pub.CreateType {
+			h := HeldActivity{IRI: id, Type: act.Type, To: heldRecipients(heldTo), CC: heldRecipients(heldCC)}
+			if err := r.holdFederation(ctx, it.SubmittedBy, h); err != nil {
+				r.errFn(log.Ctx{"account": it.SubmittedBy.Handle, "err": err.Error()})("unable to save the held item")
+			}
+		}
+	}
 	if loadAuthors {
 		items, err := r.loadItemsAuthors(ctx, it)
 		return items[0], err
@@ -1845,6 +2648,33 @@ func (r *repository) SaveItem(ctx context.Context, it Item) (Item, error) {
 	return it, err
 }
 
+// SaveItems saves the items one after the other, for importers and bots that submit them in bulk.
+// It returns, for every item, the saved version and the error encountered, a failure doesn't stop the batch.
+// Items with the same valid hash are saved only once, the repeated ones receive the result of the first.
+func (r *repository) SaveItems(ctx context.Context, items []Item) ([]Item, []error) {
+	saved := make([]Item, len(items))
+	errs := make([]error, len(items))
+	seen := make(map[Hash]int)
+	for k, it := range items {
+		if err := ctx.Err(); err != nil {
+			saved[k], errs[k] = it, errors.Annotatef(err, "batch save interrupted")
+			continue
+		}
+		if it.Hash.IsValid() {
+			if prev, ok := seen[it.Hash]; ok {
+				saved[k], errs[k] = saved[prev], errs[prev]
+				continue
+			}
+			seen[it.Hash] = k
+		}
+		saved[k], errs[k] = r.SaveItem(ctx, it)
+		if errs[k] != nil {
+			r.errFn(log.Ctx{"index": k, "item": it.Hash, "err": errs[k]})("unable to save item in batch")
+		}
+	}
+	return saved, errs
+}
+
 func (r *repository) LoadTags(ctx context.Context, ff ...*Filters) (TagCollection, uint, error) {
 	tags := make(TagCollection, 0)
 	var count uint = 0
@@ -1877,20 +2707,25 @@ func (r *repository) LoadTags(ctx context.Context, ff ...*Filters) (TagCollectio
 	return tags, count, nil
 }
 
-func (r *repository) LoadAccounts(ctx context.Context, ff ...*Filters) (AccountCollection, uint, error) {
-	accounts := make(AccountCollection, 0)
-	var count uint = 0
+func (r *repository) LoadAccounts(ctx context.Context, ff ...*Filters) (AccountCollection, Pagination, error) {
+	r.clampPageSize(ff...)
+	// NOTE(marius): every filter is loaded in its own goroutine, which writes only its own results,
+	// and we merge them after all of them finished
+	results := make([]AccountCollection, len(ff))
+	pagination := make([]Pagination, len(ff))
 	// TODO(marius): see how we can use the context returned by errgroup.WithContext()
 	g, _ := errgroup.WithContext(ctx)
-	for _, f := range ff {
+	for i, f := range ff {
+		i, f := i, f
 		g.Go(func() error {
 			it, err := r.fedbox.Actors(ctx, Values(f))
 			if err != nil {
 				r.errFn()(err.Error())
 				return err
 			}
+			pagination[i] = paginationFromCollection(it)
 			return pub.OnOrderedCollection(it, func(col *pub.OrderedCollection) error {
-				count = col.TotalItems
+				accounts := make(AccountCollection, 0)
 				for _, it := range col.OrderedItems {
 					acc := Account{Metadata: &AccountMetadata{}}
 					if err := acc.FromActivityPub(it); err != nil {
@@ -1899,15 +2734,19 @@ func (r *repository) LoadAccounts(ctx context.Context, ff ...*Filters) (AccountC
 					}
 					accounts = append(accounts, acc)
 				}
-				accounts, err = r.loadAccountsVotes(ctx, accounts...)
+				results[i], err = r.loadAccountsVotes(ctx, accounts...)
 				return err
 			})
 		})
 	}
-	if err := g.Wait(); err != nil {
-		return accounts, count, err
+	err := g.Wait()
+	accounts := make(AccountCollection, 0)
+	pages := Pagination{}
+	for i := range ff {
+		accounts = append(accounts, results[i]...)
+		pages = pagination[i]
 	}
-	return accounts, count, nil
+	return accounts, pages, err
 }
 
 func (r *repository) LoadAccountDetails(ctx context.Context, acc *Account) error {
@@ -1999,7 +2838,7 @@ func (r *repository) SendFollowResponse(ctx context.Context, f FollowRequest, ac
 	bcc := make(pub.ItemCollection, 0)
 
 	to = append(to, pub.IRI(er.Metadata.ID))
-	bcc = append(bcc, r.fedbox.Service().ID)
+	bcc = append(bcc, r.instanceAudience())
 
 	response := new(pub.Activity)
 	if reason != nil {
@@ -2033,13 +2872,22 @@ func (r *repository) FollowAccount(ctx context.Context, er, ed Account, reason *
 	if !accountValidForC2S(&er) {
 		return errors.Unauthorizedf("invalid account %s", er.Handle)
 	}
+	if ed.Hash.IsValid() && accountInCollection(ed, er.Following) {
+		return nil
+	}
+	if fol, err := r.existingActivity(ctx, er, ed, pub.FollowType); err != nil {
+		r.errFn(log.Ctx{"err": err, "follower": er.Handle})("Unable to load the existing follows")
+	} else if fol != nil {
+		r.infoFn(log.Ctx{"follower": er.Handle, "followed": ed.Handle, "follow": fol.GetLink()})("Follow already sent")
+		return nil
+	}
 
 	to := make(pub.ItemCollection, 0)
 	bcc := make(pub.ItemCollection, 0)
 
 	//to = append(to, follower.GetLink())
 	to = append(to, pub.PublicNS)
-	bcc = append(bcc, r.fedbox.Service().ID)
+	bcc = append(bcc, r.instanceAudience())
 
 	follow := new(pub.Follow)
 	if reason != nil {
@@ -2063,6 +2911,11 @@ func (r *repository) FollowAccount(ctx context.Context, er, ed Account, reason *
 }
 
 func (r *repository) SaveAccount(ctx context.Context, a Account) (Account, error) {
+	if !a.Deleted() {
+		if err := NewValidationError(validateProfile(a)...); err != nil {
+			return a, err
+		}
+	}
 	p := r.loadAPPerson(a)
 	id := p.GetLink()
 
@@ -2076,7 +2929,7 @@ func (r *repository) SaveAccount(ctx context.Context, a Account) (Account, error
 	fx := r.fedbox.Service()
 	act := &pub.Activity{
 		To:      pub.ItemCollection{pub.PublicNS},
-		BCC:     pub.ItemCollection{fx.ID},
+		BCC:     pub.ItemCollection{r.instanceAudience()},
 		Updated: now,
 	}
 
@@ -2102,7 +2955,9 @@ func (r *repository) SaveAccount(ctx context.Context, a Account) (Account, error
 	} else {
 		act.Object = p
 		p.To = pub.ItemCollection{pub.PublicNS}
-		p.BCC = pub.ItemCollection{fx.ID}
+		if !r.instanceActorAddressing {
+			p.BCC = pub.ItemCollection{fx.ID}
+		}
 		if len(id) == 0 {
 			act.Type = pub.CreateType
 		} else {
@@ -2172,6 +3027,114 @@ func (r *repository) LoadActorOutbox(ctx context.Context, actor pub.Item, f ...*
 	return &cursor, nil
 }
 
+// OutboxEntry is one of the activities in an account's outbox: a submission, a vote or a share
+type OutboxEntry struct {
+	Type      pub.ActivityVocabularyType
+	IRI       pub.IRI
+	Published time.Time
+	// Item is the submitted item, or the one that was voted on or shared
+	Item *Item
+	Vote *Vote
+	pub  pub.Item
+}
+
+// AP returns the underlying activitypub activity
+func (o OutboxEntry) AP() pub.Item {
+	return o.pub
+}
+
+// AccountOutbox is a page of entries from an account's outbox, newest first
+type AccountOutbox struct {
+	Entries    []OutboxEntry
+	Pagination Pagination
+}
+
+var outboxEntryTypes = pub.ActivityVocabularyTypes{pub.CreateType, pub.LikeType, pub.DislikeType, pub.AnnounceType}
+
+// LoadAccountOutbox loads a page of the account's outbox, starting after the cursor, if not empty.
+// The objects the activities reference by IRI are loaded in one batch.
+func (r *repository) LoadAccountOutbox(ctx context.Context, a Account, cursor string) (AccountOutbox, error) {
+	result := AccountOutbox{Entries: make([]OutboxEntry, 0)}
+	if !a.HasMetadata() || len(a.Metadata.ID) == 0 {
+		return result, errors.NotValidf("invalid account")
+	}
+	f := &Filters{Type: ActivityTypesFilter(outboxEntryTypes...), Next: cursor}
+	r.clampPageSize(f)
+
+	col, err := r.fedbox.Outbox(ctx, pub.IRI(a.Metadata.ID), Values(f))
+	if err != nil {
+		r.errFn(log.Ctx{"account": a.Handle})(err.Error())
+		return result, err
+	}
+	deferred := make(CompStrs, 0)
+	err = pub.OnCollectionIntf(col, func(c pub.CollectionInterface) error {
+		for _, it := range c.Collection() {
+			if !outboxEntryTypes.Contains(it.GetType()) {
+				continue
+			}
+			pub.OnActivity(it, func(act *pub.Activity) error {
+				e := OutboxEntry{Type: act.Type, IRI: act.GetLink(), Published: act.Published, pub: act}
+				switch act.Type {
+				case pub.CreateType:
+					i := new(Item)
+					if err := i.FromActivityPub(act); err != nil {
+						return nil
+					}
+					e.Item = i
+				case pub.LikeType, pub.DislikeType:
+					v := new(Vote)
+					if err := v.FromActivityPub(act); err != nil {
+						return nil
+					}
+					e.Vote = v
+					e.Item = v.Item
+				case pub.AnnounceType:
+					i := new(Item)
+					i.FromActivityPub(act.Object)
+					e.Item = i
+				}
+				if act.Object != nil && act.Object.IsLink() {
+					deferred = append(deferred, EqualsString(act.Object.GetLink().String()))
+				}
+				result.Entries = append(result.Entries, e)
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	if len(deferred) > 0 {
+		objects, err := r.objects(ctx, &Filters{IRI: deferred, MaxItems: len(deferred)})
+		if err != nil {
+			r.errFn(log.Ctx{"account": a.Handle})("unable to load outbox objects: %s", err)
+		}
+		for i, e := range result.Entries {
+			if e.Item == nil || !e.Item.HasMetadata() {
+				continue
+			}
+			for j, ob := range objects {
+				if ob.HasMetadata() && ob.Metadata.ID == e.Item.Metadata.ID {
+					result.Entries[i].Item = &objects[j]
+					if e.Vote != nil {
+						e.Vote.Item = &objects[j]
+					}
+				}
+			}
+		}
+	}
+	sort.SliceStable(result.Entries, func(i, j int) bool {
+		if !result.Entries[i].Published.Equal(result.Entries[j].Published) {
+			return result.Entries[i].Published.After(result.Entries[j].Published)
+		}
+		return result.Entries[i].IRI < result.Entries[j].IRI
+	})
+	result.Pagination = paginationFromCollection(col)
+	result.Pagination.Count = len(result.Entries)
+	return result, nil
+}
+
 func (r *repository) LoadActivities(ctx context.Context, ff ...*Filters) (*Cursor, error) {
 	collFn := func(ctx context.Context, f *Filters) (pub.CollectionInterface, error) {
 		return r.fedbox.Activities(ctx, Values(f))
@@ -2183,6 +3146,57 @@ func (r *repository) LoadActivities(ctx context.Context, ff ...*Filters) (*Curso
 	return &cursor, nil
 }
 
+// ActivityDetails is an activity loaded by its IRI, converted to the local type matching it,
+// together with the raw JSON received from fedbox, so moderators can inspect it
+type ActivityDetails struct {
+	Type  pub.ActivityVocabularyType
+	Actor *Account
+	Item  Renderable
+	Raw   json.RawMessage
+	pub   pub.Item
+}
+
+// AP returns the underlying activitypub activity
+func (a ActivityDetails) AP() pub.Item {
+	return a.pub
+}
+
+// LoadActivity loads any type of activity from its IRI, and resolves its actor and object
+func (r *repository) LoadActivity(ctx context.Context, iri pub.IRI) (*ActivityDetails, error) {
+	it, raw, err := r.fedbox.loadRaw(ctx, r.fedbox.normaliseIRI(iri))
+	if err != nil {
+		r.errFn(log.Ctx{"iri": iri})(err.Error())
+		return nil, errors.Annotatef(err, "Unable to load Activity: %s", iri)
+	}
+	if it == nil || !pub.ActivityTypes.Contains(it.GetType()) {
+		return nil, errors.NotValidf("%s is not an activity", iri)
+	}
+	d := ActivityDetails{Type: it.GetType(), Raw: raw, pub: it}
+	err = pub.OnActivity(it, func(act *pub.Activity) error {
+		if act.Actor != nil && act.Actor.IsLink() {
+			actor, err := r.fedbox.Actor(ctx, act.Actor.GetLink())
+			if err != nil {
+				return errors.Annotatef(err, "Unable to load actor of the activity")
+			}
+			act.Actor = actor
+		}
+		if act.Object != nil && act.Object.IsLink() {
+			ob, err := r.fedbox.object(ctx, act.Object.GetLink())
+			if err != nil {
+				return errors.Annotatef(err, "Unable to load object of the activity")
+			}
+			act.Object = ob
+		}
+		d.Actor = &Account{Metadata: &AccountMetadata{}}
+		return d.Actor.FromActivityPub(act.Actor)
+	})
+	if err != nil {
+		return &d, err
+	}
+	d.Item, err = LoadFromActivityPubItem(it)
+	return &d, err
+}
+
 func (r *repository) LoadActorInbox(ctx context.Context, actor pub.Item, f ...*Filters) (*Cursor, error) {
 	if actor == nil {
 		return nil, errors.Errorf("Invalid actor")
@@ -2199,7 +3213,7 @@ func (r *repository) LoadActorInbox(ctx context.Context, actor pub.Item, f ...*F
 
 func (r repository) moderationActivity(ctx context.Context, er *pub.Actor, ed pub.Item, reason *Item) (*pub.Activity, error) {
 	bcc := make(pub.ItemCollection, 0)
-	bcc = append(bcc, r.fedbox.Service().ID, r.app.pub.GetLink())
+	bcc = mergeRecipients(bcc, pub.ItemCollection{r.instanceAudience(), r.app.pub.GetLink()})
 
 	// We need to add the ed/er accounts' creators to the CC list
 	cc := make(pub.ItemCollection, 0)
@@ -2250,6 +3264,15 @@ func (r repository) moderationActivityOnAccount(ctx context.Context, er, ed Acco
 }
 
 func (r *repository) BlockAccount(ctx context.Context, er, ed Account, reason *Item) error {
+	if ed.Hash.IsValid() && accountInCollection(ed, er.Blocked) {
+		return nil
+	}
+	if b, err := r.existingActivity(ctx, er, ed, pub.BlockType); err != nil {
+		r.errFn(log.Ctx{"err": err, "blocker": er.Handle})("Unable to load the existing blocks")
+	} else if b != nil {
+		r.infoFn(log.Ctx{"blocker": er.Handle, "blocked": ed.Handle, "block": b.GetLink()})("Block already sent")
+		return nil
+	}
 	block, err := r.moderationActivityOnAccount(ctx, er, ed, reason)
 	if err != nil {
 		r.errFn()(err.Error())
@@ -2288,6 +3311,7 @@ func (r *repository) ReportItem(ctx context.Context, er Account, it Item, reason
 		r.errFn()(err.Error())
 		return err
 	}
+	r.refreshReported(ctx)
 	return nil
 }
 
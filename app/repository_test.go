@@ -0,0 +1,980 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/client"
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/config"
+	"github.com/mariusor/go-littr/internal/log"
+	"golang.org/x/oauth2"
+)
+
+const (
+	testActorHash  = "a3a1e1f0-11c2-4d4f-8e6a-0b3c2d1e0f01"
+	testObjectHash = "6435b2b5-26df-434c-87ca-58ddab49fcc8"
+	testLikeHash   = "2f7c3a5e-41b1-4a2e-9b0d-7d1e9c0a6b11"
+)
+
+func testRepository(srv *httptest.Server) *repository {
+	Instance.Conf = &config.Configuration{HostName: "littr.example", APIURL: srv.URL}
+	return &repository{
+		fedbox: &fedbox{
+			baseURL: pub.IRI(srv.URL),
+			client:  client.New(),
+			infoFn:  defaultCtxLogFn,
+			errFn:   defaultCtxLogFn,
+		},
+		infoFn: defaultCtxLogFn,
+		errFn:  defaultCtxLogFn,
+	}
+}
+
+func testVote(srv *httptest.Server, weight int) Vote {
+	return Vote{
+		SubmittedBy: &Account{
+			Hash:     HashFromString(testActorHash),
+			Handle:   "johndoe",
+			Metadata: &AccountMetadata{ID: srv.URL + "/actors/" + testActorHash},
+		},
+		Item: &Item{
+			Hash:     HashFromString(testObjectHash),
+			Metadata: &ItemMetadata{ID: srv.URL + "/objects/" + testObjectHash},
+		},
+		Weight: weight,
+	}
+}
+
+func writeActivityJSON(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/activity+json")
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
+
+func Test_voteFromResponse(t *testing.T) {
+	likeIRI := pub.IRI("https://fedbox.example/activities/" + testLikeHash)
+	stored := &pub.Activity{ID: likeIRI, Type: pub.LikeType}
+	tests := []struct {
+		name string
+		iri  pub.IRI
+		it   pub.Item
+		want pub.IRI
+	}{
+		{
+			name: "stored like",
+			it:   stored,
+			want: likeIRI,
+		},
+		{
+			name: "accept of stored like",
+			it:   &pub.Activity{ID: "https://fedbox.example/activities/accept", Type: pub.AcceptType, Object: stored},
+			want: likeIRI,
+		},
+		{
+			name: "accept of like IRI",
+			it:   &pub.Activity{ID: "https://fedbox.example/activities/accept", Type: pub.AcceptType, Object: likeIRI},
+			want: likeIRI,
+		},
+		{
+			name: "location header only",
+			iri:  likeIRI,
+			want: likeIRI,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			act := &pub.Activity{Type: pub.LikeType}
+			got := voteFromResponse(act, tt.iri, tt.it)
+			if got.GetLink() != tt.want {
+				t.Errorf("voteFromResponse() IRI = %s, want %s", got.GetLink(), tt.want)
+			}
+		})
+	}
+}
+
+func Test_repository_SaveVoteStoresLikeIRI(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/likes") {
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+			return
+		}
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/outbox") {
+			body, _ := ioutil.ReadAll(r.Body)
+			posted := map[string]interface{}{}
+			json.Unmarshal(body, &posted)
+			if posted["type"] != string(pub.LikeType) {
+				t.Errorf("Invalid activity type posted %v, expected %s", posted["type"], pub.LikeType)
+			}
+			likeIRI := srv.URL + "/activities/" + testLikeHash
+			w.Header().Set("Location", likeIRI)
+			writeActivityJSON(w, http.StatusCreated, `{"id":"`+likeIRI+`","type":"Like","actor":"`+srv.URL+"/actors/"+testActorHash+`","object":"`+srv.URL+"/objects/"+testObjectHash+`"}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	v, err := r.SaveVote(context.Background(), testVote(srv, 1))
+	if err != nil {
+		t.Fatalf("Unable to save vote: %s", err)
+	}
+	want := srv.URL + "/activities/" + testLikeHash
+	if !v.HasMetadata() || v.Metadata.IRI != want {
+		t.Errorf("Invalid vote IRI %v, expected %s", v.Metadata, want)
+	}
+	if v.Weight != 1 {
+		t.Errorf("Invalid vote weight %d, expected %d", v.Weight, 1)
+	}
+}
+
+func Test_repository_SaveVoteFailedUndo(t *testing.T) {
+	var srv *httptest.Server
+	posted := make([]string, 0)
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/likes") {
+			// NOTE(marius): an existing Dislike from the same actor, that needs to be undone before the Like
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[{"id":"`+srv.URL+"/activities/"+testLikeHash+`","type":"Dislike","actor":"`+srv.URL+"/actors/"+testActorHash+`","object":"`+srv.URL+"/objects/"+testObjectHash+`"}]}`)
+			return
+		}
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/outbox") {
+			body, _ := ioutil.ReadAll(r.Body)
+			act := map[string]interface{}{}
+			json.Unmarshal(body, &act)
+			typ, _ := act["type"].(string)
+			posted = append(posted, typ)
+			writeActivityJSON(w, http.StatusInternalServerError, `{"errors":[{"message":"unable to save activity"}]}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	if _, err := r.SaveVote(context.Background(), testVote(srv, 1)); err == nil {
+		t.Errorf("SaveVote should have failed when the undo failed")
+	}
+	if len(posted) != 1 || posted[0] != string(pub.UndoType) {
+		t.Errorf("Only the Undo activity should have been posted, received %v", posted)
+	}
+}
+
+func Test_repository_handleItemSaveSuccessResponseBareIRI(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/objects/"+testObjectHash) {
+			writeActivityJSON(w, http.StatusOK, `{"id":"`+srv.URL+"/objects/"+testObjectHash+`","type":"Article","name":"Test title","content":"Test content","mediaType":"text/html"}`)
+			return
+		}
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/actors") {
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	body := []byte(`"` + srv.URL + "/objects/" + testObjectHash + `"`)
+	it, err := r.handleItemSaveSuccessResponse(context.Background(), Item{}, body)
+	if err != nil {
+		t.Fatalf("Unable to handle response: %s", err)
+	}
+	if it.Hash != HashFromString(testObjectHash) {
+		t.Errorf("Invalid item hash %s, expected %s", it.Hash, testObjectHash)
+	}
+	if it.Title != "Test title" {
+		t.Errorf("Invalid item title %q, the object should have been loaded from its IRI", it.Title)
+	}
+}
+
+func Test_bareIRIFromBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want pub.IRI
+		ok   bool
+	}{
+		{
+			name: "bare IRI",
+			body: ` "https://fedbox.example/objects/1"` + "\n",
+			want: "https://fedbox.example/objects/1",
+			ok:   true,
+		},
+		{
+			name: "object",
+			body: `{"id":"https://fedbox.example/objects/1","type":"Note"}`,
+		},
+		{
+			name: "not an IRI",
+			body: `"lorem ipsum"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := bareIRIFromBody([]byte(tt.body))
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("bareIRIFromBody() = %s, %t, want %s, %t", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func Test_repository_handlerErrorResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantStatus int
+		wantMsg    string
+	}{
+		{
+			name:       "error envelope",
+			status:     http.StatusBadRequest,
+			body:       `{"@context":"https://www.w3.org/ns/activitystreams","errors":[{"status":404,"message":"not found"}]}`,
+			wantStatus: http.StatusNotFound,
+			wantMsg:    "not found",
+		},
+		{
+			name:       "plain text",
+			status:     http.StatusInternalServerError,
+			body:       "Internal Server Error\n",
+			wantStatus: http.StatusInternalServerError,
+			wantMsg:    "Internal Server Error",
+		},
+		{
+			name:       "malformed JSON",
+			status:     http.StatusBadGateway,
+			body:       `{"errors":[{"status":`,
+			wantStatus: http.StatusBadGateway,
+			wantMsg:    `{"errors":[{"status":`,
+		},
+		{
+			name:       "empty body",
+			status:     http.StatusServiceUnavailable,
+			wantStatus: http.StatusServiceUnavailable,
+			wantMsg:    http.StatusText(http.StatusServiceUnavailable),
+		},
+	}
+	r := &repository{infoFn: defaultCtxLogFn, errFn: defaultCtxLogFn}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := r.handlerErrorResponse(tt.status, []byte(tt.body))
+			if err == nil {
+				t.Fatalf("handlerErrorResponse() returned nil error")
+			}
+			if st := httpErrorResponse(err); st != tt.wantStatus {
+				t.Errorf("Invalid error status %d, expected %d", st, tt.wantStatus)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("Invalid error message %q, expected it to contain %q", err.Error(), tt.wantMsg)
+			}
+		})
+	}
+}
+
+func Test_repository_ObjectsPropagatesStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("fedbox is down for maintenance"))
+	}))
+	defer srv.Close()
+
+	repo := testRepository(srv)
+	_, err := repo.Objects(context.Background(), &Filters{})
+	if err == nil {
+		t.Fatalf("Objects() returned nil error for a %d response", http.StatusServiceUnavailable)
+	}
+	if st := httpErrorResponse(err); st != http.StatusServiceUnavailable {
+		t.Errorf("Invalid error status %d, expected %d", st, http.StatusServiceUnavailable)
+	}
+	if !strings.Contains(err.Error(), "fedbox is down for maintenance") {
+		t.Errorf("Invalid error message %q, expected it to contain the response body", err.Error())
+	}
+}
+
+func Test_repository_LoadActivity(t *testing.T) {
+	const (
+		createHash = "0e4c1f3a-7b2d-4c8e-a1f9-3d5b7e9c2a44"
+		likeHash   = testLikeHash
+	)
+	var srvURL string
+	bodies := map[string]func() string{
+		"/actors/" + testActorHash: func() string {
+			return `{"id":"` + srvURL + `/actors/` + testActorHash + `","type":"Person","preferredUsername":"johndoe"}`
+		},
+		"/objects/" + testObjectHash: func() string {
+			return `{"id":"` + srvURL + `/objects/` + testObjectHash + `","type":"Article","name":"Test title","content":"Test content","attributedTo":"` + srvURL + `/actors/` + testActorHash + `"}`
+		},
+		"/activities/" + createHash: func() string {
+			return `{"id":"` + srvURL + `/activities/` + createHash + `","type":"Create","actor":"` + srvURL + `/actors/` + testActorHash + `","object":"` + srvURL + `/objects/` + testObjectHash + `"}`
+		},
+		"/activities/" + likeHash: func() string {
+			return `{"id":"` + srvURL + `/activities/` + likeHash + `","type":"Like","actor":"` + srvURL + `/actors/` + testActorHash + `","object":"` + srvURL + `/objects/` + testObjectHash + `"}`
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			writeActivityJSON(w, http.StatusNotFound, `{"errors":[{"message":"not found"}]}`)
+			return
+		}
+		writeActivityJSON(w, http.StatusOK, body())
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	repo := testRepository(srv)
+	t.Run("Create", func(t *testing.T) {
+		iri := pub.IRI(srv.URL + "/activities/" + createHash)
+		d, err := repo.LoadActivity(context.Background(), iri)
+		if err != nil {
+			t.Fatalf("LoadActivity() error: %s", err)
+		}
+		if d.Type != pub.CreateType {
+			t.Errorf("Invalid activity type %s, expected %s", d.Type, pub.CreateType)
+		}
+		if d.Actor == nil || d.Actor.Handle != "johndoe" {
+			t.Errorf("Invalid activity actor %v, expected it to be resolved", d.Actor)
+		}
+		it, ok := d.Item.(*Item)
+		if !ok {
+			t.Fatalf("Invalid activity item type %T, expected %T", d.Item, &Item{})
+		}
+		if it.Title != "Test title" {
+			t.Errorf("Invalid item title %q, the object should have been resolved", it.Title)
+		}
+		if string(d.Raw) != bodies["/activities/"+createHash]() {
+			t.Errorf("Invalid raw JSON %s", d.Raw)
+		}
+	})
+	t.Run("Like", func(t *testing.T) {
+		iri := pub.IRI(srv.URL + "/activities/" + likeHash)
+		d, err := repo.LoadActivity(context.Background(), iri)
+		if err != nil {
+			t.Fatalf("LoadActivity() error: %s", err)
+		}
+		v, ok := d.Item.(*Vote)
+		if !ok {
+			t.Fatalf("Invalid activity item type %T, expected %T", d.Item, &Vote{})
+		}
+		if v.Weight != 1 {
+			t.Errorf("Invalid vote weight %d, expected 1", v.Weight)
+		}
+		if v.Item == nil || v.Item.Hash != HashFromString(testObjectHash) {
+			t.Errorf("Invalid voted item %v, expected %s", v.Item, testObjectHash)
+		}
+		if v.SubmittedBy == nil || v.SubmittedBy.Handle != "johndoe" {
+			t.Errorf("Invalid vote author %v, expected it to be resolved", v.SubmittedBy)
+		}
+	})
+	t.Run("not an activity", func(t *testing.T) {
+		if _, err := repo.LoadActivity(context.Background(), pub.IRI(srv.URL+"/objects/"+testObjectHash)); err == nil {
+			t.Errorf("LoadActivity() expected error for an object IRI")
+		}
+	})
+}
+
+func Test_repository_LoadAccountOutbox(t *testing.T) {
+	const (
+		createHash   = "0e4c1f3a-7b2d-4c8e-a1f9-3d5b7e9c2a44"
+		announceHash = "9b8f2e1d-5c4a-4b3e-8d7f-1a2b3c4d5e6f"
+		noteHash     = "7d6c5b4a-3e2f-4a1b-9c8d-0e1f2a3b4c5d"
+		sharedHash   = "5a4b3c2d-1e0f-4a9b-8c7d-6e5f4a3b2c1d"
+	)
+	var srv *httptest.Server
+	actorIRI := func() string { return srv.URL + "/actors/" + testActorHash }
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/outbox"):
+			if r.URL.Query().Get("after") == createHash {
+				writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollectionPage","orderedItems":[]}`)
+				return
+			}
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollectionPage","totalItems":4,`+
+				`"next":"`+actorIRI()+`/outbox?after=`+createHash+`","orderedItems":[`+
+				`{"id":"`+srv.URL+`/activities/`+announceHash+`","type":"Announce","actor":"`+actorIRI()+`","object":"`+srv.URL+`/objects/`+sharedHash+`","published":"2021-06-03T00:00:00Z"},`+
+				`{"id":"`+srv.URL+`/activities/`+testLikeHash+`","type":"Like","actor":"`+actorIRI()+`","object":"`+srv.URL+`/objects/`+testObjectHash+`","published":"2021-06-02T00:00:00Z"},`+
+				`{"id":"`+srv.URL+`/activities/`+createHash+`","type":"Create","actor":"`+actorIRI()+`","published":"2021-06-01T00:00:00Z",`+
+				`"object":{"id":"`+srv.URL+`/objects/`+noteHash+`","type":"Note","content":"Own note","mediaType":"text/html","attributedTo":"`+actorIRI()+`"}},`+
+				`{"id":"`+srv.URL+`/activities/1","type":"Follow","actor":"`+actorIRI()+`","object":"`+srv.URL+`/actors/2"}]}`)
+		case strings.HasSuffix(r.URL.Path, "/objects"):
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[`+
+				`{"id":"`+srv.URL+`/objects/`+testObjectHash+`","type":"Article","name":"Liked title","content":"Liked content","mediaType":"text/html"},`+
+				`{"id":"`+srv.URL+`/objects/`+sharedHash+`","type":"Article","name":"Shared title","content":"Shared content","mediaType":"text/html"}]}`)
+		case r.Method == http.MethodGet:
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	repo := testRepository(srv)
+	repo.fedbox.pub = &pub.Actor{ID: pub.IRI(srv.URL), Type: pub.ServiceType}
+	acc := *testVote(srv, 1).SubmittedBy
+
+	page, err := repo.LoadAccountOutbox(context.Background(), acc, "")
+	if err != nil {
+		t.Fatalf("LoadAccountOutbox() error: %s", err)
+	}
+	wantTypes := []pub.ActivityVocabularyType{pub.AnnounceType, pub.LikeType, pub.CreateType}
+	if len(page.Entries) != len(wantTypes) {
+		t.Fatalf("Invalid number of entries %d, expected %d", len(page.Entries), len(wantTypes))
+	}
+	wantTitles := []string{"Shared title", "Liked title", ""}
+	for i, e := range page.Entries {
+		if e.Type != wantTypes[i] {
+			t.Errorf("Invalid entry %d type %s, expected %s", i, e.Type, wantTypes[i])
+		}
+		if e.Item == nil {
+			t.Errorf("Entry %d has no item", i)
+			continue
+		}
+		if e.Item.Title != wantTitles[i] {
+			t.Errorf("Invalid entry %d item title %q, expected %q", i, e.Item.Title, wantTitles[i])
+		}
+	}
+	if page.Entries[1].Vote == nil || page.Entries[1].Vote.Weight != 1 {
+		t.Errorf("Invalid vote for the Like entry %v", page.Entries[1].Vote)
+	}
+	if page.Entries[2].Item.Data != "Own note" {
+		t.Errorf("Invalid created item content %q", page.Entries[2].Item.Data)
+	}
+	if next := page.Pagination.NextCursor(); next != createHash {
+		t.Fatalf("Invalid next cursor %q, expected %q", next, createHash)
+	}
+
+	page, err = repo.LoadAccountOutbox(context.Background(), acc, page.Pagination.NextCursor())
+	if err != nil {
+		t.Fatalf("LoadAccountOutbox() error for the next page: %s", err)
+	}
+	if len(page.Entries) != 0 {
+		t.Errorf("Invalid number of entries %d on the last page, expected 0", len(page.Entries))
+	}
+}
+
+func Test_loadAPItem_QuoteRoundTrip(t *testing.T) {
+	Instance.Conf = &config.Configuration{HostName: "littr.example", APIURL: "https://fedbox.example"}
+	quoted := "https://fedbox.example/objects/" + testObjectHash
+
+	item := Item{
+		Hash:     HashFromString(testLikeHash),
+		Title:    "quoting",
+		MimeType: MimeTypeHTML,
+		Data:     "<p>look at this</p>",
+		Metadata: &ItemMetadata{ID: "https://fedbox.example/objects/" + testLikeHash},
+		Quote:    &Item{Hash: HashFromString(testObjectHash), Metadata: &ItemMetadata{ID: quoted}},
+	}
+	o := new(pub.Object)
+	if err := loadAPItem(o, item); err != nil {
+		t.Fatalf("unable to convert item: %s", err)
+	}
+	if q := quotedIRI(o.Tag); q != pub.IRI(quoted) {
+		t.Errorf("Invalid quote tag %q, expected %q", q, quoted)
+	}
+	if !strings.Contains(o.Content.First().Value.String(), quoteFallback(pub.IRI(quoted))) {
+		t.Errorf("Content %q is missing the quote fallback", o.Content.First().Value)
+	}
+
+	raw, err := json.Marshal(o)
+	if err != nil {
+		t.Fatalf("unable to marshal object: %s", err)
+	}
+	it, err := pub.UnmarshalJSON(raw)
+	if err != nil {
+		t.Fatalf("unable to unmarshal object: %s", err)
+	}
+	loaded := Item{}
+	if err := loaded.FromActivityPub(it); err != nil {
+		t.Fatalf("unable to load item: %s", err)
+	}
+	if !loaded.Quote.HasMetadata() || loaded.Quote.Metadata.ID != quoted {
+		t.Errorf("Invalid quoted item %#v, expected %s", loaded.Quote, quoted)
+	}
+	if loaded.Quote.Hash != HashFromString(testObjectHash) {
+		t.Errorf("Invalid quoted hash %s, expected %s", loaded.Quote.Hash, testObjectHash)
+	}
+	if loaded.Data != item.Data {
+		t.Errorf("Invalid content %q, expected %q", loaded.Data, item.Data)
+	}
+	if len(loaded.Metadata.Tags) > 0 {
+		t.Errorf("The quote link should not be loaded as a tag: %v", loaded.Metadata.Tags)
+	}
+}
+
+func Test_loadAPPerson_FeaturedTagsRoundTrip(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	r := testRepository(srv)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(srv.URL), Type: pub.ServiceType}
+	Instance.BaseURL = "https://littr.example"
+	defer func() { Instance.BaseURL = "" }()
+
+	tags, err := normaliseFeaturedTags([]string{"#golang", "fediverse", "GoLang", " "}, 3)
+	if err != nil {
+		t.Fatalf("Unable to normalise the featured tags: %s", err)
+	}
+	if !reflect.DeepEqual(tags, []string{"golang", "fediverse"}) {
+		t.Errorf("Invalid featured tags %v", tags)
+	}
+	if _, err := normaliseFeaturedTags([]string{"a1", "b2", "c3", "d4"}, 3); !errors.IsNotValid(err) {
+		t.Errorf("Expected an error for more featured tags than the maximum, received %v", err)
+	}
+	if _, err := normaliseFeaturedTags([]string{"<script>"}, 3); !errors.IsNotValid(err) {
+		t.Errorf("Expected an error for an invalid tag, received %v", err)
+	}
+
+	acc := Account{
+		Hash:     HashFromString(testActorHash),
+		Handle:   "johndoe",
+		Metadata: &AccountMetadata{ID: srv.URL + "/actors/" + testActorHash, FeaturedTags: tags},
+	}
+	p := r.loadAPPerson(acc)
+	raw, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("unable to marshal actor: %s", err)
+	}
+	if !strings.Contains(string(raw), "https://littr.example/~johndoe/t/golang") {
+		t.Errorf("The featured tags should link to the account's tagged items: %s", raw)
+	}
+	it, err := pub.UnmarshalJSON(raw)
+	if err != nil {
+		t.Fatalf("unable to unmarshal actor: %s", err)
+	}
+	loaded := Account{}
+	if err := loaded.FromActivityPub(it); err != nil {
+		t.Fatalf("unable to load account: %s", err)
+	}
+	if !reflect.DeepEqual(loaded.Metadata.FeaturedTags, tags) {
+		t.Errorf("Invalid featured tags %v, expected %v", loaded.Metadata.FeaturedTags, tags)
+	}
+
+	// NOTE(marius): removing the featured tags removes their collection from the actor's streams
+	loaded.Metadata.FeaturedTags = []string{}
+	if p = r.loadAPPerson(loaded); len(featuredTagsFromStreams(p.Streams)) > 0 {
+		t.Errorf("The featured tags should have been removed, received %v", p.Streams)
+	}
+}
+
+func Test_loadAPPerson_BlurbRoundTrip(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	r := testRepository(srv)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(srv.URL), Type: pub.ServiceType}
+	Instance.BaseURL = "https://littr.example"
+	defer func() { Instance.BaseURL = "" }()
+
+	blurb := "I write [go](https://go.dev) with @alice"
+	acc := Account{
+		Hash:     HashFromString(testActorHash),
+		Handle:   "johndoe",
+		Metadata: &AccountMetadata{ID: srv.URL + "/actors/" + testActorHash, Blurb: []byte(blurb)},
+	}
+	p := r.loadAPPerson(acc)
+	summary := p.Summary.First().Value.String()
+	if !strings.Contains(summary, `<a href="https://go.dev"`) {
+		t.Errorf("The summary %q should contain the rendered link", summary)
+	}
+	if !strings.Contains(summary, "https://littr.example/~alice") {
+		t.Errorf("The summary %q should link the mention", summary)
+	}
+	if len(p.Tag) != 1 || p.Tag[0].GetType() != pub.MentionType {
+		t.Errorf("Expected the mention in the actor's tags, received %v", p.Tag)
+	}
+
+	raw, err := json.Marshal(p)
+	if err != nil {
+		t.Fatalf("unable to marshal actor: %s", err)
+	}
+	it, err := pub.UnmarshalJSON(raw)
+	if err != nil {
+		t.Fatalf("unable to unmarshal actor: %s", err)
+	}
+	loaded := Account{}
+	if err := loaded.FromActivityPub(it); err != nil {
+		t.Fatalf("unable to load account: %s", err)
+	}
+	if string(loaded.Metadata.Blurb) != blurb {
+		t.Errorf("Invalid bio %q, expected %q", loaded.Metadata.Blurb, blurb)
+	}
+
+	remote := &pub.Actor{
+		ID:      "https://remote.example/users/jane",
+		Type:    pub.PersonType,
+		Summary: pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content(`<p>hi <a href="https://go.dev">go</a><script>alert(1)</script></p>`)}},
+	}
+	jane := Account{}
+	if err := jane.FromActivityPub(remote); err != nil {
+		t.Fatalf("unable to load account: %s", err)
+	}
+	if b := string(jane.Metadata.Blurb); !strings.Contains(b, `<a href="https://go.dev"`) || strings.Contains(b, "script") {
+		t.Errorf("The remote bio %q should keep its links, and be sanitized", b)
+	}
+}
+
+func Test_repository_LoadVotesUndoOnLaterPage(t *testing.T) {
+	const (
+		likeA   = "1f0e2d3c-4b5a-4968-8776-a5b4c3d2e1f0"
+		likeB   = "2e1f3d4c-5b6a-4a79-8887-b6c5d4e3f2a1"
+		dislike = "3d2e4f5a-6b7c-4b8a-9998-c7d6e5f4a3b2"
+		undoA   = "4c3d5e6f-7a8b-4c9b-8aa9-d8e7f6a5b4c3"
+	)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/actors/"+testActorHash+"/outbox" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		actor := srv.URL + "/actors/" + testActorHash
+		object := srv.URL + "/objects/" + testObjectHash
+		if strings.Contains(r.URL.RawQuery, string(pub.UndoType)) {
+			// NOTE(marius): the Undo is newer than the page we loaded, it would be on a different page
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","totalItems":1,"orderedItems":[`+
+				`{"id":"`+srv.URL+`/activities/`+undoA+`","type":"Undo","actor":"`+actor+`","object":"`+srv.URL+`/activities/`+likeA+`"}]}`)
+			return
+		}
+		writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollectionPage","totalItems":10,"next":"`+srv.URL+`/actors/`+testActorHash+`/outbox?after=`+likeB+`","orderedItems":[`+
+			`{"id":"`+srv.URL+`/activities/`+likeA+`","type":"Like","actor":"`+actor+`","object":"`+object+`","published":"2020-05-02T10:00:00Z"},`+
+			`{"id":"`+srv.URL+`/activities/`+dislike+`","type":"Dislike","actor":"`+actor+`","object":"`+object+`","published":"2020-05-01T12:00:00Z"},`+
+			`{"id":"`+srv.URL+`/activities/`+likeB+`","type":"Like","actor":"`+actor+`","object":"`+object+`","published":"2020-05-01T10:00:00Z"}]}`)
+	}))
+	defer srv.Close()
+
+	repo := testRepository(srv)
+	actor := pub.IRI(srv.URL + "/actors/" + testActorHash)
+	ctx := context.Background()
+
+	page, err := repo.LoadVotes(ctx, actor, VotesFilter{})
+	if err != nil {
+		t.Fatalf("Unable to load votes: %s", err)
+	}
+	for _, v := range page.Votes {
+		if v.Metadata.IRI == srv.URL+"/activities/"+likeA {
+			t.Errorf("The vote undone on a different page should have been removed")
+		}
+	}
+	if len(page.Votes) != 2 {
+		t.Errorf("Invalid votes count %d, expected %d", len(page.Votes), 2)
+	}
+	if next := page.Pagination.NextCursor(); next != likeB {
+		t.Errorf("Invalid next page cursor %q, expected %q", next, likeB)
+	}
+
+	page, err = repo.LoadVotes(ctx, actor, VotesFilter{Types: pub.ActivityVocabularyTypes{pub.LikeType}})
+	if err != nil {
+		t.Fatalf("Unable to load likes: %s", err)
+	}
+	if len(page.Votes) != 1 || page.Votes[0].Metadata.IRI != srv.URL+"/activities/"+likeB {
+		t.Errorf("Invalid likes %v, expected only %s", page.Votes, likeB)
+	}
+
+	after, _ := time.Parse(time.RFC3339, "2020-05-01T11:00:00Z")
+	page, err = repo.LoadVotes(ctx, actor, VotesFilter{After: after})
+	if err != nil {
+		t.Fatalf("Unable to load votes: %s", err)
+	}
+	if len(page.Votes) != 1 || page.Votes[0].Metadata.IRI != srv.URL+"/activities/"+dislike {
+		t.Errorf("Invalid votes after %s: %v, expected only %s", after, page.Votes, dislike)
+	}
+}
+
+func Test_repository_CurrentAccountVotes(t *testing.T) {
+	items := []Item{
+		{Hash: HashFromString("5a4b6c7d-8e9f-4a0b-9c1d-e2f3a4b5c6d7")},
+		{Hash: HashFromString("6b5c7d8e-9f0a-4b1c-8d2e-f3a4b5c6d7e8")},
+		{Hash: HashFromString("7c6d8e9f-0a1b-4c2d-9e3f-a4b5c6d7e8f9")},
+	}
+	requests := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/inbox" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		requests++
+		actor := srv.URL + "/actors/" + testActorHash
+		obj := func(i int) string { return srv.URL + "/objects/" + items[i].Hash.String() }
+		writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","totalItems":3,"orderedItems":[`+
+			`{"id":"`+srv.URL+`/activities/`+testLikeHash+`","type":"Like","actor":"`+actor+`","object":"`+obj(0)+`"},`+
+			`{"id":"`+srv.URL+`/activities/`+testObjectHash+`","type":"Dislike","actor":"`+actor+`","object":"`+obj(2)+`"}]}`)
+	}))
+	defer srv.Close()
+
+	repo := testRepository(srv)
+	repo.fedbox.pub = &pub.Actor{ID: pub.IRI(srv.URL), Type: pub.ServiceType}
+	viewer := *testVote(srv, 0).SubmittedBy
+
+	votes, err := repo.CurrentAccountVotes(context.Background(), viewer, items...)
+	if err != nil {
+		t.Fatalf("Unable to load the viewer's votes: %s", err)
+	}
+	if requests != 1 {
+		t.Errorf("Invalid number of requests %d, expected the votes to be loaded in one", requests)
+	}
+	if len(votes) != 2 {
+		t.Fatalf("Invalid votes count %d, expected %d", len(votes), 2)
+	}
+	if v, ok := votes[items[0].Hash]; !ok || !v.IsYay() {
+		t.Errorf("Expected a yay vote on the first item, got %#v", v)
+	}
+	if _, ok := votes[items[1].Hash]; ok {
+		t.Errorf("The viewer didn't vote on the second item")
+	}
+	if v, ok := votes[items[2].Hash]; !ok || !v.IsNay() {
+		t.Errorf("Expected a nay vote on the third item, got %#v", v)
+	}
+}
+
+func Test_repository_SaveItemsPartialFailures(t *testing.T) {
+	var srv *httptest.Server
+	var posted int
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/outbox") {
+			posted++
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Header().Set("Location", srv.URL+"/activities/"+testLikeHash)
+			writeActivityJSON(w, http.StatusCreated, string(body))
+			return
+		}
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/actors") {
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	author := testVote(srv, 1).SubmittedBy
+	author.Metadata.OAuth.Token = &oauth2.Token{AccessToken: "t0k3n", TokenType: "Bearer"}
+	r.WithAccount(author)
+
+	invalid := map[int]bool{12: true, 37: true}
+	items := make([]Item, 50)
+	for k := range items {
+		items[k] = Item{SubmittedBy: author, Title: "imported", Data: "imported content", MimeType: "text/plain"}
+		if invalid[k] {
+			items[k].MimeType = "application/x-shockwave-flash"
+		}
+	}
+	saved, errs := r.SaveItems(context.Background(), items)
+	if len(saved) != len(items) || len(errs) != len(items) {
+		t.Fatalf("Expected %d results, received %d items and %d errors", len(items), len(saved), len(errs))
+	}
+	for k, err := range errs {
+		if invalid[k] && err == nil {
+			t.Errorf("Item %d should have failed validation", k)
+		}
+		if !invalid[k] && err != nil {
+			t.Errorf("Item %d should have been saved, received error: %s", k, err)
+		}
+	}
+	if posted != len(items)-len(invalid) {
+		t.Errorf("Expected %d items sent to the outbox, received %d", len(items)-len(invalid), posted)
+	}
+}
+
+// repliesServer serves n items, the item k having k replies. The last item has no replies collection at all.
+func repliesServer(n int, requests *int32) (*httptest.Server, ItemCollection) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		if r.URL.Path == "/objects" {
+			replies := make([]string, 0)
+			for k := 0; k < n-1; k++ {
+				for j := 0; j < k; j++ {
+					replies = append(replies, fmt.Sprintf(`{"type":"Note","id":"%s/objects/reply-%d-%d","inReplyTo":"%s/objects/%s"}`, srv.URL, k, j, srv.URL, testItemHash(k)))
+				}
+			}
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","totalItems":`+strconv.Itoa(len(replies))+`,"orderedItems":[`+strings.Join(replies, ",")+`]}`)
+			return
+		}
+		for k := 0; k < n-1; k++ {
+			if r.URL.Path == "/objects/"+testItemHash(k)+"/replies" {
+				writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","totalItems":`+strconv.Itoa(k)+`}`)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	items := make(ItemCollection, n)
+	for k := range items {
+		hash := testItemHash(k)
+		items[k] = Item{Hash: HashFromString(hash), pub: &pub.Object{ID: pub.IRI(srv.URL + "/objects/" + hash), Type: pub.NoteType}}
+	}
+	return srv, items
+}
+
+func testItemHash(k int) string {
+	return fmt.Sprintf("6435b2b5-26df-434c-87ca-%012d", k)
+}
+
+func Test_repository_loadItemsRepliesCount(t *testing.T) {
+	var requests int32
+	srv, items := repliesServer(5, &requests)
+	defer srv.Close()
+
+	r := testRepository(srv)
+	items, err := r.loadItemsRepliesCount(context.Background(), items...)
+	if err != nil {
+		t.Fatalf("loadItemsRepliesCount() error = %s", err)
+	}
+	for k, it := range items {
+		want := k
+		if k == len(items)-1 {
+			want = 0
+		}
+		if it.ReplyCount != want {
+			t.Errorf("Item %d ReplyCount = %d, want %d", k, it.ReplyCount, want)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("loadItemsRepliesCount() made %d requests, want 1", n)
+	}
+}
+
+func Benchmark_repository_loadItemsRepliesCount(b *testing.B) {
+	var requests int32
+	srv, items := repliesServer(MaxContentItems, &requests)
+	defer srv.Close()
+	r := testRepository(srv)
+	ctx := context.Background()
+
+	b.Run("batched", func(b *testing.B) {
+		atomic.StoreInt32(&requests, 0)
+		for i := 0; i < b.N; i++ {
+			r.loadItemsRepliesCount(ctx, items...)
+		}
+		b.ReportMetric(float64(atomic.LoadInt32(&requests))/float64(b.N), "requests/op")
+	})
+	b.Run("per item", func(b *testing.B) {
+		atomic.StoreInt32(&requests, 0)
+		for i := 0; i < b.N; i++ {
+			for k, it := range items {
+				col, err := r.fedbox.Replies(ctx, it.pub)
+				if err != nil {
+					continue
+				}
+				pub.OnOrderedCollection(col, func(c *pub.OrderedCollection) error {
+					items[k].ReplyCount = int(c.TotalItems)
+					return nil
+				})
+			}
+		}
+		b.ReportMetric(float64(atomic.LoadInt32(&requests))/float64(b.N), "requests/op")
+	})
+}
+
+func Test_repository_LoadAccountsMergesFilters(t *testing.T) {
+	hashes := map[string]string{"johndoe": testActorHash, "janedoe": testLikeHash}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("name")
+		if h, ok := hashes[name]; ok && strings.HasSuffix(r.URL.Path, "/actors") {
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","totalItems":1,"orderedItems":[`+
+				`{"id":"`+srv.URL+`/actors/`+h+`","type":"Person","preferredUsername":"`+name+`"}]}`)
+			return
+		}
+		writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+	}))
+	defer srv.Close()
+	r := testRepository(srv)
+
+	// NOTE(marius): the filters are loaded concurrently, run with -race to check they don't share their results
+	accounts, pages, err := r.LoadAccounts(context.Background(),
+		&Filters{Name: CompStrs{EqualsString("johndoe")}},
+		&Filters{Name: CompStrs{EqualsString("janedoe")}},
+	)
+	if err != nil {
+		t.Fatalf("Unable to load the accounts: %s", err)
+	}
+	if len(accounts) != 2 || accounts[0].Handle != "johndoe" || accounts[1].Handle != "janedoe" {
+		t.Errorf("Invalid accounts %v, expected johndoe and janedoe in the order of their filters", accounts)
+	}
+	if pages.Total != 1 {
+		t.Errorf("Invalid pagination %v, expected the one of the last filter", pages)
+	}
+}
+
+func Test_ActivityPubService_VoteDecayLoadsVoters(t *testing.T) {
+	var voterLoads int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/inbox":
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[`+
+				`{"id":"`+srv.URL+`/activities/`+testLikeHash+`","type":"Like","actor":"`+srv.URL+`/actors/`+testActorHash+`","object":"`+srv.URL+`/objects/`+testObjectHash+`"}]}`)
+		case strings.HasPrefix(r.URL.Path, "/actors"):
+			atomic.AddInt32(&voterLoads, 1)
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+		default:
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		decayAge  time.Duration
+		wantLoads bool
+	}{
+		{
+			name:      "decay disabled",
+			decayAge:  0,
+			wantLoads: false,
+		},
+		{
+			name:      "decay enabled",
+			decayAge:  30 * 24 * time.Hour,
+			wantLoads: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&voterLoads, 0)
+			Instance.Conf = &config.Configuration{HostName: "littr.example", APIURL: srv.URL}
+			c := appConfig{
+				Configuration: config.Configuration{HostName: "littr.example", APIURL: srv.URL, VoteDecayAge: tt.decayAge},
+				Logger:        log.Dev(log.PanicLevel),
+			}
+			r, err := ActivityPubService(c)
+			if err != nil {
+				t.Fatalf("Unable to create the repository: %s", err)
+			}
+			if (r.voteWeight != nil) != tt.wantLoads {
+				t.Errorf("Invalid vote weight function %v for a decay age of %s", r.voteWeight != nil, tt.decayAge)
+			}
+			r.fedbox.pub = &pub.Actor{ID: pub.IRI(srv.URL), Type: pub.ServiceType}
+
+			it := Item{
+				Hash:     HashFromString(testObjectHash),
+				Metadata: &ItemMetadata{ID: srv.URL + "/objects/" + testObjectHash},
+			}
+			votes, err := r.loadVotesOnItems(context.Background(), it)
+			if err != nil {
+				t.Fatalf("Unable to load the votes: %s", err)
+			}
+			if len(votes) != 1 {
+				t.Errorf("Invalid votes count %d, expected 1", len(votes))
+			}
+			if loads := atomic.LoadInt32(&voterLoads); (loads > 0) != tt.wantLoads {
+				t.Errorf("Invalid voter loads %d, expected them only with the vote decay enabled", loads)
+			}
+		})
+	}
+}
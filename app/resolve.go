@@ -0,0 +1,142 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+)
+
+// Resolved is the ActivityPub object corresponding to a local permalink
+type Resolved struct {
+	IRI       pub.IRI                    `json:"iri"`
+	Type      pub.ActivityVocabularyType `json:"type,omitempty"`
+	Federated bool                       `json:"federated"`
+}
+
+// parsePermaLink extracts the account handle and the item hash from the paths built by
+// AccountPermaLink and ItemPermaLink: /~{handle}, /~{handle}/{hash}, /{year}/{month}/{day}/{hash} and /i/{hash}
+func parsePermaLink(s string) (string, Hash, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", AnonymousHash, errors.BadRequestf("invalid url %q", s)
+	}
+	if len(u.Host) > 0 && !HostIsLocal(u.String()) {
+		return "", AnonymousHash, errors.BadRequestf("%q is not a local permalink", s)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && strings.HasPrefix(parts[0], "~") && len(parts[0]) > 1:
+		return parts[0][1:], AnonymousHash, nil
+	case len(parts) == 2 && strings.HasPrefix(parts[0], "~") && len(parts[0]) > 1:
+		if h := HashFromString(parts[1]); h.IsValid() {
+			return parts[0][1:], h, nil
+		}
+	case len(parts) == 2 && parts[0] == "i":
+		if h := HashFromString(parts[1]); h.IsValid() {
+			return "", h, nil
+		}
+	case len(parts) == 4:
+		if h := HashFromString(parts[3]); h.IsValid() {
+			return "", h, nil
+		}
+	}
+	return "", AnonymousHash, errors.BadRequestf("%q is not a valid permalink", s)
+}
+
+// ResolvePermaLink returns the IRI and the type of the item or account the permalink points to
+func (r *repository) ResolvePermaLink(ctx context.Context, s string) (Resolved, error) {
+	handle, hash, err := parsePermaLink(s)
+	if err != nil {
+		return Resolved{}, err
+	}
+	if hash.IsValid() {
+		return r.resolveItem(ctx, hash)
+	}
+	return r.resolveAccount(ctx, handle)
+}
+
+func (r *repository) resolveItem(ctx context.Context, hash Hash) (Resolved, error) {
+	f := &Filters{
+		Type:   CreateActivitiesFilter,
+		Object: &Filters{IRI: CompStrs{LikeString(hash.String())}},
+	}
+	col, err := r.fedbox.Inbox(ctx, r.instanceActor(), Values(f))
+	if err != nil {
+		return Resolved{}, errors.Annotatef(err, "unable to load item %s", hash)
+	}
+	i := Item{}
+	pub.OnOrderedCollection(col, func(c *pub.OrderedCollection) error {
+		for _, it := range c.OrderedItems {
+			if HashFromItem(activityObject(it)) == hash {
+				return i.FromActivityPub(it)
+			}
+		}
+		return nil
+	})
+	if !i.IsValid() || i.Deleted() {
+		return Resolved{}, errors.NotFoundf("item %s", hash)
+	}
+	res := Resolved{Federated: i.IsFederated()}
+	if id, ok := BuildIDFromItem(i); ok {
+		res.IRI = id
+	} else {
+		res.IRI = r.ItemIRI(i.Hash.String())
+	}
+	if i.pub != nil {
+		res.Type = i.pub.GetType()
+	}
+	return res, nil
+}
+
+func (r *repository) resolveAccount(ctx context.Context, handle string) (Resolved, error) {
+	if handle == selfName {
+		self := r.fedbox.Service()
+		return Resolved{IRI: self.GetLink(), Type: self.GetType()}, nil
+	}
+	accounts, err := r.accounts(ctx, &Filters{Name: CompStrs{EqualsString(handle)}})
+	if err != nil {
+		return Resolved{}, errors.Annotatef(err, "unable to load account %s", handle)
+	}
+	if len(accounts) == 0 {
+		return Resolved{}, errors.NotFoundf("account %s", handle)
+	}
+	a := accounts[0]
+	res := Resolved{IRI: BuildActorID(a), Federated: a.IsFederated()}
+	if a.pub != nil {
+		res.Type = a.pub.GetType()
+	}
+	return res, nil
+}
+
+// activityObject returns the object of an activity, or the item itself if it isn't one
+func activityObject(it pub.Item) pub.Item {
+	ob := it
+	pub.OnActivity(it, func(a *pub.Activity) error {
+		ob = a.Object
+		return nil
+	})
+	return ob
+}
+
+// HandleResolve serves /resolve?url= requests, returning the ActivityPub IRI of a local permalink
+func (h *handler) HandleResolve(w http.ResponseWriter, r *http.Request) {
+	u := r.URL.Query().Get("url")
+	if len(u) == 0 {
+		h.v.HandleErrors(w, r, errors.BadRequestf("missing url parameter"))
+		return
+	}
+	res, err := h.storage.ResolvePermaLink(r.Context(), u)
+	if err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	dat, _ := json.Marshal(res)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dat)
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_repository_ResolvePermaLink(t *testing.T) {
+	const remoteIRI = "https://remote.example/objects/" + testLikeHash
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/inbox" {
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+			return
+		}
+		local := `{"type":"Create","actor":"` + srv.URL + `/actors/` + testActorHash + `","object":` +
+			`{"id":"` + srv.URL + `/objects/` + testObjectHash + `","type":"Note","content":"local"}}`
+		remote := `{"type":"Create","actor":"https://remote.example/actors/jane","object":` +
+			`{"id":"` + remoteIRI + `","type":"Article","content":"remote"}}`
+		items := make([]string, 0)
+		if strings.Contains(r.URL.RawQuery, testObjectHash) {
+			items = append(items, local)
+		}
+		if strings.Contains(r.URL.RawQuery, testLikeHash) {
+			items = append(items, remote)
+		}
+		writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[`+strings.Join(items, ",")+`]}`)
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(srv.URL), Type: pub.ServiceType}
+
+	tests := []struct {
+		name    string
+		url     string
+		want    Resolved
+		wantErr bool
+	}{
+		{
+			name: "local item",
+			url:  "https://littr.example/~johndoe/" + testObjectHash,
+			want: Resolved{IRI: pub.IRI(srv.URL + "/objects/" + testObjectHash), Type: pub.NoteType},
+		},
+		{
+			name: "federated item",
+			url:  "/2020/04/01/" + testLikeHash,
+			want: Resolved{IRI: remoteIRI, Type: pub.ArticleType, Federated: true},
+		},
+		{
+			name: "short link",
+			url:  "/i/" + testObjectHash,
+			want: Resolved{IRI: pub.IRI(srv.URL + "/objects/" + testObjectHash), Type: pub.NoteType},
+		},
+		{
+			name:    "missing item",
+			url:     "/i/" + testActorHash,
+			wantErr: true,
+		},
+		{
+			name:    "remote host",
+			url:     "https://remote.example/~jane/" + testLikeHash,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.ResolvePermaLink(context.Background(), tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolvePermaLink() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolvePermaLink() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
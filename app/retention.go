@@ -0,0 +1,185 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// DefaultRetentionInterval is how often the retention job prunes the cache
+const DefaultRetentionInterval = time.Hour
+
+// localInteractions records when the local accounts last voted on, or replied to, the cached items,
+// so the retention job keeps the remote content they still interact with
+type localInteractions struct {
+	m  sync.RWMutex
+	at map[string]time.Time
+}
+
+func newLocalInteractions() *localInteractions {
+	return &localInteractions{at: make(map[string]time.Time)}
+}
+
+// touch records a local interaction with the cache entries
+func (l *localInteractions) touch(keys ...string) {
+	if l == nil {
+		return
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	now := time.Now()
+	for _, k := range keys {
+		l.at[k] = now
+	}
+}
+
+// since returns the time of the last local interaction with the cache entry
+func (l *localInteractions) since(key string) time.Time {
+	if l == nil {
+		return time.Time{}
+	}
+	l.m.RLock()
+	defer l.m.RUnlock()
+	return l.at[key]
+}
+
+// expire forgets the interactions older than cutoff
+func (l *localInteractions) expire(cutoff time.Time) {
+	if l == nil {
+		return
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	for k, at := range l.at {
+		if at.Before(cutoff) {
+			delete(l.at, k)
+		}
+	}
+}
+
+// touchItem records a local interaction with the item, and with its author
+func (c *cachedRepository) touchItem(it Item) {
+	keys := make([]string, 0)
+	for _, iri := range c.itemIRIs(it) {
+		keys = append(keys, itemCacheKey(iri))
+	}
+	if it.SubmittedBy.HasMetadata() && len(it.SubmittedBy.Metadata.ID) > 0 {
+		keys = append(keys, accountCacheKey(pub.IRI(it.SubmittedBy.Metadata.ID)))
+	}
+	c.interactions.touch(keys...)
+}
+
+// isRemoteItem returns true if neither the item, nor its author, are hosted on the current instance
+func isRemoteItem(it Item) bool {
+	if it.HasMetadata() && len(it.Metadata.ID) > 0 && HostIsLocal(it.Metadata.ID) {
+		return false
+	}
+	return !it.SubmittedBy.HasMetadata() || !HostIsLocal(it.SubmittedBy.Metadata.ID)
+}
+
+// isRemoteAccount returns true if the account isn't hosted on the current instance
+func isRemoteAccount(a Account) bool {
+	return !a.HasMetadata() || !HostIsLocal(a.Metadata.ID)
+}
+
+// accountLastActive returns the last time the account was updated, or its creation time
+func accountLastActive(a Account) time.Time {
+	if a.UpdatedAt.After(a.CreatedAt) {
+		return a.UpdatedAt
+	}
+	return a.CreatedAt
+}
+
+// featuredTags returns the tags the cached accounts feature on their profiles, by the accounts' IDs
+func (c *cachedRepository) featuredTags() map[string][]string {
+	featured := make(map[string][]string)
+	add := func(a *Account) {
+		if a.HasMetadata() && len(a.Metadata.ID) > 0 && len(a.Metadata.FeaturedTags) > 0 {
+			featured[a.Metadata.ID] = a.Metadata.FeaturedTags
+		}
+	}
+	c.c.each(func(_ string, v interface{}) {
+		switch ob := v.(type) {
+		case Item:
+			add(ob.SubmittedBy)
+		case Account:
+			add(&ob)
+		}
+	})
+	return featured
+}
+
+// isFeaturedItem returns true if the item is tagged with one of the tags its author features on their profile
+func isFeaturedItem(it Item, featured map[string][]string) bool {
+	if !it.HasMetadata() || !it.SubmittedBy.HasMetadata() {
+		return false
+	}
+	for _, ft := range featured[it.SubmittedBy.Metadata.ID] {
+		for _, t := range it.Metadata.Tags {
+			if t.Type == TagTag && strings.EqualFold(strings.TrimPrefix(t.Name, "#"), ft) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// prune removes from the cache the remote items and accounts that weren't active in the last age.
+// The local content is never removed, nor the items featured on their authors' profiles,
+// nor the remote content the local accounts interacted with recently.
+// It returns the number of removed entries.
+func (c *cachedRepository) prune(age time.Duration) int {
+	if age <= 0 {
+		return 0
+	}
+	cutoff := time.Now().Add(-age)
+	featured := c.featuredTags()
+	removed := c.c.removeFn(func(key string, v interface{}) bool {
+		if c.interactions.since(key).After(cutoff) {
+			return false
+		}
+		switch ob := v.(type) {
+		case Item:
+			return isRemoteItem(ob) && !isFeaturedItem(ob, featured) && lastActive(&ob).Before(cutoff)
+		case Account:
+			return isRemoteAccount(ob) && accountLastActive(ob).Before(cutoff)
+		}
+		return false
+	})
+	c.interactions.expire(cutoff)
+	return removed
+}
+
+// runRetention removes the expired entries, and prunes the content older than age, from the cache every interval,
+// until ctx is done
+func (c *cachedRepository) runRetention(ctx context.Context, interval, age time.Duration, infoFn CtxLogFn) {
+	if interval <= 0 {
+		interval = DefaultRetentionInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			c.c.expire()
+			if removed := c.prune(age); removed > 0 {
+				infoFn(log.Ctx{"removed": removed, "age": age})("pruned old remote content from the cache")
+			}
+		}
+	}
+}
+
+// RunRetention runs the retention job of the repository cache, until ctx is done.
+// Without the cache there's nothing to prune.
+func (a *Application) RunRetention(ctx context.Context) {
+	if a.front == nil || a.front.cache == nil {
+		return
+	}
+	a.front.cache.runRetention(ctx, a.Conf.CacheRetentionInterval, a.Conf.CacheRetentionAge, a.front.infoFn)
+}
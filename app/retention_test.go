@@ -0,0 +1,83 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+func Test_cachedRepository_prune(t *testing.T) {
+	Instance.Conf = &config.Configuration{HostName: "littr.example", APIURL: "https://fedbox.example"}
+	old := time.Now().Add(-48 * time.Hour)
+	recent := time.Now().Add(-time.Hour)
+	remote := func(id string, at time.Time) Item {
+		return Item{
+			Hash:        HashFromString(id),
+			SubmittedAt: at,
+			SubmittedBy: &Account{Handle: "jdoe", Metadata: &AccountMetadata{ID: "https://remote.example/users/jdoe"}},
+			Metadata:    &ItemMetadata{ID: "https://remote.example/objects/" + id},
+		}
+	}
+	items := map[string]Item{
+		"old-remote":        remote("0c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c01", old),
+		"recent-remote":     remote("0c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c02", recent),
+		"old-interacted":    remote("0c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c03", old),
+		"old-local":         {Hash: HashFromString("0c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c04"), SubmittedAt: old, Metadata: &ItemMetadata{ID: "https://fedbox.example/objects/0c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c04"}},
+		"old-remote-edited": remote("0c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c05", old),
+		"old-featured":      remote("0c1c2e3d-4b5f-4a6e-8c7d-9e0f1a2b3c06", old),
+	}
+	edited := items["old-remote-edited"]
+	edited.UpdatedAt = recent
+	items["old-remote-edited"] = edited
+	featured := items["old-featured"]
+	featured.Metadata.Tags = TagCollection{{Type: TagTag, Name: "#Release", URL: "https://remote.example/tags/release"}}
+	items["old-featured"] = featured
+
+	c := newCachedRepository(&countingRepository{}, newMemCache(time.Hour*24*7, 0))
+	for _, it := range items {
+		c.c.save(itemCacheKey(pub.IRI(it.Metadata.ID)), it)
+	}
+	c.c.save(accountCacheKey("https://remote.example/users/jane"), Account{Handle: "jane", CreatedAt: old, Metadata: &AccountMetadata{ID: "https://remote.example/users/jane"}})
+	c.c.save(accountCacheKey("https://fedbox.example/actors/john"), Account{Handle: "john", CreatedAt: old, Metadata: &AccountMetadata{ID: "https://fedbox.example/actors/john"}})
+	// NOTE(marius): the author of the items, recently active, features the "release" tag on their profile
+	c.c.save(accountCacheKey("https://remote.example/users/jdoe"), Account{Handle: "jdoe", CreatedAt: recent, Metadata: &AccountMetadata{ID: "https://remote.example/users/jdoe", FeaturedTags: []string{"release"}}})
+	c.touchItem(items["old-interacted"])
+
+	if removed := c.prune(24 * time.Hour); removed != 2 {
+		t.Errorf("Expected 2 pruned entries, the old remote item and account, received %d", removed)
+	}
+	for name, it := range items {
+		_, ok := c.c.load(itemCacheKey(pub.IRI(it.Metadata.ID)))
+		if name == "old-remote" && ok {
+			t.Errorf("The old remote item should have been pruned")
+		}
+		if name != "old-remote" && !ok {
+			t.Errorf("The %s item should have been kept", name)
+		}
+	}
+	if _, ok := c.c.load(accountCacheKey("https://remote.example/users/jane")); ok {
+		t.Errorf("The old remote account should have been pruned")
+	}
+	if _, ok := c.c.load(accountCacheKey("https://fedbox.example/actors/john")); !ok {
+		t.Errorf("The local account should have been kept")
+	}
+}
+
+func Test_cachedRepository_runRetentionStops(t *testing.T) {
+	c := newCachedRepository(&countingRepository{}, newMemCache(time.Minute, 0))
+	ctx, cancelFn := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.runRetention(ctx, time.Millisecond, time.Hour, defaultCtxLogFn)
+		close(done)
+	}()
+	cancelFn()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("The retention job should stop when its context is done")
+	}
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	stderrors "errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// DefaultRetryBackoff is the wait before the first retry of a failed fedbox request, it doubles on every attempt
+const DefaultRetryBackoff = 250 * time.Millisecond
+
+// SetRetries sets the maximum number of attempts of the fedbox requests that fail with a transient error,
+// and the wait before the first retry
+func SetRetries(attempts int, backoff time.Duration) OptionFn {
+	return func(f *fedbox) error {
+		if backoff <= 0 {
+			backoff = DefaultRetryBackoff
+		}
+		f.attempts = attempts
+		f.backoff = backoff
+		return nil
+	}
+}
+
+// retryableError returns true for the errors a new attempt can fix: the fedbox responses with a 5xx status,
+// and the connection level errors. The 4xx responses, and the canceled requests, are final.
+func retryableError(err error) bool {
+	if err == nil || stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var fe *fedboxError
+	if stderrors.As(err, &fe) {
+		return fe.status >= http.StatusInternalServerError
+	}
+	var ne net.Error
+	return stderrors.As(err, &ne)
+}
+
+// withRetry calls fn until it succeeds, or it fails with an error that's not transient, at most f.attempts times.
+// The wait between the attempts doubles every time, and the cancellation of the context stops it right away.
+func (f fedbox) withRetry(ctx context.Context, fn func() error) error {
+	wait := f.backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); attempt >= f.attempts || !retryableError(err) {
+			return err
+		}
+		f.errFn(log.Ctx{"attempt": attempt, "wait": wait.String(), "err": err.Error()})("retrying the failed request")
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return errors.Annotatef(ctx.Err(), "stopped retrying after %d attempts: %s", attempt, err)
+		case <-t.C:
+		}
+		wait *= 2
+	}
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_fedbox_withRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int32
+		status   int
+		attempts int
+		wantReqs int32
+		wantErr  bool
+	}{
+		{name: "fails twice then succeeds", failures: 2, status: http.StatusServiceUnavailable, attempts: 3, wantReqs: 3},
+		{name: "out of attempts", failures: 5, status: http.StatusBadGateway, attempts: 3, wantReqs: 3, wantErr: true},
+		{name: "not found is final", failures: 5, status: http.StatusNotFound, attempts: 3, wantReqs: 1, wantErr: true},
+		{name: "without retries", failures: 2, status: http.StatusInternalServerError, attempts: 1, wantReqs: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) <= tt.failures {
+					w.WriteHeader(tt.status)
+					return
+				}
+				writeActivityJSON(w, http.StatusOK, `{"type":"Note","content":"hello"}`)
+			}))
+			defer srv.Close()
+
+			r := testRepository(srv)
+			r.fedbox.attempts, r.fedbox.backoff = tt.attempts, time.Millisecond
+			ob, err := r.fedbox.object(context.Background(), pub.IRI(srv.URL+"/objects/"+testObjectHash))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Invalid error %v, expected an error: %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && (ob == nil || ob.GetType() != pub.NoteType) {
+				t.Errorf("Invalid object loaded %v", ob)
+			}
+			if n := atomic.LoadInt32(&requests); n != tt.wantReqs {
+				t.Errorf("Invalid number of requests %d, expected %d", n, tt.wantReqs)
+			}
+		})
+	}
+}
+
+func Test_fedbox_withRetryCanceled(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.fedbox.attempts, r.fedbox.backoff = 5, time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := r.fedbox.object(ctx, pub.IRI(srv.URL+"/objects/"+testObjectHash)); err == nil {
+		t.Fatalf("Expected an error for the canceled request")
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("The cancellation of the context should stop the retries, they took %s", took)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Invalid number of requests %d, expected 1", n)
+	}
+}
+
+func Test_retryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "server error", err: errorFromResponse(http.StatusBadGateway, nil), want: true},
+		{name: "client error", err: errorFromResponse(http.StatusBadRequest, nil), want: false},
+		{name: "connection error", err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, want: true},
+		{name: "canceled", err: context.Canceled, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryableError(tt.err); got != tt.want {
+				t.Errorf("retryableError(%v) = %t, expected %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
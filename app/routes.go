@@ -15,13 +15,21 @@ import (
 func (h *handler) ItemRoutes() func(chi.Router) {
 	return func(r chi.Router) {
 		r.Use(h.CSRF, ContentModelMw, h.ItemFiltersMw, LoadObjectFromInboxMw, ThreadedListingMw, SortByScore)
-		r.Get("/", h.HandleShow)
+		r.With(h.RateLimit(RateLimitItems)).Get("/", h.HandleShow)
 		r.With(h.ValidateLoggedIn(h.v.RedirectToErrors)).Post("/", h.HandleSubmit)
+		r.With(h.CORS).Get("/score", h.HandleItemScore)
 
 		r.Group(func(r chi.Router) {
 			r.Use(h.ValidateLoggedIn(h.v.RedirectToErrors))
 			r.Get("/yay", h.HandleVoting)
 			r.Get("/nay", h.HandleVoting)
+			r.Post("/mute", h.HandleMuteThread)
+			r.Post("/unmute", h.HandleMuteThread)
+			r.Post("/dismiss", h.HandleDismissItem)
+			r.Post("/undismiss", h.HandleDismissItem)
+			r.Post("/lock", h.HandleLockItem)
+			r.Post("/unlock", h.HandleLockItem)
+			r.Post("/repair", h.HandleRepairItem)
 
 			//r.Get("/bad", h.ShowReport)
 			r.With(ReportContentModelMw).Get("/bad", h.HandleShow)
@@ -32,6 +40,7 @@ func (h *handler) ItemRoutes() func(chi.Router) {
 			r.Group(func(r chi.Router) {
 				r.With(h.ValidateItemAuthor("edit"), EditContentModelMw).Get("/edit", h.HandleShow)
 				r.With(h.ValidateItemAuthor("edit")).Post("/edit", h.HandleSubmit)
+				r.With(h.ValidateItemAuthor("edit")).Post("/visibility", h.HandleChangeVisibility)
 				r.With(h.ValidateItemAuthor("delete")).Get("/rm", h.HandleDelete)
 			})
 		})
@@ -42,6 +51,7 @@ func (h *handler) Routes(c *config.Configuration) func(chi.Router) {
 	return func(r chi.Router) {
 		r.Use(middleware.GetHead)
 		r.Use(ReqLogger(h.logger))
+		r.Use(h.CanonicalHostMw)
 
 		workDir, _ := os.Getwd()
 		assetsDir := filepath.Join(workDir, "assets")
@@ -57,6 +67,7 @@ func (h *handler) Routes(c *config.Configuration) func(chi.Router) {
 			"about.css":        []string{"main.css", "about.css"},
 			"error.css":        []string{"main.css", "error.css"},
 			"login.css":        []string{"main.css", "login.css"},
+			"totp.css":         []string{"main.css", "login.css"},
 			"register.css":     []string{"main.css", "login.css"},
 			"inline.css":       []string{"inline.css"},
 			"main.js":          []string{"base.js", "main.js"},
@@ -90,17 +101,32 @@ func (h *handler) Routes(c *config.Configuration) func(chi.Router) {
 				r.With(h.NeedsSessions).Group(func(r chi.Router) {
 					r.With(ModelMw(&loginModel{Title: "Local authentication"})).Get("/login", h.HandleShow)
 					r.Post("/login", h.HandleLogin)
+					r.With(ModelMw(&loginModel{Title: "Two-factor authentication", OTP: true})).Get("/login/otp", h.HandleShow)
+					r.Post("/login/otp", h.HandleLoginTOTP)
 				})
 			})
 
-			r.With(h.LoadAuthorMw).Route("/~{handle}", func(r chi.Router) {
-				r.With(AccountListingModelMw, AccountFiltersMw, LoadOutboxMw).Get("/", h.HandleShow)
+			r.With(h.ReadAccess, h.LoadAuthorMw).Route("/~{handle}", func(r chi.Router) {
+				r.With(h.RateLimit(RateLimitProfiles), h.CSRF, AccountListingModelMw, AccountFiltersMw, LoadOutboxMw).Get("/", h.HandleShow)
+				r.With(h.RateLimit(RateLimitProfiles), h.CSRF, AccountListingModelMw, AccountFiltersMw, LoadOutboxMw).Get("/t/{tag}", h.HandleShow)
+				r.With(h.RateLimit(RateLimitCollections)).Get("/followers", h.HandleFollowCollection)
+				r.With(h.RateLimit(RateLimitCollections)).Get("/following", h.HandleFollowCollection)
 
 				r.Group(func(r chi.Router) {
 					r.Use(h.ValidateLoggedIn(h.v.RedirectToErrors))
 					r.Get("/follow", h.FollowAccount)
 					r.Get("/follow/{action}", h.HandleFollowRequest)
 					r.With(h.NeedsSessions, h.ValidateLoggedIn(h.v.RedirectToErrors)).Post("/invite", h.HandleCreateInvitation)
+					r.With(h.CSRF).Post("/automute", h.HandleThreadAutoMute)
+					r.With(h.CSRF).Post("/sensitive", h.HandleSensitivePolicy)
+					r.With(h.CSRF).Post("/minscore", h.HandleMinScore)
+					r.With(h.CSRF).Post("/featured", h.HandleFeaturedTags)
+					r.With(h.CSRF).Post("/trust", h.HandleGrantTrustLevel)
+					r.With(h.NeedsSessions, h.CSRF).Route("/2fa", func(r chi.Router) {
+						r.Get("/", h.HandleTOTPSetup)
+						r.Post("/", h.HandleEnableTOTP)
+						r.Post("/disable", h.HandleDisableTOTP)
+					})
 
 					r.With(h.CSRF, MessageUserContentModelMw, MessageFiltersMw, LoadOutboxMw).Route("/message", func(r chi.Router) {
 						r.Get("/", h.HandleShow)
@@ -117,30 +143,68 @@ func (h *handler) Routes(c *config.Configuration) func(chi.Router) {
 
 				r.Route("/{hash}", h.ItemRoutes())
 			})
-			r.Route("/{year:[0-9]{4}}/{month:[0-9]{2}}/{day:[0-9]{2}}/{hash}", h.ItemRoutes())
+			r.With(h.ReadAccess).Route("/{year:[0-9]{4}}/{month:[0-9]{2}}/{day:[0-9]{2}}/{hash}", h.ItemRoutes())
 
 			// @todo(marius) :link_generation:
 			r.Get("/i/{hash}", h.HandleItemRedirect)
 
 			r.With(h.NeedsSessions).Get("/logout", h.HandleLogout)
 
-			r.With(ListingModelMw).Group(func(r chi.Router) {
+			// NOTE(marius): the listings render the forms for the item actions, which need the CSRF token
+			r.With(h.ReadAccess, h.CSRF, ListingModelMw).Group(func(r chi.Router) {
 				// @todo(marius) :link_generation:
-				r.With(DefaultFilters, LoadServiceInboxMw, SortByScore).Get("/", h.HandleShow)
-				r.With(DomainFiltersMw, LoadServiceInboxMw, middleware.StripSlashes, SortByDate).Get("/d", h.HandleShow)
-				r.With(DomainFiltersMw, LoadServiceInboxMw, SortByDate).Get("/d/{domain}", h.HandleShow)
-				r.With(TagFiltersMw, LoadServiceInboxMw, ModerationListing, SortByDate).Get("/t/{tag}", h.HandleShow)
-				r.With(SelfFiltersMw(h.storage.fedbox.Service().ID), LoadServiceInboxMw, SortByScore).Get("/self", h.HandleShow)
-				r.With(FederatedFiltersMw(h.storage.fedbox.Service().ID), LoadServiceInboxMw, SortByScore).Get("/federated", h.HandleShow)
-				r.With(h.NeedsSessions, FollowedFiltersMw, h.ValidateLoggedIn(h.v.RedirectToErrors), LoadInboxMw, SortByDate).
+				r.With(h.RateLimit(RateLimitFeeds), DefaultFilters, LoadServiceInboxMw, h.CollapseCrosspostsMw, SortByScore).Get("/", h.HandleShow)
+				r.With(h.RateLimit(RateLimitFeeds), DefaultFilters, LoadServiceInboxMw, h.CollapseCrosspostsMw, SortByDate).Get("/new", h.HandleShow)
+				r.With(h.RateLimit(RateLimitFeeds), DefaultFilters, LoadServiceInboxMw, h.CollapseCrosspostsMw, SortByUpdated).Get("/active", h.HandleShow)
+				r.With(h.RateLimit(RateLimitFeeds), CommentsFiltersMw, LoadServiceInboxMw, SortByDate).Get("/comments", h.HandleShow)
+				r.With(h.RateLimit(RateLimitFeeds), DomainFiltersMw, LoadServiceInboxMw, h.CollapseCrosspostsMw, middleware.StripSlashes, SortByDate).Get("/d", h.HandleShow)
+				r.With(h.RateLimit(RateLimitFeeds), DomainFiltersMw, LoadServiceInboxMw, SortByDate).Get("/d/{domain}", h.HandleShow)
+				r.With(h.RateLimit(RateLimitFeeds), TagFiltersMw, LoadServiceInboxMw, ModerationListing, SortByDate).Get("/t/{tag}", h.HandleShow)
+				r.With(h.RateLimit(RateLimitFeeds), SelfFiltersMw(h.storage.fedbox.Service().ID), LoadServiceInboxMw, h.CollapseCrosspostsMw, SortByScore).Get("/self", h.HandleShow)
+				r.With(h.RateLimit(RateLimitFeeds), FederatedFiltersMw(h.storage.fedbox.Service().ID), LoadServiceInboxMw, h.CollapseCrosspostsMw, SortByScore).Get("/federated", h.HandleShow)
+				r.With(h.RateLimit(RateLimitFeeds), h.NeedsSessions, FollowedFiltersMw, h.ValidateLoggedIn(h.v.RedirectToErrors), LoadInboxMw, SortByDate).
 					Get("/followed", h.HandleShow)
-				r.With(ModelMw(&listingModel{tpl: "moderation", sortFn: ByDate}), ModerationFiltersMw, LoadServiceWithSelfAuthInboxMw, ModerationListing).
+				r.With(h.RateLimit(RateLimitFeeds), ModelMw(&listingModel{tpl: "moderation", sortFn: ByDate}), ModerationFiltersMw, LoadServiceWithSelfAuthInboxMw, ModerationListing).
 					Get("/moderation", h.HandleShow)
-				r.With(ModelMw(&listingModel{tpl: "listing", sortFn: ByDate}), ActorsFiltersMw, LoadServiceInboxMw, ThreadedListingMw).
+				r.With(h.RateLimit(RateLimitCollections), ModelMw(&listingModel{tpl: "listing", sortFn: ByDate}), ActorsFiltersMw, LoadServiceInboxMw, ThreadedListingMw).
 					Get("/~", h.HandleShow)
+				recentAccountsFn := func() (bool, string) {
+					return c.RecentAccountsListing, "The listing of the newest accounts is disabled"
+				}
+				r.With(h.RateLimit(RateLimitCollections), h.v.FailWithMessage(recentAccountsFn), ModelMw(&listingModel{tpl: "listing", sortFn: ByDate}), LoadRecentAccountsMw).
+					Get("/newcomers", h.HandleShow)
+				exploreFn := func() (bool, string) {
+					return c.ExploreFeed, "The explore feed is disabled"
+				}
+				r.With(h.RateLimit(RateLimitFeeds), h.v.FailWithMessage(exploreFn), h.NeedsSessions, h.ValidateLoggedIn(h.v.RedirectToErrors), ModelMw(&listingModel{tpl: "listing", sortFn: ByDate}), LoadExploreMw).
+					Get("/explore", h.HandleShow)
 			})
 
 			r.Get("/about", h.HandleAbout)
+			r.With(h.CORS, h.ReadAccess, h.RateLimit(RateLimitCollections)).Get("/peers", h.HandlePeers)
+			r.With(h.CORS).Options("/peers", h.HandlePeers)
+			r.With(h.CORS, h.ReadAccess).Get("/resolve", h.HandleResolve)
+			r.With(h.CORS).Options("/resolve", h.HandleResolve)
+			r.Get("/proxy", h.HandleImageProxy)
+			r.Route("/emojis", func(r chi.Router) {
+				r.With(h.CORS).Get("/", h.HandleListEmoji)
+				r.With(h.CORS).Options("/", h.HandleListEmoji)
+				// NOTE(marius): the handlers check for the moderators themselves, so they can reply with JSON errors
+				r.With(h.CSRF).Post("/", h.HandleAddEmoji)
+				r.With(h.CSRF).Delete("/{shortcode}", h.HandleRemoveEmoji)
+			})
+			r.With(h.CSRF, h.ValidateLoggedIn(h.v.RedirectToErrors)).Post("/announcements/{hash}/dismiss", h.HandleDismissAnnouncement)
+			r.With(h.CSRF).Route("/notifications", func(r chi.Router) {
+				// NOTE(marius): the handlers check for the logged account themselves, so they can reply with JSON errors
+				r.Get("/", h.HandleListNotifications)
+				r.Post("/read", h.HandleMarkNotificationsRead)
+				r.Post("/{hash}/read", h.HandleMarkNotificationsRead)
+			})
+			r.With(h.CSRF).Route("/moderation/reports", func(r chi.Router) {
+				// NOTE(marius): the handlers check for the moderators themselves, so they can reply with JSON errors
+				r.Get("/", h.HandleListReports)
+				r.Post("/{hash}", h.HandleResolveReport)
+			})
 			r.Route("/auth", func(r chi.Router) {
 				r.Use(h.NeedsSessions)
 				r.Get("/{provider}/callback", h.HandleCallback)
@@ -155,10 +219,13 @@ func (h *handler) Routes(c *config.Configuration) func(chi.Router) {
 		})
 
 		r.Group(func(r chi.Router) {
-			r.Get("/ns", assets.ServeStatic(filepath.Join(assetsDir, "/ns.json")))
+			r.With(h.CORS).Get("/ns", assets.ServeStatic(filepath.Join(assetsDir, "/ns.json")))
+			r.With(h.CORS).Options("/ns", assets.ServeStatic(filepath.Join(assetsDir, "/ns.json")))
 			r.Get("/favicon.ico", assets.ServeStatic(filepath.Join(assetsDir, "/favicon.ico")))
 			r.Get("/icons.svg", assets.ServeStatic(filepath.Join(assetsDir, "/icons.svg")))
 			r.Get("/robots.txt", assets.ServeStatic(filepath.Join(assetsDir, "/robots.txt")))
+			r.With(h.CORS).Get("/emoji/{file}", h.HandleEmoji)
+			r.With(h.CORS).Get("/avatar/{hash}", h.HandleIdenticon)
 			r.Get("/css/{path}", assets.ServeAsset(h.v.assets))
 			r.Get("/js/{path}", assets.ServeAsset(h.v.assets))
 		})
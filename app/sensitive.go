@@ -0,0 +1,136 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+)
+
+const (
+	// SensitiveHide removes the sensitive items from the listings
+	SensitiveHide = "hide"
+	// SensitiveCollapse shows the sensitive items with their content collapsed
+	SensitiveCollapse = "collapse"
+	// SensitiveShow shows the sensitive items like all the others
+	SensitiveShow = "show"
+)
+
+// SensitiveIRI is the Href of the Link tag that marks an item as sensitive, it's the ActivityStreams "sensitive" term
+const SensitiveIRI = pub.IRI("https://www.w3.org/ns/activitystreams#sensitive")
+
+// sensitiveLink returns the tag we add to a sensitive object
+func sensitiveLink() *pub.Link {
+	return &pub.Link{
+		Type: pub.LinkType,
+		Href: SensitiveIRI,
+		Name: pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content("sensitive")}},
+	}
+}
+
+// isSensitive returns true if there's a sensitive Link, or a #nsfw hashtag, in the tags
+func isSensitive(tags pub.ItemCollection) bool {
+	for _, t := range tags {
+		var name string
+		if l, ok := t.(*pub.Link); ok {
+			if l.Href.Equals(SensitiveIRI, false) {
+				return true
+			}
+			name = l.Name.First().Value.String()
+		} else {
+			pub.OnObject(t, func(o *pub.Object) error {
+				name = o.Name.First().Value.String()
+				return nil
+			})
+		}
+		if strings.EqualFold(name, "#nsfw") {
+			return true
+		}
+	}
+	return false
+}
+
+func validSensitivePolicy(policy string) bool {
+	return policy == SensitiveHide || policy == SensitiveCollapse || policy == SensitiveShow
+}
+
+// sensitivePreferences has the instance's policy for the sensitive items, for the anonymous viewers and the accounts
+// which didn't choose one. The accounts' policies are saved in their preferences.
+type sensitivePreferences struct {
+	policy string
+}
+
+func newSensitivePreferences(policy string) *sensitivePreferences {
+	if !validSensitivePolicy(policy) {
+		policy = SensitiveCollapse
+	}
+	return &sensitivePreferences{policy: policy}
+}
+
+// For returns the policy of the account, or the instance's one for the anonymous viewers,
+// and the accounts which didn't choose one
+func (s *sensitivePreferences) For(acc *Account) string {
+	if s == nil {
+		return SensitiveCollapse
+	}
+	if policy := accountPreferences(acc).SensitivePolicy; acc.IsLogged() && validSensitivePolicy(policy) {
+		return policy
+	}
+	return s.policy
+}
+
+// sensitivePolicy returns the policy for the sensitive items in the listing: the one in the filters, if there is one,
+// or the viewer's
+func (r *repository) sensitivePolicy(acc *Account, ff ...*Filters) string {
+	for _, f := range ff {
+		if f != nil && validSensitivePolicy(f.Sensitive) {
+			return f.Sensitive
+		}
+	}
+	return r.sensitive.For(acc)
+}
+
+// applySensitivePolicy removes from the list, or collapses, the sensitive items according to the policy
+func applySensitivePolicy(policy string, list RenderableList) {
+	if policy == SensitiveShow {
+		return
+	}
+	for k, ren := range list {
+		it, ok := ren.(*Item)
+		if !ok || !it.Sensitive() {
+			continue
+		}
+		if policy == SensitiveHide {
+			delete(list, k)
+			continue
+		}
+		it.Collapse()
+	}
+}
+
+// filterSensitive applies the viewer's policy for the sensitive items to the loaded listing
+func (r *repository) filterSensitive(acc *Account, list RenderableList, ff ...*Filters) {
+	applySensitivePolicy(r.sensitivePolicy(acc, ff...), list)
+}
+
+// SetSensitivePolicy saves the policy of the account for the sensitive items in its listings
+func (r *repository) SetSensitivePolicy(ctx context.Context, acc *Account, policy string) error {
+	if !validSensitivePolicy(policy) {
+		return errors.NotValidf("invalid sensitive content policy %q", policy)
+	}
+	return r.SavePreferences(ctx, acc, func(p *AccountPreferences) {
+		p.SensitivePolicy = policy
+	})
+}
+
+// HandleSensitivePolicy saves the policy of the logged account for the sensitive items
+func (h *handler) HandleSensitivePolicy(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	if err := h.storage.SetSensitivePolicy(context.TODO(), acc, r.PostFormValue("policy")); err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	h.v.Redirect(w, r, AccountPermaLink(acc), http.StatusFound)
+}
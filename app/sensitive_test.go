@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_applySensitivePolicy(t *testing.T) {
+	ob := &pub.Object{
+		ID:      pub.IRI("https://fedbox.example/objects/" + testObjectHash),
+		Type:    pub.NoteType,
+		Content: pub.NaturalLanguageValues{{Ref: pub.NilLangRef, Value: pub.Content("spoilers")}},
+		Tag:     pub.ItemCollection{sensitiveLink()},
+	}
+	tests := []struct {
+		policy    string
+		kept      bool
+		collapsed bool
+	}{
+		{policy: SensitiveHide, kept: false},
+		{policy: SensitiveCollapse, kept: true, collapsed: true},
+		{policy: SensitiveShow, kept: true, collapsed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			sensitive, other := new(Item), &Item{Hash: HashFromString(testLikeHash), Data: "other"}
+			if err := sensitive.FromActivityPub(ob); err != nil {
+				t.Fatalf("Unable to load the item: %s", err)
+			}
+			if !sensitive.Sensitive() {
+				t.Fatalf("The item with the sensitive tag should be marked as sensitive")
+			}
+			list := make(RenderableList, 0)
+			list.Append(sensitive, other)
+
+			applySensitivePolicy(tt.policy, list)
+			ren, kept := list[sensitive.Hash]
+			if kept != tt.kept {
+				t.Fatalf("The sensitive item kept = %t, expected %t", kept, tt.kept)
+			}
+			if _, ok := list[other.Hash]; !ok || other.Collapsed() {
+				t.Errorf("The items which aren't sensitive should always be shown")
+			}
+			if kept && ren.(*Item).Collapsed() != tt.collapsed {
+				t.Errorf("The sensitive item collapsed = %t, expected %t", ren.(*Item).Collapsed(), tt.collapsed)
+			}
+		})
+	}
+}
+
+func Test_repository_sensitivePolicy(t *testing.T) {
+	r := repository{sensitive: newSensitivePreferences(SensitiveHide)}
+	acc := &Account{Hash: HashFromString(testActorHash), Handle: "johndoe", Metadata: &AccountMetadata{ID: "https://fedbox.example/actors/" + testActorHash}}
+	if p := r.sensitivePolicy(&AnonymousAccount); p != SensitiveHide {
+		t.Errorf("The anonymous viewers should get the instance policy %q, received %q", SensitiveHide, p)
+	}
+	acc.Metadata.Preferences = &AccountPreferences{SensitivePolicy: SensitiveShow}
+	if p := r.sensitivePolicy(acc); p != SensitiveShow {
+		t.Errorf("The account should get its own policy %q, received %q", SensitiveShow, p)
+	}
+	if p := r.sensitivePolicy(acc, &Filters{Sensitive: SensitiveCollapse}); p != SensitiveCollapse {
+		t.Errorf("The feed filter should take precedence, expected %q, received %q", SensitiveCollapse, p)
+	}
+}
+
+func Test_repository_SetSensitivePolicy(t *testing.T) {
+	f := newAccountFedbox()
+	defer f.Close()
+	r := testRepository(f.Server)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(f.URL), Type: pub.ServiceType}
+	r.sensitive = newSensitivePreferences(SensitiveCollapse)
+
+	acc := testVote(f.Server, 1).SubmittedBy
+	if err := r.SetSensitivePolicy(context.Background(), acc, "blur"); err == nil {
+		t.Errorf("Expected an error for an invalid policy")
+	}
+	if err := r.SetSensitivePolicy(context.Background(), acc, SensitiveHide); err != nil {
+		t.Fatalf("Unable to save the policy: %s", err)
+	}
+	if p := r.sensitivePolicy(f.storedAccount(t, r)); p != SensitiveHide {
+		t.Errorf("The policy should be saved with the account, expected %q, received %q", SensitiveHide, p)
+	}
+}
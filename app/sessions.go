@@ -23,8 +23,9 @@ const (
 )
 
 type flash struct {
-	Type flashType
-	Msg  string
+	Type  flashType
+	Msg   string
+	Field string
 }
 
 type sess struct {
@@ -87,23 +88,51 @@ func hideSessionKeys(keys ...[]byte) []string {
 	return hidden
 }
 
+// cookieSameSite returns the SameSite mode for the SESSION_COOKIE_SAME_SITE value.
+// When it's not set we default to Strict in production and to Lax otherwise.
+func cookieSameSite(s string, prod bool) http.SameSite {
+	switch strings.ToLower(s) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	case "lax":
+		return http.SameSiteLaxMode
+	}
+	if prod {
+		return http.SameSiteStrictMode
+	}
+	return http.SameSiteLaxMode
+}
+
+// setCookieOptions applies the session cookie settings from the configuration
+func setCookieOptions(o *sessions.Options, c appConfig) {
+	o.Path = c.CookiePath
+	if len(o.Path) == 0 {
+		o.Path = "/"
+	}
+	o.Domain = c.CookieDomain
+	o.HttpOnly = c.CookieHTTPOnly
+	o.Secure = c.CookieSecure
+	o.SameSite = cookieSameSite(c.CookieSameSite, c.Env.IsProd())
+	if o.SameSite == http.SameSiteNoneMode {
+		// NOTE(marius): the browsers reject the SameSite=None cookies which are not Secure
+		o.Secure = true
+	}
+}
+
 func initCookieSession(c appConfig, infoFn, errFn CtxLogFn) (sessions.Store, error) {
 	ss := sessions.NewCookieStore(c.SessionKeys...)
-	ss.Options.Path = "/"
-	ss.Options.HttpOnly = true
-	ss.Options.Secure = c.Secure
-	ss.Options.SameSite = http.SameSiteLaxMode
-	ss.Options.Domain = c.HostName
+	setCookieOptions(ss.Options, c)
 
 	infoFn(log.Ctx{
-		"type":   c.SessionsBackend,
-		"env":    c.Env,
-		"keys":   hideSessionKeys(c.SessionKeys...),
-		"domain": c.HostName,
+		"type":     c.SessionsBackend,
+		"env":      c.Env,
+		"keys":     hideSessionKeys(c.SessionKeys...),
+		"domain":   ss.Options.Domain,
+		"secure":   ss.Options.Secure,
+		"sameSite": ss.Options.SameSite,
 	})("Session settings")
-	if c.Env.IsProd() {
-		ss.Options.SameSite = http.SameSiteStrictMode
-	}
 	return ss, nil
 }
 
@@ -134,14 +163,7 @@ func initFileSession(c appConfig, path string, infoFn, errFn CtxLogFn) (sessions
 		"hostname": c.HostName,
 	})("Session settings")
 	ss := sessions.NewFilesystemStore(path, c.SessionKeys...)
-	ss.Options.Path = "/"
-	ss.Options.HttpOnly = true
-	ss.Options.Secure = c.Secure
-	ss.Options.SameSite = http.SameSiteLaxMode
-	if c.Env.IsProd() {
-		ss.Options.Domain = c.HostName
-		ss.Options.SameSite = http.SameSiteStrictMode
-	}
+	setCookieOptions(ss.Options, c)
 	ss.MaxLength(1 << 20)
 	return ss, nil
 }
@@ -191,11 +213,19 @@ func (s *sess) save(w http.ResponseWriter, r *http.Request) error {
 func (s *sess) addFlashMessages(typ flashType, w http.ResponseWriter, r *http.Request, msgs ...string) {
 	ss, _ := s.get(w, r)
 	for _, msg := range msgs {
-		n := flash{typ, msg}
+		n := flash{Type: typ, Msg: msg}
 		ss.AddFlash(n)
 	}
 }
 
+// addFieldFlashMessages saves the error messages of the form fields, to be shown next to them
+func (s *sess) addFieldFlashMessages(w http.ResponseWriter, r *http.Request, fields map[string]string) {
+	ss, _ := s.get(w, r)
+	for field, msg := range fields {
+		ss.AddFlash(flash{Type: Error, Msg: msg, Field: field})
+	}
+}
+
 func (s *sess) loadFlashMessages(w http.ResponseWriter, r *http.Request) (func() []flash, error) {
 	var flashData []flash
 	flashFn := func() []flash { return flashData }
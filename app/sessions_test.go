@@ -0,0 +1,107 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+func Test_sess_LoginCookieAttributes(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     config.Configuration
+		secure   bool
+		httpOnly bool
+		sameSite http.SameSite
+	}{
+		{
+			name:     "defaults",
+			conf:     config.Configuration{CookieSecure: true, CookieHTTPOnly: true},
+			secure:   true,
+			httpOnly: true,
+			sameSite: http.SameSiteLaxMode,
+		},
+		{
+			name:     "production defaults",
+			conf:     config.Configuration{Env: config.PROD, CookieSecure: true, CookieHTTPOnly: true},
+			secure:   true,
+			httpOnly: true,
+			sameSite: http.SameSiteStrictMode,
+		},
+		{
+			name:     "lax in production",
+			conf:     config.Configuration{Env: config.PROD, CookieSecure: true, CookieHTTPOnly: true, CookieSameSite: "lax"},
+			secure:   true,
+			httpOnly: true,
+			sameSite: http.SameSiteLaxMode,
+		},
+		{
+			name:     "strict",
+			conf:     config.Configuration{CookieSecure: true, CookieHTTPOnly: true, CookieSameSite: "strict"},
+			secure:   true,
+			httpOnly: true,
+			sameSite: http.SameSiteStrictMode,
+		},
+		{
+			name:     "none is always secure",
+			conf:     config.Configuration{CookieHTTPOnly: true, CookieSameSite: "none"},
+			secure:   true,
+			httpOnly: true,
+			sameSite: http.SameSiteNoneMode,
+		},
+		{
+			name:     "insecure for development",
+			conf:     config.Configuration{CookieSameSite: "invalid"},
+			sameSite: http.SameSiteLaxMode,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.conf.HostName = "littr.example"
+			tt.conf.CookieDomain = "littr.example"
+			tt.conf.CookiePath = "/"
+			tt.conf.SessionsEnabled = true
+			c := appConfig{
+				Configuration:   tt.conf,
+				SessionsBackend: sessionsCookieBackend,
+				SessionKeys:     [][]byte{[]byte("0123456789abcdef0123456789abcdef"), []byte("fedcba9876543210fedcba9876543210")},
+			}
+			s, err := initSession(c, defaultCtxLogFn, defaultCtxLogFn)
+			if err != nil {
+				t.Fatalf("Unable to initialize the sessions: %s", err)
+			}
+
+			// NOTE(marius): this is what HandleLogin does for a successful login
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/login", nil)
+			ss, err := s.get(w, r)
+			if err != nil {
+				t.Fatalf("Unable to load the session: %s", err)
+			}
+			ss.Values[SessionUserKey] = Account{Hash: HashFromString(testActorHash), Handle: "johndoe"}
+			if err := s.save(w, r); err != nil {
+				t.Fatalf("Unable to save the session: %s", err)
+			}
+
+			cookies := w.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("Expected one cookie to be set, received %d", len(cookies))
+			}
+			cookie := cookies[0]
+			if cookie.Secure != tt.secure {
+				t.Errorf("Cookie Secure = %t, want %t", cookie.Secure, tt.secure)
+			}
+			if cookie.HttpOnly != tt.httpOnly {
+				t.Errorf("Cookie HttpOnly = %t, want %t", cookie.HttpOnly, tt.httpOnly)
+			}
+			if cookie.SameSite != tt.sameSite {
+				t.Errorf("Cookie SameSite = %d, want %d", cookie.SameSite, tt.sameSite)
+			}
+			if cookie.Domain != "littr.example" || cookie.Path != "/" {
+				t.Errorf("Cookie Domain/Path = %s%s, want littr.example/", cookie.Domain, cookie.Path)
+			}
+		})
+	}
+}
@@ -0,0 +1,557 @@
+package app
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ap/client"
+	"github.com/go-ap/errors"
+)
+
+const (
+	// SignatureAlgorithmRSASHA256 is the legacy, date based, signature algorithm
+	SignatureAlgorithmRSASHA256 = "rsa-sha256"
+	// SignatureAlgorithmHS2019 is the algorithm which uses the (created) and (expires) signature parameters
+	SignatureAlgorithmHS2019 = "hs2019"
+
+	defaultSignatureExpiration = 5 * time.Minute
+)
+
+var (
+	legacySignedHeaders = []string{"(request-target)", "host", "date"}
+	hs2019SignedHeaders = []string{"(request-target)", "(created)", "(expires)", "host", "date"}
+)
+
+// signatureParams represents the parameters of a HTTP Signature header
+type signatureParams struct {
+	KeyID     string
+	Algorithm string
+	Headers   []string
+	Signature []byte
+	Created   int64
+	Expires   int64
+}
+
+// parseSignatureParams loads the parameters from the value of a Signature header
+func parseSignatureParams(s string) (signatureParams, error) {
+	p := signatureParams{}
+	s = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), "Signature "))
+	for len(s) > 0 {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return p, errors.Newf("invalid signature parameters")
+		}
+		name := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+
+		var val string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				return p, errors.Newf("invalid signature parameter %s", name)
+			}
+			val = s[1 : end+1]
+			s = s[end+2:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			val = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		s = strings.TrimLeft(s, ", ")
+
+		switch name {
+		case "keyid":
+			p.KeyID = val
+		case "algorithm":
+			p.Algorithm = strings.ToLower(val)
+		case "headers":
+			p.Headers = strings.Fields(strings.ToLower(val))
+		case "signature":
+			sig, err := base64.StdEncoding.DecodeString(val)
+			if err != nil {
+				return p, errors.Annotatef(err, "invalid signature value")
+			}
+			p.Signature = sig
+		case "created":
+			p.Created, _ = strconv.ParseInt(val, 10, 64)
+		case "expires":
+			p.Expires, _ = strconv.ParseInt(val, 10, 64)
+		}
+	}
+	if len(p.KeyID) == 0 || len(p.Signature) == 0 {
+		return p, errors.Newf("missing signature parameters")
+	}
+	if len(p.Headers) == 0 {
+		// NOTE(marius): as per the draft RFC, the default is to sign only the date
+		p.Headers = []string{"date"}
+	}
+	return p, nil
+}
+
+// String returns the value for the Signature header
+func (p signatureParams) String() string {
+	s := strings.Builder{}
+	fmt.Fprintf(&s, `keyId="%s",algorithm="%s"`, p.KeyID, p.Algorithm)
+	if p.Created > 0 {
+		fmt.Fprintf(&s, `,created=%d`, p.Created)
+	}
+	if p.Expires > 0 {
+		fmt.Fprintf(&s, `,expires=%d`, p.Expires)
+	}
+	fmt.Fprintf(&s, `,headers="%s",signature="%s"`, strings.Join(p.Headers, " "), base64.StdEncoding.EncodeToString(p.Signature))
+	return s.String()
+}
+
+// signingString builds the string that gets signed from the request and the signature parameters
+func signingString(req *http.Request, p signatureParams) (string, error) {
+	lines := make([]string, 0, len(p.Headers))
+	for _, h := range p.Headers {
+		var val string
+		switch h {
+		case "(request-target)":
+			val = fmt.Sprintf("%s %s", strings.ToLower(req.Method), req.URL.RequestURI())
+		case "(created)":
+			if p.Created == 0 {
+				return "", errors.Newf("missing created signature parameter")
+			}
+			val = strconv.FormatInt(p.Created, 10)
+		case "(expires)":
+			if p.Expires == 0 {
+				return "", errors.Newf("missing expires signature parameter")
+			}
+			val = strconv.FormatInt(p.Expires, 10)
+		case "host":
+			val = req.Host
+			if len(val) == 0 {
+				val = req.URL.Host
+			}
+		default:
+			values := req.Header.Values(h)
+			if len(values) == 0 {
+				return "", errors.Newf("missing signed header %s", h)
+			}
+			val = strings.Join(values, ", ")
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", h, val))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// httpSigner signs requests using either the legacy date based scheme or the hs2019 one
+type httpSigner struct {
+	keyID     string
+	key       crypto.PrivateKey
+	algorithm string
+	expiresIn time.Duration
+	// digest adds the Digest header of the request body to the signed headers
+	digest bool
+}
+
+// setDigest adds the SHA-256 Digest header of the request's body
+func setDigest(req *http.Request) error {
+	var body []byte
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return errors.Annotatef(err, "unable to read the request body")
+		}
+		body, _ = ioutil.ReadAll(rc)
+		rc.Close()
+	} else {
+		body, req.Body = readBody(req.Body)
+	}
+	sum := sha256.Sum256(body)
+	req.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]))
+	return nil
+}
+
+// signString signs the SHA256 digest of s with the private key
+func signString(key crypto.PrivateKey, s string) ([]byte, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Newf("unsupported private key type %T", key)
+	}
+	digest := sha256.Sum256([]byte(s))
+	return signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// Sign adds the Signature header to the request
+func (s httpSigner) Sign(req *http.Request) error {
+	now := time.Now().UTC()
+	if len(req.Header.Get("Date")) == 0 {
+		req.Header.Set("Date", now.Format(http.TimeFormat))
+	}
+	p := signatureParams{
+		KeyID:     s.keyID,
+		Algorithm: s.algorithm,
+		Headers:   legacySignedHeaders,
+	}
+	if s.algorithm == SignatureAlgorithmHS2019 {
+		exp := s.expiresIn
+		if exp <= 0 {
+			exp = defaultSignatureExpiration
+		}
+		p.Headers = hs2019SignedHeaders
+		p.Created = now.Unix()
+		p.Expires = now.Add(exp).Unix()
+	}
+	if s.digest {
+		if err := setDigest(req); err != nil {
+			return err
+		}
+		p.Headers = append(append(make([]string, 0, len(p.Headers)+1), p.Headers...), "digest")
+	}
+	str, err := signingString(req, p)
+	if err != nil {
+		return err
+	}
+	if p.Signature, err = signString(s.key, str); err != nil {
+		return errors.Annotatef(err, "unable to sign request")
+	}
+	req.Header.Set("Signature", p.String())
+	return nil
+}
+
+// signatureVerifier checks the HTTP signatures of the inbound requests
+type signatureVerifier struct {
+	maxSkew       time.Duration
+	canonicalHost string
+	now           func() time.Time
+}
+
+// DefaultMaxClockSkew is the default for how far the Date of a signed request can be from our clock
+const DefaultMaxClockSkew = 5 * time.Minute
+
+var defaultSignatureVerifier = signatureVerifier{maxSkew: DefaultMaxClockSkew}
+
+// VerifySignature checks the HTTP signature of the request against the public key of its signer.
+// It supports both the legacy date based signatures and the hs2019 ones, for which the (expires)
+// value must not be in the past.
+func VerifySignature(req *http.Request, key crypto.PublicKey) error {
+	v := defaultSignatureVerifier
+	if Instance.Conf != nil {
+		v.canonicalHost = Instance.Conf.CanonicalHost
+	}
+	return v.Verify(req, key)
+}
+
+func (v signatureVerifier) clock() time.Time {
+	if v.now != nil {
+		return v.now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// signsHeader returns true if the header is among the ones the signature covers
+func (p signatureParams) signsHeader(h string) bool {
+	for _, hh := range p.Headers {
+		if hh == h {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDate validates that the signature covers the request's Date header, or its own (created) value, and that
+// they are within the accepted clock skew, so captured signed requests can't be replayed later.
+// NOTE(marius): replays inside the skew window are caught by fedbox refusing activities with known IDs.
+func (v signatureVerifier) checkDate(req *http.Request, p signatureParams, now time.Time) error {
+	skew := v.maxSkew
+	if skew <= 0 {
+		skew = DefaultMaxClockSkew
+	}
+	signsDate := p.signsHeader("date")
+	signsCreated := p.signsHeader("(created)")
+	if !signsDate && !signsCreated {
+		return errors.Unauthorizedf("HTTP signature doesn't cover the Date header or the (created) value")
+	}
+	if p.Expires > 0 && now.Unix() > p.Expires {
+		return errors.Unauthorizedf("HTTP signature has expired")
+	}
+	if signsCreated {
+		if p.Created <= 0 {
+			return errors.Unauthorizedf("missing HTTP signature created value")
+		}
+		created := time.Unix(p.Created, 0)
+		if created.Before(now.Add(-skew)) {
+			return errors.Unauthorizedf("HTTP signature was created too long ago")
+		}
+		if created.After(now.Add(skew)) {
+			return errors.Unauthorizedf("HTTP signature was created in the future")
+		}
+	}
+	if !signsDate {
+		return nil
+	}
+	date := req.Header.Get("Date")
+	if len(date) == 0 {
+		return errors.Unauthorizedf("missing Date header")
+	}
+	d, err := http.ParseTime(date)
+	if err != nil {
+		return errors.NewUnauthorized(err, "invalid Date header")
+	}
+	if d.Before(now.Add(-skew)) {
+		return errors.Unauthorizedf("request Date is too old")
+	}
+	if d.After(now.Add(skew)) {
+		return errors.Unauthorizedf("request Date is in the future")
+	}
+	return nil
+}
+
+// Verify checks the HTTP signature of the request against the public key of its signer.
+func (v signatureVerifier) Verify(req *http.Request, key crypto.PublicKey) error {
+	sig := req.Header.Get("Signature")
+	if auth := req.Header.Get("Authorization"); len(sig) == 0 && strings.HasPrefix(auth, "Signature ") {
+		sig = auth
+	}
+	if len(sig) == 0 {
+		return errors.Unauthorizedf("missing HTTP signature")
+	}
+	p, err := parseSignatureParams(sig)
+	if err != nil {
+		return errors.NewUnauthorized(err, "invalid HTTP signature")
+	}
+	if err := v.checkDate(req, p, v.clock()); err != nil {
+		return err
+	}
+	str, err := signingString(req, p)
+	if err != nil {
+		return errors.NewUnauthorized(err, "invalid HTTP signature")
+	}
+	err = verifySigningString(str, p, key)
+	if err != nil && v.canonicalHost != "" && !strings.EqualFold(req.Host, v.canonicalHost) {
+		// NOTE(marius): the request reached us on another host, through a proxy, but it was signed for the canonical one
+		c := req.Clone(req.Context())
+		c.Host = v.canonicalHost
+		if str, cerr := signingString(c, p); cerr == nil && verifySigningString(str, p, key) == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// verifySigningString checks the signature in p of the signing string str against the public key
+func verifySigningString(str string, p signatureParams, key crypto.PublicKey) error {
+	digest := sha256.Sum256([]byte(str))
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if p.Algorithm != "" && p.Algorithm != SignatureAlgorithmRSASHA256 && p.Algorithm != SignatureAlgorithmHS2019 {
+			return errors.Unauthorizedf("unsupported signature algorithm %s", p.Algorithm)
+		}
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], p.Signature); err != nil {
+			return errors.NewUnauthorized(err, "invalid HTTP signature")
+		}
+	case *ecdsa.PublicKey:
+		if p.Algorithm != "" && p.Algorithm != "ecdsa-sha256" && p.Algorithm != SignatureAlgorithmHS2019 {
+			return errors.Unauthorizedf("unsupported signature algorithm %s", p.Algorithm)
+		}
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(p.Signature, &rs); err != nil {
+			return errors.NewUnauthorized(err, "invalid HTTP signature")
+		}
+		if !ecdsa.Verify(k, digest[:], rs.R, rs.S) {
+			return errors.Unauthorizedf("invalid HTTP signature")
+		}
+	default:
+		return errors.Unauthorizedf("unsupported public key type %T", key)
+	}
+	return nil
+}
+
+// DefaultSignatureSchemeTTL is how long we keep using the signature scheme we learned for a remote server,
+// before probing it again
+const DefaultSignatureSchemeTTL = 24 * time.Hour
+
+// peerSignatureScheme is how a remote server expects the requests we send to it to be signed
+type peerSignatureScheme struct {
+	algorithm string
+	digest    bool
+	// confirmed is set when the server accepted a request signed with the algorithm
+	confirmed bool
+	// rejected are the algorithms the server refused our requests for, since the last accepted one
+	rejected map[string]bool
+	updated  time.Time
+}
+
+// signatureSchemes holds the signature schemes the remote servers we talked to advertised or accepted
+type signatureSchemes struct {
+	m   sync.RWMutex
+	ttl time.Duration
+	s   map[string]peerSignatureScheme
+}
+
+func newSignatureSchemes(ttl time.Duration) *signatureSchemes {
+	return &signatureSchemes{ttl: ttl, s: make(map[string]peerSignatureScheme)}
+}
+
+var peerSignatureSchemes = newSignatureSchemes(DefaultSignatureSchemeTTL)
+
+// SetSignatureSchemeTTL sets how long the signature schemes learned for the remote servers are used
+func SetSignatureSchemeTTL(ttl time.Duration) OptionFn {
+	return func(f *fedbox) error {
+		peerSignatureSchemes.m.Lock()
+		defer peerSignatureSchemes.m.Unlock()
+		peerSignatureSchemes.ttl = ttl
+		return nil
+	}
+}
+
+// get returns the scheme of the host, if it's known and didn't expire. It must be called with the lock held.
+func (s *signatureSchemes) get(host string) (peerSignatureScheme, bool) {
+	sch, ok := s.s[strings.ToLower(host)]
+	if ok && s.ttl > 0 && time.Since(sch.updated) > s.ttl {
+		return peerSignatureScheme{}, false
+	}
+	return sch, ok
+}
+
+// set stores the scheme of the host. It must be called with the lock held.
+func (s *signatureSchemes) set(host string, sch peerSignatureScheme) {
+	sch.updated = time.Now().UTC()
+	s.s[strings.ToLower(host)] = sch
+}
+
+// For returns the signature scheme to use for requests to host, defaulting to the legacy algorithm without digest
+func (s *signatureSchemes) For(host string) peerSignatureScheme {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	if sch, ok := s.get(host); ok && len(sch.algorithm) > 0 {
+		return sch
+	}
+	return peerSignatureScheme{algorithm: SignatureAlgorithmRSASHA256}
+}
+
+// ForHost returns the signature algorithm to use for requests to host, defaulting to the legacy one
+func (s *signatureSchemes) ForHost(host string) string {
+	return s.For(host).algorithm
+}
+
+// Learn stores the signature algorithm the host advertises in its response headers
+func (s *signatureSchemes) Learn(host string, h http.Header) {
+	alg := advertisedSignatureAlgorithm(h)
+	if len(alg) == 0 {
+		return
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	sch, _ := s.get(host)
+	if sch.algorithm != alg {
+		sch.algorithm, sch.confirmed = alg, false
+	}
+	s.set(host, sch)
+}
+
+// Observe updates the scheme of the host from its response to a request we signed: the scheme of an accepted request
+// is kept, and the one of a request refused with a 400 or 401 status is replaced with the other algorithm, or the digest
+// is added, unless the server already accepted it before.
+func (s *signatureSchemes) Observe(req *http.Request, status int, h http.Header, body []byte) {
+	if req == nil {
+		return
+	}
+	host := req.URL.Host
+	s.Learn(host, h)
+
+	sig := req.Header.Get("Signature")
+	if auth := req.Header.Get("Authorization"); len(sig) == 0 && strings.HasPrefix(auth, "Signature ") {
+		sig = auth
+	}
+	if len(sig) == 0 {
+		return
+	}
+	used := SignatureAlgorithmRSASHA256
+	if p, err := parseSignatureParams(sig); err == nil && p.Algorithm == SignatureAlgorithmHS2019 {
+		used = SignatureAlgorithmHS2019
+	}
+	digest := isSignedHeader(req, "digest")
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	sch, _ := s.get(host)
+	switch {
+	case status >= 200 && status < 300:
+		sch = peerSignatureScheme{algorithm: used, digest: digest || sch.digest, confirmed: true}
+	case status == http.StatusBadRequest || status == http.StatusUnauthorized:
+		if !digest && requiresDigest(h, body) {
+			sch.digest = true
+			break
+		}
+		if sch.confirmed && sch.algorithm == used {
+			// NOTE(marius): the server accepted this scheme before, it refused the request for another reason
+			return
+		}
+		if sch.rejected == nil {
+			sch.rejected = make(map[string]bool)
+		}
+		sch.rejected[used] = true
+		other := SignatureAlgorithmHS2019
+		if used == SignatureAlgorithmHS2019 {
+			other = SignatureAlgorithmRSASHA256
+		}
+		if !sch.rejected[other] {
+			sch.algorithm, sch.confirmed = other, false
+		}
+	default:
+		return
+	}
+	s.set(host, sch)
+}
+
+// requiresDigest returns true if the response to a refused request mentions the missing Digest header
+func requiresDigest(h http.Header, body []byte) bool {
+	for _, name := range []string{"Accept-Signature", "WWW-Authenticate"} {
+		for _, v := range h.Values(name) {
+			if strings.Contains(strings.ToLower(v), "digest") {
+				return true
+			}
+		}
+	}
+	return bytes.Contains(bytes.ToLower(body), []byte("digest"))
+}
+
+// advertisedSignatureAlgorithm checks the Accept-Signature and WWW-Authenticate headers for hs2019 support
+func advertisedSignatureAlgorithm(h http.Header) string {
+	for _, name := range []string{"Accept-Signature", "WWW-Authenticate"} {
+		for _, v := range h.Values(name) {
+			v = strings.ToLower(v)
+			if strings.Contains(v, SignatureAlgorithmHS2019) || strings.Contains(v, "(created)") {
+				return SignatureAlgorithmHS2019
+			}
+		}
+	}
+	return ""
+}
+
+// s2sSignFn returns a sign function that uses the signature scheme the remote server advertised, or accepted before,
+// falling back to the legacy date based signatures for older servers.
+func s2sSignFn(keyID string, key crypto.PrivateKey) client.RequestSignFn {
+	legacy := getSigner(keyID, key)
+	return func(req *http.Request) error {
+		if len(req.Header.Get("Date")) == 0 {
+			req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		}
+		sch := peerSignatureSchemes.For(req.URL.Host)
+		if sch.algorithm == SignatureAlgorithmHS2019 || sch.digest {
+			return httpSigner{keyID: keyID, key: key, algorithm: sch.algorithm, digest: sch.digest}.Sign(req)
+		}
+		return legacy.Sign(req)
+	}
+}
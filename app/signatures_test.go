@@ -0,0 +1,355 @@
+package app
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ap/errors"
+)
+
+func testSignedRequest(t *testing.T, s httpSigner) *http.Request {
+	req, _ := http.NewRequest(http.MethodPost, "https://remote.example/actors/jdoe/inbox?page=1", strings.NewReader("{}"))
+	if err := s.Sign(req); err != nil {
+		t.Fatalf("Unable to sign request: %s", err)
+	}
+	return req
+}
+
+func TestVerifySignature(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unable to generate RSA key: %s", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unable to generate ECDSA key: %s", err)
+	}
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	keyID := "https://littr.example/actors/jdoe#main-key"
+	tests := []struct {
+		name    string
+		signer  httpSigner
+		pub     interface{}
+		wantErr bool
+	}{
+		{
+			name:   "legacy rsa-sha256",
+			signer: httpSigner{keyID: keyID, key: rsaKey, algorithm: SignatureAlgorithmRSASHA256},
+			pub:    &rsaKey.PublicKey,
+		},
+		{
+			name:   "hs2019 rsa",
+			signer: httpSigner{keyID: keyID, key: rsaKey, algorithm: SignatureAlgorithmHS2019},
+			pub:    &rsaKey.PublicKey,
+		},
+		{
+			name:   "hs2019 ecdsa",
+			signer: httpSigner{keyID: keyID, key: ecKey, algorithm: SignatureAlgorithmHS2019},
+			pub:    &ecKey.PublicKey,
+		},
+		{
+			name:    "wrong key",
+			signer:  httpSigner{keyID: keyID, key: rsaKey, algorithm: SignatureAlgorithmHS2019},
+			pub:     &otherKey.PublicKey,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := testSignedRequest(t, tt.signer)
+			if err := VerifySignature(req, tt.pub); (err != nil) != tt.wantErr {
+				t.Errorf("VerifySignature() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("hs2019 signature params", func(t *testing.T) {
+		req := testSignedRequest(t, httpSigner{keyID: keyID, key: rsaKey, algorithm: SignatureAlgorithmHS2019})
+		p, err := parseSignatureParams(req.Header.Get("Signature"))
+		if err != nil {
+			t.Fatalf("Unable to parse signature: %s", err)
+		}
+		if p.Algorithm != SignatureAlgorithmHS2019 || p.Created == 0 || p.Expires <= p.Created {
+			t.Errorf("Invalid hs2019 signature parameters %#v", p)
+		}
+		if p.KeyID != keyID {
+			t.Errorf("Invalid key id %q, expected %q", p.KeyID, keyID)
+		}
+	})
+
+	t.Run("tampered request", func(t *testing.T) {
+		req := testSignedRequest(t, httpSigner{keyID: keyID, key: rsaKey, algorithm: SignatureAlgorithmRSASHA256})
+		req.URL.Path = "/actors/other/inbox"
+		if err := VerifySignature(req, &rsaKey.PublicKey); err == nil {
+			t.Errorf("VerifySignature() should fail for a modified request target")
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		req := testSignedRequest(t, httpSigner{keyID: keyID, key: rsaKey, algorithm: SignatureAlgorithmHS2019, expiresIn: time.Second})
+		p, _ := parseSignatureParams(req.Header.Get("Signature"))
+		p.Created = time.Now().Add(-time.Hour).Unix()
+		p.Expires = time.Now().Add(-time.Minute).Unix()
+		// NOTE(marius): we need to sign the request with the expired parameters
+		str, _ := signingString(req, p)
+		p.Signature = testRSASign(t, rsaKey, str)
+		req.Header.Set("Signature", p.String())
+		if err := VerifySignature(req, &rsaKey.PublicKey); err == nil {
+			t.Errorf("VerifySignature() should fail for an expired signature")
+		}
+	})
+}
+
+func Test_advertisedSignatureAlgorithm(t *testing.T) {
+	h := http.Header{}
+	if alg := advertisedSignatureAlgorithm(h); alg != "" {
+		t.Errorf("Invalid algorithm %q for no advertisement", alg)
+	}
+	h.Set("WWW-Authenticate", `Signature realm="remote.example",headers="(request-target) (created) host",algorithm="hs2019"`)
+	if alg := advertisedSignatureAlgorithm(h); alg != SignatureAlgorithmHS2019 {
+		t.Errorf("Invalid algorithm %q, expected %q", alg, SignatureAlgorithmHS2019)
+	}
+
+	schemes := newSignatureSchemes(DefaultSignatureSchemeTTL)
+	schemes.Learn("Remote.example", h)
+	if alg := schemes.ForHost("remote.example"); alg != SignatureAlgorithmHS2019 {
+		t.Errorf("Invalid algorithm %q for peer, expected %q", alg, SignatureAlgorithmHS2019)
+	}
+	if alg := schemes.ForHost("old.example"); alg != SignatureAlgorithmRSASHA256 {
+		t.Errorf("Invalid algorithm %q for unknown peer, expected %q", alg, SignatureAlgorithmRSASHA256)
+	}
+}
+
+func Test_signatureSchemes_FallbackToHS2019(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unable to generate RSA key: %s", err)
+	}
+	old := peerSignatureSchemes
+	peerSignatureSchemes = newSignatureSchemes(DefaultSignatureSchemeTTL)
+	defer func() { peerSignatureSchemes = old }()
+
+	algorithms := make([]string, 0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := parseSignatureParams(r.Header.Get("Signature"))
+		algorithms = append(algorithms, p.Algorithm)
+		if p.Algorithm != SignatureAlgorithmHS2019 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	cl := &http.Client{Transport: &transport{}}
+	sign := s2sSignFn("https://littr.example/actors/jdoe#main-key", key)
+	statuses := make([]int, 0)
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+"/inbox", strings.NewReader("{}"))
+		if err := sign(req); err != nil {
+			t.Fatalf("Unable to sign the request: %s", err)
+		}
+		resp, err := cl.Do(req)
+		if err != nil {
+			t.Fatalf("Unable to deliver the request: %s", err)
+		}
+		resp.Body.Close()
+		statuses = append(statuses, resp.StatusCode)
+	}
+	wantAlgs := []string{SignatureAlgorithmRSASHA256, SignatureAlgorithmHS2019, SignatureAlgorithmHS2019}
+	for i, alg := range algorithms {
+		if alg != wantAlgs[i] {
+			t.Errorf("Delivery %d was signed with %q, expected %q", i, alg, wantAlgs[i])
+		}
+	}
+	if statuses[2] != http.StatusAccepted {
+		t.Errorf("The deliveries after the legacy scheme was rejected should be accepted, received %v", statuses)
+	}
+
+	// NOTE(marius): once the host accepted hs2019, a refusal for another reason doesn't change the scheme
+	req := testSignedRequest(t, httpSigner{keyID: "https://littr.example/actors/jdoe#main-key", key: key, algorithm: SignatureAlgorithmHS2019})
+	req.URL.Host = strings.TrimPrefix(srv.URL, "http://")
+	peerSignatureSchemes.Observe(req, http.StatusUnauthorized, http.Header{}, nil)
+	if alg := peerSignatureSchemes.ForHost(req.URL.Host); alg != SignatureAlgorithmHS2019 {
+		t.Errorf("Invalid algorithm %q after a refusal of the accepted scheme, expected %q", alg, SignatureAlgorithmHS2019)
+	}
+}
+
+func Test_signatureSchemes_Digest(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	schemes := newSignatureSchemes(DefaultSignatureSchemeTTL)
+	req := testSignedRequest(t, httpSigner{keyID: "https://littr.example/actors/jdoe#main-key", key: key, algorithm: SignatureAlgorithmRSASHA256})
+	schemes.Observe(req, http.StatusUnauthorized, http.Header{}, []byte(`{"error":"Mastodon requires the Digest header to be signed when doing a POST request"}`))
+	sch := schemes.For("remote.example")
+	if !sch.digest {
+		t.Errorf("The digest should be required after a refusal mentioning it")
+	}
+	if sch.algorithm != SignatureAlgorithmRSASHA256 {
+		t.Errorf("Invalid algorithm %q after a digest refusal, expected %q", sch.algorithm, SignatureAlgorithmRSASHA256)
+	}
+
+	req = testSignedRequest(t, httpSigner{keyID: "https://littr.example/actors/jdoe#main-key", key: key, algorithm: sch.algorithm, digest: sch.digest})
+	if !isSignedHeader(req, "digest") {
+		t.Errorf("The digest should be signed, received headers %v", signedHeaders(req))
+	}
+	sum := sha256.Sum256([]byte("{}"))
+	if d := req.Header.Get("Digest"); d != "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("Invalid Digest header %q", d)
+	}
+	if err := VerifySignature(req, &key.PublicKey); err != nil {
+		t.Errorf("Unable to verify the signature with digest: %s", err)
+	}
+}
+
+func testRSASign(t *testing.T, key *rsa.PrivateKey, s string) []byte {
+	sig, err := signString(key, s)
+	if err != nil {
+		t.Fatalf("Unable to sign: %s", err)
+	}
+	return sig
+}
+
+func Test_signatureVerifier_ClockSkew(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unable to generate RSA key: %s", err)
+	}
+	now := time.Now().UTC()
+	v := signatureVerifier{maxSkew: 5 * time.Minute, now: func() time.Time { return now }}
+
+	tests := []struct {
+		name    string
+		date    time.Time
+		wantErr bool
+	}{
+		{
+			name: "in window",
+			date: now.Add(-2 * time.Minute),
+		},
+		{
+			name:    "too old",
+			date:    now.Add(-10 * time.Minute),
+			wantErr: true,
+		},
+		{
+			name:    "too far in the future",
+			date:    now.Add(10 * time.Minute),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "https://remote.example/inbox", nil)
+			req.Header.Set("Date", tt.date.Format(http.TimeFormat))
+			s := httpSigner{keyID: "https://littr.example/actors/jdoe#main-key", key: key, algorithm: SignatureAlgorithmRSASHA256}
+			if err := s.Sign(req); err != nil {
+				t.Fatalf("Unable to sign request: %s", err)
+			}
+			err := v.Verify(req, &key.PublicKey)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err != nil && errors.HttpStatus(err) != http.StatusUnauthorized {
+				t.Errorf("Invalid error status %d, expected %d", errors.HttpStatus(err), http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func Test_signatureVerifier_ReplayedSignatures(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unable to generate RSA key: %s", err)
+	}
+	now := time.Now().UTC()
+	v := signatureVerifier{maxSkew: 5 * time.Minute, now: func() time.Time { return now }}
+
+	tests := []struct {
+		name    string
+		headers []string
+		created time.Time
+		wantErr bool
+	}{
+		{
+			name:    "the date is not signed",
+			headers: []string{"(request-target)", "host"},
+			wantErr: true,
+		},
+		{
+			name:    "recent created without expires",
+			headers: []string{"(request-target)", "host", "(created)"},
+			created: now.Add(-2 * time.Minute),
+		},
+		{
+			name:    "old created without expires",
+			headers: []string{"(request-target)", "host", "(created)"},
+			created: now.Add(-time.Hour),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "https://remote.example/inbox", nil)
+			// NOTE(marius): a fresh Date header doesn't help when the signature doesn't cover it
+			req.Header.Set("Date", now.Format(http.TimeFormat))
+			p := signatureParams{
+				KeyID:     "https://littr.example/actors/jdoe#main-key",
+				Algorithm: SignatureAlgorithmHS2019,
+				Headers:   tt.headers,
+			}
+			if !tt.created.IsZero() {
+				p.Created = tt.created.Unix()
+			}
+			str, err := signingString(req, p)
+			if err != nil {
+				t.Fatalf("Unable to build the signing string: %s", err)
+			}
+			if p.Signature, err = signString(key, str); err != nil {
+				t.Fatalf("Unable to sign request: %s", err)
+			}
+			req.Header.Set("Signature", p.String())
+
+			err = v.Verify(req, &key.PublicKey)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err != nil && errors.HttpStatus(err) != http.StatusUnauthorized {
+				t.Errorf("Invalid error status %d, expected %d", errors.HttpStatus(err), http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func Test_signatureVerifier_CanonicalHost(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unable to generate RSA key: %s", err)
+	}
+	req, _ := http.NewRequest(http.MethodPost, "https://littr.example/inbox", strings.NewReader("{}"))
+	s := httpSigner{keyID: "https://remote.example/actors/jdoe#main-key", key: key, algorithm: SignatureAlgorithmHS2019}
+	if err := s.Sign(req); err != nil {
+		t.Fatalf("Unable to sign request: %s", err)
+	}
+	// NOTE(marius): the request reaches us through a proxy for another of the instance's hosts
+	req.Host = "www.littr.example"
+
+	if err := (signatureVerifier{}).Verify(req, &key.PublicKey); err == nil {
+		t.Errorf("Verify() should fail for a request signed for another host")
+	}
+	if err := (signatureVerifier{canonicalHost: "littr.example"}).Verify(req, &key.PublicKey); err != nil {
+		t.Errorf("Verify() should accept the signatures for the canonical host: %s", err)
+	}
+	if err := (signatureVerifier{canonicalHost: "other.example"}).Verify(req, &key.PublicKey); err == nil {
+		t.Errorf("Verify() should fail for a request signed for a host that is not the canonical one")
+	}
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"context"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+// ItemRepository loads and saves the items
+type ItemRepository interface {
+	ItemIRI(hash string) pub.IRI
+	LoadItem(ctx context.Context, iri pub.IRI) (Item, error)
+	SaveItem(ctx context.Context, it Item) (Item, error)
+	SaveItems(ctx context.Context, items []Item) ([]Item, []error)
+	RepairItem(ctx context.Context, it *Item) (ItemRepair, error)
+	RepairAllScores(ctx context.Context, items ItemCollection) ([]ItemRepair, error)
+}
+
+// VoteRepository loads and saves the votes on the items
+type VoteRepository interface {
+	LoadVotes(ctx context.Context, actor pub.Item, vf VotesFilter) (VotesPage, error)
+	CurrentAccountVotes(ctx context.Context, viewer Account, items ...Item) (map[Hash]Vote, error)
+	SaveVote(ctx context.Context, v Vote) (Vote, error)
+}
+
+// AccountRepository loads and saves the accounts
+type AccountRepository interface {
+	LoadAccount(ctx context.Context, iri pub.IRI) (*Account, error)
+	LoadAccounts(ctx context.Context, ff ...*Filters) (AccountCollection, Pagination, error)
+	LoadAccountDetails(ctx context.Context, acc *Account) error
+	SaveAccount(ctx context.Context, a Account) (Account, error)
+}
+
+// Repository is the storage the frontend handlers depend on, fedbox being the only one we have for now
+type Repository interface {
+	ItemRepository
+	VoteRepository
+	AccountRepository
+}
+
+var (
+	_ ItemRepository    = new(repository)
+	_ VoteRepository    = new(repository)
+	_ AccountRepository = new(repository)
+	_ Repository        = new(repository)
+)
+
+// ItemIRI returns the IRI of the local item with hash
+func (r *repository) ItemIRI(hash string) pub.IRI {
+	return objects.IRI(r.fedbox.Service()).AddPath(hash)
+}
+
+// ContextItemRepository returns the repository for the items loaded by the Repository middleware
+func ContextItemRepository(ctx context.Context) ItemRepository {
+	r, _ := ctx.Value(RepositoryCtxtKey).(ItemRepository)
+	return r
+}
+
+// ContextVoteRepository returns the repository for the votes loaded by the Repository middleware
+func ContextVoteRepository(ctx context.Context) VoteRepository {
+	r, _ := ctx.Value(RepositoryCtxtKey).(VoteRepository)
+	return r
+}
+
+// ContextAccountRepository returns the repository for the accounts loaded by the Repository middleware
+func ContextAccountRepository(ctx context.Context) AccountRepository {
+	r, _ := ctx.Value(RepositoryCtxtKey).(AccountRepository)
+	return r
+}
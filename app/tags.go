@@ -9,11 +9,19 @@ import (
 	"time"
 
 	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
 )
 
 const TagMention = "mention"
 const TagTag = "tag"
 
+const (
+	// TagsLimitReject refuses the items with more tags than the maximum
+	TagsLimitReject = "reject"
+	// TagsLimitTruncate keeps the first tags of the items with more tags than the maximum
+	TagsLimitTruncate = "truncate"
+)
+
 type Tag struct {
 	Hash        Hash          `json:"hash"`
 	Type        string        `json:"-"`
@@ -127,6 +135,11 @@ func replaceTags(mime string, r HasContent) string {
 	if len(data) == 0 {
 		return ""
 	}
+	if e, ok := r.(HasEmoji); ok {
+		data = replaceEmoji(data, e.Emoji())
+	} else {
+		data = replaceEmoji(data, nil)
+	}
 	if len(r.Tags())+len(r.Mentions()) == 0 {
 		return string(data)
 	}
@@ -151,11 +164,19 @@ func replaceTags(mime string, r HasContent) string {
 		replaces[lbl] = mimeTypeTagReplace(mime, t)
 	}
 	for to, repl := range replaces {
-		data = bytes.ReplaceAll(data, []byte(to), []byte(repl))
+		// NOTE(marius): the tags are saved lowercase, so we match them in the content regardless of their case
+		data = regexp.MustCompile("(?i)"+regexp.QuoteMeta(to)).ReplaceAllLiteral(data, []byte(repl))
 	}
 	return string(data)
 }
 
+// tagsRegexp matches the bare @mentions, ~mentions and #tags, they need to start a word,
+// so the email addresses and the URL fragments are left alone
+var tagsRegexp = regexp.MustCompile(`(?:\A|\s)((?:[~@]\w+)(?:@[\w-]+.?\w*)?|(?:#\w[\w-]+))`)
+
+// codeRegexp matches the markdown code blocks and spans, and the HTML code elements, we don't look for tags in them
+var codeRegexp = regexp.MustCompile("(?is)```.*?```|`[^`\n]*`|<pre[^>]*>.*?</pre>|<code[^>]*>.*?</code>")
+
 func loadTags(data string) (TagCollection, TagCollection) {
 	if !strings.ContainsAny(data, "#@~") {
 		return nil, nil
@@ -163,8 +184,8 @@ func loadTags(data string) (TagCollection, TagCollection) {
 	tags := make(TagCollection, 0)
 	mentions := make(TagCollection, 0)
 
-	r := regexp.MustCompile(`(?:\A|\s)((?:[~@]\w+)(?:@[\w-]+.?\w*)?|(?:#[\w-]{3,}))`)
-	matches := r.FindAllSubmatch([]byte(data), -1)
+	data = codeRegexp.ReplaceAllString(data, " ")
+	matches := tagsRegexp.FindAllSubmatch([]byte(data), -1)
 
 	for _, sub := range matches {
 		t := getTagFromBytes(sub[1])
@@ -203,3 +224,67 @@ func getTagFromBytes(d []byte) Tag {
 	}
 	return t
 }
+
+// autoLinkTags adds to the item's metadata the bare #tags and @mentions from its content, so they get linked
+// when rendering it, and the mentioned accounts get addressed
+func autoLinkTags(it *Item) {
+	if it == nil || len(it.Data) == 0 || it.IsLink() {
+		return
+	}
+	tags, mentions := loadTags(it.Data)
+	if len(tags)+len(mentions) == 0 {
+		return
+	}
+	if it.Metadata == nil {
+		it.Metadata = &ItemMetadata{}
+	}
+	for _, t := range tags {
+		if !it.Metadata.Tags.Contains(t) {
+			it.Metadata.Tags = append(it.Metadata.Tags, t)
+		}
+	}
+	for _, t := range mentions {
+		if !it.Metadata.Mentions.Contains(t) {
+			it.Metadata.Mentions = append(it.Metadata.Mentions, t)
+		}
+	}
+}
+
+// normalizeTags lowercases the names of the tags and strips their '#' prefix, then it removes the duplicates
+func normalizeTags(tags TagCollection) TagCollection {
+	if len(tags) == 0 {
+		return tags
+	}
+	result := make(TagCollection, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		name := strings.ToLower(strings.TrimLeft(t.Name, "#"))
+		if len(name) == 0 || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if i := strings.LastIndex(t.URL, "/t/"); i >= 0 && strings.EqualFold(t.URL[i+3:], name) {
+			t.URL = t.URL[:i+3] + name
+		}
+		t.Name = name
+		result = append(result, t)
+	}
+	return result
+}
+
+// limitTags normalizes the tags of the item, and applies the maximum number of tags per item,
+// refusing the item, or dropping the extra tags, depending on the policy
+func (r *repository) limitTags(it *Item) error {
+	if !it.HasMetadata() {
+		return nil
+	}
+	it.Metadata.Tags = normalizeTags(it.Metadata.Tags)
+	if r.maxTags <= 0 || len(it.Metadata.Tags) <= r.maxTags {
+		return nil
+	}
+	if r.tagsLimitPolicy != TagsLimitTruncate {
+		return errors.BadRequestf("items can not have more than %d tags", r.maxTags)
+	}
+	it.Metadata.Tags = it.Metadata.Tags[:r.maxTags]
+	return nil
+}
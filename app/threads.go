@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+)
+
+const (
+	// ThreadDepthReject refuses the replies nested deeper than the maximum thread depth
+	ThreadDepthReject = "reject"
+	// ThreadDepthReparent saves the replies nested too deep as replies to their deepest allowed ancestor
+	ThreadDepthReparent = "reparent"
+
+	// maxThreadWalk bounds the number of ancestors we load when checking the depth of a reply
+	maxThreadWalk = 256
+)
+
+// firstInReplyTo returns the IRI of the item the object is a direct reply to
+func firstInReplyTo(it pub.Item) pub.IRI {
+	if it == nil {
+		return ""
+	}
+	if repl, ok := it.(pub.ItemCollection); ok {
+		if first := repl.First(); first != nil {
+			return first.GetLink()
+		}
+		return ""
+	}
+	return it.GetLink()
+}
+
+// threadAncestors returns the chain of items the object at iri is replying to, starting with itself
+// and ending with the top level item of the thread.
+func (r *repository) threadAncestors(ctx context.Context, iri pub.IRI, limit int) pub.IRIs {
+	chain := make(pub.IRIs, 0)
+	for len(iri) > 0 && !chain.Contains(iri) && len(chain) < limit {
+		chain = append(chain, iri)
+		ob, err := r.fedbox.Object(ctx, iri)
+		if err != nil || ob == nil {
+			break
+		}
+		iri = firstInReplyTo(ob.InReplyTo)
+	}
+	return chain
+}
+
+// limitThreadDepth checks the nesting level of a reply against the maximum thread depth,
+// and, depending on the policy, rejects it or moves it under its deepest allowed ancestor.
+func (r *repository) limitThreadDepth(ctx context.Context, it *Item) error {
+	if r.maxThreadDepth <= 0 || it.Parent == nil {
+		return nil
+	}
+	if _, ok := BuildIDFromItem(*it); ok {
+		// NOTE(marius): we check only the new replies, the existing ones keep their place when edited
+		return nil
+	}
+	par, ok := BuildIDFromItem(*it.Parent)
+	if !ok {
+		return nil
+	}
+	// NOTE(marius): the reply is one level deeper than the number of its ancestors
+	chain := r.threadAncestors(ctx, par, maxThreadWalk)
+	if len(chain) <= r.maxThreadDepth {
+		return nil
+	}
+	if r.threadDepthPolicy != ThreadDepthReparent || len(chain) >= maxThreadWalk {
+		return errors.BadRequestf("replies can not be nested deeper than %d levels", r.maxThreadDepth)
+	}
+	anc := chain[len(chain)-r.maxThreadDepth]
+	it.Parent = &Item{Hash: HashFromIRI(anc), Metadata: &ItemMetadata{ID: anc.String()}}
+	return nil
+}
+
+// limitCommentsDepth moves the comments nested deeper than max under their deepest allowed ancestor,
+// so the rendered threads don't go more than max levels deep. A max of 0 disables it.
+func limitCommentsDepth(com ItemPtrCollection, level, max int) ItemPtrCollection {
+	if max <= 0 {
+		return com
+	}
+	visited := make(Hashes, 0)
+	var flatten func(ItemPtrCollection, int) ItemPtrCollection
+	var descendants func(ItemPtrCollection, int) ItemPtrCollection
+
+	descendants = func(com ItemPtrCollection, level int) ItemPtrCollection {
+		res := make(ItemPtrCollection, 0)
+		for _, cur := range com {
+			if cur == nil || visited.Contains(cur.Hash) {
+				continue
+			}
+			visited = append(visited, cur.Hash)
+			cur.Level = uint8(level)
+			children := cur.children
+			cur.children = nil
+			res = append(res, cur)
+			res = append(res, descendants(children, level)...)
+		}
+		return res
+	}
+	flatten = func(com ItemPtrCollection, level int) ItemPtrCollection {
+		res := make(ItemPtrCollection, 0)
+		for _, cur := range com {
+			if cur == nil || visited.Contains(cur.Hash) {
+				continue
+			}
+			visited = append(visited, cur.Hash)
+			cur.Level = uint8(level)
+			res = append(res, cur)
+			if level >= max {
+				res = append(res, descendants(cur.children, level)...)
+				cur.children = nil
+			} else {
+				cur.children = flatten(cur.children, level+1)
+			}
+		}
+		return res
+	}
+	return flatten(com, level)
+}
@@ -0,0 +1,185 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"golang.org/x/oauth2"
+)
+
+var testThreadHashes = map[string]string{
+	"a": "0b1e5a3c-7d2f-4e8a-9c61-3f2a1b4c5d01",
+	"b": "0b1e5a3c-7d2f-4e8a-9c61-3f2a1b4c5d02",
+	"c": "0b1e5a3c-7d2f-4e8a-9c61-3f2a1b4c5d03",
+	"d": "0b1e5a3c-7d2f-4e8a-9c61-3f2a1b4c5d04",
+}
+
+// testThreadServer serves a thread where "c" replies to "b", which replies to the top level item "a"
+func testThreadServer(posted *bool) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			*posted = true
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		parents := map[string]string{"/objects/b": "a", "/objects/c": "b"}
+		switch r.URL.Path {
+		case "/objects/a":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"id":"%s/objects/a","type":"Note"}`, srv.URL))
+		case "/objects/b", "/objects/c":
+			body := fmt.Sprintf(`{"id":"%s%s","type":"Note","inReplyTo":["%s/objects/%s"]}`, srv.URL, r.URL.Path, srv.URL, parents[r.URL.Path])
+			writeActivityJSON(w, http.StatusOK, body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return srv
+}
+
+func testReplyTo(srv *httptest.Server, parent string) Item {
+	author := testVote(srv, 1).SubmittedBy
+	author.Metadata.OAuth.Token = &oauth2.Token{AccessToken: "t0k3n", TokenType: "Bearer"}
+	par := srv.URL + "/objects/" + parent
+	return Item{
+		SubmittedBy: author,
+		Data:        "reply",
+		MimeType:    "text/plain",
+		Parent:      &Item{Hash: HashFromString(testThreadHashes[parent]), Metadata: &ItemMetadata{ID: par}},
+		Metadata:    &ItemMetadata{},
+	}
+}
+
+func Test_repository_SaveItemRejectsDeepReply(t *testing.T) {
+	var posted bool
+	srv := testThreadServer(&posted)
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.maxThreadDepth = 2
+	r.threadDepthPolicy = ThreadDepthReject
+	it := testReplyTo(srv, "c")
+	r.WithAccount(it.SubmittedBy)
+
+	_, err := r.SaveItem(context.Background(), it)
+	if !errors.IsBadRequest(err) {
+		t.Errorf("Expected a bad request error for a reply at depth 3, received: %v", err)
+	}
+	if posted {
+		t.Errorf("The reply beyond the maximum depth should not have been sent to the outbox")
+	}
+}
+
+func Test_repository_limitThreadDepth(t *testing.T) {
+	var posted bool
+	srv := testThreadServer(&posted)
+	defer srv.Close()
+
+	tests := []struct {
+		name    string
+		parent  string
+		policy  string
+		max     int
+		wantPar string
+		wantErr bool
+	}{
+		{name: "disabled", parent: "c", policy: ThreadDepthReject, max: 0, wantPar: "c"},
+		{name: "within limit", parent: "b", policy: ThreadDepthReject, max: 2, wantPar: "b"},
+		{name: "reject", parent: "c", policy: ThreadDepthReject, max: 2, wantErr: true},
+		{name: "reparent", parent: "c", policy: ThreadDepthReparent, max: 2, wantPar: "b"},
+		{name: "reparent to top", parent: "c", policy: ThreadDepthReparent, max: 1, wantPar: "a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRepository(srv)
+			r.maxThreadDepth = tt.max
+			r.threadDepthPolicy = tt.policy
+			it := testReplyTo(srv, tt.parent)
+			err := r.limitThreadDepth(context.Background(), &it)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("limitThreadDepth() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !strings.HasSuffix(it.Parent.Metadata.ID, "/objects/"+tt.wantPar) {
+				t.Errorf("limitThreadDepth() parent = %s, want %s", it.Parent.Metadata.ID, tt.wantPar)
+			}
+		})
+	}
+}
+
+func Test_limitCommentsDepth(t *testing.T) {
+	a := &Item{Hash: HashFromString(testThreadHashes["a"])}
+	b := &Item{Hash: HashFromString(testThreadHashes["b"]), Parent: a}
+	c := &Item{Hash: HashFromString(testThreadHashes["c"]), Parent: b}
+	d := &Item{Hash: HashFromString(testThreadHashes["d"]), Parent: c}
+	comments := ItemPtrCollection{a, b, c, d}
+	reparentComments(&comments)
+	addLevelComments(comments)
+
+	comments = limitCommentsDepth(comments, 0, 1)
+	if len(comments) != 1 || comments[0] != a {
+		t.Fatalf("Expected a single top level comment, got %d", len(comments))
+	}
+	if len(a.children) != 3 {
+		t.Fatalf("Expected all the replies to be moved under the top level comment, got %d", len(a.children))
+	}
+	for _, ch := range a.children {
+		if ch.Level != 1 {
+			t.Errorf("Comment %s has level %d, expected 1", ch.Hash, ch.Level)
+		}
+		if len(ch.children) > 0 {
+			t.Errorf("Comment %s should not have any replies nested under it", ch.Hash)
+		}
+	}
+}
+
+func Test_reparentCommentsKeepsRepliesToTombstones(t *testing.T) {
+	base := "https://fedbox.example/objects/"
+	raw := []string{
+		`{"id":"` + base + testThreadHashes["a"] + `","type":"Note","content":"top"}`,
+		`{"id":"` + base + testThreadHashes["b"] + `","type":"Tombstone","formerType":"Note","inReplyTo":["` + base + testThreadHashes["a"] + `"]}`,
+		`{"id":"` + base + testThreadHashes["c"] + `","type":"Note","content":"reply","inReplyTo":["` + base + testThreadHashes["b"] + `"]}`,
+	}
+	comments := make(ItemPtrCollection, 0)
+	for _, r := range raw {
+		it, err := pub.UnmarshalJSON([]byte(r))
+		if err != nil {
+			t.Fatalf("Unable to unmarshal %s: %s", r, err)
+		}
+		i := new(Item)
+		if err := i.FromActivityPub(it); err != nil {
+			t.Fatalf("Unable to load item from %s: %s", r, err)
+		}
+		comments = append(comments, i)
+	}
+	deleted := comments[1]
+	if !deleted.Deleted() {
+		t.Errorf("The Tombstone should be loaded as a deleted item")
+	}
+	if deleted.Hash != HashFromString(testThreadHashes["b"]) {
+		t.Errorf("The deleted item hash %s, expected %s", deleted.Hash, testThreadHashes["b"])
+	}
+	if !deleted.Parent.IsValid() || deleted.Parent.Hash != HashFromString(testThreadHashes["a"]) {
+		t.Errorf("The deleted item should keep its parent")
+	}
+
+	reparentComments(&comments)
+	if len(comments) != 1 {
+		t.Fatalf("Expected a single top level item, got %d", len(comments))
+	}
+	top := comments[0]
+	if len(top.children) != 1 || top.children[0] != deleted {
+		t.Fatalf("The deleted item should be kept as a reply of the top level item")
+	}
+	if len(deleted.children) != 1 || deleted.children[0].Hash != HashFromString(testThreadHashes["c"]) {
+		t.Errorf("The replies of the deleted item should stay attached to it")
+	}
+}
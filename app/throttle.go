@@ -0,0 +1,178 @@
+package app
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ap/errors"
+)
+
+const (
+	DefaultLoginFailureWindow = 15 * time.Minute
+	DefaultLoginLockout       = 15 * time.Minute
+	// maxLoginLockout caps the doubling of the lockouts
+	maxLoginLockout = 24 * time.Hour
+)
+
+// loginFailures are the failed logins of an account, or from a remote address
+type loginFailures struct {
+	count    int
+	first    time.Time
+	until    time.Time
+	lockouts int
+}
+
+// loginThrottle counts the failed logins per account and per remote address, and locks them out temporarily
+// after max failures in the window. Every lockout that follows lasts twice as long as the previous one.
+type loginThrottle struct {
+	m       sync.Mutex
+	max     int
+	window  time.Duration
+	lockout time.Duration
+	pruned  time.Time
+	c       map[string]*loginFailures
+}
+
+func newLoginThrottle(max int, window, lockout time.Duration) *loginThrottle {
+	if max <= 0 {
+		return nil
+	}
+	if window <= 0 {
+		window = DefaultLoginFailureWindow
+	}
+	if lockout <= 0 {
+		lockout = DefaultLoginLockout
+	}
+	return &loginThrottle{max: max, window: window, lockout: lockout, c: make(map[string]*loginFailures)}
+}
+
+func loginAccountKey(handle string) string {
+	return "account:" + strings.ToLower(handle)
+}
+
+// loginAddrKey returns the key for the remote address of the request
+// NOTE(marius): we don't look at the X-Forwarded-For headers, as anyone can set them
+func loginAddrKey(r *http.Request) string {
+	addr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	return "addr:" + addr
+}
+
+func (l *loginThrottle) lockoutFor(lockouts int) time.Duration {
+	d := l.lockout
+	for i := 1; i < lockouts && d < maxLoginLockout; i++ {
+		d *= 2
+	}
+	if d > maxLoginLockout {
+		d = maxLoginLockout
+	}
+	return d
+}
+
+// expired returns true if we can forget about the failures, we keep the ones which have been locked out
+// for another lockout period, so the next one can be longer
+func (l *loginThrottle) expired(f *loginFailures, now time.Time) bool {
+	expiry := f.first.Add(l.window)
+	if f.lockouts > 0 {
+		if until := f.until.Add(l.lockoutFor(f.lockouts)); until.After(expiry) {
+			expiry = until
+		}
+	}
+	return now.After(expiry)
+}
+
+func (l *loginThrottle) prune(now time.Time) {
+	if now.Sub(l.pruned) < l.window {
+		return
+	}
+	for k, f := range l.c {
+		if l.expired(f, now) {
+			delete(l.c, k)
+		}
+	}
+	l.pruned = now
+}
+
+// locked returns how long until the logins for the keys are allowed again
+func (l *loginThrottle) locked(keys ...string) (time.Duration, bool) {
+	if l == nil {
+		return 0, false
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	for _, k := range keys {
+		if f, ok := l.c[k]; ok && now.Before(f.until) {
+			if d := f.until.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait, wait > 0
+}
+
+// fail records a failed login for the keys, locking out the ones that reached the maximum number of failures
+func (l *loginThrottle) fail(keys ...string) {
+	if l == nil {
+		return
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	now := time.Now()
+	l.prune(now)
+	for _, k := range keys {
+		f, ok := l.c[k]
+		if !ok {
+			f = new(loginFailures)
+			l.c[k] = f
+		}
+		if now.Sub(f.first) > l.window {
+			f.count = 0
+			f.first = now
+		}
+		f.count++
+		if f.count >= l.max {
+			f.lockouts++
+			f.until = now.Add(l.lockoutFor(f.lockouts))
+			f.count = 0
+			f.first = now
+		}
+	}
+}
+
+// reset removes the failed logins for the keys
+func (l *loginThrottle) reset(keys ...string) {
+	if l == nil {
+		return
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	for _, k := range keys {
+		delete(l.c, k)
+	}
+}
+
+// tooManyLogins responds with a 429 status and a Retry-After header to the login requests that have been locked out
+func (h *handler) tooManyLogins(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	retry := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
+	d := &errorModel{
+		Status:     http.StatusTooManyRequests,
+		StatusText: http.StatusText(http.StatusTooManyRequests),
+		Title:      "Error 429",
+		Errors:     []error{errors.Newf("Too many failed logins, try again in %s", (time.Duration(retry) * time.Second).String())},
+	}
+	w.Header().Set("Cache-Control", " no-store, must-revalidate")
+	w.WriteHeader(d.Status)
+	h.v.RenderTemplate(r, w, "error", d)
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_loginThrottle_LocksOutAfterMaxFailures(t *testing.T) {
+	const max = 3
+	l := newLoginThrottle(max, time.Minute, time.Minute)
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	keys := []string{loginAccountKey("johndoe"), loginAddrKey(req)}
+
+	for i := 1; i <= max; i++ {
+		if _, locked := l.locked(keys...); locked {
+			t.Fatalf("Login attempt %d should not be locked out", i)
+		}
+		l.fail(keys...)
+	}
+	wait, locked := l.locked(keys...)
+	if !locked {
+		t.Fatalf("Login attempt %d should be locked out", max+1)
+	}
+	if wait <= 0 || wait > time.Minute {
+		t.Errorf("Invalid lockout duration %s, expected at most %s", wait, time.Minute)
+	}
+	if _, locked := l.locked(loginAccountKey("janedoe")); locked {
+		t.Errorf("Other accounts should not be locked out")
+	}
+
+	// NOTE(marius): a successful login for the account doesn't unlock the remote address
+	l.reset(loginAccountKey("JohnDoe"))
+	if _, locked := l.locked(loginAccountKey("johndoe")); locked {
+		t.Errorf("The account should not be locked out after reset")
+	}
+	if _, locked := l.locked(keys...); !locked {
+		t.Errorf("The remote address should still be locked out")
+	}
+}
+
+func Test_loginThrottle_lockoutFor(t *testing.T) {
+	l := newLoginThrottle(5, time.Minute, 15*time.Minute)
+	tests := []struct {
+		lockouts int
+		want     time.Duration
+	}{
+		{lockouts: 1, want: 15 * time.Minute},
+		{lockouts: 2, want: 30 * time.Minute},
+		{lockouts: 3, want: time.Hour},
+		{lockouts: 20, want: maxLoginLockout},
+	}
+	for _, tt := range tests {
+		if got := l.lockoutFor(tt.lockouts); got != tt.want {
+			t.Errorf("lockoutFor(%d) = %s, want %s", tt.lockouts, got, tt.want)
+		}
+	}
+}
+
+func Test_loginThrottle_Disabled(t *testing.T) {
+	l := newLoginThrottle(0, time.Minute, time.Minute)
+	for i := 0; i < 10; i++ {
+		l.fail(loginAccountKey("johndoe"))
+	}
+	if _, locked := l.locked(loginAccountKey("johndoe")); locked {
+		t.Errorf("Logins should never be locked out when the throttling is disabled")
+	}
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// tombstones holds the IRIs of the remote objects that were deleted before we ever stored them,
+// so loading them later fails with 410 Gone instead of being fetched again.
+type tombstones struct {
+	m   sync.RWMutex
+	iri map[pub.IRI]struct{}
+}
+
+func newTombstones() *tombstones {
+	return &tombstones{iri: make(map[pub.IRI]struct{})}
+}
+
+// Add records the iri as deleted
+func (t *tombstones) Add(iri pub.IRI) {
+	if t == nil || len(iri) == 0 {
+		return
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.iri[iri] = struct{}{}
+}
+
+// Deleted returns true if the iri was recorded as deleted
+func (t *tombstones) Deleted(iri pub.IRI) bool {
+	if t == nil {
+		return false
+	}
+	t.m.RLock()
+	defer t.m.RUnlock()
+	_, ok := t.iri[iri]
+	return ok
+}
+
+func goneError(iri pub.IRI) error {
+	return &fedboxError{status: http.StatusGone, error: errors.WrapWithStatus(http.StatusGone, nil, "%s was deleted", iri)}
+}
+
+// processDelete checks the object of a remote Delete activity. If we never stored the object, the Delete is
+// a no-op: the IRI is recorded in the tombstones index, and it returns false, so the caller can accept the
+// activity without creating a Tombstone for it.
+// Only the actors hosted on the same instance as the object can delete it.
+func (r *repository) processDelete(ctx context.Context, act *pub.Activity) (bool, error) {
+	if act == nil || act.Type != pub.DeleteType || act.Object == nil || act.Actor == nil {
+		return false, errors.BadRequestf("invalid Delete activity")
+	}
+	iri := act.Object.GetLink()
+	if !strings.EqualFold(host(act.Actor.GetLink().String()), host(iri.String())) {
+		return false, errors.Forbiddenf("%s can't delete %s from another instance", act.Actor.GetLink(), iri)
+	}
+	if r.deleted.Deleted(iri) {
+		return false, nil
+	}
+	ob, err := r.fedbox.Object(ctx, iri)
+	if err != nil && httpErrorResponse(err) != http.StatusNotFound && httpErrorResponse(err) != http.StatusGone {
+		return false, err
+	}
+	if ob == nil || len(ob.GetLink()) == 0 {
+		r.infoFn(log.Ctx{"iri": iri})("delete for unknown object")
+		r.deleted.Add(iri)
+		return false, nil
+	}
+	return true, nil
+}
+
+// processDeletes records the objects of the remote Delete activities we load from the inboxes, fedbox is the one
+// receiving them, so we can only check them afterwards.
+func (r *repository) processDeletes(ctx context.Context, deletes ...*pub.Activity) {
+	for _, act := range deletes {
+		if _, err := r.processDelete(ctx, act); err != nil {
+			r.errFn(log.Ctx{"iri": act.GetLink()})("invalid Delete activity: %s", err)
+		}
+	}
+}
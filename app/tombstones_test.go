@@ -0,0 +1,64 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_repository_processDeleteUnknownObject(t *testing.T) {
+	fetches := 0
+	posts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posts++
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/objects/"+testObjectHash {
+			fetches++
+		}
+		writeActivityJSON(w, http.StatusNotFound, `{"errors":[{"status":404,"message":"not found"}]}`)
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.deleted = newTombstones()
+	iri := pub.IRI(srv.URL + "/objects/" + testObjectHash)
+	del := &pub.Activity{
+		Type:   pub.DeleteType,
+		Actor:  pub.IRI("https://remote.example/users/jdoe"),
+		Object: iri,
+	}
+	if _, err := r.processDelete(context.Background(), del); err == nil || r.deleted.Deleted(iri) {
+		t.Errorf("The Delete of an actor from another instance than the object's should be refused")
+	}
+	del.Actor = pub.IRI(srv.URL + "/users/jdoe")
+
+	known, err := r.processDelete(context.Background(), del)
+	if err != nil {
+		t.Fatalf("The Delete of an unknown object should not fail: %s", err)
+	}
+	if known {
+		t.Errorf("The object of the Delete should be unknown")
+	}
+	if posts != 0 {
+		t.Errorf("No Tombstone should be created for an unknown object, received %d requests", posts)
+	}
+	if !r.deleted.Deleted(iri) {
+		t.Fatalf("The unknown object should be recorded as deleted")
+	}
+
+	// NOTE(marius): repeating the Delete, or loading the object, doesn't fetch it again
+	if _, err := r.processDelete(context.Background(), del); err != nil {
+		t.Errorf("The repeated Delete should not fail: %s", err)
+	}
+	_, err = r.LoadItem(context.Background(), iri)
+	if status := httpErrorResponse(err); status != http.StatusGone {
+		t.Errorf("Invalid status %d for loading a deleted object, expected %d", status, http.StatusGone)
+	}
+	if fetches != 1 {
+		t.Errorf("The deleted object was fetched %d times, expected %d", fetches, 1)
+	}
+}
@@ -0,0 +1,439 @@
+package app
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+const (
+	// totpPeriod is the number of seconds an authentication code is valid for
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew is the number of periods around the current one for which we still accept the codes,
+	// to compensate for the clock drift of the devices
+	totpSkew          = 1
+	totpSecretSize    = 20
+	totpRecoveryCodes = 8
+)
+
+const (
+	SessionPendingTOTPKey = "__pending_acct"
+	SessionTOTPSecretKey  = "__totp_secret"
+)
+
+// TOTP is the time based one time password configuration of an account
+type TOTP struct {
+	// Secret is the secret shared with the authenticator application, encrypted with the instance's key
+	Secret []byte `json:"secret"`
+	// Recovery are the hashes of the recovery codes that haven't been used yet
+	Recovery []string `json:"recovery,omitempty"`
+}
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func newTOTPSecret() ([]byte, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return nil, errors.Annotatef(err, "unable to generate the secret")
+	}
+	return secret, nil
+}
+
+// totpCode computes the HOTP value, as described in RFC 4226, of the secret for the counter
+func totpCode(secret []byte, counter uint64) string {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, counter)
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(buf)
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	val := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, val%mod)
+}
+
+// validTOTPCode checks the code against the ones of the secret for the periods around now
+func validTOTPCode(secret []byte, code string, now time.Time) bool {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return false
+	}
+	counter := uint64(now.Unix() / totpPeriod)
+	for i := -totpSkew; i <= totpSkew; i++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, counter+uint64(i))), []byte(code)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// TOTPKeyURI returns the otpauth URI the authenticator applications use to enroll the secret
+func TOTPKeyURI(issuer, handle string, secret []byte) string {
+	q := url.Values{}
+	q.Set("secret", totpEncoding.EncodeToString(secret))
+	q.Set("issuer", issuer)
+	q.Set("digits", strconv.Itoa(totpDigits))
+	q.Set("period", strconv.Itoa(totpPeriod))
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + issuer + ":" + handle, RawQuery: q.Encode()}
+	return u.String()
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRecoveryCodes returns the recovery codes we show to the user, and their hashes which we store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, totpRecoveryCodes)
+	hashes := make([]string, totpRecoveryCodes)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+			return nil, nil, errors.Annotatef(err, "unable to generate the recovery codes")
+		}
+		c := strings.ToLower(totpEncoding.EncodeToString(buf))
+		codes[i] = c[:4] + "-" + c[4:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// totpStore keeps the TOTP configurations of the accounts on disk, with their secrets encrypted
+type totpStore struct {
+	path string
+	aead cipher.AEAD
+	l    sync.Mutex
+}
+
+func newTOTPStore(path string, key []byte) (*totpStore, error) {
+	if len(key) == 0 {
+		return nil, errors.NotImplementedf("no encryption key, unable to use two-factor authentication")
+	}
+	sum := sha256.Sum256(key)
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, errors.Annotatef(err, "unable to create the two-factor authentication storage")
+	}
+	return &totpStore{path: path, aead: aead}, nil
+}
+
+func (s *totpStore) file(h Hash) string {
+	return filepath.Join(s.path, h.String()+".json")
+}
+
+func (s *totpStore) seal(secret []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, secret, nil), nil
+}
+
+func (s *totpStore) open(sealed []byte) ([]byte, error) {
+	n := s.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, errors.NotValidf("invalid secret")
+	}
+	return s.aead.Open(nil, sealed[:n], sealed[n:], nil)
+}
+
+func (s *totpStore) load(h Hash) (*TOTP, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.read(h)
+}
+
+func (s *totpStore) read(h Hash) (*TOTP, error) {
+	dat, err := ioutil.ReadFile(s.file(h))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	t := new(TOTP)
+	if err := json.Unmarshal(dat, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *totpStore) save(h Hash, t *TOTP) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.write(h, t)
+}
+
+func (s *totpStore) write(h Hash, t *TOTP) error {
+	dat, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.file(h), dat, 0600)
+}
+
+func (s *totpStore) remove(h Hash) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if err := os.Remove(s.file(h)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// verify checks the code against the account's secret, or its recovery codes, which are removed once used
+func (s *totpStore) verify(h Hash, code string, now time.Time) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	t, err := s.read(h)
+	if err != nil {
+		return errors.Annotatef(err, "unable to load the two-factor authentication settings")
+	}
+	if t == nil {
+		return errors.NotFoundf("two-factor authentication is not enabled")
+	}
+	secret, err := s.open(t.Secret)
+	if err != nil {
+		return errors.Annotatef(err, "unable to decrypt the two-factor authentication secret")
+	}
+	if validTOTPCode(secret, code, now) {
+		return nil
+	}
+	hash := hashRecoveryCode(code)
+	for i, rc := range t.Recovery {
+		if subtle.ConstantTimeCompare([]byte(rc), []byte(hash)) == 1 {
+			t.Recovery = append(t.Recovery[:i], t.Recovery[i+1:]...)
+			return s.write(h, t)
+		}
+	}
+	return errors.Unauthorizedf("invalid authentication code")
+}
+
+// TOTPEnabled returns true if the account has two-factor authentication enabled.
+// When we can't tell, we assume it does, so the logins fail instead of skipping the check.
+func (r *repository) TOTPEnabled(a *Account) bool {
+	if r.totp == nil || !a.IsValid() {
+		return false
+	}
+	t, err := r.totp.load(a.Hash)
+	if err != nil {
+		r.errFn(log.Ctx{"handle": a.Handle, "err": err.Error()})("unable to load the two-factor authentication settings")
+		return true
+	}
+	if a.HasMetadata() {
+		a.Metadata.TOTP = t
+	}
+	return t != nil
+}
+
+// EnableTOTP turns on two-factor authentication for the account if the code is valid for the secret.
+// It returns the recovery codes, which the user can see only now.
+func (r *repository) EnableTOTP(a *Account, secret []byte, code string) ([]string, error) {
+	if r.totp == nil {
+		return nil, errors.NotImplementedf("two-factor authentication is not available")
+	}
+	if !a.IsLogged() {
+		return nil, errors.Unauthorizedf("invalid account")
+	}
+	if !validTOTPCode(secret, code, time.Now()) {
+		return nil, errors.BadRequestf("invalid authentication code")
+	}
+	sealed, err := r.totp.seal(secret)
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to encrypt the two-factor authentication secret")
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	t := &TOTP{Secret: sealed, Recovery: hashes}
+	if err := r.totp.save(a.Hash, t); err != nil {
+		return nil, errors.Annotatef(err, "unable to save the two-factor authentication settings")
+	}
+	if a.HasMetadata() {
+		a.Metadata.TOTP = t
+	}
+	return codes, nil
+}
+
+// DisableTOTP turns off two-factor authentication for the account, the code can also be one of the recovery codes
+func (r *repository) DisableTOTP(a *Account, code string) error {
+	if err := r.VerifyTOTP(a, code); err != nil {
+		return err
+	}
+	if err := r.totp.remove(a.Hash); err != nil {
+		return errors.Annotatef(err, "unable to remove the two-factor authentication settings")
+	}
+	if a.HasMetadata() {
+		a.Metadata.TOTP = nil
+	}
+	return nil
+}
+
+// VerifyTOTP checks the code of an account with two-factor authentication enabled,
+// the recovery codes can be used only once
+func (r *repository) VerifyTOTP(a *Account, code string) error {
+	if r.totp == nil {
+		return errors.NotImplementedf("two-factor authentication is not available")
+	}
+	if !a.IsValid() {
+		return errors.Unauthorizedf("invalid account")
+	}
+	return r.totp.verify(a.Hash, code, time.Now())
+}
+
+// ownAccount returns the logged account if it's the one in the request's path
+func ownAccount(r *http.Request) (*Account, error) {
+	acc := loggedAccount(r)
+	authors := ContextAuthors(r.Context())
+	if !acc.IsLogged() || len(authors) == 0 || authors[0].Hash != acc.Hash {
+		return nil, errors.Forbiddenf("you can only change the settings of your own account")
+	}
+	return acc, nil
+}
+
+// HandleTOTPSetup serves GET /~{handle}/2fa requests, showing the secret the user needs to add
+// to their authenticator application, if they don't have two-factor authentication enabled yet
+func (h *handler) HandleTOTPSetup(w http.ResponseWriter, r *http.Request) {
+	acc, err := ownAccount(r)
+	if err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	m := &totpModel{Title: "Two-factor authentication", Account: *acc}
+	if m.Enabled = h.storage.TOTPEnabled(acc); !m.Enabled {
+		secret, err := newTOTPSecret()
+		if err != nil {
+			h.v.HandleErrors(w, r, err)
+			return
+		}
+		s, err := h.v.s.get(w, r)
+		if err != nil {
+			h.v.HandleErrors(w, r, errors.Annotatef(err, "unable to load the session"))
+			return
+		}
+		s.Values[SessionTOTPSecretKey] = totpEncoding.EncodeToString(secret)
+		m.Secret = totpEncoding.EncodeToString(secret)
+		m.URI = TOTPKeyURI(h.conf.HostName, acc.Handle, secret)
+	}
+	if err := h.v.RenderTemplate(r, w, m.Template(), m); err != nil {
+		h.v.HandleErrors(w, r, err)
+	}
+}
+
+// HandleEnableTOTP serves POST /~{handle}/2fa requests, enabling two-factor authentication if the
+// code matches the secret shown by HandleTOTPSetup
+func (h *handler) HandleEnableTOTP(w http.ResponseWriter, r *http.Request) {
+	acc, err := ownAccount(r)
+	if err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	s, err := h.v.s.get(w, r)
+	if err != nil {
+		h.v.HandleErrors(w, r, errors.Annotatef(err, "unable to load the session"))
+		return
+	}
+	enc, _ := s.Values[SessionTOTPSecretKey].(string)
+	secret, err := totpEncoding.DecodeString(enc)
+	if err != nil || len(secret) == 0 {
+		h.v.HandleErrors(w, r, errors.BadRequestf("the two-factor authentication setup has expired, please try again"))
+		return
+	}
+	codes, err := h.storage.EnableTOTP(acc, secret, r.PostFormValue("otp"))
+	if err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	delete(s.Values, SessionTOTPSecretKey)
+	h.v.addFlashMessage(Success, w, r, "Two-factor authentication is now enabled")
+	m := &totpModel{Title: "Two-factor authentication", Account: *acc, Enabled: true, Recovery: codes}
+	if err := h.v.RenderTemplate(r, w, m.Template(), m); err != nil {
+		h.v.HandleErrors(w, r, err)
+	}
+}
+
+// HandleDisableTOTP serves POST /~{handle}/2fa/disable requests
+func (h *handler) HandleDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	acc, err := ownAccount(r)
+	if err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	if err := h.storage.DisableTOTP(acc, r.PostFormValue("otp")); err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	h.v.addFlashMessage(Success, w, r, "Two-factor authentication is now disabled")
+	h.v.Redirect(w, r, AccountPermaLink(acc), http.StatusSeeOther)
+}
+
+// HandleLoginTOTP serves POST /login/otp requests, finishing the login of the accounts
+// with two-factor authentication enabled that passed the password check in HandleLogin
+func (h *handler) HandleLoginTOTP(w http.ResponseWriter, r *http.Request) {
+	s, err := h.v.s.get(w, r)
+	if err != nil {
+		h.v.addFlashMessage(Error, w, r, "Login failed: unable to load session")
+		h.v.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	acct, ok := s.Values[SessionPendingTOTPKey].(Account)
+	if !ok || !acct.IsLogged() {
+		h.v.addFlashMessage(Error, w, r, "Login failed: please authenticate again")
+		h.v.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	throttleKeys := []string{loginAccountKey(acct.Handle), loginAddrKey(r)}
+	if wait, locked := h.logins.locked(throttleKeys...); locked {
+		h.tooManyLogins(w, r, wait)
+		return
+	}
+	if err := h.storage.VerifyTOTP(&acct, r.PostFormValue("otp")); err != nil {
+		// NOTE(marius): a failed code sends the user back to the password check, so guessing the codes is not cheap
+		h.errFn(log.Ctx{"handle": acct.Handle, "err": err.Error()})("two-factor authentication failed")
+		delete(s.Values, SessionPendingTOTPKey)
+		h.logins.fail(throttleKeys...)
+		h.v.addFlashMessage(Error, w, r, "Login failed: invalid authentication code")
+		h.v.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	delete(s.Values, SessionPendingTOTPKey)
+	h.logins.reset(loginAccountKey(acct.Handle))
+	s.Values[SessionUserKey] = acct
+	h.v.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_totpCode(t *testing.T) {
+	// NOTE(marius): the SHA1 test vectors from RFC 6238, truncated to 6 digits
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(secret, uint64(tt.unix/totpPeriod)); got != tt.want {
+			t.Errorf("totpCode() at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func Test_repository_LoginRequiresTOTPCode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "totp")
+	if err != nil {
+		t.Fatalf("Unable to create temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := &repository{infoFn: defaultCtxLogFn, errFn: defaultCtxLogFn}
+	if r.totp, err = newTOTPStore(dir, []byte("not-so-secret-session-key")); err != nil {
+		t.Fatalf("Unable to create the TOTP storage: %s", err)
+	}
+	acc := &Account{Hash: HashFromString(testActorHash), Handle: "johndoe", Metadata: &AccountMetadata{}}
+	if r.TOTPEnabled(acc) {
+		t.Fatalf("Two-factor authentication should be disabled for a new account")
+	}
+
+	secret, _ := newTOTPSecret()
+	if _, err := r.EnableTOTP(acc, secret, "invalid"); err == nil {
+		t.Errorf("Two-factor authentication should not be enabled with an invalid code")
+	}
+	recovery, err := r.EnableTOTP(acc, secret, totpCode(secret, uint64(time.Now().Unix()/totpPeriod)))
+	if err != nil {
+		t.Fatalf("Unable to enable two-factor authentication: %s", err)
+	}
+	if len(recovery) != totpRecoveryCodes {
+		t.Errorf("Expected %d recovery codes, received %d", totpRecoveryCodes, len(recovery))
+	}
+	if !r.TOTPEnabled(acc) || acc.Metadata.TOTP == nil {
+		t.Fatalf("Two-factor authentication should be enabled")
+	}
+	if string(acc.Metadata.TOTP.Secret) == string(secret) {
+		t.Errorf("The secret should be stored encrypted")
+	}
+
+	if err := r.VerifyTOTP(acc, ""); err == nil {
+		t.Errorf("The login should fail without an authentication code")
+	}
+	stale := totpCode(secret, uint64(time.Now().Add(-time.Hour).Unix()/totpPeriod))
+	if err := r.VerifyTOTP(acc, stale); err == nil {
+		t.Errorf("The login should fail with an expired authentication code")
+	}
+	if err := r.VerifyTOTP(acc, totpCode(secret, uint64(time.Now().Unix()/totpPeriod))); err != nil {
+		t.Errorf("The login should succeed with a valid authentication code: %s", err)
+	}
+	if err := r.VerifyTOTP(acc, recovery[0]); err != nil {
+		t.Errorf("The login should succeed with a recovery code: %s", err)
+	}
+	if err := r.VerifyTOTP(acc, recovery[0]); err == nil {
+		t.Errorf("The recovery codes should be usable only once")
+	}
+
+	if err := r.DisableTOTP(acc, recovery[1]); err != nil {
+		t.Fatalf("Unable to disable two-factor authentication: %s", err)
+	}
+	if r.TOTPEnabled(acc) {
+		t.Errorf("Two-factor authentication should be disabled")
+	}
+}
@@ -0,0 +1,230 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/log"
+	"golang.org/x/oauth2"
+)
+
+// transport wraps the round tripper used for the requests to fedbox and the other ActivityPub servers
+// in order to have control of the outgoing requests.
+type transport struct {
+	next       http.RoundTripper
+	userAgent  string
+	userAgents map[string]string
+	debugFn    CtxLogFn
+}
+
+// baseTransport is the original default transport which we wrap
+var baseTransport = http.DefaultTransport
+
+// defaultTransport is the transport of the defaultClient
+var defaultTransport = &transport{}
+
+// defaultClient is the client for the requests to fedbox and the other ActivityPub servers.
+// NOTE(marius): we don't replace http.DefaultTransport with our transport, so the other requests of the process
+// aren't changed by the fedbox settings, like the extra root CAs, or the User-Agent
+var defaultClient = &http.Client{Transport: defaultTransport}
+
+// withDefaultClient returns a context that makes the oauth2 requests to fedbox use the defaultClient
+func withDefaultClient(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, defaultClient)
+}
+
+func (t *transport) base() http.RoundTripper {
+	if t.next == nil {
+		return baseTransport
+	}
+	return t.next
+}
+
+// tlsConfig builds the TLS configuration for the outgoing requests.
+// The certificates in the caFile PEM bundle are trusted alongside the system ones.
+func tlsConfig(caFile string, insecure bool) (*tls.Config, error) {
+	conf := &tls.Config{InsecureSkipVerify: insecure}
+	if len(caFile) == 0 {
+		return conf, nil
+	}
+	pem, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to read root CAs file %s", caFile)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Newf("no valid certificates found in root CAs file %s", caFile)
+	}
+	conf.RootCAs = pool
+	return conf, nil
+}
+
+// setTLSConfig makes the transport use a copy of the base transport with the conf TLS configuration
+func (t *transport) setTLSConfig(conf *tls.Config) {
+	if conf == nil {
+		return
+	}
+	base, ok := baseTransport.(*http.Transport)
+	if !ok {
+		return
+	}
+	tr := base.Clone()
+	tr.TLSClientConfig = conf
+	t.next = tr
+}
+
+// WithUserAgent returns a context that overrides the User-Agent of the outgoing requests created with it
+func WithUserAgent(ctx context.Context, ua string) context.Context {
+	return context.WithValue(ctx, UserAgentCtxtKey, ua)
+}
+
+// ContextUserAgent returns the User-Agent override from the context, if any
+func ContextUserAgent(ctx context.Context) string {
+	ua, _ := ctx.Value(UserAgentCtxtKey).(string)
+	return ua
+}
+
+// userAgentFor returns the User-Agent to be used for the request.
+// In order of precedence: the one from the request's context, the per peer one, and the default one.
+func (t *transport) userAgentFor(req *http.Request) string {
+	if ua := ContextUserAgent(req.Context()); len(ua) > 0 {
+		return ua
+	}
+	if ua, ok := t.userAgents[strings.ToLower(req.URL.Hostname())]; ok {
+		return ua
+	}
+	return t.userAgent
+}
+
+// signedHeaders returns the list of headers that are part of the HTTP signature of the request
+func signedHeaders(req *http.Request) []string {
+	sig := req.Header.Get("Signature")
+	if auth := req.Header.Get("Authorization"); len(sig) == 0 && strings.HasPrefix(auth, "Signature ") {
+		sig = strings.TrimPrefix(auth, "Signature ")
+	}
+	if len(sig) == 0 {
+		return nil
+	}
+	for _, param := range strings.Split(sig, ",") {
+		param = strings.TrimSpace(param)
+		if strings.HasPrefix(param, "headers=") {
+			return strings.Fields(strings.ToLower(strings.Trim(strings.TrimPrefix(param, "headers="), `"`)))
+		}
+	}
+	return nil
+}
+
+func isSignedHeader(req *http.Request, h string) bool {
+	for _, s := range signedHeaders(req) {
+		if s == strings.ToLower(h) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	// NOTE(marius): if the User-Agent is part of the signature, changing it would invalidate the request
+	if ua := t.userAgentFor(req); len(ua) > 0 && !isSignedHeader(req, "User-Agent") {
+		req.Header.Set("User-Agent", ua)
+	}
+	if t.debugFn != nil {
+		t.logRequest(req)
+	}
+	resp, err := t.base().RoundTrip(req)
+	if err == nil && resp != nil {
+		var body []byte
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+			body, resp.Body = readBody(resp.Body)
+		}
+		peerSignatureSchemes.Observe(req, resp.StatusCode, resp.Header, body)
+		if t.debugFn != nil {
+			t.logResponse(req, resp)
+		}
+	}
+	return resp, err
+}
+
+// maxLoggedBody is the maximum length of a request or response body we write to the debug log
+const maxLoggedBody = 4096
+
+var redactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+func loggableHeaders(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range redactedHeaders {
+		if len(h.Get(name)) > 0 {
+			h.Set(name, "[redacted]")
+		}
+	}
+	return h
+}
+
+func loggableBody(b []byte) string {
+	if len(b) > maxLoggedBody {
+		return fmt.Sprintf("%s... (%d bytes truncated)", b[:maxLoggedBody], len(b)-maxLoggedBody)
+	}
+	return string(b)
+}
+
+// readBody returns the content of body, and a new reader with the same content to replace it
+func readBody(body io.ReadCloser) ([]byte, io.ReadCloser) {
+	if body == nil || body == http.NoBody {
+		return nil, body
+	}
+	b, _ := ioutil.ReadAll(body)
+	body.Close()
+	return b, ioutil.NopCloser(bytes.NewReader(b))
+}
+
+func (t *transport) logRequest(req *http.Request) {
+	var body []byte
+	body, req.Body = readBody(req.Body)
+	t.debugFn(log.Ctx{
+		"method":  req.Method,
+		"url":     req.URL.String(),
+		"headers": loggableHeaders(req.Header),
+		"body":    loggableBody(body),
+	})("outgoing request")
+}
+
+func (t *transport) logResponse(req *http.Request, resp *http.Response) {
+	var body []byte
+	body, resp.Body = readBody(resp.Body)
+	t.debugFn(log.Ctx{
+		"method":  req.Method,
+		"url":     req.URL.String(),
+		"status":  resp.StatusCode,
+		"headers": loggableHeaders(resp.Header),
+		"body":    loggableBody(body),
+	})("received response")
+}
+
+// parsePeerUserAgents loads the per peer User-Agent values from a "host=UA,host=UA" list
+func parsePeerUserAgents(s []string) map[string]string {
+	uas := make(map[string]string)
+	for _, peer := range s {
+		pieces := strings.SplitN(peer, "=", 2)
+		if len(pieces) != 2 {
+			continue
+		}
+		h := strings.ToLower(strings.TrimSpace(pieces[0]))
+		ua := strings.TrimSpace(pieces[1])
+		if len(h) > 0 && len(ua) > 0 {
+			uas[h] = ua
+		}
+	}
+	return uas
+}
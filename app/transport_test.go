@@ -0,0 +1,260 @@
+package app
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-ap/client"
+	"github.com/mariusor/go-littr/internal/log"
+	"golang.org/x/oauth2"
+)
+
+func Test_transport_UserAgent(t *testing.T) {
+	received := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("User-Agent")
+	}))
+	defer srv.Close()
+
+	u, _ := url.Parse(srv.URL)
+	tests := []struct {
+		name      string
+		tr        *transport
+		ctx       context.Context
+		signature string
+		want      string
+	}{
+		{
+			name: "default",
+			tr:   &transport{userAgent: "littr.example-HEAD"},
+			ctx:  context.Background(),
+			want: "littr.example-HEAD",
+		},
+		{
+			name: "peer",
+			tr:   &transport{userAgent: "littr.example-HEAD", userAgents: map[string]string{u.Hostname(): "picky-peer-agent"}},
+			ctx:  context.Background(),
+			want: "picky-peer-agent",
+		},
+		{
+			name: "request",
+			tr:   &transport{userAgent: "littr.example-HEAD", userAgents: map[string]string{u.Hostname(): "picky-peer-agent"}},
+			ctx:  WithUserAgent(context.Background(), "request-agent"),
+			want: "request-agent",
+		},
+		{
+			name:      "signed",
+			tr:        &transport{userAgent: "littr.example-HEAD"},
+			ctx:       context.Background(),
+			signature: `keyId="https://example.com/actors/1#main-key",algorithm="rsa-sha256",headers="(request-target) host date user-agent",signature="dGVzdA=="`,
+			want:      "signed-agent",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequestWithContext(tt.ctx, http.MethodGet, srv.URL, nil)
+			if len(tt.signature) > 0 {
+				req.Header.Set("User-Agent", "signed-agent")
+				req.Header.Set("Signature", tt.signature)
+			}
+			cl := http.Client{Transport: tt.tr}
+			resp, err := cl.Do(req)
+			if err != nil {
+				t.Fatalf("Unable to send request: %s", err)
+			}
+			resp.Body.Close()
+			if received != tt.want {
+				t.Errorf("Invalid User-Agent %q, expected %q", received, tt.want)
+			}
+		})
+	}
+}
+
+func Test_NewClientKeepsDefaultTransport(t *testing.T) {
+	received := ""
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("User-Agent")
+		writeActivityJSON(w, http.StatusOK, `{"id":"`+r.Host+`","type":"Service"}`)
+	}))
+	defer srv.Close()
+
+	prev := http.DefaultTransport
+	if _, err := NewClient(SetURL(srv.URL), SetUA("littr.example-HEAD")); err != nil {
+		t.Fatalf("Unable to create the fedbox client: %s", err)
+	}
+	if http.DefaultTransport != prev {
+		t.Errorf("The fedbox client should not replace http.DefaultTransport")
+	}
+	if received != "littr.example-HEAD" {
+		t.Errorf("Invalid User-Agent %q for the fedbox request, expected %q", received, "littr.example-HEAD")
+	}
+}
+
+func Test_transport_TLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "littr-tls")
+	if err != nil {
+		t.Fatalf("Unable to create temporary dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, caPEM, 0600); err != nil {
+		t.Fatalf("Unable to write CA file: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		caFile   string
+		insecure bool
+		wantErr  bool
+	}{
+		{
+			name:    "default rejects unknown certificate",
+			wantErr: true,
+		},
+		{
+			name:   "custom CA",
+			caFile: caFile,
+		},
+		{
+			name:     "insecure",
+			insecure: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := tlsConfig(tt.caFile, tt.insecure)
+			if err != nil {
+				t.Fatalf("Unable to build TLS config: %s", err)
+			}
+			tr := &transport{}
+			tr.setTLSConfig(conf)
+			resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Get() error = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_tlsConfigInvalidCAFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "littr-ca")
+	if err != nil {
+		t.Fatalf("Unable to create temporary file: %s", err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("not a certificate")
+	f.Close()
+
+	if _, err := tlsConfig(f.Name(), false); err == nil {
+		t.Errorf("tlsConfig() expected error for a file without certificates")
+	}
+	if _, err := tlsConfig(f.Name()+".missing", false); err == nil {
+		t.Errorf("tlsConfig() expected error for a missing file")
+	}
+}
+
+func Test_transport_DebugLogSaveItem(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/outbox") {
+			objIRI := srv.URL + "/objects/" + testObjectHash
+			w.Header().Set("Location", srv.URL+"/activities/"+testLikeHash)
+			writeActivityJSON(w, http.StatusCreated, `{"type":"Create","actor":"`+srv.URL+"/actors/"+testActorHash+`","object":{"id":"`+objIRI+`","type":"Note","content":"Test content","mediaType":"text/html"}}`)
+			return
+		}
+		if r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, "/actors") {
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	logged := make([]log.Ctx, 0)
+	debugFn := func(ctx ...log.Ctx) LogFn {
+		return func(s string, _ ...interface{}) {
+			for _, c := range ctx {
+				c["msg"] = s
+				logged = append(logged, c)
+			}
+		}
+	}
+	r := testRepository(srv)
+	r.fedbox.client = client.New(client.WithHTTPClient(&http.Client{Transport: &transport{debugFn: debugFn}}))
+	author := testVote(srv, 1).SubmittedBy
+	author.Metadata.OAuth.Token = &oauth2.Token{AccessToken: "s3cr3t-t0k3n", TokenType: "Bearer"}
+	r.WithAccount(author)
+
+	it := Item{
+		SubmittedBy: author,
+		Data:        "Test content",
+		MimeType:    "text/html",
+		Flags:       FlagsPrivate,
+		Metadata:    &ItemMetadata{},
+	}
+	if _, err := r.SaveItem(context.Background(), it); err != nil {
+		t.Fatalf("Unable to save item: %s", err)
+	}
+
+	var req, resp log.Ctx
+	for _, c := range logged {
+		if c["method"] != http.MethodPost {
+			continue
+		}
+		if c["msg"] == "outgoing request" {
+			req = c
+		}
+		if c["msg"] == "received response" {
+			resp = c
+		}
+	}
+	if req == nil {
+		t.Fatalf("The outgoing request to the outbox was not logged")
+	}
+	if body, _ := req["body"].(string); !strings.Contains(body, "Test content") {
+		t.Errorf("Invalid logged request body %q, expected it to contain the saved item", body)
+	}
+	headers, _ := req["headers"].(http.Header)
+	if auth := headers.Get("Authorization"); auth != "[redacted]" {
+		t.Errorf("Invalid logged Authorization header %q, expected it to be redacted", auth)
+	}
+	for _, c := range logged {
+		for _, v := range c {
+			if s, ok := v.(string); ok && strings.Contains(s, "s3cr3t-t0k3n") {
+				t.Errorf("The access token leaked in the debug log: %v", c)
+			}
+		}
+	}
+	if resp == nil {
+		t.Fatalf("The response from the outbox was not logged")
+	}
+	if st, _ := resp["status"].(int); st != http.StatusCreated {
+		t.Errorf("Invalid logged response status %d, expected %d", st, http.StatusCreated)
+	}
+}
+
+func Test_loggableBody(t *testing.T) {
+	if got := loggableBody([]byte("short")); got != "short" {
+		t.Errorf("loggableBody() = %q, expected the body unchanged", got)
+	}
+	long := strings.Repeat("a", maxLoggedBody+10)
+	got := loggableBody([]byte(long))
+	if !strings.HasPrefix(got, long[:maxLoggedBody]) || !strings.HasSuffix(got, "(10 bytes truncated)") {
+		t.Errorf("loggableBody() = %q, expected it to be truncated", got[maxLoggedBody:])
+	}
+}
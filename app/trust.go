@@ -0,0 +1,273 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-ap/errors"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+// TrustLevel is how much the instance trusts an account, the gates for the new accounts, like the federation hold,
+// check it instead of the account's age or karma
+type TrustLevel uint8
+
+const (
+	// TrustLevelNew accounts are younger than the new account watermark
+	TrustLevelNew TrustLevel = iota
+	// TrustLevelBasic accounts are past the new account watermark
+	TrustLevelBasic
+	// TrustLevelMember accounts are older than the member age, and have at least the member karma
+	TrustLevelMember
+	// TrustLevelLeader accounts were granted the level by a moderator, the moderators themselves are always leaders
+	TrustLevelLeader
+)
+
+func (t TrustLevel) String() string {
+	switch t {
+	case TrustLevelNew:
+		return "new"
+	case TrustLevelBasic:
+		return "basic"
+	case TrustLevelMember:
+		return "member"
+	case TrustLevelLeader:
+		return "leader"
+	}
+	return "unknown"
+}
+
+func validTrustLevel(t TrustLevel) bool {
+	return t <= TrustLevelLeader
+}
+
+// trustLevels computes the trust levels of the accounts, and keeps the last ones we computed with the accounts' karma.
+// The levels the moderators granted are saved with the accounts.
+type trustLevels struct {
+	m           sync.RWMutex
+	newAge      time.Duration
+	memberAge   time.Duration
+	memberKarma int
+	known       map[Hash]TrustLevel
+	karma       map[Hash]int
+}
+
+func newTrustLevels(newAge, memberAge time.Duration, memberKarma int) *trustLevels {
+	return &trustLevels{
+		newAge:      newAge,
+		memberAge:   memberAge,
+		memberKarma: memberKarma,
+		known:       make(map[Hash]TrustLevel),
+		karma:       make(map[Hash]int),
+	}
+}
+
+// accountAge returns how old the account is, and false if we don't know when it was created
+func accountAge(acc *Account) (time.Duration, bool) {
+	if acc == nil || acc.CreatedAt.IsZero() {
+		return 0, false
+	}
+	return time.Since(acc.CreatedAt), true
+}
+
+// isNew returns true if the account is younger than the new account watermark
+func (t *trustLevels) isNew(acc *Account) bool {
+	age, ok := accountAge(acc)
+	return t.newAge > 0 && ok && age < t.newAge
+}
+
+// needsKarma returns true if the karma of the account is the only thing between it and the member level
+func (t *trustLevels) needsKarma(acc *Account) bool {
+	if t == nil || t.memberKarma <= 0 || t.level(acc, 0) >= TrustLevelMember || t.isNew(acc) {
+		return false
+	}
+	age, ok := accountAge(acc)
+	return (ok && age >= t.memberAge) || t.memberAge <= 0
+}
+
+// level computes the trust level of the account from its age, its karma, and the level a moderator granted it
+func (t *trustLevels) level(acc *Account, karma int) TrustLevel {
+	if t == nil {
+		return TrustLevelBasic
+	}
+	if acc.IsModerator() {
+		return TrustLevelLeader
+	}
+	lvl := TrustLevelBasic
+	if t.isNew(acc) {
+		lvl = TrustLevelNew
+	} else if age, ok := accountAge(acc); ((ok && age >= t.memberAge) || t.memberAge <= 0) && karma >= t.memberKarma {
+		lvl = TrustLevelMember
+	}
+	if granted := accountPreferences(acc).Trust; granted > lvl {
+		lvl = granted
+	}
+	return lvl
+}
+
+// For returns the trust level of the account without loading its karma: the higher of the one computed
+// from its age, and of the last one we computed with its karma
+func (t *trustLevels) For(acc *Account) TrustLevel {
+	if t == nil {
+		return TrustLevelBasic
+	}
+	lvl := t.level(acc, 0)
+	if acc == nil || t.isNew(acc) {
+		return lvl
+	}
+	t.m.RLock()
+	defer t.m.RUnlock()
+	if known, ok := t.known[acc.Hash]; ok && known > lvl {
+		lvl = known
+	}
+	return lvl
+}
+
+// record saves the level computed for the account, and returns the previous one, if we knew it
+func (t *trustLevels) record(acc Hash, lvl TrustLevel) (TrustLevel, bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	prev, ok := t.known[acc]
+	t.known[acc] = lvl
+	return prev, ok
+}
+
+// isKnown returns true if we computed the level of the account with its karma before
+func (t *trustLevels) isKnown(acc Hash) bool {
+	t.m.RLock()
+	defer t.m.RUnlock()
+	_, ok := t.known[acc]
+	return ok
+}
+
+// recordKarma saves the karma we loaded for the account
+func (t *trustLevels) recordKarma(acc Hash, karma int) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.karma[acc] = karma
+}
+
+// Karma returns the last karma we loaded for the account
+func (t *trustLevels) Karma(acc Hash) int {
+	if t == nil {
+		return 0
+	}
+	t.m.RLock()
+	defer t.m.RUnlock()
+	return t.karma[acc]
+}
+
+// needsMarkdownKarma returns true if the karma of the account decides if its markdown is trusted
+func (r *repository) needsMarkdownKarma(a *Account) bool {
+	if r.trustedMarkdownKarma <= 0 || a.IsModerator() {
+		return false
+	}
+	return r.trustedMarkdown == TrustedMarkdownMembers || (r.trustedMarkdown == TrustedMarkdownLocal && a.IsLocal())
+}
+
+// accountKarma returns the score of the newest items of the account
+func (r *repository) accountKarma(ctx context.Context, a *Account) (int, error) {
+	if !a.HasMetadata() || len(a.Metadata.ID) == 0 {
+		return 0, errors.NotValidf("invalid account")
+	}
+	items, err := r.objects(ctx, &Filters{AttrTo: CompStrs{EqualsString(a.Metadata.ID)}, MaxItems: MaxContentItems})
+	if err != nil {
+		return 0, err
+	}
+	karma := 0
+	for _, it := range items {
+		karma += it.Score
+	}
+	return karma, nil
+}
+
+// LoadTrustLevel computes the trust level of the account, loading its karma only if it can make a difference,
+// and sets it on the account. The changes of the accounts' levels are logged.
+func (r *repository) LoadTrustLevel(ctx context.Context, a *Account) (TrustLevel, error) {
+	if !a.IsValid() {
+		return TrustLevelNew, errors.NotValidf("invalid account")
+	}
+	if r.trust == nil {
+		a.Trust = TrustLevelBasic
+		return a.Trust, nil
+	}
+	karma := 0
+	if r.trust.needsKarma(a) || r.needsMarkdownKarma(a) {
+		var err error
+		if karma, err = r.accountKarma(ctx, a); err != nil {
+			// NOTE(marius): we keep the level the account had, instead of demoting it when fedbox isn't reachable
+			a.Trust = r.trust.For(a)
+			a.Karma = r.trust.Karma(a.Hash)
+			return a.Trust, errors.Annotatef(err, "unable to load the karma of %s", a.Handle)
+		}
+		r.trust.recordKarma(a.Hash, karma)
+	}
+	a.Karma = karma
+	a.Trust = r.trust.level(a, karma)
+	if prev, ok := r.trust.record(a.Hash, a.Trust); ok && prev != a.Trust {
+		r.infoFn(log.Ctx{"account": a.Handle, "from": prev.String(), "to": a.Trust.String(), "karma": karma})("account trust level changed")
+	}
+	return a.Trust, nil
+}
+
+// authorTrustLevel sets the trust level on an account we loaded as the author of some content, the karma is loaded
+// only the first time we see the account, afterwards we use the last level we computed with it
+func (r *repository) authorTrustLevel(ctx context.Context, a *Account) {
+	if !a.IsValid() {
+		return
+	}
+	if r.trust != nil && !r.trust.isKnown(a.Hash) {
+		if _, err := r.LoadTrustLevel(ctx, a); err != nil {
+			r.errFn(log.Ctx{"account": a.Handle})("unable to load the trust level: %s", err)
+		}
+		return
+	}
+	a.Trust = r.trust.For(a)
+	a.Karma = r.trust.Karma(a.Hash)
+}
+
+// GrantTrustLevel saves with the account the trust level a moderator granted to it, granting the new level
+// removes the grant
+func (r *repository) GrantTrustLevel(ctx context.Context, by Account, acc *Account, lvl TrustLevel) error {
+	if !by.IsModerator() {
+		return errors.Forbiddenf("only the moderators can grant trust levels")
+	}
+	if !acc.IsValid() {
+		return errors.NotValidf("invalid account %s", acc.Handle)
+	}
+	if !validTrustLevel(lvl) {
+		return errors.NotValidf("invalid trust level %d", lvl)
+	}
+	err := r.SavePreferences(ctx, acc, func(p *AccountPreferences) {
+		p.Trust = lvl
+	})
+	if err != nil {
+		return errors.Annotatef(err, "unable to save the trust level of %s", acc.Handle)
+	}
+	r.infoFn(log.Ctx{"account": acc.Handle, "level": lvl.String(), "by": by.Handle})("granted account trust level")
+	_, err = r.LoadTrustLevel(ctx, acc)
+	return err
+}
+
+// HandleGrantTrustLevel serves the moderators' POST /~{handle}/trust requests, granting the level to the account
+func (h *handler) HandleGrantTrustLevel(w http.ResponseWriter, r *http.Request) {
+	authors := ContextAuthors(r.Context())
+	if len(authors) == 0 {
+		h.v.HandleErrors(w, r, errors.NotFoundf("account not found"))
+		return
+	}
+	acc := authors[0]
+	lvl, err := strconv.ParseUint(r.PostFormValue("level"), 10, 8)
+	if err != nil {
+		h.v.HandleErrors(w, r, errors.NewNotValid(err, "invalid trust level"))
+		return
+	}
+	if err := h.storage.GrantTrustLevel(context.TODO(), *loggedAccount(r), &acc, TrustLevel(lvl)); err != nil {
+		h.v.HandleErrors(w, r, err)
+		return
+	}
+	h.v.Redirect(w, r, AccountPermaLink(&acc), http.StatusFound)
+}
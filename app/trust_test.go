@@ -0,0 +1,112 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+)
+
+func Test_repository_LoadTrustLevel(t *testing.T) {
+	likes := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		object := fmt.Sprintf("%s/objects/%s", srv.URL, testObjectHash)
+		switch r.URL.Path {
+		case "/objects":
+			writeActivityJSON(w, http.StatusOK, fmt.Sprintf(`{"type":"OrderedCollection","orderedItems":[
+				{"id":"%s","type":"Note","attributedTo":"%s/actors/%s","content":"hello"}]}`, object, srv.URL, testActorHash))
+		case "/inbox":
+			votes := make([]string, likes)
+			for i := range votes {
+				votes[i] = fmt.Sprintf(`{"id":"%s/activities/like-%d","type":"Like","actor":"%s/actors/voter-%d","object":"%s"}`,
+					srv.URL, i, srv.URL, i, object)
+			}
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[`+strings.Join(votes, ",")+`]}`)
+		default:
+			writeActivityJSON(w, http.StatusOK, `{"type":"OrderedCollection","orderedItems":[]}`)
+		}
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	r.trust = newTrustLevels(24*time.Hour, 48*time.Hour, 2)
+	acc := testVote(srv, 1).SubmittedBy
+	load := func() TrustLevel {
+		lvl, err := r.LoadTrustLevel(context.Background(), acc)
+		if err != nil {
+			t.Fatalf("Unable to load the trust level: %s", err)
+		}
+		if acc.Trust != lvl {
+			t.Errorf("The account's trust level %s should be the loaded one %s", acc.Trust, lvl)
+		}
+		return lvl
+	}
+
+	acc.CreatedAt = time.Now().Add(-time.Hour)
+	likes = 5
+	if lvl := load(); lvl != TrustLevelNew {
+		t.Errorf("An account younger than the watermark should be new, received %s", lvl)
+	}
+	acc.CreatedAt = time.Now().Add(-72 * time.Hour)
+	likes = 1
+	if lvl := load(); lvl != TrustLevelBasic {
+		t.Errorf("An account under the member karma should be basic, received %s", lvl)
+	}
+	likes = 2
+	if lvl := load(); lvl != TrustLevelMember {
+		t.Errorf("An account crossing the member age and karma should be a member, received %s", lvl)
+	}
+	if lvl := r.trust.For(acc); lvl != TrustLevelMember {
+		t.Errorf("The member level should be kept without loading the karma again, received %s", lvl)
+	}
+	if r.holds = newFederationHold(r.trust); r.holds.Holds(acc) {
+		t.Errorf("The activities of a member shouldn't be held")
+	}
+}
+
+func Test_repository_GrantTrustLevel(t *testing.T) {
+	f := newAccountFedbox()
+	defer f.Close()
+
+	r := testRepository(f.Server)
+	r.fedbox.pub = &pub.Actor{ID: pub.IRI(f.URL), Type: pub.ServiceType}
+	r.trust = newTrustLevels(24*time.Hour, 48*time.Hour, 2)
+	Instance.Conf.Moderators = []string{"mod"}
+	mod := Account{Hash: HashFromString(testLikeHash), Handle: "mod", CreatedAt: time.Now().Add(-time.Hour)}
+	acc := testVote(f.Server, 1).SubmittedBy
+	acc.CreatedAt = time.Now().Add(-time.Hour)
+
+	if err := r.GrantTrustLevel(context.Background(), *acc, acc, TrustLevelLeader); err == nil {
+		t.Errorf("Only the moderators should be able to grant trust levels")
+	}
+	if err := r.GrantTrustLevel(context.Background(), mod, acc, TrustLevelLeader); err != nil {
+		t.Fatalf("Unable to grant the trust level: %s", err)
+	}
+	if acc.Trust != TrustLevelLeader {
+		t.Errorf("The granted level should be %s, received %s", TrustLevelLeader, acc.Trust)
+	}
+	// NOTE(marius): the grant is saved with the account, so it's applied to the authors we load after restarts
+	stored := f.storedAccount(t, r)
+	stored.CreatedAt = acc.CreatedAt
+	r.trust = newTrustLevels(24*time.Hour, 48*time.Hour, 2)
+	r.authorTrustLevel(context.Background(), stored)
+	if stored.Trust != TrustLevelLeader {
+		t.Errorf("The level granted to the stored account should be %s, received %s", TrustLevelLeader, stored.Trust)
+	}
+	if !isTrustedAuthor(TrustedMarkdownMembers, 0, stored) {
+		t.Errorf("The markdown of an account granted the leader level should be trusted")
+	}
+
+	if err := r.GrantTrustLevel(context.Background(), mod, acc, TrustLevelNew); err != nil {
+		t.Fatalf("Unable to remove the granted trust level: %s", err)
+	}
+	if acc.Trust != TrustLevelNew || accountPreferences(f.storedAccount(t, r)).Trust != TrustLevelNew {
+		t.Errorf("Without the grant the account should be back at %s, received %s", TrustLevelNew, acc.Trust)
+	}
+}
@@ -0,0 +1,157 @@
+package app
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+)
+
+// untrustedRecipients removes from the personal recipients the ones hosted on trusted instances,
+// so they don't count against the fan-out cap and are always addressed directly.
+func (r *repository) untrustedRecipients(personal map[pub.IRI]pub.IRI) map[pub.IRI]pub.IRI {
+	for iri := range personal {
+		if r.peers.IsTrusted(host(iri.String())) {
+			delete(personal, iri)
+		}
+	}
+	return personal
+}
+
+// signerKeyTTL is how long we keep the public keys of the verified signers before loading them again
+const signerKeyTTL = time.Hour
+
+// maxSignerDocumentSize limits how much of a signer's actor document we read
+const maxSignerDocumentSize = 1 << 20
+
+type signerKey struct {
+	actor pub.IRI
+	key   crypto.PublicKey
+	at    time.Time
+}
+
+// signerKeys holds the public keys of the remote actors whose HTTP signatures we verified, by their keyId.
+// The keys are loaded with the same client as the remote media, which connects only to public addresses.
+type signerKeys struct {
+	m      sync.RWMutex
+	keys   map[string]signerKey
+	client *http.Client
+}
+
+func newSignerKeys() *signerKeys {
+	return &signerKeys{keys: make(map[string]signerKey), client: newMediaClient(false)}
+}
+
+func (s *signerKeys) get(keyID string) (signerKey, bool) {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	k, ok := s.keys[keyID]
+	if !ok || time.Since(k.at) > signerKeyTTL {
+		return k, false
+	}
+	return k, true
+}
+
+func (s *signerKeys) set(keyID string, k signerKey) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	now := time.Now()
+	for id, kk := range s.keys {
+		if now.Sub(kk.at) > signerKeyTTL {
+			delete(s.keys, id)
+		}
+	}
+	k.at = now
+	s.keys[keyID] = k
+}
+
+// load fetches the actor document the keyId points to, and returns its public key, if the document is the one
+// we asked for and the key belongs to it
+func (s *signerKeys) load(ctx context.Context, keyID string) (signerKey, error) {
+	iri := keyID
+	if i := strings.IndexByte(iri, '#'); i > 0 {
+		iri = iri[:i]
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, iri, nil)
+	if err != nil {
+		return signerKey{}, errors.NewUnauthorized(err, "invalid keyId %s", keyID)
+	}
+	req.Header.Set("Accept", "application/activity+json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return signerKey{}, errors.NewUnauthorized(err, "unable to load the signer %s", iri)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSignerDocumentSize))
+	if err != nil {
+		return signerKey{}, errors.NewUnauthorized(err, "unable to load the signer %s", iri)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return signerKey{}, errors.Unauthorizedf("unable to load the signer %s: %s", iri, resp.Status)
+	}
+	it, err := pub.UnmarshalJSON(body)
+	if err != nil {
+		return signerKey{}, errors.NewUnauthorized(err, "invalid signer %s", iri)
+	}
+	signer, err := pub.ToActor(it)
+	if err != nil {
+		return signerKey{}, errors.NewUnauthorized(err, "invalid signer %s", iri)
+	}
+	// NOTE(marius): any server can claim to be an actor of another instance, and sign with its own key
+	if signer.ID != pub.IRI(iri) {
+		return signerKey{}, errors.Unauthorizedf("the signer %s is not the one the keyId points to", signer.ID)
+	}
+	if signer.PublicKey.ID != pub.IRI(keyID) || signer.PublicKey.Owner != signer.ID {
+		return signerKey{}, errors.Unauthorizedf("the key %s doesn't belong to the signer %s", keyID, signer.ID)
+	}
+	block, _ := pem.Decode([]byte(signer.PublicKey.PublicKeyPem))
+	if block == nil {
+		return signerKey{}, errors.Unauthorizedf("the signer doesn't have a public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return signerKey{}, errors.NewUnauthorized(err, "invalid public key")
+	}
+	return signerKey{actor: signer.ID, key: key}, nil
+}
+
+// verifiedSigner returns the IRI of the actor that signed the request, if it's on a trusted instance and the signature
+// is valid. The signers' keys are loaded only for the trusted instances, and kept for signerKeyTTL.
+func (r *repository) verifiedSigner(req *http.Request) (pub.IRI, error) {
+	sig := req.Header.Get("Signature")
+	if auth := req.Header.Get("Authorization"); len(sig) == 0 && strings.HasPrefix(auth, "Signature ") {
+		sig = auth
+	}
+	p, err := parseSignatureParams(sig)
+	if err != nil {
+		return "", errors.NewUnauthorized(err, "invalid HTTP signature")
+	}
+	if !r.peers.IsTrusted(host(p.KeyID)) {
+		return "", errors.Forbiddenf("the signer's instance is not trusted")
+	}
+	if r.signers == nil {
+		return "", errors.Unauthorizedf("unable to verify the HTTP signatures")
+	}
+	k, ok := r.signers.get(p.KeyID)
+	if !ok {
+		if k, err = r.signers.load(req.Context(), p.KeyID); err != nil {
+			return "", err
+		}
+	}
+	if err := VerifySignature(req, k.key); err != nil {
+		return "", err
+	}
+	if !ok {
+		r.signers.set(p.KeyID, k)
+	}
+	return k.actor, nil
+}
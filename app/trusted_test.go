@@ -0,0 +1,34 @@
+package app
+
+import (
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+func Test_repository_untrustedRecipients(t *testing.T) {
+	Instance.Conf = &config.Configuration{HostName: "littr.example", APIURL: "https://fedbox.littr.example"}
+	r := repository{peers: newPeers([]string{"blocked.partner.example"}, []string{"partner.example"})}
+
+	trusted := pub.IRI("https://partner.example/users/jane")
+	subdomain := pub.IRI("https://social.partner.example/users/jane")
+	blocked := pub.IRI("https://blocked.partner.example/users/jane")
+	other := pub.IRI("https://remote.example/users/john")
+	personal := r.untrustedRecipients(map[pub.IRI]pub.IRI{
+		trusted:   "https://partner.example/inbox",
+		subdomain: "https://social.partner.example/inbox",
+		blocked:   "https://blocked.partner.example/inbox",
+		other:     "https://remote.example/inbox",
+	})
+	for _, iri := range []pub.IRI{trusted, subdomain} {
+		if _, ok := personal[iri]; ok {
+			t.Errorf("The recipient %s on the trusted instance should not count against the cap", iri)
+		}
+	}
+	for _, iri := range []pub.IRI{blocked, other} {
+		if _, ok := personal[iri]; !ok {
+			t.Errorf("The recipient %s on the other instance should count against the cap", iri)
+		}
+	}
+}
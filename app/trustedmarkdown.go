@@ -0,0 +1,69 @@
+package app
+
+import (
+	"html/template"
+
+	"github.com/microcosm-cc/bluemonday"
+)
+
+const (
+	// TrustedMarkdownNone renders the markdown of all the authors with the strict policy
+	TrustedMarkdownNone = "none"
+	// TrustedMarkdownModerators renders the markdown of the moderators with the relaxed policy
+	TrustedMarkdownModerators = "moderators"
+	// TrustedMarkdownLocal renders the markdown of all the local accounts with the relaxed policy
+	TrustedMarkdownLocal = "local"
+	// TrustedMarkdownMembers renders the markdown of the accounts at the member trust level, or above it,
+	// with the relaxed policy
+	TrustedMarkdownMembers = "members"
+)
+
+// StrictMarkdownPolicy sanitizes the rendered markdown of the authors who are not trusted
+var StrictMarkdownPolicy = strictMarkdownPolicy()
+
+// TrustedMarkdownPolicy sanitizes the rendered markdown of the trusted authors
+var TrustedMarkdownPolicy = trustedMarkdownPolicy()
+
+func strictMarkdownPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.RequireNoFollowOnLinks(true)
+	return p
+}
+
+func trustedMarkdownPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.RequireNoFollowOnLinks(false)
+	p.AllowElements("section", "details", "summary", "wbr", "small", "kbd")
+	p.AllowAttrs("open").OnElements("details")
+	p.AllowAttrs("class", "title").Globally()
+	p.AllowAttrs("start", "reversed").OnElements("ol")
+	return p
+}
+
+// isTrustedAuthor returns true if the author's markdown is rendered with the relaxed policy, depending on the
+// TRUSTED_MARKDOWN role. Besides the role, the authors need to be past the new account level, and to have
+// at least the karma we loaded with their trust level. The moderators are always trusted.
+func isTrustedAuthor(role string, karma int, a *Account) bool {
+	switch role {
+	case TrustedMarkdownModerators:
+		return a.IsModerator()
+	case TrustedMarkdownLocal:
+		return a.IsModerator() || a.IsLogged() && a.IsLocal() && a.Trust > TrustLevelNew && a.Karma >= karma
+	case TrustedMarkdownMembers:
+		return a.IsModerator() || a.IsLogged() && a.Trust >= TrustLevelMember && a.Karma >= karma
+	}
+	return false
+}
+
+// markdownFor renders the markdown data of the item, sanitized with the policy of its author
+func markdownFor(role string, karma int, it *Item, data string) template.HTML {
+	var author *Account
+	if it != nil {
+		author = it.SubmittedBy
+	}
+	html := MdPolicy.RenderToString([]byte(data))
+	if isTrustedAuthor(role, karma, author) {
+		return template.HTML(TrustedMarkdownPolicy.Sanitize(html))
+	}
+	return template.HTML(StrictMarkdownPolicy.Sanitize(html))
+}
@@ -0,0 +1,69 @@
+package app
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+func Test_markdownFor(t *testing.T) {
+	defer func(c *config.Configuration) { Instance.Conf = c }(Instance.Conf)
+	Instance.Conf = &config.Configuration{HostName: "littr.example", Moderators: []string{"admin"}}
+
+	const data = `<span class="warning">important</span> see [the docs](https://docs.example/)`
+	untrusted := &Item{SubmittedBy: &Account{Hash: HashFromString(testActorHash), Handle: "johndoe",
+		Metadata: &AccountMetadata{ID: "https://littr.example/actors/" + testActorHash}}}
+	trusted := &Item{SubmittedBy: &Account{Hash: HashFromString(testLikeHash), Handle: "admin",
+		Metadata: &AccountMetadata{ID: "https://littr.example/actors/" + testLikeHash}}}
+
+	strict := string(markdownFor(TrustedMarkdownModerators, 0, untrusted, data))
+	relaxed := string(markdownFor(TrustedMarkdownModerators, 0, trusted, data))
+	if strict == relaxed {
+		t.Fatalf("The same content should render differently for the trusted and the untrusted authors: %s", strict)
+	}
+	if strings.Contains(strict, "warning") || !strings.Contains(strict, "nofollow") {
+		t.Errorf("The content of the untrusted author should be rendered with the strict policy: %s", strict)
+	}
+	if !strings.Contains(relaxed, `<span class="warning">important</span>`) || strings.Contains(relaxed, "nofollow") {
+		t.Errorf("The content of the trusted author should be rendered with the relaxed policy: %s", relaxed)
+	}
+	if none := string(markdownFor(TrustedMarkdownNone, 0, trusted, data)); none != strict {
+		t.Errorf("Without trusted authors all the content should be rendered with the strict policy: %s", none)
+	}
+}
+
+func Test_isTrustedAuthor(t *testing.T) {
+	defer func(c *config.Configuration) { Instance.Conf = c }(Instance.Conf)
+	Instance.Conf = &config.Configuration{HostName: "littr.example", Moderators: []string{"admin"}}
+
+	local := func(trust TrustLevel, karma int) *Account {
+		return &Account{Hash: HashFromString(testActorHash), Handle: "johndoe", Trust: trust, Karma: karma,
+			Metadata: &AccountMetadata{ID: "https://littr.example/actors/" + testActorHash}}
+	}
+	mod := &Account{Hash: HashFromString(testLikeHash), Handle: "admin",
+		Metadata: &AccountMetadata{ID: "https://littr.example/actors/" + testLikeHash}}
+	tests := []struct {
+		name  string
+		role  string
+		karma int
+		acc   *Account
+		want  bool
+	}{
+		{name: "local new account", role: TrustedMarkdownLocal, acc: local(TrustLevelNew, 100)},
+		{name: "local basic account", role: TrustedMarkdownLocal, acc: local(TrustLevelBasic, 0), want: true},
+		{name: "local under the karma", role: TrustedMarkdownLocal, karma: 10, acc: local(TrustLevelBasic, 9)},
+		{name: "local with the karma", role: TrustedMarkdownLocal, karma: 10, acc: local(TrustLevelBasic, 10), want: true},
+		{name: "member under the karma", role: TrustedMarkdownMembers, karma: 10, acc: local(TrustLevelMember, 9)},
+		{name: "member with the karma", role: TrustedMarkdownMembers, karma: 10, acc: local(TrustLevelMember, 10), want: true},
+		{name: "basic account with the karma", role: TrustedMarkdownMembers, karma: 10, acc: local(TrustLevelBasic, 10)},
+		{name: "moderator without the karma", role: TrustedMarkdownLocal, karma: 10, acc: mod, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTrustedAuthor(tt.role, tt.karma, tt.acc); got != tt.want {
+				t.Errorf("isTrustedAuthor() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/go-ap/errors"
+)
+
+// maxDisplayNameLength is the maximum number of characters of the accounts' display names
+const maxDisplayNameLength = 100
+
+// handleRegexp matches the handles we can mention, see tagsRegexp
+var handleRegexp = regexp.MustCompile(`^\w{1,64}$`)
+
+// fieldError is a validation error for one of the fields of a submitted form
+type fieldError struct {
+	field string
+	error
+}
+
+func (e *fieldError) Unwrap() error {
+	return e.error
+}
+
+// Field returns the name of the form field the error belongs to
+func (e *fieldError) Field() string {
+	return e.field
+}
+
+func invalidField(field, s string, args ...interface{}) error {
+	return &fieldError{field: field, error: errors.BadRequestf(s, args...)}
+}
+
+// ValidationError groups the errors of the fields of a submitted form, so all of them can be shown at once,
+// next to their fields
+type ValidationError struct {
+	Fields map[string]string
+}
+
+// NewValidationError groups errs by the form field they belong to, errors that don't belong to a field are kept
+// under the empty one. It returns nil if there are no errors.
+func NewValidationError(errs ...error) *ValidationError {
+	v := &ValidationError{Fields: make(map[string]string)}
+	for _, err := range errs {
+		v.Add(err)
+	}
+	if len(v.Fields) == 0 {
+		return nil
+	}
+	return v
+}
+
+// Add appends the message of err to the ones of its field
+func (v *ValidationError) Add(err error) {
+	if err == nil {
+		return
+	}
+	field := ""
+	var fe *fieldError
+	if errors.As(err, &fe) {
+		field = fe.Field()
+	}
+	if msg, ok := v.Fields[field]; ok {
+		v.Fields[field] = fmt.Sprintf("%s, %s", msg, err.Error())
+		return
+	}
+	v.Fields[field] = err.Error()
+}
+
+// Field returns the message of the field, or an empty string if it's valid
+func (v *ValidationError) Field(name string) string {
+	return v.Fields[name]
+}
+
+func (v *ValidationError) Error() string {
+	fields := make([]string, 0, len(v.Fields))
+	for f := range v.Fields {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	msgs := make([]string, len(fields))
+	for i, f := range fields {
+		msgs[i] = v.Fields[f]
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// validateProfile returns the errors of the fields of the account which can change after it was created,
+// the display name and the email
+func validateProfile(a Account) []error {
+	errs := make([]error, 0)
+	if !a.HasMetadata() {
+		return errs
+	}
+	if name := a.Metadata.Name; len([]rune(name)) > maxDisplayNameLength {
+		errs = append(errs, invalidField("name", "the display name must be at most %d characters long", maxDisplayNameLength))
+	} else if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		errs = append(errs, invalidField("name", "the display name can not contain control characters"))
+	}
+	if email := a.Metadata.Email; len(email) > 0 {
+		if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+			errs = append(errs, invalidField("email", "%q is not a valid email address", email))
+		}
+	}
+	return errs
+}
+
+// validateAccount returns the errors of the fields of a new account, its password has to follow the policy
+func validateAccount(a Account, policy PasswordPolicy) []error {
+	errs := make([]error, 0)
+	if !handleRegexp.MatchString(a.Handle) {
+		errs = append(errs, invalidField("handle", "the handle must have at most 64 letters, digits or underscores"))
+	}
+	errs = append(errs, validateProfile(a)...)
+	pw := ""
+	if a.HasMetadata() {
+		pw = string(a.Metadata.Password)
+	}
+	return append(errs, policy.Validate(pw, a.Handle)...)
+}
+
+// withoutFieldFlashes returns the flash messages that aren't shown next to a form field
+func withoutFieldFlashes(flashes []flash) []flash {
+	result := make([]flash, 0, len(flashes))
+	for _, f := range flashes {
+		if len(f.Field) == 0 {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// fieldFlash returns the message of the flash for the form field
+func fieldFlash(flashes func() []flash) func(string) string {
+	return func(field string) string {
+		for _, f := range flashes() {
+			if len(field) > 0 && f.Field == field {
+				return f.Msg
+			}
+		}
+		return ""
+	}
+}
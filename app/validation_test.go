@@ -0,0 +1,79 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-ap/errors"
+)
+
+func Test_handler_accountFromPost(t *testing.T) {
+	h := &handler{}
+	h.conf.PasswordMinLength = 10
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantFields []string
+	}{
+		{
+			name: "valid",
+			form: url.Values{"handle": {"johndoe"}, "pw": {"correct horse battery"}, "pw-confirm": {"correct horse battery"},
+				"name": {"John Doe"}, "email": {"john@example.com"}},
+		},
+		{
+			name:       "invalid handle and short password",
+			form:       url.Values{"handle": {"john doe!"}, "pw": {"h0rse"}, "pw-confirm": {"h0rse"}},
+			wantFields: []string{"handle", "pw"},
+		},
+		{
+			name: "all invalid",
+			form: url.Values{"handle": {""}, "pw": {"h0rse"}, "pw-confirm": {"horse"},
+				"name": {strings.Repeat("john", 30)}, "email": {"john at example"}},
+			wantFields: []string{"handle", "pw", "pw-confirm", "name", "email"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(tt.form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			_, err := h.accountFromPost(r)
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Fatalf("Unexpected error %s", err)
+				}
+				return
+			}
+			var ve *ValidationError
+			if !errors.As(err, &ve) {
+				t.Fatalf("Invalid error %v, expected a %T", err, ve)
+			}
+			if len(ve.Fields) != len(tt.wantFields) {
+				t.Errorf("Invalid fields %v, expected %v", ve.Fields, tt.wantFields)
+			}
+			for _, field := range tt.wantFields {
+				if len(ve.Field(field)) == 0 {
+					t.Errorf("The error should contain a message for the %s field, received %v", field, ve.Fields)
+				}
+			}
+			if status := httpErrorResponse(err); status != http.StatusBadRequest {
+				t.Errorf("Invalid status %d for the validation error, expected %d", status, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func Test_repository_SaveAccountValidation(t *testing.T) {
+	acc := Account{Handle: "johndoe", Metadata: &AccountMetadata{Name: "John\x00Doe", Email: "john@"}}
+	_, err := new(repository).SaveAccount(context.Background(), acc)
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("Invalid error %v, expected a %T", err, ve)
+	}
+	if len(ve.Field("name")) == 0 || len(ve.Field("email")) == 0 {
+		t.Errorf("The error should contain the display name and the email, received %v", ve.Fields)
+	}
+}
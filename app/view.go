@@ -3,6 +3,7 @@ package app
 import (
 	"encoding/base64"
 	"fmt"
+	ht "html"
 	"html/template"
 	"math"
 	"mime"
@@ -150,6 +151,7 @@ func (v *view) RenderTemplate(r *http.Request, w http.ResponseWriter, name strin
 	}
 
 	version := Instance.Version
+	flashes := v.loadFlashMessages(w, r)
 	ren := render.New(render.Options{
 		AssetNames: assets.TemplateNames,
 		Asset:      assets.Template,
@@ -169,20 +171,24 @@ func (v *view) RenderTemplate(r *http.Request, w http.ResponseWriter, name strin
 			"IsAccount":             func(t Renderable) bool { return t.Type() == ActorType },
 			"IsModeration":          func(t Renderable) bool { return t.Type() == ModerationType },
 			"SessionEnabled":        func() bool { return v.s.enabled },
-			"LoadFlashMessages":     v.loadFlashMessages(w, r),
+			"LoadFlashMessages":     func() []flash { return withoutFieldFlashes(flashes()) },
+			"FieldError":            fieldFlash(flashes),
 			"Mod10":                 mod10,
 			"ShowText":              showText(m),
 			"ShowTitle":             showTitle(m),
-			"HTML":                  html,
+			"HTML":                  func(s string) template.HTML { return StripTrackingParamsHTML(html(s), v.c.TrackingParams) },
 			"Text":                  text,
 			"isAudio":               isAudio,
 			"Audio":                 audio,
 			"Video":                 video,
 			"isVideo":               isVideo,
 			"Image":                 image,
+			"Attachment":            attachment,
 			"Avatar":                avatar,
 			"isImage":               isImage,
-			"Markdown":              Markdown,
+			"Markdown":              func(s string) template.HTML { return StripTrackingParamsHTML(Markdown(s), v.c.TrackingParams) },
+			"AuthorMarkdown":        func(it *Item, s string) template.HTML { return StripTrackingParamsHTML(markdownFor(v.c.TrustedMarkdown, v.c.TrustedMarkdownKarma, it, s), v.c.TrackingParams) },
+			"CleanURL":              func(s string) string { return StripTrackingParams(s, v.c.TrackingParams) },
 			"replaceTags":           replaceTags,
 			"AccountLocalLink":      AccountLocalLink,
 			"ShowAccountHandle":     ShowAccountHandle,
@@ -205,6 +211,7 @@ func (v *view) RenderTemplate(r *http.Request, w http.ResponseWriter, name strin
 			"PrevPageLink":          prevPageLink,
 			"CanPaginate":           canPaginate,
 			"Config":                func() config.Configuration { return *v.c },
+			"PasswordPolicy":        func() PasswordPolicy { return PasswordPolicyFromConfig(*v.c) },
 			"Version":               func() string { return version },
 			"Name":                  appName,
 			"Menu":                  func() []headerEl { return headerMenu(r) },
@@ -232,6 +239,7 @@ func (v *view) RenderTemplate(r *http.Request, w http.ResponseWriter, name strin
 			"AccountIsBlocked":      func(a *Account) bool { return AccountIsBlocked(accountFromRequest(), a) },
 			"AccountIsReported":     func(a *Account) bool { return AccountIsReported(accountFromRequest(), a) },
 			"ItemReported":          func(i *Item) bool { return ItemIsReported(accountFromRequest(), i) },
+			"ThreadIsMuted":         func(i *Item) bool { return threadIsMuted(ContextRepository(r.Context()), accountFromRequest(), i) },
 			"RenderLabel":           renderActivityLabel,
 			csrf.TemplateTag:        func() template.HTML { return csrf.TemplateField(r) },
 			"ToTitle":               ToTitle,
@@ -359,8 +367,11 @@ func (v *view) HandleErrors(w http.ResponseWriter, r *http.Request, errs ...erro
 		if err == nil {
 			continue
 		}
+		var ve *ValidationError
 		if renderErrors {
 			status = httpErrorResponse(err)
+		} else if errors.As(err, &ve) {
+			v.addFieldFlashMessages(w, r, ve.Fields)
 		} else {
 			v.addFlashMessage(Error, w, r, err.Error())
 		}
@@ -401,6 +412,13 @@ func (v *view) addFlashMessage(typ flashType, w http.ResponseWriter, r *http.Req
 	v.s.addFlashMessages(typ, w, r, msgs...)
 }
 
+func (v *view) addFieldFlashMessages(w http.ResponseWriter, r *http.Request, fields map[string]string) {
+	if !v.s.enabled {
+		return
+	}
+	v.s.addFieldFlashMessages(w, r, fields)
+}
+
 func (v *view) loadFlashMessages(w http.ResponseWriter, r *http.Request) func() []flash {
 	var flashData []flash
 	flashFn := func() []flash { return flashData }
@@ -500,7 +518,7 @@ type headerEl struct {
 }
 
 func headerMenu(r *http.Request) []headerEl {
-	sections := []string{"/self", "/federated", "/followed", "submit"}
+	sections := []string{"/self", "/federated", "/comments", "/followed", "submit"}
 	ret := make([]headerEl, 0)
 	for _, s := range sections {
 		el := headerEl{
@@ -515,6 +533,8 @@ func headerMenu(r *http.Request) []headerEl {
 			el.Icon = []string{"home"}
 		case "/federated":
 			el.Icon = []string{"activitypub"}
+		case "/comments":
+			el.Icon = []string{"reply"}
 		case "/followed":
 			el.Icon = []string{"star"}
 			el.Auth = true
@@ -624,6 +644,11 @@ func isDocument(mime string) bool {
 }
 
 func audio(mime, data string) template.HTML {
+	// NOTE(marius): the media type comes from the remote objects, we render it only if it's a valid one
+	mime = attachmentMimeType(mime)
+	if isMediaURL(data) {
+		return template.HTML(fmt.Sprintf(audioURLFmt, ht.EscapeString(data), mime))
+	}
 	return template.HTML(fmt.Sprintf(audioFmt, mime, data, mime))
 }
 
@@ -642,6 +667,10 @@ func itemType(mime string) template.HTML {
 }
 
 func video(mime, data string) template.HTML {
+	mime = attachmentMimeType(mime)
+	if isMediaURL(data) {
+		return template.HTML(fmt.Sprintf(videoURLFmt, ht.EscapeString(data), mime))
+	}
 	return template.HTML(fmt.Sprintf(videoFmt, mime, data, mime))
 }
 
@@ -649,6 +678,9 @@ func avatar(typ, data string) template.HTML {
 	if m, _, err := mime.ParseMediaType(typ); err == nil {
 		typ = m
 	}
+	if isMediaURL(data) {
+		return template.HTML(fmt.Sprintf(avatarURLFmt, ht.EscapeString(data)))
+	}
 	if typ == MimeTypeSVG {
 		if dec, err := base64.RawStdEncoding.DecodeString(data); err == nil {
 			data = string(dec)
@@ -658,21 +690,33 @@ func avatar(typ, data string) template.HTML {
 	return template.HTML(fmt.Sprintf(avatarFmt, typ, data))
 }
 
-func image(mime, data string) template.HTML {
+func image(mime, data, alt string) template.HTML {
 	if mime == MimeTypeSVG {
 		if dec, err := base64.RawStdEncoding.DecodeString(data); err == nil {
 			data = string(dec)
 		}
 		return template.HTML(data)
 	}
-	return template.HTML(fmt.Sprintf(imageFmt, mime, data))
+	if isMediaURL(data) {
+		return template.HTML(fmt.Sprintf(imageURLFmt, ht.EscapeString(data), ht.EscapeString(alt)))
+	}
+	return template.HTML(fmt.Sprintf(imageFmt, mime, data, ht.EscapeString(alt)))
 }
 
 func icons(c []string) template.HTML {
 	return icon(c...)
 }
 
+// accountDefaultAvatar returns the avatar of the accounts that didn't set one, depending on the configured style
 func accountDefaultAvatar (act *Account) ImageMetadata {
+	switch avatarStyle() {
+	case AvatarNone:
+		return ImageMetadata{}
+	case AvatarIdenticon:
+		if act.Hash.IsValid() {
+			return ImageMetadata{URI: identiconURL(act.Hash), MimeType: MimeTypeSVG}
+		}
+	}
 	if len(act.Handle) == 0 {
 		return ImageMetadata{}
 	}
@@ -685,10 +729,14 @@ func accountDefaultAvatar (act *Account) ImageMetadata {
 }
 
 const (
-	imageFmt     = `<image src='data:%s;base64,%s' />`
+	imageFmt     = `<image src='data:%s;base64,%s' alt='%s' />`
 	avatarFmt    = `<image src='data:%s;base64,%s' width='48' height='48' class='icon avatar' />`
 	videoFmt     = `<video controls width='90%%'><source src='data:%s;base64,%s' type='%s'/></video>`
 	audioFmt     = `<audio controls><source src='data:%s;base64,%s' type='%s'/></audio>`
+	imageURLFmt  = `<image src='%s' alt='%s' />`
+	avatarURLFmt = `<image src='%s' width='48' height='48' class='icon avatar' />`
+	videoURLFmt  = `<video controls width='90%%'><source src='%s' type='%s'/></video>`
+	audioURLFmt  = `<audio controls><source src='%s' type='%s'/></audio>`
 	iconFmt      = `<svg aria-hidden="true" class="icon icon-%s"><use xlink:href="#icon-%s"><title>%s</title></use></svg>`
 	avatarSvgFmt = `<svg aria-hidden="true" class="icon avatar" width="48" height="48" viewBox="0 0 50 50">
   <rect width="100%%" height="100%%" fill="%s"/> <text fill="%s" font-size="%d" font-weight="800" x="50%%" y="55%%" dominant-baseline="middle" text-anchor="middle">%s</text>
@@ -1135,7 +1183,12 @@ func GetDomainTitle (i Item) template.HTML {
 	if err != nil {
 		return unknownDomain
 	}
-	return template.HTML(getDomain(u))
+	d := getDomain(u)
+	if i.HasMetadata() && len(i.Metadata.Domain) > 0 {
+		// NOTE(marius): we show the domain in its normalized form, keeping the user path some sites have
+		d = i.Metadata.Domain + strings.TrimPrefix(d, u.Host)
+	}
+	return template.HTML(d)
 }
 
 func GetDomainURL(i Item) template.HTMLAttr {
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"net/http"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/go-ap/errors"
+	"github.com/go-chi/chi"
+	"github.com/mariusor/go-littr/internal/log"
+)
+
+const (
+	// VisibilityPublic items are addressed to the public namespace and to the author's followers
+	VisibilityPublic = "public"
+	// VisibilityFollowers items are addressed only to the author's followers and to the accounts they mention
+	VisibilityFollowers = "followers"
+)
+
+func validVisibility(v string) bool {
+	return v == VisibilityPublic || v == VisibilityFollowers
+}
+
+// itemVisibility returns the current visibility of the item
+func itemVisibility(it Item) string {
+	if it.Private() {
+		return VisibilityFollowers
+	}
+	return VisibilityPublic
+}
+
+// withoutRecipients returns the recipients in col that are not in any of the other collections
+func withoutRecipients(col pub.ItemCollection, other ...pub.ItemCollection) pub.ItemCollection {
+	result := make(pub.ItemCollection, 0)
+	for _, rec := range col {
+		if rec == nil || len(rec.GetLink()) == 0 {
+			continue
+		}
+		found := false
+		for _, o := range other {
+			if o.Contains(rec.GetLink()) {
+				found = true
+				break
+			}
+		}
+		if !found && !result.Contains(rec.GetLink()) {
+			result = append(result, rec.GetLink())
+		}
+	}
+	return result
+}
+
+// ChangeVisibility re-addresses an existing item of the account to the audience of the visibility, with an Update
+// activity.
+// When tightening it, the recipients that lose access to the item receive the Update too, in its BCC, so the servers
+// that honour it can hide their copy. This is only best effort, we can't recall what was already federated.
+// When loosening it, the Update is delivered to the wider audience.
+func (r *repository) ChangeVisibility(ctx context.Context, by Account, it Item, visibility string) (Item, error) {
+	if !by.IsLogged() {
+		return it, errors.Unauthorizedf("invalid account %s", by.Handle)
+	}
+	if it.SubmittedBy == nil || it.SubmittedBy.Hash != by.Hash {
+		return it, errors.Forbiddenf("only the author can change the visibility of an item")
+	}
+	if !validVisibility(visibility) {
+		return it, errors.NotValidf("invalid visibility %q", visibility)
+	}
+	if itemVisibility(it) == visibility {
+		return it, nil
+	}
+	id, ok := BuildIDFromItem(it)
+	if !ok {
+		return it, errors.NotFoundf("item hash is empty, can not change its visibility")
+	}
+	ob, err := r.fedbox.Object(ctx, id)
+	if err != nil {
+		return it, errors.Annotatef(err, "unable to load item %s", id)
+	}
+	if ob == nil || ob.GetType() == pub.TombstoneType {
+		return it, errors.NotFoundf("item %s was deleted", id)
+	}
+
+	var followers pub.IRI
+	if by.HasMetadata() && len(by.Metadata.FollowersIRI) > 0 {
+		followers = pub.IRI(by.Metadata.FollowersIRI)
+	}
+	public := pub.ItemCollection{pub.PublicNS}
+	to, cc := withoutRecipients(ob.To, public), withoutRecipients(ob.CC, public)
+	bcc := make(pub.ItemCollection, 0)
+	if visibility == VisibilityFollowers {
+		if len(followers) > 0 && !to.Contains(followers) {
+			to = append(to, followers)
+			cc = withoutRecipients(cc, pub.ItemCollection{followers})
+		}
+		// NOTE(marius): the service actor received the public item, and it's the one we federate it further with
+		bcc = mergeRecipients(bcc, withoutRecipients(ob.To, to, cc, public), withoutRecipients(ob.CC, to, cc, public),
+			pub.ItemCollection{r.instanceAudience()})
+		it.MakePrivate()
+	} else {
+		to = mergeRecipients(pub.ItemCollection{pub.PublicNS}, to)
+		if len(followers) > 0 && !to.Contains(followers) {
+			cc = mergeRecipients(cc, pub.ItemCollection{followers})
+		}
+		bcc = append(bcc, r.instanceAudience())
+		it.MakePublic()
+	}
+	ob.To, ob.CC = to, cc
+
+	act := &pub.Activity{
+		Type:   pub.UpdateType,
+		To:     to,
+		CC:     cc,
+		BCC:    bcc,
+		Actor:  r.loadAPPerson(by).GetLink(),
+		Object: ob,
+	}
+	if _, _, err = r.fedbox.ToOutbox(ctx, act); err != nil {
+		r.errFn(log.Ctx{"item": it.Hash, "err": err})("unable to update the item's visibility")
+		return it, err
+	}
+	r.infoFn(log.Ctx{"item": it.Hash, "visibility": visibility})("updated item visibility")
+	return it, nil
+}
+
+// HandleChangeVisibility serves the /visibility requests of the item's author
+func (h *handler) HandleChangeVisibility(w http.ResponseWriter, r *http.Request) {
+	acc := loggedAccount(r)
+	ctx := context.TODO()
+	p, err := h.storage.LoadItem(ctx, h.storage.ItemIRI(chi.URLParam(r, "hash")))
+	if err != nil {
+		h.errFn()("Error: %s", err)
+		h.v.HandleErrors(w, r, errors.NewNotFound(err, "not found"))
+		return
+	}
+	if p, err = h.storage.ChangeVisibility(ctx, *acc, p, r.PostFormValue("visibility")); err != nil {
+		h.errFn()("Error: %s", err)
+		h.v.addFlashMessage(Error, w, r, "Unable to change the item visibility")
+	}
+	h.v.Redirect(w, r, ItemPermaLink(&p), http.StatusFound)
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	pub "github.com/go-ap/activitypub"
+	"golang.org/x/oauth2"
+)
+
+func Test_repository_ChangeVisibilityTightens(t *testing.T) {
+	var srv *httptest.Server
+	var update *pub.Activity
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			body, _ := ioutil.ReadAll(r.Body)
+			update = new(pub.Activity)
+			if err := json.Unmarshal(body, update); err != nil {
+				t.Errorf("Unable to unmarshal the activity sent to the outbox: %s", err)
+			}
+			w.Header().Set("Location", srv.URL+"/activities/"+testLikeHash)
+			writeActivityJSON(w, http.StatusCreated, string(body))
+			return
+		}
+		writeActivityJSON(w, http.StatusOK, `{"id":"`+srv.URL+`/objects/`+testObjectHash+`","type":"Note","content":"public",`+
+			`"to":["https://www.w3.org/ns/activitystreams#Public"],"cc":["`+srv.URL+`/actors/`+testActorHash+`/followers"]}`)
+	}))
+	defer srv.Close()
+
+	r := testRepository(srv)
+	vote := testVote(srv, 1)
+	author := vote.SubmittedBy
+	author.Metadata.FollowersIRI = srv.URL + "/actors/" + testActorHash + "/followers"
+	author.Metadata.OAuth.Token = &oauth2.Token{AccessToken: "t0k3n", TokenType: "Bearer"}
+	r.WithAccount(author)
+	it := *vote.Item
+	it.SubmittedBy = author
+
+	it, err := r.ChangeVisibility(context.Background(), *author, it, VisibilityFollowers)
+	if err != nil {
+		t.Fatalf("Unable to change the visibility of the item: %s", err)
+	}
+	if !it.Private() {
+		t.Errorf("The item should be private after restricting it to the followers")
+	}
+	if update == nil || update.Type != pub.UpdateType {
+		t.Fatalf("Expected an Update activity to be sent to the outbox, received %v", update)
+	}
+	if update.To.Contains(pub.PublicNS) || update.CC.Contains(pub.PublicNS) {
+		t.Errorf("The Update should not be addressed to the public namespace: to %v, cc %v", update.To, update.CC)
+	}
+	if !update.To.Contains(pub.IRI(author.Metadata.FollowersIRI)) {
+		t.Errorf("The Update should be addressed to the author's followers, received to %v", update.To)
+	}
+}
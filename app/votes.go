@@ -1,10 +1,16 @@
 package app
 
 import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
 	"time"
 
 	pub "github.com/go-ap/activitypub"
 	"github.com/go-ap/errors"
+	"github.com/go-chi/chi"
 )
 
 const (
@@ -105,6 +111,24 @@ func (v VoteCollection) First() (*Vote, error) {
 	return nil, errors.Errorf("empty %T", v)
 }
 
+// Active returns the votes that haven't been undone, without the Undo activities themselves
+func (v VoteCollection) Active() VoteCollection {
+	undone := make(map[string]bool)
+	for _, vv := range v {
+		if vv.HasMetadata() && len(vv.Metadata.OriginalIRI) > 0 {
+			undone[vv.Metadata.OriginalIRI] = true
+		}
+	}
+	active := make(VoteCollection, 0)
+	for _, vv := range v {
+		if vv.HasMetadata() && (len(vv.Metadata.OriginalIRI) > 0 || undone[vv.Metadata.IRI]) {
+			continue
+		}
+		active = append(active, vv)
+	}
+	return active
+}
+
 // Score
 func (v VoteCollection) Score() int {
 	score := 0
@@ -113,3 +137,172 @@ func (v VoteCollection) Score() int {
 	}
 	return score
 }
+
+// Directions returns the number of up votes and of down votes in the collection
+func (v VoteCollection) Directions() (int, int) {
+	up, down := 0, 0
+	for _, vot := range v {
+		if vot.Weight > 0 {
+			up++
+		}
+		if vot.Weight < 0 {
+			down++
+		}
+	}
+	return up, down
+}
+
+// VoteWeightFn returns the multiplier applied to a vote's raw weight when aggregating an item's score.
+// The raw weight is what gets federated, the multiplier is only local scoring policy.
+type VoteWeightFn func(v Vote) float64
+
+// FullVoteWeight doesn't alter the raw weight of the votes
+func FullVoteWeight(_ Vote) float64 {
+	return 1.0
+}
+
+// AccountAgeVoteWeight returns a VoteWeightFn that scales linearly with the voter's account age,
+// reaching full weight for accounts older than maxAge, and never going lower than minWeight.
+func AccountAgeVoteWeight(maxAge time.Duration, minWeight float64) VoteWeightFn {
+	if maxAge <= 0 {
+		return FullVoteWeight
+	}
+	if minWeight < 0 {
+		minWeight = 0
+	}
+	if minWeight > 1 {
+		minWeight = 1
+	}
+	return func(v Vote) float64 {
+		if v.SubmittedBy == nil || v.SubmittedBy.CreatedAt.IsZero() {
+			return minWeight
+		}
+		age := time.Now().UTC().Sub(v.SubmittedBy.CreatedAt)
+		if age >= maxAge {
+			return 1.0
+		}
+		w := float64(age) / float64(maxAge)
+		if w < minWeight {
+			return minWeight
+		}
+		return w
+	}
+}
+
+// WeightedScore returns the sum of the votes' weights after applying the fn multiplier
+func (v VoteCollection) WeightedScore(fn VoteWeightFn) int {
+	if fn == nil {
+		return v.Score()
+	}
+	score := 0.0
+	for _, vot := range v {
+		score += float64(vot.Weight) * fn(vot)
+	}
+	return int(math.Round(score))
+}
+
+// BrigadePolicy holds the thresholds for flagging items that receive a burst of votes
+// from newly created accounts, or from accounts on a single remote domain.
+type BrigadePolicy struct {
+	Window     time.Duration
+	AccountAge time.Duration
+	Ratio      float64
+	MinVotes   int
+	Discount   bool
+	LocalHosts []string
+}
+
+func (b BrigadePolicy) isLocal(h string) bool {
+	for _, l := range b.LocalHosts {
+		if strings.EqualFold(h, l) {
+			return true
+		}
+	}
+	return false
+}
+
+// Detect returns the votes that are considered to be part of a brigade, if the recent votes cast
+// in the policy's time window come disproportionately from young accounts or from a single domain.
+func (b BrigadePolicy) Detect(votes VoteCollection, now time.Time) VoteCollection {
+	if b.Window <= 0 || b.Ratio <= 0 {
+		return nil
+	}
+	recent := make(VoteCollection, 0)
+	for _, v := range votes {
+		if v.Weight != 0 && now.Sub(v.SubmittedAt) <= b.Window {
+			recent = append(recent, v)
+		}
+	}
+	if len(recent) == 0 || len(recent) < b.MinVotes {
+		return nil
+	}
+
+	young := make(VoteCollection, 0)
+	domains := make(map[string]VoteCollection)
+	for _, v := range recent {
+		if v.SubmittedBy == nil {
+			continue
+		}
+		if !v.SubmittedBy.CreatedAt.IsZero() && now.Sub(v.SubmittedBy.CreatedAt) < b.AccountAge {
+			young = append(young, v)
+		}
+		if !v.SubmittedBy.HasMetadata() {
+			continue
+		}
+		if h := host(v.SubmittedBy.Metadata.ID); len(h) > 0 && !b.isLocal(h) {
+			domains[h] = append(domains[h], v)
+		}
+	}
+
+	suspect := make(VoteCollection, 0)
+	total := float64(len(recent))
+	if float64(len(young))/total >= b.Ratio {
+		suspect = append(suspect, young...)
+	}
+	for _, fromDomain := range domains {
+		if float64(len(fromDomain))/total < b.Ratio {
+			continue
+		}
+		for _, v := range fromDomain {
+			if !suspect.Contains(v) {
+				suspect = append(suspect, v)
+			}
+		}
+	}
+	if len(suspect) == 0 {
+		return nil
+	}
+	return suspect
+}
+
+// Without returns the votes which are not found in the exclude collection
+func (v VoteCollection) Without(exclude VoteCollection) VoteCollection {
+	result := make(VoteCollection, 0)
+	for _, vv := range v {
+		if !exclude.Contains(vv) {
+			result = append(result, vv)
+		}
+	}
+	return result
+}
+
+// itemScoreJSON is the score of an item, with the number of up and down votes it received
+type itemScoreJSON struct {
+	Hash      Hash `json:"hash"`
+	Score     int  `json:"score"`
+	Upvotes   int  `json:"upvotes"`
+	Downvotes int  `json:"downvotes"`
+}
+
+// HandleItemScore serves the /score requests, with the score of the current item and its up and down votes
+func (h *handler) HandleItemScore(w http.ResponseWriter, r *http.Request) {
+	it, err := h.storage.LoadItem(context.TODO(), h.storage.ItemIRI(chi.URLParam(r, "hash")))
+	if err != nil {
+		writeJSONError(w, errors.NewNotFound(err, "not found"))
+		return
+	}
+	dat, _ := json.Marshal(itemScoreJSON{Hash: it.Hash, Score: it.Score, Upvotes: it.Upvotes, Downvotes: it.Downvotes})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dat)
+}
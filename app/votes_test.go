@@ -0,0 +1,261 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	pub "github.com/go-ap/activitypub"
+	"github.com/mariusor/go-littr/internal/config"
+)
+
+func Test_scoreItems(t *testing.T) {
+	it := Item{Hash: HashFromString("6435b2b5-26df-434c-87ca-58ddab49fcc8")}
+
+	old := &Account{Hash: HashFromString("a3a1e1f0-11c2-4d4f-8e6a-0b3c2d1e0f01"), CreatedAt: time.Now().UTC().Add(-365 * 24 * time.Hour)}
+	young := &Account{Hash: HashFromString("b4b2f2e1-22d3-4e5a-9f7b-1c4d3e2f1a02"), CreatedAt: time.Now().UTC().Add(-time.Hour)}
+	fresh := &Account{Hash: HashFromString("c5c3a3f2-33e4-4f6b-8a8c-2d5e4f3a2b03"), CreatedAt: time.Now().UTC()}
+
+	votes := VoteCollection{
+		{SubmittedBy: old, Item: &it, Weight: 1},
+		{SubmittedBy: old, Item: &Item{Hash: HashFromString("2f7c3a5e-41b1-4a2e-9b0d-7d1e9c0a6b11")}, Weight: 1},
+		{SubmittedBy: young, Item: &it, Weight: 1},
+		{SubmittedBy: young, Item: &it, Weight: 1},
+		{SubmittedBy: fresh, Item: &it, Weight: 1},
+		{SubmittedBy: fresh, Item: &it, Weight: 1},
+		{SubmittedBy: fresh, Item: &it, Weight: 1},
+		{SubmittedBy: fresh, Item: &it, Weight: -1},
+	}
+
+	tests := []struct {
+		name   string
+		weight VoteWeightFn
+		want   int
+	}{
+		{
+			name:   "no decay",
+			weight: nil,
+			want:   5,
+		},
+		{
+			name:   "full weight",
+			weight: FullVoteWeight,
+			want:   5,
+		},
+		{
+			name:   "decay by account age",
+			weight: AccountAgeVoteWeight(30*24*time.Hour, 0.1),
+			want:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := scoreItems(ItemCollection{it}, votes, tt.weight, nil)
+			if items[0].Score != tt.want {
+				t.Errorf("Invalid score %d, expected %d", items[0].Score, tt.want)
+			}
+		})
+	}
+}
+
+func Test_scoreItemsDirections(t *testing.T) {
+	it := Item{Hash: HashFromString("6435b2b5-26df-434c-87ca-58ddab49fcc8")}
+	votes := make(VoteCollection, 0)
+	for i := 0; i < 5; i++ {
+		votes = append(votes, Vote{Item: &it, Weight: 1})
+	}
+	for i := 0; i < 2; i++ {
+		votes = append(votes, Vote{Item: &it, Weight: -1})
+	}
+	items := scoreItems(ItemCollection{it}, votes, nil, nil)
+	if items[0].Score != 3 || items[0].Upvotes != 5 || items[0].Downvotes != 2 {
+		t.Errorf("Invalid score %d, with %d up and %d down votes, expected 3, with 5 up and 2 down votes",
+			items[0].Score, items[0].Upvotes, items[0].Downvotes)
+	}
+}
+
+func TestAccountAgeVoteWeight(t *testing.T) {
+	fn := AccountAgeVoteWeight(10*24*time.Hour, 0.2)
+
+	tests := []struct {
+		name string
+		by   *Account
+		want float64
+	}{
+		{
+			name: "missing voter",
+			by:   nil,
+			want: 0.2,
+		},
+		{
+			name: "new account",
+			by:   &Account{CreatedAt: time.Now().UTC()},
+			want: 0.2,
+		},
+		{
+			name: "old account",
+			by:   &Account{CreatedAt: time.Now().UTC().Add(-20 * 24 * time.Hour)},
+			want: 1.0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fn(Vote{SubmittedBy: tt.by}); got != tt.want {
+				t.Errorf("Invalid weight %f, expected %f", got, tt.want)
+			}
+		})
+	}
+	if w := AccountAgeVoteWeight(0, 0.2)(Vote{}); w != 1.0 {
+		t.Errorf("Invalid weight %f for disabled decay, expected %f", w, 1.0)
+	}
+}
+
+func TestBrigadePolicy_Detect(t *testing.T) {
+	now := time.Now().UTC()
+	it := &Item{Hash: HashFromString("6435b2b5-26df-434c-87ca-58ddab49fcc8")}
+	policy := BrigadePolicy{
+		Window:     time.Hour,
+		AccountAge: 7 * 24 * time.Hour,
+		Ratio:      0.6,
+		MinVotes:   4,
+		LocalHosts: []string{"example.com"},
+	}
+	voter := func(id string, age time.Duration) *Account {
+		return &Account{CreatedAt: now.Add(-age), Metadata: &AccountMetadata{ID: id}}
+	}
+	vote := func(by *Account, iri string) Vote {
+		return Vote{SubmittedBy: by, SubmittedAt: now.Add(-time.Minute), Item: it, Weight: 1, Metadata: &VoteMetadata{IRI: iri}}
+	}
+
+	organic := VoteCollection{
+		vote(voter("https://example.com/actors/1", 400*24*time.Hour), "https://example.com/1"),
+		vote(voter("https://example.com/actors/2", 100*24*time.Hour), "https://example.com/2"),
+		vote(voter("https://remote.example/actors/3", 30*24*time.Hour), "https://remote.example/3"),
+		vote(voter("https://other.example/actors/4", time.Hour), "https://other.example/4"),
+		vote(voter("https://example.com/actors/5", 10*24*time.Hour), "https://example.com/5"),
+	}
+	youngBrigade := VoteCollection{
+		vote(voter("https://example.com/actors/1", 400*24*time.Hour), "https://example.com/1"),
+		vote(voter("https://example.com/actors/6", time.Hour), "https://example.com/6"),
+		vote(voter("https://example.com/actors/7", 2*time.Hour), "https://example.com/7"),
+		vote(voter("https://example.com/actors/8", 3*time.Hour), "https://example.com/8"),
+		vote(voter("https://example.com/actors/9", 4*time.Hour), "https://example.com/9"),
+	}
+	domainBrigade := VoteCollection{
+		vote(voter("https://example.com/actors/1", 400*24*time.Hour), "https://example.com/1"),
+		vote(voter("https://brigade.example/actors/1", 90*24*time.Hour), "https://brigade.example/1"),
+		vote(voter("https://brigade.example/actors/2", 90*24*time.Hour), "https://brigade.example/2"),
+		vote(voter("https://brigade.example/actors/3", 90*24*time.Hour), "https://brigade.example/3"),
+		vote(voter("https://brigade.example/actors/4", 90*24*time.Hour), "https://brigade.example/4"),
+	}
+
+	tests := []struct {
+		name    string
+		votes   VoteCollection
+		suspect int
+	}{
+		{
+			name:    "organic",
+			votes:   organic,
+			suspect: 0,
+		},
+		{
+			name:    "young accounts",
+			votes:   youngBrigade,
+			suspect: 4,
+		},
+		{
+			name:    "single domain",
+			votes:   domainBrigade,
+			suspect: 4,
+		},
+		{
+			name:    "too few votes",
+			votes:   youngBrigade[:3],
+			suspect: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Detect(tt.votes, now); len(got) != tt.suspect {
+				t.Errorf("Invalid suspect votes count %d, expected %d", len(got), tt.suspect)
+			}
+		})
+	}
+
+	t.Run("discount", func(t *testing.T) {
+		bp := policy
+		bp.Discount = true
+		items := scoreItems(ItemCollection{*it}, youngBrigade, nil, &bp)
+		if !items[0].Brigaded() {
+			t.Errorf("Item should have been flagged as brigaded")
+		}
+		if items[0].Score != 1 {
+			t.Errorf("Invalid score %d after discounting the brigade, expected %d", items[0].Score, 1)
+		}
+		items = scoreItems(ItemCollection{*it}, organic, nil, &bp)
+		if items[0].Brigaded() {
+			t.Errorf("Item should not have been flagged as brigaded")
+		}
+	})
+}
+
+func TestVote_FromActivityPub(t *testing.T) {
+	Instance.Conf = &config.Configuration{HostName: "littr.example", APIURL: "https://fedbox.example"}
+
+	actor := pub.IRI("https://fedbox.example/actors/a3a1e1f0-11c2-4d4f-8e6a-0b3c2d1e0f01")
+	object := pub.IRI("https://fedbox.example/objects/6435b2b5-26df-434c-87ca-58ddab49fcc8")
+	like := &pub.Activity{ID: "https://fedbox.example/activities/2f7c3a5e-41b1-4a2e-9b0d-7d1e9c0a6b11", Type: pub.LikeType, Actor: actor, Object: object}
+	dislike := &pub.Activity{ID: "https://fedbox.example/activities/b4b2f2e1-22d3-4e5a-9f7b-1c4d3e2f1a02", Type: pub.DislikeType, Actor: actor, Object: object}
+	undo := &pub.Activity{ID: "https://fedbox.example/activities/c5c3a3f2-33e4-4f6b-8a8c-2d5e4f3a2b03", Type: pub.UndoType, Actor: actor, Object: like}
+
+	tests := []struct {
+		name        string
+		act         *pub.Activity
+		weight      int
+		originalIRI string
+	}{
+		{
+			name:   "like",
+			act:    like,
+			weight: 1,
+		},
+		{
+			name:   "dislike",
+			act:    dislike,
+			weight: -1,
+		},
+		{
+			name:        "undo of like",
+			act:         undo,
+			weight:      0,
+			originalIRI: like.ID.String(),
+		},
+	}
+	votes := make(VoteCollection, 0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := Vote{}
+			if err := v.FromActivityPub(tt.act); err != nil {
+				t.Fatalf("Unable to load vote: %s", err)
+			}
+			if v.Weight != tt.weight {
+				t.Errorf("Invalid weight %d, expected %d", v.Weight, tt.weight)
+			}
+			if v.Metadata.OriginalIRI != tt.originalIRI {
+				t.Errorf("Invalid original IRI %q, expected %q", v.Metadata.OriginalIRI, tt.originalIRI)
+			}
+			if v.Item == nil || v.Item.Hash != HashFromIRI(object) {
+				t.Errorf("Invalid voted item %v, expected %s", v.Item, object)
+			}
+			votes = append(votes, v)
+		})
+	}
+
+	active := votes.Active()
+	if len(active) != 1 {
+		t.Fatalf("Invalid active votes count %d, expected %d", len(active), 1)
+	}
+	if active.Score() != -1 {
+		t.Errorf("Invalid score %d after subtracting the undone like, expected %d", active.Score(), -1)
+	}
+}
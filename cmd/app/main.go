@@ -2,9 +2,7 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
 	"flag"
-	"net/http"
 	"os"
 	"syscall"
 	"time"
@@ -44,6 +42,8 @@ func Run(a app.Application) int {
 		}
 	}()
 
+	go a.RunRetention(ctx)
+
 	runFn := func() error {
 		// Run our server in a goroutine so that it doesn't block.
 		if err := srvRun(); err != nil {
@@ -63,6 +63,21 @@ func Run(a app.Application) int {
 			a.Logger.Info("SIGUSR1 received, switching to maintenance mode")
 			a.Conf.MaintenanceMode = !a.Conf.MaintenanceMode
 		},
+		syscall.SIGUSR2: func(_ chan int) {
+			a.Logger.Info("SIGUSR2 received, repairing the scores of the cached items")
+			report, err := a.RepairScores(ctx)
+			if err != nil {
+				a.Logger.Errorf("Error: %s", err)
+				return
+			}
+			repaired := 0
+			for _, rep := range report {
+				if rep.Discrepancy() {
+					repaired++
+				}
+			}
+			a.Logger.WithContext(log.Ctx{"items": len(report), "repaired": repaired}).Info("Repaired the scores")
+		},
 		syscall.SIGTERM: func(status chan int) {
 			// kill -SIGTERM XXXX
 			a.Logger.Info("SIGTERM received, stopping")
@@ -106,7 +121,6 @@ func main() {
 	r.Use(middleware.RequestID)
 	if !c.Env.IsProd() {
 		r.Use(middleware.Recoverer)
-		http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
 	os.Exit(Run(app.New(c, host, port, version, r)))
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/joho/godotenv"
 	"github.com/mariusor/go-littr/internal/log"
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -32,8 +33,115 @@ type Configuration struct {
 	UserFollowingEnabled       bool
 	ModerationEnabled          bool
 	MaintenanceMode            bool
+	VoteDecayAge               time.Duration
+	VoteMinWeight              float64
+	Moderators                 []string
+	BrigadeWindow              time.Duration
+	BrigadeAccountAge          time.Duration
+	BrigadeRatio               float64
+	BrigadeMinVotes            int
+	BrigadeDiscount            bool
+	DefaultPageSize            int
+	MaxPageSize                int
+	UserAgent                  string
+	PeerUserAgents             []string
+	MaxClockSkew               time.Duration
+	TLSRootCAs                 string
+	InsecureSkipVerify         bool
+	DebugFederation            bool
+	MaxRecipients              int
+	NodeInfoTTL                time.Duration
+	BlockedInstances           []string
+	TrackingParams             []string
+	AutoMuteThreshold          int
+	ImageProxy                 bool
+	ImageProxyMaxSize          int64
+	ImageProxyCacheTTL         time.Duration
+	ImageProxyCacheSize        int64
+	ImageProxyInsecure         bool
+	MimeTypes                  []string
+	HTMLPolicy                 string
+	TrustedHTMLPolicy          string
+	AnonymousReadAccess        bool
+	MaxThreadDepth             int
+	ThreadDepthPolicy          string
+	OnlyTopLevel               bool
+	RecentAccountsListing      bool
+	MinFederationAge           time.Duration
+	CORSOrigins                []string
+	CORSMethods                []string
+	CORSHeaders                []string
+	PasswordMinLength          int
+	PasswordClasses            []string
+	PasswordBlockCommon        bool
+	LoginMaxFailures           int
+	LoginFailureWindow         time.Duration
+	LoginLockout               time.Duration
+	CookieSecure               bool
+	CookieHTTPOnly             bool
+	CookieSameSite             string
+	CookieDomain               string
+	CookiePath                 string
+	RepositoryCacheTTL         time.Duration
+	RepositoryCacheSize        int
+	CollapseCrossposts         bool
+	MarkdownFeatures           []string
+	CustomEmojiPath            string
+	EmojiMaxSize               int64
+	TrustedInstances           []string
+	CanonicalHost              string
+	AnonymousReports           bool
+	ReportHideThreshold        int
+	ExploreFeed                bool
+	ExploreCacheTTL            time.Duration
+	AutoLinkContent            bool
+	Relays                     []string
+	CacheRetentionAge          time.Duration
+	CacheRetentionInterval     time.Duration
+	MaxTags                    int
+	TagsLimitPolicy            string
+	AvatarStyle                string
+	RateLimits                 map[string]int
+	RateLimitWindow            time.Duration
+	DetectLanguage             bool
+	SensitivePolicy            string
+	NotificationsPageSize      int
+	SignatureSchemeTTL         time.Duration
+	FollowCollections          string
+	RequireAltText             bool
+	InstanceActorAddressing    bool
+	MaxRemoteFetchDepth        int
+	MaxFeaturedTags            int
+	ShowLinkDomains            bool
+	MinDisplayScore            int
+	AnnouncementsPath          string
+	TrustedMarkdown            string
+	TrustedMarkdownKarma       int
+	OrderedCollections         bool
+	DefaultLanguage            string
+	NewAccountAge              time.Duration
+	TrustMemberAge             time.Duration
+	TrustMemberKarma           int
+	APIMaxAttempts             int
+	APIRetryBackoff            time.Duration
+	NotificationsGroupWindow   time.Duration
 }
 
+// DefaultMaxRemoteFetchDepth is the number of ancestors of a remote item we dereference when resolving it
+const DefaultMaxRemoteFetchDepth = 8
+
+// NoMinDisplayScore is the minimum score which disables collapsing the items with low scores
+const NoMinDisplayScore = math.MinInt32
+
+// DefaultMarkdownFeatures are the markdown extensions enabled when rendering the submitted items
+const DefaultMarkdownFeatures = "html,tables"
+
+// DefaultMimeTypes are the content types accepted for the submitted items
+const DefaultMimeTypes = "text/markdown,text/plain,text/html,application/url"
+
+// DefaultTrackingParams are the query parameters removed from the rendered links, the ones ending in * are prefixes
+const DefaultTrackingParams = "utm_*,fbclid,gclid,dclid,msclkid,mc_cid,mc_eid,igshid,yclid,_hsenc,_hsmi"
+
 const (
 	DefaultListenPort = 3000
 	DefaultListenHost = ""
@@ -61,6 +169,98 @@ const (
 	KeyDisableUserFollowing       = "DISABLE_USER_FOLLOWING"
 	KeyDisableModeration          = "DISABLE_MODERATION"
 	KeyAdminContact               = "ADMIN_CONTACT"
+	KeyVoteDecayAge               = "VOTE_DECAY_AGE"
+	KeyVoteMinWeight              = "VOTE_MIN_WEIGHT"
+	KeyModerators                 = "MODERATORS"
+	KeyBrigadeWindow              = "BRIGADE_WINDOW"
+	KeyBrigadeAccountAge          = "BRIGADE_ACCOUNT_AGE"
+	KeyBrigadeRatio               = "BRIGADE_RATIO"
+	KeyBrigadeMinVotes            = "BRIGADE_MIN_VOTES"
+	KeyBrigadeDiscount            = "BRIGADE_DISCOUNT"
+	KeyDefaultPageSize            = "DEFAULT_PAGE_SIZE"
+	KeyMaxPageSize                = "MAX_PAGE_SIZE"
+	KeyUserAgent                  = "USER_AGENT"
+	KeyPeerUserAgents             = "PEER_USER_AGENTS"
+	KeyMaxClockSkew               = "MAX_CLOCK_SKEW"
+	KeyTLSRootCAs                 = "TLS_ROOT_CAS"
+	KeyInsecureSkipVerify         = "INSECURE_SKIP_VERIFY"
+	KeyDebugFederation            = "DEBUG_FEDERATION"
+	KeyMaxRecipients              = "MAX_RECIPIENTS"
+	KeyNodeInfoTTL                = "NODEINFO_CACHE_TTL"
+	KeyBlockedInstances           = "BLOCKED_INSTANCES"
+	KeyTrackingParams             = "TRACKING_PARAMS"
+	KeyAutoMuteThreshold          = "AUTO_MUTE_THRESHOLD"
+	KeyImageProxy                 = "IMAGE_PROXY"
+	KeyImageProxyMaxSize          = "IMAGE_PROXY_MAX_SIZE"
+	KeyImageProxyCacheTTL         = "IMAGE_PROXY_CACHE_TTL"
+	KeyImageProxyCacheSize        = "IMAGE_PROXY_CACHE_SIZE"
+	KeyImageProxyInsecure         = "IMAGE_PROXY_INSECURE_SKIP_VERIFY"
+	KeyMimeTypes                  = "ALLOWED_MIME_TYPES"
+	KeyHTMLPolicy                 = "HTML_POLICY"
+	KeyTrustedHTMLPolicy          = "TRUSTED_HTML_POLICY"
+	KeyAnonymousReadAccess        = "ANONYMOUS_READ_ACCESS"
+	KeyMaxThreadDepth             = "MAX_THREAD_DEPTH"
+	KeyThreadDepthPolicy          = "THREAD_DEPTH_POLICY"
+	KeyOnlyTopLevel               = "FRONTPAGE_ONLY_TOP_LEVEL"
+	KeyRecentAccountsListing      = "RECENT_ACCOUNTS_LISTING"
+	KeyMinFederationAge           = "MIN_FEDERATION_AGE"
+	KeyCORSOrigins                = "CORS_ALLOWED_ORIGINS"
+	KeyCORSMethods                = "CORS_ALLOWED_METHODS"
+	KeyCORSHeaders                = "CORS_ALLOWED_HEADERS"
+	KeyPasswordMinLength          = "PASSWORD_MIN_LENGTH"
+	KeyPasswordClasses            = "PASSWORD_REQUIRED_CLASSES"
+	KeyPasswordBlockCommon        = "PASSWORD_BLOCK_COMMON"
+	KeyLoginMaxFailures           = "LOGIN_MAX_FAILURES"
+	KeyLoginFailureWindow         = "LOGIN_FAILURE_WINDOW"
+	KeyLoginLockout               = "LOGIN_LOCKOUT"
+	KeyCookieSecure               = "SESSION_COOKIE_SECURE"
+	KeyCookieHTTPOnly             = "SESSION_COOKIE_HTTP_ONLY"
+	KeyCookieSameSite             = "SESSION_COOKIE_SAME_SITE"
+	KeyCookieDomain               = "SESSION_COOKIE_DOMAIN"
+	KeyCookiePath                 = "SESSION_COOKIE_PATH"
+	KeyRepositoryCacheTTL         = "REPOSITORY_CACHE_TTL"
+	KeyRepositoryCacheSize        = "REPOSITORY_CACHE_SIZE"
+	KeyCollapseCrossposts         = "COLLAPSE_CROSSPOSTS"
+	KeyMarkdownFeatures           = "MARKDOWN_FEATURES"
+	KeyCustomEmojiPath            = "CUSTOM_EMOJI_PATH"
+	KeyEmojiMaxSize               = "CUSTOM_EMOJI_MAX_SIZE"
+	KeyTrustedInstances           = "TRUSTED_INSTANCES"
+	KeyCanonicalHost              = "CANONICAL_HOST"
+	KeyAnonymousReports           = "ANONYMOUS_REPORTS"
+	KeyReportHideThreshold        = "REPORT_HIDE_THRESHOLD"
+	KeyExploreFeed                = "EXPLORE_FEED"
+	KeyExploreCacheTTL            = "EXPLORE_CACHE_TTL"
+	KeyAutoLinkContent            = "AUTO_LINK_CONTENT"
+	KeyRelays                     = "RELAYS"
+	KeyCacheRetentionAge          = "CACHE_RETENTION_AGE"
+	KeyCacheRetentionInterval     = "CACHE_RETENTION_INTERVAL"
+	KeyMaxTags                    = "MAX_TAGS"
+	KeyTagsLimitPolicy            = "TAGS_LIMIT_POLICY"
+	KeyAvatarStyle                = "AVATAR_STYLE"
+	KeyRateLimits                 = "RATE_LIMITS"
+	KeyRateLimitWindow            = "RATE_LIMIT_WINDOW"
+	KeyDetectLanguage             = "DETECT_LANGUAGE"
+	KeySensitivePolicy            = "SENSITIVE_POLICY"
+	KeyNotificationsPageSize      = "NOTIFICATIONS_PAGE_SIZE"
+	KeySignatureSchemeTTL         = "SIGNATURE_SCHEME_TTL"
+	KeyFollowCollections          = "FOLLOW_COLLECTIONS_VISIBILITY"
+	KeyRequireAltText             = "REQUIRE_ALT_TEXT"
+	KeyInstanceActorAddressing    = "INSTANCE_ACTOR_ADDRESSING"
+	KeyMaxRemoteFetchDepth        = "MAX_REMOTE_FETCH_DEPTH"
+	KeyMaxFeaturedTags            = "MAX_FEATURED_TAGS"
+	KeyShowLinkDomains            = "SHOW_LINK_DOMAINS"
+	KeyMinDisplayScore            = "MIN_DISPLAY_SCORE"
+	KeyAnnouncementsPath          = "ANNOUNCEMENTS_PATH"
+	KeyTrustedMarkdown            = "TRUSTED_MARKDOWN"
+	KeyTrustedMarkdownKarma       = "TRUSTED_MARKDOWN_KARMA"
+	KeyOrderedCollections         = "FEDBOX_ORDERED_COLLECTIONS"
+	KeyDefaultLanguage            = "DEFAULT_LANGUAGE"
+	KeyNewAccountAge              = "NEW_ACCOUNT_AGE"
+	KeyTrustMemberAge             = "TRUST_MEMBER_AGE"
+	KeyTrustMemberKarma           = "TRUST_MEMBER_KARMA"
+	KeyAPIMaxAttempts             = "API_MAX_ATTEMPTS"
+	KeyAPIRetryBackoff            = "API_RETRY_BACKOFF"
+	KeyNotificationsGroupWindow   = "NOTIFICATIONS_COALESCE_WINDOW"
 )
 
 func prefKey(k string) string {
@@ -161,6 +361,196 @@ func Load(e EnvType, wait time.Duration) *Configuration {
 
 	c.APIURL = loadKeyFromEnv(KeyAPIUrl, "")
 
+	// NOTE(marius): a zero decay age disables the vote weight scaling
+	c.VoteDecayAge, _ = time.ParseDuration(loadKeyFromEnv(KeyVoteDecayAge, ""))          // VOTE_DECAY_AGE
+	c.VoteMinWeight, _ = strconv.ParseFloat(loadKeyFromEnv(KeyVoteMinWeight, "0.1"), 64) // VOTE_MIN_WEIGHT
+
+	for _, m := range strings.Split(loadKeyFromEnv(KeyModerators, ""), ",") { // MODERATORS
+		if m = strings.TrimSpace(m); len(m) > 0 {
+			c.Moderators = append(c.Moderators, m)
+		}
+	}
+	// NOTE(marius): a zero window disables the brigade detection
+	c.BrigadeWindow, _ = time.ParseDuration(loadKeyFromEnv(KeyBrigadeWindow, ""))                       // BRIGADE_WINDOW
+	c.BrigadeAccountAge, _ = time.ParseDuration(loadKeyFromEnv(KeyBrigadeAccountAge, "168h"))           // BRIGADE_ACCOUNT_AGE
+	c.BrigadeRatio, _ = strconv.ParseFloat(loadKeyFromEnv(KeyBrigadeRatio, "0.6"), 64)                  // BRIGADE_RATIO
+	if minVotes, _ := strconv.ParseInt(loadKeyFromEnv(KeyBrigadeMinVotes, "5"), 10, 32); minVotes > 0 { // BRIGADE_MIN_VOTES
+		c.BrigadeMinVotes = int(minVotes)
+	}
+	c.BrigadeDiscount, _ = strconv.ParseBool(loadKeyFromEnv(KeyBrigadeDiscount, "")) // BRIGADE_DISCOUNT
+
+	if size, _ := strconv.ParseInt(loadKeyFromEnv(KeyDefaultPageSize, ""), 10, 32); size > 0 { // DEFAULT_PAGE_SIZE
+		c.DefaultPageSize = int(size)
+	}
+	if size, _ := strconv.ParseInt(loadKeyFromEnv(KeyMaxPageSize, ""), 10, 32); size > 0 { // MAX_PAGE_SIZE
+		c.MaxPageSize = int(size)
+	}
+
+	c.UserAgent = loadKeyFromEnv(KeyUserAgent, "")                                 // USER_AGENT
+	for _, ua := range strings.Split(loadKeyFromEnv(KeyPeerUserAgents, ""), ",") { // PEER_USER_AGENTS
+		if ua = strings.TrimSpace(ua); len(ua) > 0 {
+			c.PeerUserAgents = append(c.PeerUserAgents, ua)
+		}
+	}
+	c.MaxClockSkew, _ = time.ParseDuration(loadKeyFromEnv(KeyMaxClockSkew, "5m"))          // MAX_CLOCK_SKEW
+	c.TLSRootCAs = loadKeyFromEnv(KeyTLSRootCAs, "")                                       // TLS_ROOT_CAS
+	c.InsecureSkipVerify, _ = strconv.ParseBool(loadKeyFromEnv(KeyInsecureSkipVerify, "")) // INSECURE_SKIP_VERIFY
+	c.DebugFederation, _ = strconv.ParseBool(loadKeyFromEnv(KeyDebugFederation, ""))       // DEBUG_FEDERATION
+	if max, _ := strconv.ParseInt(loadKeyFromEnv(KeyMaxRecipients, ""), 10, 32); max > 0 { // MAX_RECIPIENTS
+		c.MaxRecipients = int(max)
+	}
+	c.NodeInfoTTL, _ = time.ParseDuration(loadKeyFromEnv(KeyNodeInfoTTL, "24h"))    // NODEINFO_CACHE_TTL
+	for _, h := range strings.Split(loadKeyFromEnv(KeyBlockedInstances, ""), ",") { // BLOCKED_INSTANCES
+		if h = strings.TrimSpace(h); len(h) > 0 {
+			c.BlockedInstances = append(c.BlockedInstances, h)
+		}
+	}
+	for _, p := range strings.Split(loadKeyFromEnv(KeyTrackingParams, DefaultTrackingParams), ",") { // TRACKING_PARAMS
+		if p = strings.TrimSpace(p); len(p) > 0 {
+			c.TrackingParams = append(c.TrackingParams, p)
+		}
+	}
+	if th, _ := strconv.ParseInt(loadKeyFromEnv(KeyAutoMuteThreshold, ""), 10, 32); th > 0 { // AUTO_MUTE_THRESHOLD
+		c.AutoMuteThreshold = int(th)
+	}
+	c.ImageProxy, _ = strconv.ParseBool(loadKeyFromEnv(KeyImageProxy, ""))                                  // IMAGE_PROXY
+	c.ImageProxyMaxSize, _ = strconv.ParseInt(loadKeyFromEnv(KeyImageProxyMaxSize, "5242880"), 10, 64)      // IMAGE_PROXY_MAX_SIZE
+	c.ImageProxyCacheTTL, _ = time.ParseDuration(loadKeyFromEnv(KeyImageProxyCacheTTL, "1h"))               // IMAGE_PROXY_CACHE_TTL
+	c.ImageProxyCacheSize, _ = strconv.ParseInt(loadKeyFromEnv(KeyImageProxyCacheSize, "67108864"), 10, 64) // IMAGE_PROXY_CACHE_SIZE
+	c.ImageProxyInsecure, _ = strconv.ParseBool(loadKeyFromEnv(KeyImageProxyInsecure, ""))                  // IMAGE_PROXY_INSECURE_SKIP_VERIFY
+	for _, m := range strings.Split(loadKeyFromEnv(KeyMimeTypes, DefaultMimeTypes), ",") {                  // ALLOWED_MIME_TYPES
+		if m = strings.ToLower(strings.TrimSpace(m)); len(m) > 0 {
+			c.MimeTypes = append(c.MimeTypes, m)
+		}
+	}
+	c.HTMLPolicy = strings.ToLower(loadKeyFromEnv(KeyHTMLPolicy, "sanitize"))               // HTML_POLICY
+	c.TrustedHTMLPolicy = strings.ToLower(loadKeyFromEnv(KeyTrustedHTMLPolicy, "sanitize")) // TRUSTED_HTML_POLICY
+	c.AnonymousReadAccess = true
+	if anon, err := strconv.ParseBool(loadKeyFromEnv(KeyAnonymousReadAccess, "")); err == nil { // ANONYMOUS_READ_ACCESS
+		c.AnonymousReadAccess = anon
+	}
+	if depth, _ := strconv.ParseInt(loadKeyFromEnv(KeyMaxThreadDepth, ""), 10, 32); depth > 0 { // MAX_THREAD_DEPTH
+		c.MaxThreadDepth = int(depth)
+	}
+	c.ThreadDepthPolicy = strings.ToLower(loadKeyFromEnv(KeyThreadDepthPolicy, "reject")) // THREAD_DEPTH_POLICY
+	c.OnlyTopLevel = true
+	if top, err := strconv.ParseBool(loadKeyFromEnv(KeyOnlyTopLevel, "")); err == nil { // FRONTPAGE_ONLY_TOP_LEVEL
+		c.OnlyTopLevel = top
+	}
+	c.RecentAccountsListing = true
+	if recent, err := strconv.ParseBool(loadKeyFromEnv(KeyRecentAccountsListing, "")); err == nil { // RECENT_ACCOUNTS_LISTING
+		c.RecentAccountsListing = recent
+	}
+	c.MinFederationAge, _ = time.ParseDuration(loadKeyFromEnv(KeyMinFederationAge, "0"))           // MIN_FEDERATION_AGE
+	c.CORSOrigins = splitList(loadKeyFromEnv(KeyCORSOrigins, ""))                                  // CORS_ALLOWED_ORIGINS
+	c.CORSMethods = splitList(loadKeyFromEnv(KeyCORSMethods, "GET,HEAD,OPTIONS"))                  // CORS_ALLOWED_METHODS
+	c.CORSHeaders = splitList(loadKeyFromEnv(KeyCORSHeaders, "Accept,Content-Type,Authorization")) // CORS_ALLOWED_HEADERS
+	c.PasswordMinLength = 8
+	if l, err := strconv.ParseInt(loadKeyFromEnv(KeyPasswordMinLength, ""), 10, 32); err == nil && l >= 0 { // PASSWORD_MIN_LENGTH
+		c.PasswordMinLength = int(l)
+	}
+	c.PasswordClasses = splitList(strings.ToLower(loadKeyFromEnv(KeyPasswordClasses, ""))) // PASSWORD_REQUIRED_CLASSES
+	c.PasswordBlockCommon = true
+	if block, err := strconv.ParseBool(loadKeyFromEnv(KeyPasswordBlockCommon, "")); err == nil { // PASSWORD_BLOCK_COMMON
+		c.PasswordBlockCommon = block
+	}
+	c.LoginMaxFailures = 5
+	if max, err := strconv.ParseInt(loadKeyFromEnv(KeyLoginMaxFailures, ""), 10, 32); err == nil && max >= 0 { // LOGIN_MAX_FAILURES
+		c.LoginMaxFailures = int(max)
+	}
+	c.LoginFailureWindow, _ = time.ParseDuration(loadKeyFromEnv(KeyLoginFailureWindow, "15m")) // LOGIN_FAILURE_WINDOW
+	c.LoginLockout, _ = time.ParseDuration(loadKeyFromEnv(KeyLoginLockout, "15m"))             // LOGIN_LOCKOUT
+	c.CookieSecure = true
+	if secure, err := strconv.ParseBool(loadKeyFromEnv(KeyCookieSecure, "")); err == nil { // SESSION_COOKIE_SECURE
+		c.CookieSecure = secure
+	}
+	c.CookieHTTPOnly = true
+	if httpOnly, err := strconv.ParseBool(loadKeyFromEnv(KeyCookieHTTPOnly, "")); err == nil { // SESSION_COOKIE_HTTP_ONLY
+		c.CookieHTTPOnly = httpOnly
+	}
+	c.CookieSameSite = strings.ToLower(loadKeyFromEnv(KeyCookieSameSite, ""))                      // SESSION_COOKIE_SAME_SITE
+	c.CookieDomain = loadKeyFromEnv(KeyCookieDomain, c.HostName)                                   // SESSION_COOKIE_DOMAIN
+	c.CookiePath = loadKeyFromEnv(KeyCookiePath, "/")                                              // SESSION_COOKIE_PATH
+	c.RepositoryCacheTTL, _ = time.ParseDuration(loadKeyFromEnv(KeyRepositoryCacheTTL, "0"))       // REPOSITORY_CACHE_TTL
+	if size, _ := strconv.ParseInt(loadKeyFromEnv(KeyRepositoryCacheSize, ""), 10, 32); size > 0 { // REPOSITORY_CACHE_SIZE
+		c.RepositoryCacheSize = int(size)
+	}
+	c.CollapseCrossposts, _ = strconv.ParseBool(loadKeyFromEnv(KeyCollapseCrossposts, "")) // COLLAPSE_CROSSPOSTS
+
+	c.MarkdownFeatures = splitList(strings.ToLower(loadKeyFromEnv(KeyMarkdownFeatures, DefaultMarkdownFeatures))) // MARKDOWN_FEATURES
+	c.EmojiMaxSize, _ = strconv.ParseInt(loadKeyFromEnv(KeyEmojiMaxSize, "262144"), 10, 64)                       // CUSTOM_EMOJI_MAX_SIZE
+	c.CustomEmojiPath = loadKeyFromEnv(KeyCustomEmojiPath, "")                                                    // CUSTOM_EMOJI_PATH
+	c.TrustedInstances = splitList(loadKeyFromEnv(KeyTrustedInstances, ""))                                       // TRUSTED_INSTANCES
+	c.CanonicalHost = strings.ToLower(loadKeyFromEnv(KeyCanonicalHost, ""))                                       // CANONICAL_HOST
+	c.AnonymousReports, _ = strconv.ParseBool(loadKeyFromEnv(KeyAnonymousReports, ""))                            // ANONYMOUS_REPORTS
+	if th, _ := strconv.ParseInt(loadKeyFromEnv(KeyReportHideThreshold, ""), 10, 32); th > 0 {                    // REPORT_HIDE_THRESHOLD
+		c.ReportHideThreshold = int(th)
+	}
+	c.ExploreFeed, _ = strconv.ParseBool(loadKeyFromEnv(KeyExploreFeed, ""))                          // EXPLORE_FEED
+	c.ExploreCacheTTL, _ = time.ParseDuration(loadKeyFromEnv(KeyExploreCacheTTL, "10m"))              // EXPLORE_CACHE_TTL
+	c.AutoLinkContent, _ = strconv.ParseBool(loadKeyFromEnv(KeyAutoLinkContent, ""))                  // AUTO_LINK_CONTENT
+	c.Relays = splitList(loadKeyFromEnv(KeyRelays, ""))                                               // RELAYS
+	c.CacheRetentionAge, _ = time.ParseDuration(loadKeyFromEnv(KeyCacheRetentionAge, "0"))            // CACHE_RETENTION_AGE
+	c.CacheRetentionInterval, _ = time.ParseDuration(loadKeyFromEnv(KeyCacheRetentionInterval, "1h")) // CACHE_RETENTION_INTERVAL
+	if max, _ := strconv.ParseInt(loadKeyFromEnv(KeyMaxTags, ""), 10, 32); max > 0 {                  // MAX_TAGS
+		c.MaxTags = int(max)
+	}
+	c.TagsLimitPolicy = strings.ToLower(loadKeyFromEnv(KeyTagsLimitPolicy, "reject")) // TAGS_LIMIT_POLICY
+	c.AvatarStyle = strings.ToLower(loadKeyFromEnv(KeyAvatarStyle, "identicon"))      // AVATAR_STYLE
+	c.RateLimits = make(map[string]int)
+	for _, l := range splitList(loadKeyFromEnv(KeyRateLimits, "")) { // RATE_LIMITS
+		kv := strings.SplitN(l, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if max, err := strconv.Atoi(strings.TrimSpace(kv[1])); err == nil && max > 0 {
+			c.RateLimits[strings.ToLower(strings.TrimSpace(kv[0]))] = max
+		}
+	}
+	c.RateLimitWindow, _ = time.ParseDuration(loadKeyFromEnv(KeyRateLimitWindow, "1m")) // RATE_LIMIT_WINDOW
+	c.DetectLanguage, _ = strconv.ParseBool(loadKeyFromEnv(KeyDetectLanguage, ""))      // DETECT_LANGUAGE
+	c.SensitivePolicy = strings.ToLower(loadKeyFromEnv(KeySensitivePolicy, "collapse")) // SENSITIVE_POLICY
+
+	if size, _ := strconv.ParseInt(loadKeyFromEnv(KeyNotificationsPageSize, ""), 10, 32); size > 0 { // NOTIFICATIONS_PAGE_SIZE
+		c.NotificationsPageSize = int(size)
+	}
+	c.SignatureSchemeTTL, _ = time.ParseDuration(loadKeyFromEnv(KeySignatureSchemeTTL, "24h")) // SIGNATURE_SCHEME_TTL
+	c.FollowCollections = strings.ToLower(loadKeyFromEnv(KeyFollowCollections, "public"))      // FOLLOW_COLLECTIONS_VISIBILITY
+	c.RequireAltText, _ = strconv.ParseBool(loadKeyFromEnv(KeyRequireAltText, ""))             // REQUIRE_ALT_TEXT
+
+	c.InstanceActorAddressing, _ = strconv.ParseBool(loadKeyFromEnv(KeyInstanceActorAddressing, "")) // INSTANCE_ACTOR_ADDRESSING
+	c.MaxRemoteFetchDepth = DefaultMaxRemoteFetchDepth
+	if depth, err := strconv.ParseInt(loadKeyFromEnv(KeyMaxRemoteFetchDepth, ""), 10, 32); err == nil && depth >= 0 { // MAX_REMOTE_FETCH_DEPTH
+		c.MaxRemoteFetchDepth = int(depth)
+	}
+	c.MaxFeaturedTags, _ = strconv.Atoi(loadKeyFromEnv(KeyMaxFeaturedTags, "5")) // MAX_FEATURED_TAGS
+	c.ShowLinkDomains = true
+	if show, err := strconv.ParseBool(loadKeyFromEnv(KeyShowLinkDomains, "")); err == nil { // SHOW_LINK_DOMAINS
+		c.ShowLinkDomains = show
+	}
+	c.MinDisplayScore = NoMinDisplayScore
+	if score, err := strconv.Atoi(loadKeyFromEnv(KeyMinDisplayScore, "")); err == nil { // MIN_DISPLAY_SCORE
+		c.MinDisplayScore = score
+	}
+
+	c.AnnouncementsPath = loadKeyFromEnv(KeyAnnouncementsPath, "")                         // ANNOUNCEMENTS_PATH
+	c.TrustedMarkdown = strings.ToLower(loadKeyFromEnv(KeyTrustedMarkdown, "none"))        // TRUSTED_MARKDOWN
+	c.TrustedMarkdownKarma, _ = strconv.Atoi(loadKeyFromEnv(KeyTrustedMarkdownKarma, "0")) // TRUSTED_MARKDOWN_KARMA
+	c.OrderedCollections, _ = strconv.ParseBool(loadKeyFromEnv(KeyOrderedCollections, "")) // FEDBOX_ORDERED_COLLECTIONS
+	c.DefaultLanguage = strings.ToLower(loadKeyFromEnv(KeyDefaultLanguage, ""))            // DEFAULT_LANGUAGE
+	c.NewAccountAge = c.MinFederationAge
+	if age, err := time.ParseDuration(loadKeyFromEnv(KeyNewAccountAge, "")); err == nil { // NEW_ACCOUNT_AGE
+		c.NewAccountAge = age
+	}
+	c.TrustMemberAge, _ = time.ParseDuration(loadKeyFromEnv(KeyTrustMemberAge, "720h")) // TRUST_MEMBER_AGE
+	c.TrustMemberKarma, _ = strconv.Atoi(loadKeyFromEnv(KeyTrustMemberKarma, "10"))     // TRUST_MEMBER_KARMA
+	c.APIMaxAttempts = 3
+	if attempts, err := strconv.Atoi(loadKeyFromEnv(KeyAPIMaxAttempts, "")); err == nil && attempts > 0 { // API_MAX_ATTEMPTS
+		c.APIMaxAttempts = attempts
+	}
+	c.APIRetryBackoff, _ = time.ParseDuration(loadKeyFromEnv(KeyAPIRetryBackoff, "250ms"))                 // API_RETRY_BACKOFF
+	c.NotificationsGroupWindow, _ = time.ParseDuration(loadKeyFromEnv(KeyNotificationsGroupWindow, "24h")) // NOTIFICATIONS_COALESCE_WINDOW
+
 	return c
 }
 
@@ -170,3 +560,14 @@ func (c Configuration) Listen() string {
 	}
 	return fmt.Sprintf(":%d", c.ListenPort)
 }
+
+// splitList returns the non empty values of a comma separated list
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			list = append(list, v)
+		}
+	}
+	return list
+}